@@ -0,0 +1,133 @@
+// Command replay runs the debug agent's error grouping and analysis over a saved corpus of error logs
+// and reports grouping stability and schema-parse failures, to evaluate a model or prompt change.
+//
+// Usage:
+//
+//	go run ./cmd/replay -corpus cmd/replay/testdata -backend gemini -model gemini-2.5-flash -runs 3 -analyze
+//
+// The corpus is a JSON file, or a directory of JSON files, each holding an adk.ReplayCase.
+// Backend flags default to the bot's environment variables (LLM_BACKEND, MODEL_NAME, ...).
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"go.uber.org/zap"
+)
+
+func main() {
+	corpus := flag.String("corpus", "", "JSON file or directory of JSON files with saved error logs (required)")
+	backend := flag.String("backend", envOr("LLM_BACKEND", adk.BackendVertexAI), "LLM backend: vertexai, gemini, openai or fake")
+	model := flag.String("model", envOr("MODEL_NAME", "gemini-2.5-flash-lite"), "Model name")
+	project := flag.String("project", os.Getenv("GCP_PROJECT_ID"), "GCP project for Vertex AI")
+	location := flag.String("location", envOr("VERTEX_LOCATION", "us-central1"), "GCP location for Vertex AI")
+	apiKey := flag.String("api-key", os.Getenv("LLM_API_KEY"), "API key for the gemini and openai backends")
+	baseURL := flag.String("base-url", os.Getenv("LLM_BASE_URL"), "Endpoint for the openai backend")
+	runs := flag.Int("runs", 3, "Number of times each case is grouped")
+	analyze := flag.Bool("analyze", false, "Also analyze each group of the first run")
+	flag.Parse()
+
+	if *corpus == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cases, err := loadCorpus(*corpus)
+	if err != nil {
+		log.Fatalf("Failed to load corpus: %v", err)
+	}
+
+	ctx := context.Background()
+	llm, err := adk.NewBackend(ctx, adk.Config{
+		Backend:   *backend,
+		Project:   *project,
+		Location:  *location,
+		ModelName: *model,
+		APIKey:    *apiKey,
+		BaseURL:   *baseURL,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create backend: %v", err)
+	}
+
+	results := adk.Replay(ctx, llm, *model, cases, adk.ReplayOptions{Runs: *runs, Analyze: *analyze}, zap.NewNop())
+	if !report(os.Stdout, results) {
+		os.Exit(1)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// loadCorpus reads a case from path, or from each .json file in it if it is a directory.
+func loadCorpus(path string) ([]adk.ReplayCase, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+			return nil, err
+		}
+	}
+
+	var cases []adk.ReplayCase
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var c adk.ReplayCase
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if c.Name == "" {
+			c.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		cases = append(cases, c)
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no cases found in %s", path)
+	}
+	return cases, nil
+}
+
+// report prints the results as a table and returns false if any case had parse failures or errors.
+func report(out io.Writer, results []adk.ReplayResult) bool {
+	ok := true
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CASE\tERRORS\tGROUPS\tSTABILITY\tGROUP PARSE FAILURES\tANALYSIS PARSE FAILURES\tERRORS RETURNED")
+	for _, r := range results {
+		counts := make([]string, len(r.GroupCounts))
+		for i, c := range r.GroupCounts {
+			counts[i] = fmt.Sprint(c)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%.2f\t%d\t%d/%d\t%d\n", r.Name, r.ErrorCount, strings.Join(counts, ","),
+			r.Stability, r.GroupParseFailures, r.AnalysisParseFailures, r.AnalysisCount, len(r.Failures))
+		if r.GroupParseFailures > 0 || r.AnalysisParseFailures > 0 || len(r.Failures) > 0 {
+			ok = false
+		}
+	}
+	w.Flush()
+
+	for _, r := range results {
+		for _, f := range r.Failures {
+			fmt.Fprintf(out, "%s: %s\n", r.Name, f)
+		}
+	}
+	return ok
+}
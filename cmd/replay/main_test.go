@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+)
+
+func TestLoadCorpus(t *testing.T) {
+	cases, err := loadCorpus("testdata")
+	if err != nil {
+		t.Fatalf("loadCorpus() error = %v", err)
+	}
+	if len(cases) != 1 || cases[0].Name != "db-outage" || len(cases[0].Errors) != 6 {
+		t.Errorf("loadCorpus() = %+v", cases)
+	}
+
+	// Cases without a name are named after their file
+	file := filepath.Join(t.TempDir(), "unnamed.json")
+	if err := os.WriteFile(file, []byte(`{"errors": [{"message": "boom"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if cases, err := loadCorpus(file); err != nil || cases[0].Name != "unnamed" {
+		t.Errorf("loadCorpus(%s) = %+v, %v", file, cases, err)
+	}
+
+	if _, err := loadCorpus(t.TempDir()); err == nil {
+		t.Error("loadCorpus() should fail for an empty directory")
+	}
+}
+
+func TestReport(t *testing.T) {
+	out, err := os.CreateTemp(t.TempDir(), "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	if !report(out, []adk.ReplayResult{{Name: "ok", GroupCounts: []int{2, 2}, Stability: 1}}) {
+		t.Error("report() should pass without failures")
+	}
+	if report(out, []adk.ReplayResult{{Name: "bad", GroupParseFailures: 1}}) {
+		t.Error("report() should fail on parse failures")
+	}
+}
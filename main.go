@@ -2,18 +2,26 @@ package main
 
 import (
 	"context"
+	"io"
 	"log"
 	"os"
 	"time"
 
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/approval"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudrun"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudrunslackbot"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudtrace"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/config"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/debug"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/deploy"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/export"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/logger"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/logging"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/memory"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/monitoring"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/redact"
 	slackinternal "github.com/nakamasato/cloud-run-slack-bot/pkg/slack"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/trace"
 	"github.com/slack-go/slack"
@@ -84,6 +92,30 @@ func main() {
 		zapLogger.Warn("GCP_PROJECT_ID not set, tracing disabled")
 	}
 
+	// Initialize metrics, e.g. LLM usage of debug analyses, if METRICS_ENABLED is set
+	metricsEnabled := os.Getenv("METRICS_ENABLED") == "true"
+	if metricsEnabled && projectID != "" {
+		meterProvider, err := trace.NewMeterProvider(ctx, trace.Config{
+			ProjectID:   projectID,
+			ServiceName: "cloud-run-slack-bot",
+		}, zapLogger.Logger)
+		if err != nil {
+			zapLogger.Warn("Failed to initialize metrics", zap.Error(err))
+		} else {
+			defer func() {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := meterProvider.Shutdown(shutdownCtx); err != nil {
+					zapLogger.Error("Failed to shutdown meter provider", zap.Error(err))
+				}
+			}()
+		}
+	} else if !metricsEnabled {
+		zapLogger.Info("Metrics disabled (METRICS_ENABLED not set to true)")
+	} else {
+		zapLogger.Warn("GCP_PROJECT_ID not set, metrics disabled")
+	}
+
 	// Initialize clients for all projects
 	rClients := make(map[string]*cloudrun.Client)
 	mClients := make(map[string]*monitoring.Client)
@@ -106,7 +138,9 @@ func main() {
 
 	// Initialize debug feature if enabled
 	var lClients map[string]*logging.Client
+	var tClients map[string]*cloudtrace.Client
 	var debugger *debug.Debugger
+	var exportStore export.Store
 
 	if cfg.DebugEnabled {
 		zapLogger.Info("Debug feature enabled, initializing logging clients and ADK agent")
@@ -121,19 +155,61 @@ func main() {
 			lClients[project.ID] = lClient
 		}
 
+		// Initialize Cloud Trace clients per project to read the spans of failed requests
+		tClients = make(map[string]*cloudtrace.Client)
+		for _, project := range cfg.Projects {
+			tClient, err := cloudtrace.NewClient(ctx, project.ID, zapLogger.Logger)
+			if err != nil {
+				zapLogger.Fatal("Failed to create Cloud Trace client for project", zap.String("projectID", project.ID), zap.Error(err))
+			}
+			tClients[project.ID] = tClient
+		}
+
 		// Initialize ADK agent (singleton)
 		adkAgent, err := adk.NewDebugAgent(ctx, adk.Config{
+			Backend:   cfg.LLMBackend,
 			Project:   cfg.GCPProjectID,
 			Location:  cfg.VertexLocation,
 			ModelName: cfg.ModelName,
+			APIKey:    cfg.LLMAPIKey,
+			BaseURL:   cfg.LLMBaseURL,
 		}, zapLogger.Logger)
 		if err != nil {
 			zapLogger.Fatal("Failed to create ADK agent", zap.Error(err))
 		}
 
+		// Initialize the store for exported incident notes, if configured
+		exportStore, err = export.NewStore(ctx, cfg.DebugExportDest)
+		if err != nil {
+			zapLogger.Fatal("Failed to create export store", zap.Error(err))
+		}
+
+		// Logs are redacted before they reach the LLM or Slack
+		redactor, err := redact.New(cfg.DebugRedactDetectors, cfg.DebugRedactPatterns)
+		if err != nil {
+			zapLogger.Fatal("Failed to create redactor", zap.Error(err))
+		}
+
+		// Estimate costs with the configured price, or the model's list price if known
+		pricing := adk.Pricing{InputPerMillion: cfg.LLMInputPrice, OutputPerMillion: cfg.LLMOutputPrice}
+		if pricing.IsZero() {
+			pricing = adk.DefaultPricing(cfg.ModelName)
+		}
+
 		// Initialize debugger
-		debugger = debug.NewDebugger(lClients, adkAgent, debug.Config{
+		debugger = debug.NewDebugger(lClients, rClients, mClients, tClients, adkAgent, debug.Config{
 			LookbackDuration: time.Duration(cfg.DebugTimeWindow) * time.Minute,
+			MaxErrors:        cfg.DebugMaxErrors,
+			SampleBuckets:    cfg.DebugBuckets,
+			MaxCount:         cfg.DebugMaxCount,
+			Concurrency:      cfg.DebugConcurrency,
+			AnalysisTimeout:  time.Duration(cfg.DebugAnalysisTimeout) * time.Second,
+			TraceLogsTimeout: time.Duration(cfg.DebugTraceLogTimeout) * time.Second,
+			CacheTTL:         time.Duration(cfg.DebugCacheTTL) * time.Minute,
+			MaxToolSteps:     cfg.DebugAgentMaxSteps,
+			Redactor:         redactor,
+			Model:            cfg.ModelName,
+			Pricing:          pricing,
 		}, zapLogger.Logger)
 	}
 
@@ -154,8 +230,57 @@ func main() {
 				zapLogger.Error("Failed to close logging client for project", zap.String("projectID", projectID), zap.Error(err))
 			}
 		}
+		for projectID, tClient := range tClients {
+			if err := tClient.Close(); err != nil {
+				zapLogger.Error("Failed to close Cloud Trace client for project", zap.String("projectID", projectID), zap.Error(err))
+			}
+		}
 	}()
 
+	// Audit events go to a dedicated Cloud Logging log, or the application log if it cannot be written
+	auditLogger := zapLogger
+	if projectID != "" {
+		cloudLogger, err := logger.NewCloudLogger(ctx, projectID, cfg.AuditLogName)
+		if err != nil {
+			zapLogger.Warn("Failed to create audit logger, writing audit events to the application log", zap.Error(err))
+		} else {
+			auditLogger = cloudLogger
+			defer func() {
+				if err := cloudLogger.Close(); err != nil {
+					zapLogger.Error("Failed to close audit logger", zap.Error(err))
+				}
+			}()
+		}
+	}
+	var auditFile io.Writer
+	if cfg.AuditLogFile != "" {
+		f, err := os.OpenFile(cfg.AuditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			zapLogger.Fatal("Failed to open audit log file", zap.String("path", cfg.AuditLogFile), zap.Error(err))
+		}
+		defer f.Close()
+		auditFile = f
+	}
+	auditTrail := audit.NewTrail(auditLogger, auditFile)
+
+	// Current resources of users are kept in Firestore when configured, so that they survive restarts
+	memoryStore, err := memory.NewStore(ctx, cfg.MemoryStore, projectID, cfg.MemoryCollection)
+	if err != nil {
+		zapLogger.Fatal("Failed to create memory store", zap.Error(err))
+	}
+	resources := memory.New(memoryStore, time.Duration(cfg.MemoryTTL)*time.Hour)
+
+	// Requests of commands that change Cloud Run state wait for approval in Firestore when configured,
+	// so that they can still be approved after the bot scaled to zero
+	approvalStore, err := approval.NewStore(ctx, cfg.ApprovalStore, projectID, cfg.ApprovalCollection)
+	if err != nil {
+		zapLogger.Fatal("Failed to create approval store", zap.Error(err))
+	}
+	approvals := approval.New(approvalStore, time.Duration(cfg.ApprovalTimeout)*time.Minute)
+
+	// Changes to Cloud Run resources notified through Pub/Sub are shown in the App Home tab
+	deploys := deploy.NewLog()
+
 	// Setup Slack client
 	ops := []slack.Option{}
 	if cfg.SlackAppToken != "" {
@@ -164,13 +289,14 @@ func main() {
 	sClient := slack.New(cfg.SlackBotToken, ops...)
 
 	// Create multi-project handler
-	handler := slackinternal.NewMultiProjectSlackEventHandler(sClient, rClients, mClients, debugger, cfg.TmpDir, cfg, zapLogger.Logger)
+	handler := slackinternal.NewMultiProjectSlackEventHandler(sClient, rClients, mClients, debugger, exportStore, auditTrail, resources, deploys, approvals, cfg.TmpDir, cfg, zapLogger.Logger)
 
 	// Create service with multi-project support
 	svc := cloudrunslackbot.NewMultiProjectCloudRunSlackBotService(
 		sClient,
 		cfg,
 		handler,
+		deploys,
 		zapLogger,
 	)
 	svc.Run()
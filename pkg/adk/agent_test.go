@@ -73,3 +73,39 @@ func TestConfig(t *testing.T) {
 		t.Errorf("Expected model 'gemini-2.5-flash', got %s", cfg.ModelName)
 	}
 }
+
+func TestErrorLogDescribeForGrouping(t *testing.T) {
+	tests := []struct {
+		name string
+		log  ErrorLog
+		want string
+	}{
+		{
+			name: "message only",
+			log:  ErrorLog{Message: "connection timeout"},
+			want: "connection timeout",
+		},
+		{
+			name: "type already in message",
+			log:  ErrorLog{Message: "TypeError: x is undefined", ErrorType: "TypeError"},
+			want: "TypeError: x is undefined",
+		},
+		{
+			name: "type, request and frames",
+			log: ErrorLog{
+				Message:    "pool exhausted",
+				ErrorType:  "java.lang.IllegalStateException",
+				Request:    "GET /api -> 500",
+				StackTrace: "java.lang.IllegalStateException: pool exhausted\n\tat a.B.c(B.java:1)\n\tat a.B.d(B.java:2)\n\tat a.B.e(B.java:3)\n\tat a.B.f(B.java:4)",
+			},
+			want: "java.lang.IllegalStateException: pool exhausted [request: GET /api -> 500] [frames: at a.B.c(B.java:1) | at a.B.d(B.java:2) | at a.B.e(B.java:3)]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.log.describeForGrouping(); got != tt.want {
+				t.Errorf("describeForGrouping() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
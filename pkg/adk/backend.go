@@ -0,0 +1,428 @@
+package adk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// Supported LLM backends.
+const (
+	BackendVertexAI = "vertexai" // Gemini via Vertex AI (default)
+	BackendGemini   = "gemini"   // Gemini API with an API key
+	BackendOpenAI   = "openai"   // OpenAI-compatible chat completions endpoint
+	BackendFake     = "fake"     // Canned responses, for testing
+)
+
+// Backend generates text for a prompt. When schema is non-nil the response must be JSON matching it.
+type Backend interface {
+	Generate(ctx context.Context, prompt string, schema *genai.Schema) (string, error)
+}
+
+// NewBackend creates the backend selected by cfg.Backend.
+func NewBackend(ctx context.Context, cfg Config) (Backend, error) {
+	switch cfg.Backend {
+	case "", BackendVertexAI:
+		return newGenAIBackend(ctx, &genai.ClientConfig{
+			Project:  cfg.Project,
+			Location: cfg.Location,
+			Backend:  genai.BackendVertexAI,
+		}, cfg.ModelName)
+	case BackendGemini:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("API key is required for the %s backend", BackendGemini)
+		}
+		return newGenAIBackend(ctx, &genai.ClientConfig{
+			APIKey:  cfg.APIKey,
+			Backend: genai.BackendGeminiAPI,
+		}, cfg.ModelName)
+	case BackendOpenAI:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("base URL is required for the %s backend", BackendOpenAI)
+		}
+		return NewOpenAIBackend(cfg.BaseURL, cfg.APIKey, cfg.ModelName), nil
+	case BackendFake:
+		return &FakeBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported LLM backend: %s", cfg.Backend)
+	}
+}
+
+// genAIBackend calls Gemini through the GenAI SDK (Vertex AI or Gemini API).
+type genAIBackend struct {
+	client *genai.Client
+	model  string
+}
+
+func newGenAIBackend(ctx context.Context, clientConfig *genai.ClientConfig, model string) (*genAIBackend, error) {
+	client, err := genai.NewClient(ctx, clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GenAI client: %w", err)
+	}
+	return &genAIBackend{client: client, model: model}, nil
+}
+
+func (b *genAIBackend) Generate(ctx context.Context, prompt string, schema *genai.Schema) (string, error) {
+	// Zero temperature keeps results stable across repeated runs on the same data
+	cfg := &genai.GenerateContentConfig{
+		Temperature: genai.Ptr[float32](0),
+	}
+	if schema != nil {
+		cfg.ResponseMIMEType = "application/json"
+		cfg.ResponseSchema = schema
+	}
+
+	result, err := b.client.Models.GenerateContent(ctx, b.model, genai.Text(prompt), cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate content: %w", err)
+	}
+	recordGenAIUsage(ctx, result)
+
+	// Use the Text() helper method to get concatenated text from all parts
+	return result.Text(), nil
+}
+
+func (b *genAIBackend) GenerateWithTools(ctx context.Context, messages []Message, tools []Tool) (Message, error) {
+	cfg := &genai.GenerateContentConfig{
+		Temperature: genai.Ptr[float32](0),
+	}
+	if len(tools) > 0 {
+		decls := make([]*genai.FunctionDeclaration, len(tools))
+		for i, t := range tools {
+			decls[i] = &genai.FunctionDeclaration{Name: t.Name, Description: t.Description, Parameters: t.Parameters}
+		}
+		cfg.Tools = []*genai.Tool{{FunctionDeclarations: decls}}
+	}
+
+	contents := make([]*genai.Content, 0, len(messages))
+	for _, m := range messages {
+		contents = append(contents, toGenAIContent(m))
+	}
+
+	result, err := b.client.Models.GenerateContent(ctx, b.model, contents, cfg)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to generate content: %w", err)
+	}
+	recordGenAIUsage(ctx, result)
+	if len(result.Candidates) == 0 || result.Candidates[0].Content == nil {
+		return Message{}, fmt.Errorf("no candidates in response")
+	}
+
+	content := result.Candidates[0].Content
+	reply := Message{Role: RoleModel, raw: content}
+	var texts []string
+	for _, part := range content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			// The Gemini API may leave ID empty, in which case responses are matched by name
+			call := part.FunctionCall
+			reply.ToolCalls = append(reply.ToolCalls, ToolCall{ID: call.ID, Name: call.Name, Args: call.Args})
+		case part.Text != "" && !part.Thought:
+			texts = append(texts, part.Text)
+		}
+	}
+	reply.Text = strings.Join(texts, "")
+	return reply, nil
+}
+
+// toGenAIContent converts a message to GenAI content. Tool results are sent as function responses from the user.
+func toGenAIContent(m Message) *genai.Content {
+	if raw, ok := m.raw.(*genai.Content); ok {
+		return raw
+	}
+	switch m.Role {
+	case RoleModel:
+		var parts []*genai.Part
+		if m.Text != "" {
+			parts = append(parts, genai.NewPartFromText(m.Text))
+		}
+		for _, call := range m.ToolCalls {
+			parts = append(parts, &genai.Part{FunctionCall: &genai.FunctionCall{ID: call.ID, Name: call.Name, Args: call.Args}})
+		}
+		return genai.NewContentFromParts(parts, genai.RoleModel)
+	case RoleTool:
+		parts := make([]*genai.Part, len(m.ToolResults))
+		for i, r := range m.ToolResults {
+			parts[i] = &genai.Part{FunctionResponse: &genai.FunctionResponse{
+				ID:       r.CallID,
+				Name:     r.Name,
+				Response: map[string]any{"output": r.Content},
+			}}
+		}
+		return genai.NewContentFromParts(parts, genai.RoleUser)
+	default:
+		return genai.NewContentFromText(m.Text, genai.RoleUser)
+	}
+}
+
+// recordGenAIUsage records the token counts of a response. Thinking tokens are billed as output.
+func recordGenAIUsage(ctx context.Context, result *genai.GenerateContentResponse) {
+	if u := result.UsageMetadata; u != nil {
+		recordUsage(ctx, int(u.PromptTokenCount), int(u.CandidatesTokenCount+u.ThoughtsTokenCount))
+	}
+}
+
+// OpenAIBackend calls an OpenAI-compatible chat completions endpoint,
+// such as OpenAI or a local model server (vLLM, Ollama, LM Studio).
+type OpenAIBackend struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// NewOpenAIBackend creates a backend for the endpoint at baseURL (e.g. "https://api.openai.com/v1").
+func NewOpenAIBackend(baseURL, apiKey, model string) *OpenAIBackend {
+	return &OpenAIBackend{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		httpClient: &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON-encoded arguments
+	} `json:"function"`
+}
+
+type openAIRequest struct {
+	Model          string                   `json:"model"`
+	Messages       []openAIMessage          `json:"messages"`
+	Temperature    float32                  `json:"temperature"`
+	ResponseFormat map[string]interface{}   `json:"response_format,omitempty"`
+	Tools          []map[string]interface{} `json:"tools,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (b *OpenAIBackend) Generate(ctx context.Context, prompt string, schema *genai.Schema) (string, error) {
+	reqBody := openAIRequest{
+		Model:    b.model,
+		Messages: []openAIMessage{{Role: "user", Content: prompt}},
+	}
+	if schema != nil {
+		reqBody.ResponseFormat = map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "response",
+				"schema": toJSONSchema(schema),
+			},
+		}
+	}
+
+	reply, err := b.complete(ctx, reqBody)
+	if err != nil {
+		return "", err
+	}
+	return reply.Content, nil
+}
+
+func (b *OpenAIBackend) GenerateWithTools(ctx context.Context, messages []Message, tools []Tool) (Message, error) {
+	reqBody := openAIRequest{Model: b.model}
+	for _, m := range messages {
+		reqBody.Messages = append(reqBody.Messages, toOpenAIMessages(m)...)
+	}
+	for _, t := range tools {
+		params := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		if t.Parameters != nil {
+			params = toJSONSchema(t.Parameters)
+		}
+		reqBody.Tools = append(reqBody.Tools, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  params,
+			},
+		})
+	}
+
+	reply, err := b.complete(ctx, reqBody)
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{Role: RoleModel, Text: reply.Content}
+	for _, call := range reply.ToolCalls {
+		args := map[string]any{}
+		if call.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+				return Message{}, fmt.Errorf("failed to parse arguments of tool call %s: %w", call.Function.Name, err)
+			}
+		}
+		msg.ToolCalls = append(msg.ToolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Args: args})
+	}
+	return msg, nil
+}
+
+// toOpenAIMessages converts a message to chat messages. Each tool result is a separate message.
+func toOpenAIMessages(m Message) []openAIMessage {
+	switch m.Role {
+	case RoleModel:
+		msg := openAIMessage{Role: "assistant", Content: m.Text}
+		for _, call := range m.ToolCalls {
+			args, _ := json.Marshal(call.Args)
+			tc := openAIToolCall{ID: call.ID, Type: "function"}
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = string(args)
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		return []openAIMessage{msg}
+	case RoleTool:
+		msgs := make([]openAIMessage, len(m.ToolResults))
+		for i, r := range m.ToolResults {
+			msgs[i] = openAIMessage{Role: "tool", Content: r.Content, ToolCallID: r.CallID}
+		}
+		return msgs
+	default:
+		return []openAIMessage{{Role: "user", Content: m.Text}}
+	}
+}
+
+// complete sends a chat completions request and returns the first choice's message.
+func (b *OpenAIBackend) complete(ctx context.Context, reqBody openAIRequest) (openAIMessage, error) {
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return openAIMessage{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return openAIMessage{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return openAIMessage{}, fmt.Errorf("failed to call chat completions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openAIMessage{}, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return openAIMessage{}, fmt.Errorf("chat completions returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var completion openAIResponse
+	if err := json.Unmarshal(respBody, &completion); err != nil {
+		return openAIMessage{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if completion.Usage != nil {
+		recordUsage(ctx, completion.Usage.PromptTokens, completion.Usage.CompletionTokens)
+	}
+	if len(completion.Choices) == 0 {
+		return openAIMessage{}, fmt.Errorf("no choices in response")
+	}
+	return completion.Choices[0].Message, nil
+}
+
+// toJSONSchema converts a GenAI schema to the JSON Schema format used by OpenAI-compatible APIs.
+func toJSONSchema(s *genai.Schema) map[string]interface{} {
+	out := map[string]interface{}{
+		"type": strings.ToLower(string(s.Type)),
+	}
+	if s.Description != "" {
+		out["description"] = s.Description
+	}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if s.Items != nil {
+		out["items"] = toJSONSchema(s.Items)
+	}
+	if len(s.Properties) > 0 {
+		props := make(map[string]interface{}, len(s.Properties))
+		for name, prop := range s.Properties {
+			props[name] = toJSONSchema(prop)
+		}
+		out["properties"] = props
+	}
+	if len(s.Required) > 0 {
+		out["required"] = s.Required
+	}
+	return out
+}
+
+// FakeBackend returns canned responses without calling a model.
+// With a nil Respond it leaves grouping to the deterministic templates and returns a fixed analysis or answer.
+// With a nil RespondWithTools it answers tool-calling conversations without calling any tool.
+// Token usage is estimated at 4 characters per token.
+type FakeBackend struct {
+	Respond          func(prompt string, schema *genai.Schema) (string, error)
+	RespondWithTools func(messages []Message, tools []Tool) (Message, error)
+}
+
+func (b *FakeBackend) Generate(ctx context.Context, prompt string, schema *genai.Schema) (string, error) {
+	text, err := b.generate(prompt, schema)
+	if err == nil {
+		recordUsage(ctx, estimateTokens(prompt), estimateTokens(text))
+	}
+	return text, err
+}
+
+func (b *FakeBackend) generate(prompt string, schema *genai.Schema) (string, error) {
+	if b.Respond != nil {
+		return b.Respond(prompt, schema)
+	}
+	if schema == nil {
+		return "Fake answer", nil
+	}
+	if schema == groupResponseSchema {
+		return `{"groups": []}`, nil
+	}
+	return `{"summary": "Fake analysis", "possible_causes": ["Fake cause"], "suggestions": ["Fake suggestion"]}`, nil
+}
+
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+func (b *FakeBackend) GenerateWithTools(ctx context.Context, messages []Message, tools []Tool) (Message, error) {
+	reply := Message{Role: RoleModel, Text: "Fake findings"}
+	var err error
+	if b.RespondWithTools != nil {
+		reply, err = b.RespondWithTools(messages, tools)
+	}
+	if err == nil {
+		var prompt int
+		for _, m := range messages {
+			prompt += estimateTokens(m.Text)
+			for _, r := range m.ToolResults {
+				prompt += estimateTokens(r.Content)
+			}
+		}
+		recordUsage(ctx, prompt, estimateTokens(reply.Text))
+	}
+	return reply, err
+}
@@ -0,0 +1,504 @@
+package adk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/genai"
+)
+
+func TestOpenAIBackend_Generate(t *testing.T) {
+	var got openAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("unexpected Authorization header: %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"summary\": \"ok\"}"}}]}`))
+	}))
+	defer server.Close()
+
+	backend := NewOpenAIBackend(server.URL+"/v1/", "secret", "local-model")
+	text, err := backend.Generate(context.Background(), "hello", analysisResponseSchema)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if text != `{"summary": "ok"}` {
+		t.Errorf("Generate() = %q", text)
+	}
+	if got.Model != "local-model" || len(got.Messages) != 1 || got.Messages[0].Content != "hello" {
+		t.Errorf("unexpected request: %+v", got)
+	}
+	if got.ResponseFormat["type"] != "json_schema" {
+		t.Errorf("expected json_schema response format, got %v", got.ResponseFormat)
+	}
+}
+
+func TestOpenAIBackend_GenerateError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	backend := NewOpenAIBackend(server.URL, "", "missing")
+	_, err := backend.Generate(context.Background(), "hello", nil)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Generate() error = %v, want 404 error", err)
+	}
+}
+
+func TestToJSONSchema(t *testing.T) {
+	schema := toJSONSchema(groupResponseSchema)
+	if schema["type"] != "object" {
+		t.Errorf("type = %v, want object", schema["type"])
+	}
+	groups := schema["properties"].(map[string]interface{})["groups"].(map[string]interface{})
+	if groups["type"] != "array" {
+		t.Errorf("groups type = %v, want array", groups["type"])
+	}
+	items := groups["items"].(map[string]interface{})
+	if items["type"] != "object" {
+		t.Errorf("items type = %v, want object", items["type"])
+	}
+	props := items["properties"].(map[string]interface{})
+	indices := props["indices"].(map[string]interface{})
+	if indices["items"].(map[string]interface{})["type"] != "integer" {
+		t.Errorf("indices items = %v, want integer", indices["items"])
+	}
+
+	// Enums restrict the values of a string, e.g. the severity of a finding
+	severity := toJSONSchema(&genai.Schema{Type: genai.TypeString, Enum: []string{"low", "high"}})
+	if fmt.Sprint(severity["enum"]) != "[low high]" {
+		t.Errorf("enum = %v, want [low high]", severity["enum"])
+	}
+	if _, ok := schema["enum"]; ok {
+		t.Errorf("enum = %v for a schema without enum", schema["enum"])
+	}
+}
+
+func TestOpenAIBackend_GenerateSchemaRoots(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{}"}}]}`))
+	}))
+	defer server.Close()
+
+	backend := NewOpenAIBackend(server.URL, "", "local-model")
+	for _, schema := range []*genai.Schema{groupResponseSchema, analysisResponseSchema} {
+		if _, err := backend.Generate(context.Background(), "hello", schema); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		format := got["response_format"].(map[string]interface{})
+		root := format["json_schema"].(map[string]interface{})["schema"].(map[string]interface{})
+		if root["type"] != "object" {
+			t.Errorf("response_format schema type = %v, want object", root["type"])
+		}
+	}
+}
+
+func TestParseGroupResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     int
+		wantErr  bool
+	}{
+		{name: "object", response: `{"groups": [{"pattern": "Timeout", "indices": [1, 2]}]}`, want: 1},
+		{name: "code block", response: "```json\n{\"groups\": [{\"pattern\": \"A\", \"indices\": [1]}, {\"pattern\": \"B\", \"indices\": [2]}]}\n```", want: 2},
+		{name: "bare array", response: `[{"pattern": "Timeout", "indices": [1]}]`, want: 1},
+		{name: "not json", response: "Sure! Here are the groups.", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := parseGroupResponse(tt.response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGroupResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(items) != tt.want {
+				t.Errorf("parseGroupResponse() = %d groups, want %d", len(items), tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "fake", cfg: Config{Backend: BackendFake}},
+		{name: "openai", cfg: Config{Backend: BackendOpenAI, BaseURL: "http://localhost:11434/v1"}},
+		{name: "openai without base URL", cfg: Config{Backend: BackendOpenAI}, wantErr: true},
+		{name: "gemini without API key", cfg: Config{Backend: BackendGemini}, wantErr: true},
+		{name: "unknown", cfg: Config{Backend: "unknown"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewBackend(context.Background(), tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDebugAgent_FakeBackend(t *testing.T) {
+	agent := NewDebugAgentWithBackend(&FakeBackend{}, zap.NewNop())
+	errors := []ErrorLog{
+		{Message: "connection refused to 10.0.0.1:5432"},
+		{Message: "connection refused to 10.0.0.2:5432"},
+		{Message: "user 42 not found"},
+	}
+
+	groups, err := agent.GroupErrors(context.Background(), errors)
+	if err != nil {
+		t.Fatalf("GroupErrors() error = %v", err)
+	}
+	if len(groups) != 2 || groups[0].Count != 2 || groups[1].Count != 1 {
+		t.Fatalf("GroupErrors() = %+v, want template groups of 2 and 1", groups)
+	}
+
+	analysis, err := agent.AnalyzeErrors(context.Background(), groups[0], AnalysisInput{})
+	if err != nil {
+		t.Fatalf("AnalyzeErrors() error = %v", err)
+	}
+	if analysis.Summary != "Fake analysis" {
+		t.Errorf("AnalyzeErrors() summary = %q", analysis.Summary)
+	}
+}
+
+func TestDebugAgent_FakeBackendRespond(t *testing.T) {
+	var prompts []string
+	backend := &FakeBackend{Respond: func(prompt string, schema *genai.Schema) (string, error) {
+		prompts = append(prompts, prompt)
+		return `{"groups": [{"pattern": "Lookup failures", "indices": [1, 2]}]}`, nil
+	}}
+	agent := NewDebugAgentWithBackend(backend, zap.NewNop())
+
+	groups, err := agent.GroupErrors(context.Background(), []ErrorLog{
+		{Message: "user 42 not found"},
+		{Message: "order 7 not found"},
+		{Message: "order 8 not found"},
+	})
+	if err != nil {
+		t.Fatalf("GroupErrors() error = %v", err)
+	}
+	if len(prompts) != 1 {
+		t.Fatalf("expected 1 LLM call, got %d", len(prompts))
+	}
+	if len(groups) != 1 || groups[0].Pattern != "Lookup failures" || groups[0].Count != 3 {
+		t.Errorf("GroupErrors() = %+v, want a single merged group", groups)
+	}
+}
+
+func TestDebugAgent_AnswerFollowUp(t *testing.T) {
+	var prompt string
+	backend := &FakeBackend{Respond: func(p string, schema *genai.Schema) (string, error) {
+		if schema != nil {
+			t.Errorf("follow-up answers should not use a response schema")
+		}
+		prompt = p
+		return "  It is the DB.  ", nil
+	}}
+	agent := NewDebugAgentWithBackend(backend, zap.NewNop())
+
+	history := []Turn{{Question: "what is group 1?", Answer: "connection errors"}}
+	answer, err := agent.AnswerFollowUp(context.Background(), "Group 1: connection refused", history, "is this related to the DB?")
+	if err != nil {
+		t.Fatalf("AnswerFollowUp() error = %v", err)
+	}
+	if answer != "It is the DB." {
+		t.Errorf("AnswerFollowUp() = %q", answer)
+	}
+	for _, want := range []string{"Group 1: connection refused", "Q: what is group 1?\nA: connection errors", "Question: is this related to the DB?"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q", want)
+		}
+	}
+}
+
+func TestOpenAIBackend_GenerateWithTools(t *testing.T) {
+	var got openAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": null, "tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "query_logs", "arguments": "{\"filter\": \"severity>=WARNING\", \"limit\": 10}"}}
+		]}}]}`))
+	}))
+	defer server.Close()
+
+	backend := NewOpenAIBackend(server.URL, "", "local-model")
+	tools := []Tool{{Name: "query_logs", Description: "Query logs", Parameters: &genai.Schema{Type: genai.TypeObject}}}
+	messages := []Message{
+		{Role: RoleUser, Text: "investigate"},
+		{Role: RoleModel, ToolCalls: []ToolCall{{ID: "call_0", Name: "query_logs", Args: map[string]any{"limit": 5}}}},
+		{Role: RoleTool, ToolResults: []ToolResult{{CallID: "call_0", Name: "query_logs", Content: "no logs"}}},
+	}
+	reply, err := backend.GenerateWithTools(context.Background(), messages, tools)
+	if err != nil {
+		t.Fatalf("GenerateWithTools() error = %v", err)
+	}
+	if len(reply.ToolCalls) != 1 || reply.ToolCalls[0].ID != "call_1" || reply.ToolCalls[0].Name != "query_logs" {
+		t.Fatalf("GenerateWithTools() tool calls = %+v", reply.ToolCalls)
+	}
+	if reply.ToolCalls[0].Args["filter"] != "severity>=WARNING" || reply.ToolCalls[0].Args["limit"] != float64(10) {
+		t.Errorf("GenerateWithTools() args = %v", reply.ToolCalls[0].Args)
+	}
+
+	if len(got.Tools) != 1 || got.Tools[0]["type"] != "function" {
+		t.Errorf("unexpected tools in request: %v", got.Tools)
+	}
+	if len(got.Messages) != 3 {
+		t.Fatalf("expected 3 messages in request, got %+v", got.Messages)
+	}
+	if assistant := got.Messages[1]; assistant.Role != "assistant" || len(assistant.ToolCalls) != 1 || assistant.ToolCalls[0].Function.Arguments != `{"limit":5}` {
+		t.Errorf("unexpected assistant message: %+v", assistant)
+	}
+	if tool := got.Messages[2]; tool.Role != "tool" || tool.ToolCallID != "call_0" || tool.Content != "no logs" {
+		t.Errorf("unexpected tool message: %+v", tool)
+	}
+}
+
+func TestDebugAgent_AnalyzeErrorsWithTools(t *testing.T) {
+	var analysisPrompt string
+	steps := 0
+	backend := &FakeBackend{
+		Respond: func(prompt string, schema *genai.Schema) (string, error) {
+			analysisPrompt = prompt
+			return `{"summary": "Bad deploy", "possible_causes": [], "suggestions": []}`, nil
+		},
+		RespondWithTools: func(messages []Message, tools []Tool) (Message, error) {
+			steps++
+			if steps == 1 {
+				return Message{Role: RoleModel, ToolCalls: []ToolCall{{ID: "1", Name: "list_revisions", Args: map[string]any{"limit": 2}}}}, nil
+			}
+			last := messages[len(messages)-1]
+			if last.Role != RoleTool || last.ToolResults[0].Content != "rev-2 created at 10:00" {
+				t.Errorf("unexpected tool result message: %+v", last)
+			}
+			return Message{Role: RoleModel, Text: "Errors started with rev-2."}, nil
+		},
+	}
+	agent := NewDebugAgentWithBackend(backend, zap.NewNop())
+
+	var gotLimit int
+	tools := []Tool{{
+		Name: "list_revisions",
+		Run: func(ctx context.Context, args map[string]any) (string, error) {
+			gotLimit = IntArg(args, "limit", 5, 20)
+			return "rev-2 created at 10:00", nil
+		},
+	}}
+	analysis, err := agent.AnalyzeErrors(context.Background(), ErrorGroup{Pattern: "timeout", Count: 3}, AnalysisInput{Tools: tools, MaxToolSteps: 3})
+	if err != nil {
+		t.Fatalf("AnalyzeErrors() error = %v", err)
+	}
+	if analysis.Summary != "Bad deploy" {
+		t.Errorf("AnalyzeErrors() summary = %q", analysis.Summary)
+	}
+	if steps != 2 || gotLimit != 2 {
+		t.Errorf("steps = %d, limit = %d, want 2 steps with limit 2", steps, gotLimit)
+	}
+	for _, want := range []string{"Investigation Findings", `list_revisions({"limit":2})`, "rev-2 created at 10:00", "Conclusion: Errors started with rev-2."} {
+		if !strings.Contains(analysisPrompt, want) {
+			t.Errorf("analysis prompt does not contain %q", want)
+		}
+	}
+}
+
+func TestDebugAgent_InvestigateStepBudget(t *testing.T) {
+	steps, runs := 0, 0
+	backend := &FakeBackend{RespondWithTools: func(messages []Message, tools []Tool) (Message, error) {
+		steps++
+		return Message{Role: RoleModel, ToolCalls: []ToolCall{{Name: "query_logs"}, {Name: "unknown"}}}, nil
+	}}
+	agent := NewDebugAgentWithBackend(backend, zap.NewNop())
+	tools := []Tool{{Name: "query_logs", Run: func(ctx context.Context, args map[string]any) (string, error) {
+		runs++
+		return strings.Repeat("x", maxToolOutputChars+100), nil
+	}}}
+
+	findings, err := agent.investigate(context.Background(), backend, "desc", tools, 2)
+	if err != nil {
+		t.Fatalf("investigate() error = %v", err)
+	}
+	if steps != 2 || runs != 2 {
+		t.Errorf("steps = %d, runs = %d, want 2 each", steps, runs)
+	}
+	if !strings.Contains(findings, `error: unknown tool "unknown"`) || !strings.Contains(findings, "(truncated)") {
+		t.Errorf("unexpected findings: %s", findings)
+	}
+}
+
+func TestIntArg(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]any
+		want int
+	}{
+		{name: "missing", args: map[string]any{}, want: 10},
+		{name: "json number", args: map[string]any{"n": float64(3)}, want: 3},
+		{name: "int", args: map[string]any{"n": 4}, want: 4},
+		{name: "above max", args: map[string]any{"n": float64(100)}, want: 50},
+		{name: "not positive", args: map[string]any{"n": float64(0)}, want: 10},
+		{name: "string", args: map[string]any{"n": "3"}, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IntArg(tt.args, "n", 10, 50); got != tt.want {
+				t.Errorf("IntArg() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	cases := []ReplayCase{{
+		Name: "db",
+		Errors: []ErrorLog{
+			{Message: "connection refused to 10.0.0.1:5432"},
+			{Message: "user 42 not found"},
+			{Message: "user 43 not found"},
+		},
+	}}
+
+	// Alternate between two groupings, and return an analysis that does not match the schema
+	calls := 0
+	backend := &FakeBackend{Respond: func(prompt string, schema *genai.Schema) (string, error) {
+		if schema == analysisResponseSchema {
+			return "not json", nil
+		}
+		calls++
+		if calls%2 == 1 {
+			return `{"groups": [{"pattern": "All errors", "indices": [1, 2]}]}`, nil
+		}
+		return `{"groups": [{"pattern": "Connection", "indices": [1]}, {"pattern": "Lookup", "indices": [2]}]}`, nil
+	}}
+
+	results := Replay(context.Background(), backend, "test-model", cases, ReplayOptions{Runs: 3, Analyze: true}, zap.NewNop())
+	if len(results) != 1 {
+		t.Fatalf("Replay() returned %d results", len(results))
+	}
+	r := results[0]
+	if got := fmt.Sprint(r.GroupCounts); got != "[1 2 1]" {
+		t.Errorf("GroupCounts = %s, want [1 2 1]", got)
+	}
+	// Run 2 separates the connection error from the lookups (1 of 3 pairs agree); run 3 matches run 1
+	if want := (1.0/3 + 1) / 2; math.Abs(r.Stability-want) > 1e-9 {
+		t.Errorf("Stability = %v, want %v", r.Stability, want)
+	}
+	if r.GroupParseFailures != 0 || r.AnalysisCount != 1 || r.AnalysisParseFailures != 1 {
+		t.Errorf("unexpected failures: %+v", r)
+	}
+}
+
+func TestReplay_GroupParseFailure(t *testing.T) {
+	backend := &FakeBackend{Respond: func(prompt string, schema *genai.Schema) (string, error) {
+		return "Sure! Here are the groups.", nil
+	}}
+	cases := []ReplayCase{{Name: "bad", Errors: []ErrorLog{{Message: "disk full"}, {Message: "user 1 not found"}}}}
+
+	r := Replay(context.Background(), backend, "", cases, ReplayOptions{Runs: 2}, zap.NewNop())[0]
+	if r.GroupParseFailures != 2 || r.Stability != 1 {
+		t.Errorf("Replay() = %+v, want 2 parse failures with stable fallback groups", r)
+	}
+}
+
+func TestUsageMeter(t *testing.T) {
+	backend := &FakeBackend{Respond: func(prompt string, schema *genai.Schema) (string, error) {
+		return `{"summary": "s", "possible_causes": [], "suggestions": []}`, nil
+	}}
+	agent := NewDebugAgentWithBackend(backend, zap.NewNop())
+
+	meter := &UsageMeter{}
+	ctx := WithUsageMeter(context.Background(), meter)
+	group := ErrorGroup{Pattern: "p", Count: 1, Representative: ErrorLog{Message: "boom"}}
+	for i := 0; i < 2; i++ {
+		if _, err := agent.AnalyzeErrors(ctx, group, AnalysisInput{}); err != nil {
+			t.Fatalf("AnalyzeErrors() error = %v", err)
+		}
+	}
+
+	usage := meter.Total()
+	if usage.Calls != 2 || usage.PromptTokens == 0 || usage.ResponseTokens != 2*estimateTokens(`{"summary": "s", "possible_causes": [], "suggestions": []}`) {
+		t.Errorf("Total() = %+v", usage)
+	}
+	if usage.TotalTokens() != usage.PromptTokens+usage.ResponseTokens {
+		t.Errorf("TotalTokens() = %d", usage.TotalTokens())
+	}
+
+	// A meter with a callback is called with the total after each call
+	var totals []int
+	callbackMeter := NewUsageMeter(func(total Usage) { totals = append(totals, total.Calls) })
+	for i := 0; i < 2; i++ {
+		if _, err := agent.AnalyzeErrors(WithUsageMeter(context.Background(), callbackMeter), group, AnalysisInput{}); err != nil {
+			t.Fatalf("AnalyzeErrors() error = %v", err)
+		}
+	}
+	if fmt.Sprint(totals) != "[1 2]" {
+		t.Errorf("callback called with %v calls, want [1 2]", totals)
+	}
+
+	// Calls without a meter are not counted anywhere
+	var nilMeter *UsageMeter
+	nilMeter.Add(Usage{Calls: 1})
+	if _, err := agent.AnalyzeErrors(context.Background(), group, AnalysisInput{}); err != nil || meter.Total() != usage {
+		t.Errorf("usage changed without a meter: %+v, %v", meter.Total(), err)
+	}
+}
+
+func TestOpenAIBackend_Usage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ok"}}], "usage": {"prompt_tokens": 120, "completion_tokens": 30}}`))
+	}))
+	defer server.Close()
+
+	meter := &UsageMeter{}
+	backend := NewOpenAIBackend(server.URL, "", "model")
+	if _, err := backend.Generate(WithUsageMeter(context.Background(), meter), "hello", nil); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if got, want := meter.Total(), (Usage{Calls: 1, PromptTokens: 120, ResponseTokens: 30}); got != want {
+		t.Errorf("Total() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPricing(t *testing.T) {
+	tests := []struct {
+		model string
+		want  Pricing
+	}{
+		{model: "gemini-2.5-flash-lite", want: Pricing{InputPerMillion: 0.10, OutputPerMillion: 0.40}},
+		{model: "gemini-2.5-flash-001", want: Pricing{InputPerMillion: 0.30, OutputPerMillion: 2.50}},
+		{model: "llama3", want: Pricing{}},
+	}
+	for _, tt := range tests {
+		if got := DefaultPricing(tt.model); got != tt.want {
+			t.Errorf("DefaultPricing(%q) = %+v, want %+v", tt.model, got, tt.want)
+		}
+	}
+
+	cost := Pricing{InputPerMillion: 1, OutputPerMillion: 4}.Cost(Usage{PromptTokens: 500000, ResponseTokens: 250000})
+	if math.Abs(cost-1.5) > 1e-9 {
+		t.Errorf("Cost() = %v, want 1.5", cost)
+	}
+}
@@ -0,0 +1,113 @@
+package adk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	timestampRegexp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`)
+	uuidRegexp      = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	ipRegexp        = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`)
+	hexPrefixRegexp = regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`)
+	// hexIDRegexp matches hex-looking tokens; only those mixing digits and letters are treated
+	// as IDs so that plain words ("facade") and numbers are left to the other rules.
+	hexIDRegexp      = regexp.MustCompile(`\b[0-9a-fA-F]{6,}\b`)
+	quotedRegexp     = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`[^`]*`")
+	numberRegexp     = regexp.MustCompile(`\b\d+(?:\.\d+)?`) // also matches numbers with units, e.g. "30s"
+	whitespaceRegexp = regexp.MustCompile(`\s+`)
+)
+
+func replaceHexIDs(msg string) string {
+	return hexIDRegexp.ReplaceAllStringFunc(msg, func(tok string) string {
+		if strings.ContainsAny(tok, "0123456789") && strings.ContainsAny(tok, "abcdefABCDEF") {
+			return "<hex>"
+		}
+		return tok
+	})
+}
+
+// NormalizeMessage turns an error message into a template by replacing variable parts
+// such as UUIDs, numbers, timestamps, hex IDs and quoted values with placeholders.
+// More specific patterns run before the generic number pattern.
+func NormalizeMessage(msg string) string {
+	msg = timestampRegexp.ReplaceAllString(msg, "<ts>")
+	msg = uuidRegexp.ReplaceAllString(msg, "<uuid>")
+	msg = ipRegexp.ReplaceAllString(msg, "<ip>")
+	msg = hexPrefixRegexp.ReplaceAllString(msg, "<hex>")
+	msg = replaceHexIDs(msg)
+	msg = quotedRegexp.ReplaceAllString(msg, "<str>")
+	msg = numberRegexp.ReplaceAllString(msg, "<num>")
+	return strings.TrimSpace(whitespaceRegexp.ReplaceAllString(msg, " "))
+}
+
+// Fingerprint returns the deterministic grouping key of an error.
+func Fingerprint(e ErrorLog) string {
+	if e.ErrorType == "" {
+		return NormalizeMessage(e.Message)
+	}
+	return e.ErrorType + "|" + NormalizeMessage(e.Message)
+}
+
+// errorTemplate is a set of errors sharing the same fingerprint.
+type errorTemplate struct {
+	Template string     // Normalized message
+	Errors   []ErrorLog // Errors matching the template, in input order
+}
+
+// groupByTemplate groups errors with identical fingerprints.
+// Templates are ordered by error count (descending), then by first occurrence.
+func groupByTemplate(errors []ErrorLog) []errorTemplate {
+	index := make(map[string]int)
+	var templates []errorTemplate
+	for _, e := range errors {
+		key := Fingerprint(e)
+		i, ok := index[key]
+		if !ok {
+			i = len(templates)
+			index[key] = i
+			templates = append(templates, errorTemplate{Template: NormalizeMessage(e.Message)})
+		}
+		templates[i].Errors = append(templates[i].Errors, e)
+	}
+	sort.SliceStable(templates, func(i, j int) bool {
+		return len(templates[i].Errors) > len(templates[j].Errors)
+	})
+	return templates
+}
+
+// toErrorGroup builds an error group from one or more templates.
+func toErrorGroup(pattern string, templates []errorTemplate) ErrorGroup {
+	group := ErrorGroup{Pattern: pattern}
+	for _, t := range templates {
+		for _, e := range t.Errors {
+			if group.Count == 0 {
+				group.Representative = e
+			} else {
+				group.SimilarErrors = append(group.SimilarErrors, e)
+			}
+			group.Count++
+		}
+	}
+	return group
+}
+
+// GroupFingerprint returns a stable key for an error group: the hash of the sorted,
+// distinct fingerprints of its errors.
+func GroupFingerprint(g ErrorGroup) string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, e := range append([]ErrorLog{g.Representative}, g.SimilarErrors...) {
+		key := Fingerprint(e)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
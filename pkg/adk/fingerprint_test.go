@@ -0,0 +1,147 @@
+package adk
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNormalizeMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{
+			name: "uuid and number",
+			msg:  "order 550e8400-e29b-41d4-a716-446655440000 failed after 3 retries",
+			want: "order <uuid> failed after <num> retries",
+		},
+		{
+			name: "timestamp",
+			msg:  "deadline exceeded at 2024-01-01T10:00:00.123Z",
+			want: "deadline exceeded at <ts>",
+		},
+		{
+			name: "hex ids",
+			msg:  "object 0x7f3a9c not found in 5f2b9c7e1a",
+			want: "object <hex> not found in <hex>",
+		},
+		{
+			name: "plain hex-looking words are kept",
+			msg:  "facade decade failed",
+			want: "facade decade failed",
+		},
+		{
+			name: "quoted values",
+			msg:  `user "alice" not found in table 'users'`,
+			want: "user <str> not found in table <str>",
+		},
+		{
+			name: "ip address and whitespace",
+			msg:  "dial tcp 10.0.0.12:5432:   connection refused",
+			want: "dial tcp <ip>: connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeMessage(tt.msg); got != tt.want {
+				t.Errorf("NormalizeMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := ErrorLog{Message: "user 1 not found"}
+	b := ErrorLog{Message: "user 2 not found"}
+	c := ErrorLog{Message: "user 2 not found", ErrorType: "NotFoundException"}
+
+	if Fingerprint(a) != Fingerprint(b) {
+		t.Errorf("Expected same fingerprint, got %q and %q", Fingerprint(a), Fingerprint(b))
+	}
+	if Fingerprint(b) == Fingerprint(c) {
+		t.Errorf("Expected error type to be part of the fingerprint")
+	}
+}
+
+func TestGroupByTemplate(t *testing.T) {
+	errors := []ErrorLog{
+		{Message: "timeout after 30s", TraceID: "T1"},
+		{Message: "user 1 not found", TraceID: "T2"},
+		{Message: "user 2 not found", TraceID: "T3"},
+		{Message: "timeout after 10s", TraceID: "T4"},
+		{Message: "user 3 not found", TraceID: "T5"},
+	}
+
+	templates := groupByTemplate(errors)
+	if len(templates) != 2 {
+		t.Fatalf("Expected 2 templates, got %d", len(templates))
+	}
+	// Most frequent template first
+	if templates[0].Template != "user <num> not found" || len(templates[0].Errors) != 3 {
+		t.Errorf("Unexpected first template: %q (%d errors)", templates[0].Template, len(templates[0].Errors))
+	}
+	if templates[1].Template != "timeout after <num>s" || len(templates[1].Errors) != 2 {
+		t.Errorf("Unexpected second template: %q (%d errors)", templates[1].Template, len(templates[1].Errors))
+	}
+	// Input order is preserved within a template
+	if templates[0].Errors[0].TraceID != "T2" {
+		t.Errorf("Expected first error T2, got %s", templates[0].Errors[0].TraceID)
+	}
+}
+
+func TestToErrorGroup(t *testing.T) {
+	templates := []errorTemplate{
+		{Template: "a", Errors: []ErrorLog{{Message: "a1"}, {Message: "a2"}}},
+		{Template: "b", Errors: []ErrorLog{{Message: "b1"}}},
+	}
+	group := toErrorGroup("pattern", templates)
+	if group.Count != 3 {
+		t.Errorf("Expected count 3, got %d", group.Count)
+	}
+	if group.Representative.Message != "a1" {
+		t.Errorf("Expected representative a1, got %s", group.Representative.Message)
+	}
+	if len(group.SimilarErrors) != 2 {
+		t.Errorf("Expected 2 similar errors, got %d", len(group.SimilarErrors))
+	}
+}
+
+func TestGroupErrors_SingleTemplateSkipsLLM(t *testing.T) {
+	// The agent has no client; a single template must not reach the LLM
+	agent := &DebugAgent{logger: zap.NewNop()}
+	groups, err := agent.GroupErrors(t.Context(), []ErrorLog{
+		{Message: "user 1 not found"},
+		{Message: "user 2 not found"},
+	})
+	if err != nil {
+		t.Fatalf("GroupErrors failed: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Count != 2 {
+		t.Fatalf("Expected one group of 2 errors, got %+v", groups)
+	}
+	if groups[0].Pattern != "user <num> not found" {
+		t.Errorf("Unexpected pattern: %s", groups[0].Pattern)
+	}
+}
+
+func TestGroupFingerprint(t *testing.T) {
+	a := ErrorGroup{
+		Representative: ErrorLog{Message: "user 1 not found"},
+		SimilarErrors:  []ErrorLog{{Message: "timeout after 30s"}, {Message: "user 2 not found"}},
+	}
+	// Same templates in a different order and with different values
+	b := ErrorGroup{
+		Representative: ErrorLog{Message: "timeout after 5s"},
+		SimilarErrors:  []ErrorLog{{Message: "user 3 not found"}},
+	}
+	c := ErrorGroup{Representative: ErrorLog{Message: "user 1 not found"}}
+
+	if GroupFingerprint(a) != GroupFingerprint(b) {
+		t.Errorf("groups with the same templates should have the same fingerprint")
+	}
+	if GroupFingerprint(a) == GroupFingerprint(c) {
+		t.Errorf("groups with different templates should have different fingerprints")
+	}
+}
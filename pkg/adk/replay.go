@@ -0,0 +1,156 @@
+package adk
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+	"google.golang.org/genai"
+)
+
+// ReplayCase is a saved set of error logs, e.g. exported from a past incident, to replay against a backend.
+type ReplayCase struct {
+	Name   string     `json:"name"`
+	Errors []ErrorLog `json:"errors"`
+}
+
+// ReplayOptions configures a replay.
+type ReplayOptions struct {
+	Runs    int  // Number of times each case is grouped, to measure stability (at least 1)
+	Analyze bool // Whether to also analyze each group of the first run
+}
+
+// ReplayResult reports how a backend handled a case.
+type ReplayResult struct {
+	Name                  string
+	ErrorCount            int
+	GroupCounts           []int    // Number of groups in each run
+	Stability             float64  // Mean Rand index of each run's grouping against the first run (1 means identical)
+	GroupParseFailures    int      // Grouping responses that did not match the schema
+	AnalysisCount         int      // Number of groups analyzed
+	AnalysisParseFailures int      // Analysis responses that did not match the schema
+	Failures              []string // Errors returned by the backend
+}
+
+// recordingBackend remembers the last response to a grouping prompt.
+type recordingBackend struct {
+	Backend
+	mu            sync.Mutex
+	groupResponse string
+}
+
+func (b *recordingBackend) Generate(ctx context.Context, prompt string, schema *genai.Schema) (string, error) {
+	text, err := b.Backend.Generate(ctx, prompt, schema)
+	if schema == groupResponseSchema {
+		b.mu.Lock()
+		b.groupResponse = text
+		b.mu.Unlock()
+	}
+	return text, err
+}
+
+// takeGroupResponse returns and clears the last grouping response, and whether there was one.
+func (b *recordingBackend) takeGroupResponse() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	text, ok := b.groupResponse, b.groupResponse != ""
+	b.groupResponse = ""
+	return text, ok
+}
+
+// Replay runs GroupErrors (and optionally AnalyzeErrors) over saved cases against backend, so that
+// a model or prompt change can be evaluated for grouping stability and schema-parse failures before rollout.
+func Replay(ctx context.Context, backend Backend, model string, cases []ReplayCase, opts ReplayOptions, logger *zap.Logger) []ReplayResult {
+	recorder := &recordingBackend{Backend: backend}
+	agent := NewDebugAgentWithBackend(recorder, logger)
+	agent.model = model
+	runs := max(opts.Runs, 1)
+
+	results := make([]ReplayResult, 0, len(cases))
+	for _, c := range cases {
+		result := ReplayResult{Name: c.Name, ErrorCount: len(c.Errors)}
+		var first []int
+		var firstGroups []ErrorGroup
+		var stabilitySum float64
+		compared := 0
+		for run := 0; run < runs; run++ {
+			groups, err := agent.GroupErrors(ctx, c.Errors)
+			if response, ok := recorder.takeGroupResponse(); ok {
+				if _, parseErr := parseGroupResponse(response); parseErr != nil {
+					result.GroupParseFailures++
+				}
+			}
+			if err != nil {
+				result.Failures = append(result.Failures, err.Error())
+				continue
+			}
+			result.GroupCounts = append(result.GroupCounts, len(groups))
+			labels := groupLabels(c.Errors, groups)
+			if first == nil {
+				first, firstGroups = labels, groups
+				continue
+			}
+			stabilitySum += randIndex(first, labels)
+			compared++
+		}
+		result.Stability = 1
+		if compared > 0 {
+			result.Stability = stabilitySum / float64(compared)
+		}
+
+		if opts.Analyze {
+			for _, g := range firstGroups {
+				analysis, err := agent.AnalyzeErrors(ctx, g, AnalysisInput{})
+				result.AnalysisCount++
+				if err != nil {
+					result.Failures = append(result.Failures, err.Error())
+					continue
+				}
+				if analysis.ParseFailed {
+					result.AnalysisParseFailures++
+				}
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// groupLabels returns the index of the group each error was assigned to, or -1 if it is in none.
+func groupLabels(errors []ErrorLog, groups []ErrorGroup) []int {
+	// Identical errors are interchangeable, so each occurrence takes the next free index
+	indices := make(map[ErrorLog][]int)
+	for i, e := range errors {
+		indices[e] = append(indices[e], i)
+	}
+	labels := make([]int, len(errors))
+	for i := range labels {
+		labels[i] = -1
+	}
+	for g, group := range groups {
+		for _, e := range append([]ErrorLog{group.Representative}, group.SimilarErrors...) {
+			if free := indices[e]; len(free) > 0 {
+				labels[free[0]] = g
+				indices[e] = free[1:]
+			}
+		}
+	}
+	return labels
+}
+
+// randIndex returns the fraction of error pairs on which two groupings agree (both together or both apart).
+func randIndex(a, b []int) float64 {
+	pairs, agree := 0, 0
+	for i := range a {
+		for j := i + 1; j < len(a); j++ {
+			pairs++
+			if (a[i] == a[j]) == (b[i] == b[j]) {
+				agree++
+			}
+		}
+	}
+	if pairs == 0 {
+		return 1
+	}
+	return float64(agree) / float64(pairs)
+}
@@ -0,0 +1,136 @@
+package adk
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Usage is the number of tokens used by LLM calls.
+type Usage struct {
+	Calls          int // Number of LLM calls
+	PromptTokens   int // Input tokens
+	ResponseTokens int // Output tokens, including thinking tokens
+}
+
+// TotalTokens returns the number of input and output tokens.
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.ResponseTokens
+}
+
+// Add returns the sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		Calls:          u.Calls + other.Calls,
+		PromptTokens:   u.PromptTokens + other.PromptTokens,
+		ResponseTokens: u.ResponseTokens + other.ResponseTokens,
+	}
+}
+
+// UsageMeter accumulates the usage of the LLM calls made with a context from WithUsageMeter.
+// It is safe for concurrent use.
+type UsageMeter struct {
+	mu    sync.Mutex
+	usage Usage
+	onAdd func(total Usage) // nil if usage is only read at the end
+}
+
+// NewUsageMeter creates a meter that calls onAdd with the accumulated usage after each LLM call, e.g. to stop a
+// run that exceeds a budget.
+func NewUsageMeter(onAdd func(total Usage)) *UsageMeter {
+	return &UsageMeter{onAdd: onAdd}
+}
+
+// Add adds usage to the meter. It does nothing on a nil meter.
+func (m *UsageMeter) Add(usage Usage) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.usage = m.usage.Add(usage)
+	total := m.usage
+	m.mu.Unlock()
+	if m.onAdd != nil {
+		m.onAdd(total)
+	}
+}
+
+// Total returns the usage accumulated so far.
+func (m *UsageMeter) Total() Usage {
+	if m == nil {
+		return Usage{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+type usageMeterKey struct{}
+
+// WithUsageMeter returns a context whose LLM calls are counted by meter.
+func WithUsageMeter(ctx context.Context, meter *UsageMeter) context.Context {
+	return context.WithValue(ctx, usageMeterKey{}, meter)
+}
+
+// UsageMeterFrom returns the meter of ctx, or nil if it has none.
+func UsageMeterFrom(ctx context.Context) *UsageMeter {
+	meter, _ := ctx.Value(usageMeterKey{}).(*UsageMeter)
+	return meter
+}
+
+// recordUsage is called by backends with the token counts reported for a call.
+func recordUsage(ctx context.Context, promptTokens, responseTokens int) {
+	UsageMeterFrom(ctx).Add(Usage{Calls: 1, PromptTokens: promptTokens, ResponseTokens: responseTokens})
+}
+
+// metered runs one LLM call, logging its token usage and adding it to the meter of ctx, if any.
+func (a *DebugAgent) metered(ctx context.Context, purpose string, call func(ctx context.Context) error) error {
+	meter := &UsageMeter{}
+	err := call(WithUsageMeter(ctx, meter))
+	usage := meter.Total()
+	a.logger.Debug("LLM call",
+		zap.String("purpose", purpose),
+		zap.String("model", a.model),
+		zap.Int("prompt_tokens", usage.PromptTokens),
+		zap.Int("response_tokens", usage.ResponseTokens))
+	UsageMeterFrom(ctx).Add(usage)
+	return err
+}
+
+// Pricing is the price of a model in USD per million tokens.
+type Pricing struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// Cost returns the estimated cost of usage in USD.
+func (p Pricing) Cost(u Usage) float64 {
+	return (float64(u.PromptTokens)*p.InputPerMillion + float64(u.ResponseTokens)*p.OutputPerMillion) / 1e6
+}
+
+// IsZero reports whether the price is unknown.
+func (p Pricing) IsZero() bool {
+	return p.InputPerMillion == 0 && p.OutputPerMillion == 0
+}
+
+// defaultPricing lists standard list prices of common models, by model name prefix (longest match wins).
+var defaultPricing = map[string]Pricing{
+	"gemini-2.5-pro":        {InputPerMillion: 1.25, OutputPerMillion: 10},
+	"gemini-2.5-flash":      {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+	"gemini-2.5-flash-lite": {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	"gemini-2.0-flash":      {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	"gemini-2.0-flash-lite": {InputPerMillion: 0.075, OutputPerMillion: 0.30},
+}
+
+// DefaultPricing returns the list price of a known model, or zero Pricing if it is unknown.
+func DefaultPricing(model string) Pricing {
+	var best string
+	for prefix := range defaultPricing {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	return defaultPricing[best]
+}
@@ -0,0 +1,147 @@
+// Package approval keeps requests to run commands that change Cloud Run state, e.g. a rollback,
+// until a user other than the requester approves or rejects them.
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/firestore"
+)
+
+// Request is a command waiting for approval.
+type Request struct {
+	ID        string
+	Command   string    // Command to run once approved, e.g. rollback
+	Resource  string    // Target resource as project:type:name
+	Argument  string    // Argument of the command, e.g. the revision to roll back to
+	Requester string    // Slack user ID of the requester
+	Channel   string    // Slack channel the request was made in
+	MessageTS string    // Timestamp of the message with the Approve and Reject buttons
+	CreatedAt time.Time // When the request was made
+	ExpiresAt time.Time // When the request can no longer be approved
+}
+
+// Store persists pending requests by ID. Get returns false if the request does not exist.
+// Take removes the request and returns it, or false if it does not exist, e.g. because it was
+// decided in the meantime; only one of concurrent callers gets the request, so it is decided once.
+type Store interface {
+	Get(ctx context.Context, id string) (Request, bool, error)
+	Put(ctx context.Context, req Request) error
+	Take(ctx context.Context, id string) (Request, bool, error)
+}
+
+// NewStore creates a store for kind: "memory" (or empty) for an in-process store that is lost on restart,
+// or "firestore" for the collection in the (default) Firestore database of projectID.
+func NewStore(ctx context.Context, kind, projectID, collection string) (Store, error) {
+	useFirestore, err := firestore.UseFirestore(kind, projectID, "approval")
+	if err != nil {
+		return nil, err
+	}
+	if !useFirestore {
+		return NewMapStore(), nil
+	}
+	return NewFirestoreStore(ctx, projectID, firestore.DefaultDatabase, collection)
+}
+
+// Approvals creates pending requests that expire timeout after they were made.
+type Approvals struct {
+	store   Store
+	timeout time.Duration
+	now     func() time.Time
+}
+
+func New(store Store, timeout time.Duration) *Approvals {
+	return &Approvals{store: store, timeout: timeout, now: time.Now}
+}
+
+// NewRequest returns a request with a new ID, which is saved with Put once its message is posted.
+func (a *Approvals) NewRequest(command, resource, argument, requester, channel string) (Request, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return Request{}, fmt.Errorf("failed to generate request ID: %w", err)
+	}
+	now := a.now()
+	return Request{
+		ID:        hex.EncodeToString(b),
+		Command:   command,
+		Resource:  resource,
+		Argument:  argument,
+		Requester: requester,
+		Channel:   channel,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.timeout),
+	}, nil
+}
+
+// Put saves a pending request.
+func (a *Approvals) Put(ctx context.Context, req Request) error {
+	if err := a.store.Put(ctx, req); err != nil {
+		return fmt.Errorf("failed to save approval request %s: %w", req.ID, err)
+	}
+	return nil
+}
+
+// Get returns a pending request, which may have expired.
+func (a *Approvals) Get(ctx context.Context, id string) (Request, bool, error) {
+	req, ok, err := a.store.Get(ctx, id)
+	if err != nil {
+		return Request{}, false, fmt.Errorf("failed to get approval request %s: %w", id, err)
+	}
+	return req, ok, nil
+}
+
+// Take removes a pending request to decide on it. It returns false if the request was already decided.
+func (a *Approvals) Take(ctx context.Context, id string) (Request, bool, error) {
+	req, ok, err := a.store.Take(ctx, id)
+	if err != nil {
+		return Request{}, false, fmt.Errorf("failed to take approval request %s: %w", id, err)
+	}
+	return req, ok, nil
+}
+
+// Expired reports whether a request can no longer be approved.
+func (a *Approvals) Expired(req Request) bool {
+	return !a.now().Before(req.ExpiresAt)
+}
+
+// Timeout returns how long requests wait for approval.
+func (a *Approvals) Timeout() time.Duration {
+	return a.timeout
+}
+
+// MapStore keeps requests in process memory.
+type MapStore struct {
+	mu       sync.Mutex
+	requests map[string]Request
+}
+
+func NewMapStore() *MapStore {
+	return &MapStore{requests: make(map[string]Request)}
+}
+
+func (s *MapStore) Get(_ context.Context, id string) (Request, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok := s.requests[id]
+	return req, ok, nil
+}
+
+func (s *MapStore) Put(_ context.Context, req Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[req.ID] = req
+	return nil
+}
+
+func (s *MapStore) Take(_ context.Context, id string) (Request, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, ok := s.requests[id]
+	delete(s.requests, id)
+	return req, ok, nil
+}
@@ -0,0 +1,154 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	firestore "google.golang.org/api/firestore/v1"
+	"google.golang.org/api/option"
+)
+
+func TestApprovals(t *testing.T) {
+	ctx := context.Background()
+	a := New(NewMapStore(), 30*time.Minute)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	req, err := a.NewRequest("rollback", "p1:service:web", "web-00001-abc", "U1", "C1")
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	if len(req.ID) != 32 || !req.ExpiresAt.Equal(now.Add(30*time.Minute)) {
+		t.Errorf("NewRequest() = %+v", req)
+	}
+	other, _ := a.NewRequest("rollback", "p1:service:web", "web-00001-abc", "U1", "C1")
+	if other.ID == req.ID {
+		t.Error("Expected requests to get different IDs")
+	}
+
+	if _, ok, err := a.Get(ctx, req.ID); ok || err != nil {
+		t.Fatalf("Get() = %v, %v before Put", ok, err)
+	}
+	req.MessageTS = "1700000000.000100"
+	if err := a.Put(ctx, req); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got, ok, _ := a.Get(ctx, req.ID); !ok || got != req {
+		t.Errorf("Get() = %+v, %v, want %+v", got, ok, req)
+	}
+
+	if a.Expired(req) {
+		t.Error("Expected the request not to have expired yet")
+	}
+	now = now.Add(30 * time.Minute)
+	if !a.Expired(req) {
+		t.Error("Expected the request to expire after the timeout")
+	}
+
+	// A request is decided once
+	if got, ok, err := a.Take(ctx, req.ID); !ok || err != nil || got.ID != req.ID {
+		t.Fatalf("Take() = %+v, %v, %v", got, ok, err)
+	}
+	if _, ok, _ := a.Take(ctx, req.ID); ok {
+		t.Error("Expected the request to be taken only once")
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		kind      string
+		projectID string
+		wantErr   bool
+	}{
+		{kind: ""},
+		{kind: "memory"},
+		{kind: "firestore", wantErr: true},
+		{kind: "redis", projectID: "p1", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := NewStore(context.Background(), tt.kind, tt.projectID, "approvals")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewStore(%q) error = %v, wantErr %v", tt.kind, err, tt.wantErr)
+		}
+	}
+}
+
+// fakeFirestore serves the document Get, Patch and Delete methods of the Firestore REST API.
+func fakeFirestore(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	docs := make(map[string]*firestore.Document)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		name := strings.TrimPrefix(r.URL.Path, "/v1/")
+		switch r.Method {
+		case http.MethodGet:
+			doc, ok := docs[name]
+			if !ok {
+				http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(doc)
+		case http.MethodPatch:
+			var doc firestore.Document
+			if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+				t.Errorf("Failed to decode document: %v", err)
+			}
+			doc.Name = name
+			docs[name] = &doc
+			_ = json.NewEncoder(w).Encode(doc)
+		case http.MethodDelete:
+			if _, ok := docs[name]; !ok && r.URL.Query().Get("currentDocument.exists") == "true" {
+				http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+				return
+			}
+			delete(docs, name)
+			_, _ = w.Write([]byte("{}"))
+		}
+	}))
+}
+
+func TestFirestoreStore(t *testing.T) {
+	server := fakeFirestore(t)
+	defer server.Close()
+
+	ctx := context.Background()
+	store, err := NewFirestoreStore(ctx, "p1", "(default)", "approvals", option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewFirestoreStore failed: %v", err)
+	}
+
+	if _, ok, err := store.Get(ctx, "r1"); ok || err != nil {
+		t.Fatalf("Get() = %v, %v for a missing document", ok, err)
+	}
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := Request{
+		ID: "r1", Command: "rollback", Resource: "p1:service:web", Argument: "web-00001-abc",
+		Requester: "U1", Channel: "C1", MessageTS: "1700000000.000100", CreatedAt: created, ExpiresAt: created.Add(time.Hour),
+	}
+	if err := store.Put(ctx, want); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	got, ok, err := store.Get(ctx, "r1")
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v", ok, err)
+	}
+	if got.Command != want.Command || got.Resource != want.Resource || got.Argument != want.Argument || got.Requester != want.Requester ||
+		got.Channel != want.Channel || got.MessageTS != want.MessageTS || !got.CreatedAt.Equal(want.CreatedAt) || !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+
+	if got, ok, err := store.Take(ctx, "r1"); err != nil || !ok || got.Argument != want.Argument {
+		t.Fatalf("Take() = %+v, %v, %v", got, ok, err)
+	}
+	if _, ok, err := store.Take(ctx, "r1"); ok || err != nil {
+		t.Errorf("Take() = %v, %v, want the request to be taken only once", ok, err)
+	}
+}
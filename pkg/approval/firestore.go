@@ -0,0 +1,72 @@
+package approval
+
+import (
+	"context"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/firestore"
+	"google.golang.org/api/option"
+)
+
+// FirestoreStore keeps requests as documents of a Firestore collection, so that they survive restarts, e.g. when
+// Cloud Run scales the bot to zero before a request is approved, and are shared between instances. Documents have
+// an expiresAt timestamp, which a Firestore TTL policy can use to delete requests nobody decided on.
+type FirestoreStore struct {
+	collection *firestore.Collection
+}
+
+func NewFirestoreStore(ctx context.Context, projectID, database, collection string, opts ...option.ClientOption) (*FirestoreStore, error) {
+	c, err := firestore.NewCollection(ctx, projectID, database, collection, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &FirestoreStore{collection: c}, nil
+}
+
+func (s *FirestoreStore) Get(ctx context.Context, id string) (Request, bool, error) {
+	doc, ok, err := s.collection.Get(ctx, id)
+	if err != nil || !ok {
+		return Request{}, false, err
+	}
+	req := Request{
+		ID:        id,
+		Command:   doc.String("command"),
+		Resource:  doc.String("resource"),
+		Argument:  doc.String("argument"),
+		Requester: doc.String("requester"),
+		Channel:   doc.String("channel"),
+		MessageTS: doc.String("messageTs"),
+	}
+	if req.CreatedAt, err = doc.Timestamp("createdAt"); err != nil {
+		return Request{}, false, err
+	}
+	if req.ExpiresAt, err = doc.Timestamp("expiresAt"); err != nil {
+		return Request{}, false, err
+	}
+	return req, true, nil
+}
+
+func (s *FirestoreStore) Put(ctx context.Context, req Request) error {
+	return s.collection.Set(ctx, req.ID, firestore.Document{
+		"command":   firestore.StringValue(req.Command),
+		"resource":  firestore.StringValue(req.Resource),
+		"argument":  firestore.StringValue(req.Argument),
+		"requester": firestore.StringValue(req.Requester),
+		"channel":   firestore.StringValue(req.Channel),
+		"messageTs": firestore.StringValue(req.MessageTS),
+		"createdAt": firestore.TimestampValue(req.CreatedAt),
+		"expiresAt": firestore.TimestampValue(req.ExpiresAt),
+	})
+}
+
+// Take deletes the document on the condition that it still exists, so that only one of concurrent callers,
+// possibly on different instances, succeeds.
+func (s *FirestoreStore) Take(ctx context.Context, id string) (Request, bool, error) {
+	req, ok, err := s.Get(ctx, id)
+	if err != nil || !ok {
+		return Request{}, false, err
+	}
+	if ok, err := s.collection.DeleteExisting(ctx, id); err != nil || !ok {
+		return Request{}, false, err
+	}
+	return req, true, nil
+}
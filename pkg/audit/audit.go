@@ -0,0 +1,201 @@
+// Package audit records the commands and actions run through the bot, so that it is possible to tell who ran what from Slack.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// maxRecent is the number of events kept per channel for the audit command.
+const maxRecent = 100
+
+// Outcome is how a command ended.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeDenied  Outcome = "denied" // Rejected by access control
+	OutcomeError   Outcome = "error"
+)
+
+// Call is an API call made while running a command.
+type Call struct {
+	Method string `json:"method"`           // e.g. cloudrun.GetService
+	Target string `json:"target,omitempty"` // e.g. the service name
+}
+
+// Event is a command or interaction run by a Slack user.
+type Event struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Channel   string    `json:"channel"`
+	Command   string    `json:"command"`
+	Projects  []string  `json:"projects,omitempty"`
+	Resource  string    `json:"resource,omitempty"` // Target resource as project:type:name
+	Calls     []Call    `json:"calls,omitempty"`
+	Outcome   Outcome   `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latencyMs"`
+}
+
+// recording is an event being filled in while its command runs.
+type recording struct {
+	mu     sync.Mutex
+	event  Event
+	denied bool
+}
+
+type recordingKey struct{}
+
+// Start begins recording a command and returns a context that carries it. Pass the context to Finish once the command is done.
+func Start(ctx context.Context, user, channel, command string) context.Context {
+	r := &recording{event: Event{Time: time.Now(), User: user, Channel: channel, Command: command}}
+	return context.WithValue(ctx, recordingKey{}, r)
+}
+
+func recordingFrom(ctx context.Context) *recording {
+	r, _ := ctx.Value(recordingKey{}).(*recording)
+	return r
+}
+
+// SetCommand sets the command and the projects it acts on, once they are known.
+func SetCommand(ctx context.Context, command string, projects []string) {
+	if r := recordingFrom(ctx); r != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.event.Command = command
+		r.event.Projects = projects
+	}
+}
+
+// SetResource sets the resource the command acts on.
+func SetResource(ctx context.Context, resource string) {
+	if r := recordingFrom(ctx); r != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.event.Resource = resource
+	}
+}
+
+// Deny marks the command as rejected by access control.
+func Deny(ctx context.Context) {
+	if r := recordingFrom(ctx); r != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.denied = true
+	}
+}
+
+// RecordCall adds an API call to the command recorded in ctx, if any.
+func RecordCall(ctx context.Context, method, target string) {
+	if r := recordingFrom(ctx); r != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.event.Calls = append(r.event.Calls, Call{Method: method, Target: target})
+	}
+}
+
+// Trail writes audit events to a logger and optionally a JSONL file, and keeps the recent events of each channel.
+// A nil Trail discards events.
+type Trail struct {
+	logger *logger.Logger
+	file   io.Writer // nil if events are only logged
+
+	mu     sync.Mutex
+	now    func() time.Time
+	recent map[string][]Event // channel -> events, oldest first
+}
+
+// NewTrail creates a trail that logs events with logger and, if file is not nil, appends them to it as JSON lines.
+func NewTrail(logger *logger.Logger, file io.Writer) *Trail {
+	return &Trail{logger: logger, file: file, now: time.Now, recent: make(map[string][]Event)}
+}
+
+// Finish completes the event started on ctx with the command's error and writes it.
+func (t *Trail) Finish(ctx context.Context, err error) {
+	r := recordingFrom(ctx)
+	if t == nil || r == nil {
+		return
+	}
+	r.mu.Lock()
+	event := r.event
+	event.Calls = append([]Call(nil), r.event.Calls...)
+	denied := r.denied
+	r.mu.Unlock()
+
+	event.LatencyMs = t.now().Sub(event.Time).Milliseconds()
+	switch {
+	case denied:
+		event.Outcome = OutcomeDenied
+	case err != nil:
+		event.Outcome = OutcomeError
+	default:
+		event.Outcome = OutcomeSuccess
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	t.write(ctx, event)
+}
+
+func (t *Trail) write(ctx context.Context, event Event) {
+	t.logger.WithContext(ctx).Info("Audit event",
+		zap.String("user", event.User),
+		zap.String("channel", event.Channel),
+		zap.String("command", event.Command),
+		zap.Strings("projects", event.Projects),
+		zap.String("resource", event.Resource),
+		zap.Any("calls", event.Calls),
+		zap.String("outcome", string(event.Outcome)),
+		zap.String("error", event.Error),
+		zap.Int64("latency_ms", event.LatencyMs))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := append(t.recent[event.Channel], event)
+	if len(events) > maxRecent {
+		events = events[len(events)-maxRecent:]
+	}
+	t.recent[event.Channel] = events
+
+	if t.file != nil {
+		if err := writeJSONLine(t.file, event); err != nil {
+			t.logger.Warn("Failed to write audit event to file", zap.Error(err))
+		}
+	}
+}
+
+func writeJSONLine(w io.Writer, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Recent returns up to n of the latest events in a channel, newest first.
+// Events are kept in memory, so they only cover this instance since it started.
+func (t *Trail) Recent(channel string, n int) []Event {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := t.recent[channel]
+	if n > len(events) {
+		n = len(events)
+	}
+	recent := make([]Event, 0, n)
+	for i := len(events) - 1; i >= len(events)-n; i-- {
+		recent = append(recent, events[i])
+	}
+	return recent
+}
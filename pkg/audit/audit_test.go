@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestTrail(file io.Writer) (*Trail, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	trail := NewTrail(&logger.Logger{Logger: zap.New(core)}, file)
+	return trail, logs
+}
+
+func TestTrail_Finish(t *testing.T) {
+	tests := []struct {
+		name        string
+		deny        bool
+		err         error
+		wantOutcome Outcome
+	}{
+		{name: "success", wantOutcome: OutcomeSuccess},
+		{name: "error", err: errors.New("not found"), wantOutcome: OutcomeError},
+		{name: "denied", deny: true, wantOutcome: OutcomeDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file bytes.Buffer
+			trail, logs := newTestTrail(&file)
+
+			ctx := Start(context.Background(), "U1", "C1", "select-resource-for-describe")
+			SetCommand(ctx, "describe", []string{"project1"})
+			SetResource(ctx, "project1:service:web")
+			RecordCall(ctx, "cloudrun.GetService", "web")
+			if tt.deny {
+				Deny(ctx)
+			}
+			trail.Finish(ctx, tt.err)
+
+			events := trail.Recent("C1", 10)
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(events))
+			}
+			e := events[0]
+			if e.User != "U1" || e.Command != "describe" || e.Resource != "project1:service:web" || e.Outcome != tt.wantOutcome {
+				t.Errorf("Unexpected event: %+v", e)
+			}
+			if len(e.Calls) != 1 || e.Calls[0] != (Call{Method: "cloudrun.GetService", Target: "web"}) {
+				t.Errorf("Unexpected calls: %+v", e.Calls)
+			}
+			if tt.err != nil && e.Error != tt.err.Error() {
+				t.Errorf("Expected error %q, got %q", tt.err.Error(), e.Error)
+			}
+
+			if logs.Len() != 1 || logs.All()[0].ContextMap()["outcome"] != string(tt.wantOutcome) {
+				t.Errorf("Unexpected log entries: %+v", logs.All())
+			}
+			var logged Event
+			if err := json.Unmarshal(file.Bytes(), &logged); err != nil {
+				t.Fatalf("Failed to parse JSONL: %v", err)
+			}
+			if logged.Command != "describe" || logged.Outcome != tt.wantOutcome {
+				t.Errorf("Unexpected JSONL event: %+v", logged)
+			}
+		})
+	}
+}
+
+func TestTrail_Recent(t *testing.T) {
+	var file bytes.Buffer
+	trail, _ := newTestTrail(&file)
+	for i := 0; i < maxRecent+5; i++ {
+		ctx := Start(context.Background(), "U1", "C1", "describe")
+		trail.Finish(ctx, nil)
+	}
+	trail.Finish(Start(context.Background(), "U2", "C2", "metrics"), nil)
+	trail.Finish(Start(context.Background(), "U1", "C1", "debug"), nil)
+
+	if got := len(trail.Recent("C1", 1000)); got != maxRecent {
+		t.Errorf("Expected %d events kept, got %d", maxRecent, got)
+	}
+	recent := trail.Recent("C1", 2)
+	if len(recent) != 2 || recent[0].Command != "debug" || recent[1].Command != "describe" {
+		t.Errorf("Expected newest events first, got %+v", recent)
+	}
+	if len(trail.Recent("C3", 10)) != 0 {
+		t.Error("Expected no events for another channel")
+	}
+	if lines := strings.Count(file.String(), "\n"); lines != maxRecent+7 {
+		t.Errorf("Expected %d JSONL lines, got %d", maxRecent+7, lines)
+	}
+}
+
+func TestTrail_Latency(t *testing.T) {
+	trail, _ := newTestTrail(nil)
+	ctx := Start(context.Background(), "U1", "C1", "describe")
+	started := recordingFrom(ctx).event.Time
+	trail.now = func() time.Time { return started.Add(1500 * time.Millisecond) }
+	trail.Finish(ctx, nil)
+	if got := trail.Recent("C1", 1)[0].LatencyMs; got != 1500 {
+		t.Errorf("Expected latency 1500ms, got %d", got)
+	}
+}
+
+func TestNoRecording(t *testing.T) {
+	// Calls outside a recorded command, e.g. from background jobs, are ignored
+	ctx := context.Background()
+	RecordCall(ctx, "cloudrun.GetService", "web")
+	SetCommand(ctx, "describe", nil)
+	SetResource(ctx, "project1:service:web")
+	Deny(ctx)
+
+	var trail *Trail
+	trail.Finish(Start(ctx, "U1", "C1", "describe"), nil)
+	if trail.Recent("C1", 10) != nil {
+		t.Error("Expected nil trail to have no events")
+	}
+}
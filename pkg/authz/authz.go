@@ -0,0 +1,290 @@
+// Package authz decides which bot commands a Slack user may run, based on roles granted per project and channel.
+package authz
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Role is a level of access. Each role includes the permissions of the roles below it.
+type Role int
+
+const (
+	RoleNone     Role = iota // No access
+	RoleViewer               // Read-only commands, e.g. describe and metrics
+	RoleOperator             // Commands that run analyses or act on results, e.g. debug and export
+	RoleAdmin                // All commands
+)
+
+var roleNames = map[Role]string{
+	RoleNone:     "none",
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole parses a role name.
+func ParseRole(name string) (Role, error) {
+	for role, n := range roleNames {
+		if n == name {
+			return role, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q: must be one of viewer, operator, admin, none", name)
+}
+
+// Commands that can be authorized.
+const (
+	CommandHelp       = "help"
+	CommandDescribe   = "describe"
+	CommandMetrics    = "metrics"
+	CommandSet        = "set"
+	CommandSetChannel = "set-channel" // Sets the default resource of a channel
+	CommandSample     = "sample"
+	CommandDebug      = "debug"
+	CommandFollowUp   = "follow-up"
+	CommandCancel     = "cancel"
+	CommandExport     = "export"
+	CommandFeedback   = "feedback"
+	CommandAudit      = "audit"
+	CommandRollback   = "rollback" // Routes all traffic of a service to a revision, once approved
+)
+
+// DefaultCommandRoles are the roles required for each command unless the policy overrides them.
+// Commands not listed require RoleAdmin.
+var DefaultCommandRoles = map[string]Role{
+	CommandHelp:       RoleNone,
+	CommandDescribe:   RoleViewer,
+	CommandMetrics:    RoleViewer,
+	CommandSet:        RoleViewer,
+	CommandSample:     RoleViewer,
+	CommandDebug:      RoleOperator,
+	CommandFollowUp:   RoleOperator,
+	CommandCancel:     RoleOperator,
+	CommandExport:     RoleOperator,
+	CommandFeedback:   RoleViewer,
+	CommandAudit:      RoleOperator,
+	CommandSetChannel: RoleOperator,
+	CommandRollback:   RoleAdmin,
+}
+
+// Grant gives a role to users and members of user groups, optionally limited to a project and/or channel.
+type Grant struct {
+	Project string   `json:"project,omitempty"` // GCP project ID (empty for all projects)
+	Channel string   `json:"channel,omitempty"` // Slack channel ID (empty for all channels)
+	Users   []string `json:"users,omitempty"`   // Slack user IDs
+	Groups  []string `json:"groups,omitempty"`  // Slack user group IDs
+	Role    string   `json:"role"`
+
+	role Role
+}
+
+// Approvers are the users and members of user groups who may approve requests of other users.
+type Approvers struct {
+	Users  []string `json:"users,omitempty"`  // Slack user IDs
+	Groups []string `json:"groups,omitempty"` // Slack user group IDs
+}
+
+// Policy is the access control configuration, e.g. from the RBAC_CONFIG environment variable.
+type Policy struct {
+	DefaultRole string            `json:"defaultRole,omitempty"` // Role of users without a grant (default "none")
+	Commands    map[string]string `json:"commands,omitempty"`    // Required role by command, overriding DefaultCommandRoles
+	Grants      []Grant           `json:"grants"`
+	Approvers   *Approvers        `json:"approvers,omitempty"` // Users who may approve commands that change Cloud Run state, in the projects they may run them
+
+	defaultRole  Role
+	commandRoles map[string]Role
+}
+
+// Validate checks the role names of the policy and resolves them.
+func (p *Policy) Validate() error {
+	var err error
+	p.defaultRole = RoleNone
+	if p.DefaultRole != "" {
+		if p.defaultRole, err = ParseRole(p.DefaultRole); err != nil {
+			return fmt.Errorf("defaultRole: %w", err)
+		}
+	}
+	p.commandRoles = make(map[string]Role, len(DefaultCommandRoles)+len(p.Commands))
+	for command, role := range DefaultCommandRoles {
+		p.commandRoles[command] = role
+	}
+	for command, name := range p.Commands {
+		if p.commandRoles[command], err = ParseRole(name); err != nil {
+			return fmt.Errorf("command %s: %w", command, err)
+		}
+	}
+	if p.Approvers != nil && len(p.Approvers.Users) == 0 && len(p.Approvers.Groups) == 0 {
+		return fmt.Errorf("approvers: at least one user or group is required")
+	}
+	for i := range p.Grants {
+		g := &p.Grants[i]
+		if len(g.Users) == 0 && len(g.Groups) == 0 {
+			return fmt.Errorf("grant %d: at least one user or group is required", i)
+		}
+		if g.role, err = ParseRole(g.Role); err != nil {
+			return fmt.Errorf("grant %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// requiredRole returns the role required for a command.
+func (p *Policy) requiredRole(command string) Role {
+	if role, ok := p.commandRoles[command]; ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// GroupResolver returns the members of a Slack user group.
+type GroupResolver interface {
+	GroupMembers(ctx context.Context, groupID string) ([]string, error)
+}
+
+// groupCacheTTL is how long user group memberships are reused.
+const groupCacheTTL = 5 * time.Minute
+
+type cachedGroup struct {
+	members   []string
+	fetchedAt time.Time
+}
+
+// Authorizer checks requests against a policy.
+type Authorizer struct {
+	policy *Policy
+	groups GroupResolver // nil if grants only name users
+
+	mu    sync.Mutex
+	now   func() time.Time
+	cache map[string]cachedGroup
+}
+
+// New creates an authorizer for a validated policy.
+func New(policy *Policy, groups GroupResolver) *Authorizer {
+	return &Authorizer{policy: policy, groups: groups, now: time.Now, cache: make(map[string]cachedGroup)}
+}
+
+// Request is a command a user wants to run.
+type Request struct {
+	UserID    string
+	ChannelID string
+	Command   string
+	Projects  []string // Projects the command acts on; grants for other projects do not apply
+}
+
+// Decision is the outcome of an authorization check.
+type Decision struct {
+	Allowed  bool
+	Role     Role // Role of the user for the request
+	Required Role // Role required for the command
+}
+
+// Authorize decides whether the request is allowed. The user's role is the highest role granted for the
+// channel and every project of the request. Failing to resolve a user group denies rather than allows.
+func (a *Authorizer) Authorize(ctx context.Context, req Request) (Decision, error) {
+	required := a.policy.requiredRole(req.Command)
+	role, err := a.role(ctx, req)
+	return Decision{Allowed: role >= required, Role: role, Required: required}, err
+}
+
+// HasApprovers reports whether the policy names approvers. Without approvers, requests cannot be approved.
+func (a *Authorizer) HasApprovers() bool {
+	return a.policy.Approvers != nil
+}
+
+// IsApprover reports whether the user may approve the request of another user: the user must be an approver and
+// also be allowed to run the command in the channel and projects of the request, so that approvers of one project
+// cannot approve changes to another. Failing to resolve a user group denies rather than allows.
+func (a *Authorizer) IsApprover(ctx context.Context, req Request) (bool, error) {
+	if a.policy.Approvers == nil {
+		return false, nil
+	}
+	approver, err := a.isMember(ctx, Grant{Users: a.policy.Approvers.Users, Groups: a.policy.Approvers.Groups}, req.UserID)
+	if err != nil || !approver {
+		return false, err
+	}
+	decision, err := a.Authorize(ctx, req)
+	return decision.Allowed, err
+}
+
+func (a *Authorizer) role(ctx context.Context, req Request) (Role, error) {
+	projects := req.Projects
+	if len(projects) == 0 {
+		projects = []string{""}
+	}
+	// The user needs the role in every project the command touches
+	role := RoleAdmin
+	for _, project := range projects {
+		r, err := a.projectRole(ctx, req.UserID, req.ChannelID, project)
+		if err != nil {
+			return RoleNone, err
+		}
+		role = min(role, r)
+	}
+	return role, nil
+}
+
+func (a *Authorizer) projectRole(ctx context.Context, userID, channelID, project string) (Role, error) {
+	role := a.policy.defaultRole
+	for _, g := range a.policy.Grants {
+		if g.role <= role || (g.Channel != "" && g.Channel != channelID) || (g.Project != "" && g.Project != project) {
+			continue
+		}
+		member, err := a.isMember(ctx, g, userID)
+		if err != nil {
+			return RoleNone, err
+		}
+		if member {
+			role = g.role
+		}
+	}
+	return role, nil
+}
+
+func (a *Authorizer) isMember(ctx context.Context, g Grant, userID string) (bool, error) {
+	if slices.Contains(g.Users, userID) {
+		return true, nil
+	}
+	for _, group := range g.Groups {
+		members, err := a.groupMembers(ctx, group)
+		if err != nil {
+			return false, err
+		}
+		if slices.Contains(members, userID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (a *Authorizer) groupMembers(ctx context.Context, groupID string) ([]string, error) {
+	if a.groups == nil {
+		return nil, fmt.Errorf("user group %s cannot be resolved", groupID)
+	}
+	a.mu.Lock()
+	cached, ok := a.cache[groupID]
+	a.mu.Unlock()
+	if ok && a.now().Sub(cached.fetchedAt) < groupCacheTTL {
+		return cached.members, nil
+	}
+
+	members, err := a.groups.GroupMembers(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of user group %s: %w", groupID, err)
+	}
+	a.mu.Lock()
+	a.cache[groupID] = cachedGroup{members: members, fetchedAt: a.now()}
+	a.mu.Unlock()
+	return members, nil
+}
@@ -0,0 +1,188 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeGroups struct {
+	members map[string][]string
+	calls   int
+	err     error
+}
+
+func (f *fakeGroups) GroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	f.calls++
+	return f.members[groupID], f.err
+}
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []Role{RoleNone, RoleViewer, RoleOperator, RoleAdmin} {
+		got, err := ParseRole(role.String())
+		if err != nil || got != role {
+			t.Errorf("ParseRole(%q) = %v, %v, want %v", role.String(), got, err, role)
+		}
+	}
+	if _, err := ParseRole("owner"); err == nil {
+		t.Error("Expected error for unknown role")
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "empty", policy: Policy{}},
+		{name: "valid", policy: Policy{DefaultRole: "viewer", Commands: map[string]string{CommandDebug: "admin"}, Grants: []Grant{{Users: []string{"U1"}, Role: "operator"}}}},
+		{name: "invalid default role", policy: Policy{DefaultRole: "owner"}, wantErr: true},
+		{name: "invalid command role", policy: Policy{Commands: map[string]string{CommandDebug: "owner"}}, wantErr: true},
+		{name: "invalid grant role", policy: Policy{Grants: []Grant{{Users: []string{"U1"}, Role: "owner"}}}, wantErr: true},
+		{name: "grant without members", policy: Policy{Grants: []Grant{{Role: "viewer"}}}, wantErr: true},
+		{name: "approvers", policy: Policy{Approvers: &Approvers{Groups: []string{"S1"}}}},
+		{name: "approvers without members", policy: Policy{Approvers: &Approvers{}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	policy := &Policy{
+		DefaultRole: "viewer",
+		Commands:    map[string]string{CommandExport: "admin"},
+		Grants: []Grant{
+			{Project: "prod", Users: []string{"U1"}, Role: "operator"},
+			{Project: "dev", Groups: []string{"S1"}, Role: "operator"},
+			{Channel: "C-ops", Users: []string{"U2"}, Role: "admin"},
+		},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	groups := &fakeGroups{members: map[string][]string{"S1": {"U1", "U3"}}}
+	a := New(policy, groups)
+
+	tests := []struct {
+		name     string
+		req      Request
+		allowed  bool
+		wantRole Role
+	}{
+		{name: "default role runs viewer command", req: Request{UserID: "U9", Command: CommandDescribe, Projects: []string{"prod"}}, allowed: true, wantRole: RoleViewer},
+		{name: "default role cannot debug", req: Request{UserID: "U9", Command: CommandDebug, Projects: []string{"prod"}}, allowed: false, wantRole: RoleViewer},
+		{name: "project grant", req: Request{UserID: "U1", Command: CommandDebug, Projects: []string{"prod"}}, allowed: true, wantRole: RoleOperator},
+		{name: "project grant does not apply to other projects", req: Request{UserID: "U3", Command: CommandDebug, Projects: []string{"prod"}}, allowed: false, wantRole: RoleViewer},
+		{name: "group grant", req: Request{UserID: "U3", Command: CommandDebug, Projects: []string{"dev"}}, allowed: true, wantRole: RoleOperator},
+		{name: "role is the lowest across projects", req: Request{UserID: "U3", Command: CommandDebug, Projects: []string{"dev", "prod"}}, allowed: false, wantRole: RoleViewer},
+		{name: "grant in both projects", req: Request{UserID: "U1", Command: CommandDebug, Projects: []string{"dev", "prod"}}, allowed: true, wantRole: RoleOperator},
+		{name: "command override", req: Request{UserID: "U1", Command: CommandExport, Projects: []string{"prod"}}, allowed: false, wantRole: RoleOperator},
+		{name: "channel grant", req: Request{UserID: "U2", ChannelID: "C-ops", Command: CommandExport, Projects: []string{"prod"}}, allowed: true, wantRole: RoleAdmin},
+		{name: "channel grant does not apply to other channels", req: Request{UserID: "U2", ChannelID: "C-dev", Command: CommandExport, Projects: []string{"prod"}}, allowed: false, wantRole: RoleViewer},
+		{name: "unknown command requires admin", req: Request{UserID: "U1", Command: "reboot", Projects: []string{"prod"}}, allowed: false, wantRole: RoleOperator},
+		{name: "no projects only matches grants for all projects", req: Request{UserID: "U1", Command: CommandHelp}, allowed: true, wantRole: RoleViewer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := a.Authorize(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Authorize failed: %v", err)
+			}
+			if decision.Allowed != tt.allowed || decision.Role != tt.wantRole {
+				t.Errorf("Authorize() = %+v, want allowed %v with role %v", decision, tt.allowed, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestAuthorize_GroupCache(t *testing.T) {
+	policy := &Policy{Grants: []Grant{{Groups: []string{"S1"}, Role: "operator"}}}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	groups := &fakeGroups{members: map[string][]string{"S1": {"U1"}}}
+	a := New(policy, groups)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	req := Request{UserID: "U1", Command: CommandDebug, Projects: []string{"prod"}}
+	for i := 0; i < 2; i++ {
+		if decision, err := a.Authorize(context.Background(), req); err != nil || !decision.Allowed {
+			t.Fatalf("Authorize() = %+v, %v, want allowed", decision, err)
+		}
+	}
+	if groups.calls != 1 {
+		t.Errorf("Expected group members to be cached, got %d calls", groups.calls)
+	}
+
+	now = now.Add(groupCacheTTL + time.Second)
+	if _, err := a.Authorize(context.Background(), req); err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	if groups.calls != 2 {
+		t.Errorf("Expected group members to be fetched again after TTL, got %d calls", groups.calls)
+	}
+}
+
+func TestAuthorize_GroupError(t *testing.T) {
+	policy := &Policy{DefaultRole: "viewer", Grants: []Grant{{Groups: []string{"S1"}, Role: "operator"}}}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	a := New(policy, &fakeGroups{err: errors.New("missing_scope")})
+
+	decision, err := a.Authorize(context.Background(), Request{UserID: "U1", Command: CommandDescribe, Projects: []string{"prod"}})
+	if err == nil || decision.Allowed {
+		t.Errorf("Authorize() = %+v, %v, want denied with error", decision, err)
+	}
+}
+
+func TestIsApprover(t *testing.T) {
+	policy := &Policy{
+		Grants: []Grant{
+			{Users: []string{"U1", "U3"}, Role: "admin"},
+			{Project: "prod", Groups: []string{"S1"}, Role: "admin"},
+		},
+		Approvers: &Approvers{Users: []string{"U1"}, Groups: []string{"S1"}},
+	}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	a := New(policy, &fakeGroups{members: map[string][]string{"S1": {"U2"}}})
+	if !a.HasApprovers() {
+		t.Error("Expected the policy to have approvers")
+	}
+	tests := []struct {
+		user    string
+		project string
+		want    bool
+	}{
+		{user: "U1", project: "prod", want: true},
+		{user: "U1", project: "dev", want: true},
+		{user: "U2", project: "prod", want: true},
+		{user: "U2", project: "dev", want: false},  // An approver without the role in the project
+		{user: "U3", project: "prod", want: false}, // An admin who is not an approver
+	}
+	for _, tt := range tests {
+		req := Request{UserID: tt.user, ChannelID: "C1", Command: CommandRollback, Projects: []string{tt.project}}
+		if got, err := a.IsApprover(context.Background(), req); err != nil || got != tt.want {
+			t.Errorf("IsApprover(%s, %s) = %v, %v, want %v", tt.user, tt.project, got, err, tt.want)
+		}
+	}
+
+	noApprovers := New(&Policy{}, nil)
+	if noApprovers.HasApprovers() {
+		t.Error("Expected a policy without approvers")
+	}
+	if got, err := noApprovers.IsApprover(context.Background(), Request{UserID: "U1", Command: CommandRollback}); got || err != nil {
+		t.Errorf("IsApprover() = %v, %v without approvers", got, err)
+	}
+}
@@ -3,9 +3,12 @@ package cloudrun
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/trace"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -19,6 +22,7 @@ type Client struct {
 	runService                   *run.Service
 	projectLocationServiceClient *run.ProjectsLocationsServicesService
 	projectLocationJobClient     *run.ProjectsLocationsJobsService
+	revisionClient               *run.ProjectsLocationsServicesRevisionsService
 	logger                       *zap.Logger
 }
 
@@ -33,6 +37,15 @@ type CloudRunService struct {
 	ResourceLimits map[string]string
 }
 
+// CloudRunRevision is a revision of a Cloud Run service.
+type CloudRunRevision struct {
+	Name       string
+	Service    string
+	Image      string
+	Creator    string
+	CreateTime time.Time
+}
+
 type CloudRunJob struct {
 	Name         string
 	Region       string
@@ -57,6 +70,23 @@ func (c *CloudRunService) getUrl(urlPath string) string {
 	return fmt.Sprintf("https://console.cloud.google.com/run/detail/%s/%s/%s?project=%s", c.Region, c.Name, urlPath, c.Project)
 }
 
+// ParseServiceUrl returns the project, region and name of the service of a console URL such as those of getUrl.
+func ParseServiceUrl(rawUrl string) (project, region, name string, err error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", "", "", err
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if u.Host != "console.cloud.google.com" || len(parts) < 4 || parts[0] != "run" || parts[1] != "detail" {
+		return "", "", "", fmt.Errorf("not a Cloud Run service URL: %s", rawUrl)
+	}
+	project = u.Query().Get("project")
+	if project == "" {
+		return "", "", "", fmt.Errorf("no project in Cloud Run service URL: %s", rawUrl)
+	}
+	return project, parts[2], parts[3], nil
+}
+
 func (c *CloudRunService) String() string {
 	return fmt.Sprintf(
 		"Name: %s\n- LatestRevision: %s\n- Image: %s\n- LastModifier: %s\n- UpdateTime: %s\n- Resource Limit: (cpu:%s, memory:%s)\n",
@@ -100,12 +130,14 @@ func NewClient(ctx context.Context, project, region string, logger *zap.Logger)
 	}
 	plSvc := run.NewProjectsLocationsServicesService(runService)
 	plJobSvc := run.NewProjectsLocationsJobsService(runService)
+	revSvc := run.NewProjectsLocationsServicesRevisionsService(runService)
 	return &Client{
 		project:                      project,
 		region:                       region,
 		runService:                   runService,
 		projectLocationServiceClient: plSvc,
 		projectLocationJobClient:     plJobSvc,
+		revisionClient:               revSvc,
 		logger:                       logger,
 	}, nil
 }
@@ -119,6 +151,7 @@ func (c *Client) Close() error {
 func (c *Client) ListServices(ctx context.Context) ([]string, error) {
 	ctx, span := trace.GetTracer().Start(ctx, "cloudrun.ListServices")
 	defer span.End()
+	audit.RecordCall(ctx, "cloudrun.ListServices", c.project)
 
 	span.SetAttributes(
 		attribute.String("cloudrun.project", c.project),
@@ -145,6 +178,7 @@ func (c *Client) ListServices(ctx context.Context) ([]string, error) {
 func (c *Client) ListJobs(ctx context.Context) ([]string, error) {
 	ctx, span := trace.GetTracer().Start(ctx, "cloudrun.ListJobs")
 	defer span.End()
+	audit.RecordCall(ctx, "cloudrun.ListJobs", c.project)
 
 	span.SetAttributes(
 		attribute.String("cloudrun.project", c.project),
@@ -171,6 +205,7 @@ func (c *Client) ListJobs(ctx context.Context) ([]string, error) {
 func (c *Client) GetService(ctx context.Context, serviceName string) (*CloudRunService, error) {
 	ctx, span := trace.GetTracer().Start(ctx, "cloudrun.GetService")
 	defer span.End()
+	audit.RecordCall(ctx, "cloudrun.GetService", serviceName)
 
 	span.SetAttributes(
 		attribute.String("cloudrun.project", c.project),
@@ -216,6 +251,7 @@ func (c *Client) GetService(ctx context.Context, serviceName string) (*CloudRunS
 func (c *Client) GetJob(ctx context.Context, jobName string) (*CloudRunJob, error) {
 	ctx, span := trace.GetTracer().Start(ctx, "cloudrun.GetJob")
 	defer span.End()
+	audit.RecordCall(ctx, "cloudrun.GetJob", jobName)
 
 	span.SetAttributes(
 		attribute.String("cloudrun.project", c.project),
@@ -253,3 +289,87 @@ func (c *Client) GetJob(ctx context.Context, jobName string) (*CloudRunJob, erro
 
 	return job, nil
 }
+
+// ListRevisions returns up to limit most recent revisions of a service, newest first.
+func (c *Client) ListRevisions(ctx context.Context, serviceName string, limit int) ([]CloudRunRevision, error) {
+	ctx, span := trace.GetTracer().Start(ctx, "cloudrun.ListRevisions")
+	defer span.End()
+	audit.RecordCall(ctx, "cloudrun.ListRevisions", serviceName)
+
+	span.SetAttributes(
+		attribute.String("cloudrun.project", c.project),
+		attribute.String("cloudrun.region", c.region),
+		attribute.String("cloudrun.service.name", serviceName),
+	)
+
+	parent := fmt.Sprintf("%s/services/%s", c.getProjectLocation(), serviceName)
+	res, err := c.revisionClient.List(parent).Context(ctx).Do()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	revisions := make([]CloudRunRevision, 0, len(res.Revisions))
+	for _, r := range res.Revisions {
+		createTime, err := time.Parse(time.RFC3339Nano, r.CreateTime)
+		if err != nil {
+			c.logger.Warn("Failed to parse revision create time", zap.String("revision", r.Name), zap.Error(err))
+		}
+		rev := CloudRunRevision{
+			Name:       strings.TrimPrefix(r.Name, parent+"/revisions/"),
+			Service:    serviceName,
+			Creator:    r.Creator,
+			CreateTime: createTime,
+		}
+		if len(r.Containers) > 0 {
+			rev.Image = r.Containers[0].Image
+		}
+		revisions = append(revisions, rev)
+	}
+	sortRevisionsNewestFirst(revisions)
+	if limit > 0 && len(revisions) > limit {
+		revisions = revisions[:limit]
+	}
+
+	span.SetAttributes(attribute.Int("cloudrun.revisions.count", len(revisions)))
+	return revisions, nil
+}
+
+// RouteAllTraffic sends all traffic of a service to one of its revisions, e.g. to roll back a deploy.
+// It returns once Cloud Run has accepted the change, which completes in the background.
+func (c *Client) RouteAllTraffic(ctx context.Context, serviceName, revision string) error {
+	ctx, span := trace.GetTracer().Start(ctx, "cloudrun.RouteAllTraffic")
+	defer span.End()
+	audit.RecordCall(ctx, "cloudrun.RouteAllTraffic", serviceName+"@"+revision)
+
+	span.SetAttributes(
+		attribute.String("cloudrun.project", c.project),
+		attribute.String("cloudrun.region", c.region),
+		attribute.String("cloudrun.service.name", serviceName),
+		attribute.String("cloudrun.revision.name", revision),
+	)
+
+	service := &run.GoogleCloudRunV2Service{
+		Traffic: []*run.GoogleCloudRunV2TrafficTarget{{
+			Type:     "TRAFFIC_TARGET_ALLOCATION_TYPE_REVISION",
+			Revision: revision,
+			Percent:  100,
+		}},
+	}
+	name := fmt.Sprintf("%s/services/%s", c.getProjectLocation(), serviceName)
+	op, err := c.projectLocationServiceClient.Patch(name, service).UpdateMask("traffic").Context(ctx).Do()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	c.logger.Info("Routing all traffic to revision", zap.String("service", serviceName), zap.String("revision", revision), zap.String("operation", op.Name))
+	return nil
+}
+
+func sortRevisionsNewestFirst(revisions []CloudRunRevision) {
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].CreateTime.After(revisions[j].CreateTime)
+	})
+}
@@ -2,6 +2,7 @@ package cloudrun
 
 import (
 	"testing"
+	"time"
 )
 
 func TestCloudRunService_GetMetricsUrl(t *testing.T) {
@@ -78,3 +79,73 @@ func TestCloudRunJob_GetYamlUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestSortRevisionsNewestFirst(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	revisions := []CloudRunRevision{
+		{Name: "svc-00001", CreateTime: base},
+		{Name: "svc-00003", CreateTime: base.Add(2 * time.Hour)},
+		{Name: "svc-00002", CreateTime: base.Add(time.Hour)},
+	}
+
+	sortRevisionsNewestFirst(revisions)
+
+	want := []string{"svc-00003", "svc-00002", "svc-00001"}
+	for i, name := range want {
+		if revisions[i].Name != name {
+			t.Errorf("revisions[%d] = %s, want %s", i, revisions[i].Name, name)
+		}
+	}
+}
+
+func TestParseServiceUrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		wantProject string
+		wantRegion  string
+		wantName    string
+		wantErr     bool
+	}{
+		{
+			name:        "metrics",
+			url:         "https://console.cloud.google.com/run/detail/asia-northeast1/test/metrics?project=project",
+			wantProject: "project",
+			wantRegion:  "asia-northeast1",
+			wantName:    "test",
+		},
+		{
+			name:        "service without tab",
+			url:         "https://console.cloud.google.com/run/detail/us-central1/web?project=p1&authuser=1",
+			wantProject: "p1",
+			wantRegion:  "us-central1",
+			wantName:    "web",
+		},
+		{
+			name:    "job",
+			url:     "https://console.cloud.google.com/run/jobs/details/asia-northeast1/my-job/yaml?project=project",
+			wantErr: true,
+		},
+		{
+			name:    "no project",
+			url:     "https://console.cloud.google.com/run/detail/asia-northeast1/test/metrics",
+			wantErr: true,
+		},
+		{
+			name:    "other host",
+			url:     "https://example.com/run/detail/asia-northeast1/test/metrics?project=project",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, region, name, err := ParseServiceUrl(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseServiceUrl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if project != tt.wantProject || region != tt.wantRegion || name != tt.wantName {
+				t.Errorf("ParseServiceUrl() = %v, %v, %v, want %v, %v, %v", project, region, name, tt.wantProject, tt.wantRegion, tt.wantName)
+			}
+		})
+	}
+}
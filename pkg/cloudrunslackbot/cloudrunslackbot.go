@@ -2,6 +2,7 @@ package cloudrunslackbot
 
 import (
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/config"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/deploy"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/logger"
 	slackinternal "github.com/nakamasato/cloud-run-slack-bot/pkg/slack"
 	"github.com/slack-go/slack"
@@ -19,10 +20,11 @@ func NewCloudRunSlackBotService(sClient *slack.Client, channels map[string]strin
 	return NewCloudRunSlackBotHttp(channels, defaultChannel, sClient, handler, signingSecret, log)
 }
 
-// NewMultiProjectCloudRunSlackBotService creates a service for multi-project support
-func NewMultiProjectCloudRunSlackBotService(sClient *slack.Client, cfg *config.Config, handler *slackinternal.MultiProjectSlackEventHandler, log *logger.Logger) CloudRunSlackBotService {
+// NewMultiProjectCloudRunSlackBotService creates a service for multi-project support.
+// Changes to Cloud Run resources received on /cloudrun/events are recorded in deploys (HTTP mode only).
+func NewMultiProjectCloudRunSlackBotService(sClient *slack.Client, cfg *config.Config, handler *slackinternal.MultiProjectSlackEventHandler, deploys *deploy.Log, log *logger.Logger) CloudRunSlackBotService {
 	if cfg.SlackAppMode == "socket" {
 		return NewMultiProjectCloudRunSlackBotSocket(cfg, sClient, handler, log)
 	}
-	return NewMultiProjectCloudRunSlackBotHttp(cfg, sClient, handler, log)
+	return NewMultiProjectCloudRunSlackBotHttp(cfg, sClient, handler, deploys, log)
 }
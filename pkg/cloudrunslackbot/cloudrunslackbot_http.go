@@ -1,11 +1,13 @@
 package cloudrunslackbot
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"net/http"
 
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/config"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/deploy"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/logger"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/pubsub"
 	slackinternal "github.com/nakamasato/cloud-run-slack-bot/pkg/slack"
@@ -57,31 +59,10 @@ func (svc *CloudRunSlackBotHttp) Run() {
 // SlackEventsHandler is http.HandlerFunc for Slack Events API
 func (svc *CloudRunSlackBotHttp) SlackEventsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		logger := svc.logger.WithContext(ctx).With(zap.String("handler", "SlackEventsHandler"))
+		logger := svc.logger.WithContext(r.Context()).With(zap.String("handler", "SlackEventsHandler"))
 
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			logger.Error("Failed to read request body", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		// Verify the request signature
-		sv, err := slack.NewSecretsVerifier(r.Header, svc.signingSecret)
-		if err != nil {
-			logger.Error("Failed to create secrets verifier", zap.Error(err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		if _, err := sv.Write(body); err != nil {
-			logger.Error("Failed to write body to verifier", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		if err := sv.Ensure(); err != nil {
-			logger.Error("Failed to verify request signature", zap.Error(err))
-			w.WriteHeader(http.StatusUnauthorized)
+		body, ok := verifySlackRequest(w, r, svc.signingSecret, logger)
+		if !ok {
 			return
 		}
 
@@ -92,8 +73,6 @@ func (svc *CloudRunSlackBotHttp) SlackEventsHandler() http.HandlerFunc {
 			return
 		}
 
-		_ = ctx // Suppress unused variable warning
-
 		switch eventsAPIEvent.Type {
 		case slackevents.URLVerification:
 			var res *slackevents.ChallengeResponse
@@ -121,8 +100,7 @@ func (svc *CloudRunSlackBotHttp) SlackEventsHandler() http.HandlerFunc {
 
 func (svc *CloudRunSlackBotHttp) SlackInteractionHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		logger := svc.logger.WithContext(ctx).With(zap.String("handler", "SlackInteractionHandler"))
+		logger := svc.logger.WithContext(r.Context()).With(zap.String("handler", "SlackInteractionHandler"))
 
 		payload := r.FormValue("payload")
 		var interaction slack.InteractionCallback
@@ -137,8 +115,6 @@ func (svc *CloudRunSlackBotHttp) SlackInteractionHandler() http.HandlerFunc {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-
-		_ = ctx // Suppress unused variable warning
 	}
 }
 
@@ -151,11 +127,11 @@ type MultiProjectCloudRunSlackBotHttp struct {
 	logger        *logger.Logger
 }
 
-func NewMultiProjectCloudRunSlackBotHttp(cfg *config.Config, sClient *slack.Client, handler *slackinternal.MultiProjectSlackEventHandler, log *logger.Logger) *MultiProjectCloudRunSlackBotHttp {
+func NewMultiProjectCloudRunSlackBotHttp(cfg *config.Config, sClient *slack.Client, handler *slackinternal.MultiProjectSlackEventHandler, deploys *deploy.Log, log *logger.Logger) *MultiProjectCloudRunSlackBotHttp {
 	return &MultiProjectCloudRunSlackBotHttp{
 		client:        sClient,
 		slackHandler:  handler,
-		auditHandler:  pubsub.NewMultiProjectCloudRunAuditLogHandler(cfg, sClient, log),
+		auditHandler:  pubsub.NewMultiProjectCloudRunAuditLogHandler(cfg, sClient, deploys, log),
 		signingSecret: cfg.SlackSigningSecret,
 		logger:        log,
 	}
@@ -171,6 +147,10 @@ func (svc *MultiProjectCloudRunSlackBotHttp) Run() {
 		http.HandlerFunc(svc.SlackInteractionHandler()),
 		"slack-interaction",
 	))
+	http.Handle("/slack/commands", otelhttp.NewHandler(
+		http.HandlerFunc(svc.SlackCommandsHandler()),
+		"slack-commands",
+	))
 	http.Handle("/cloudrun/events", otelhttp.NewHandler(
 		http.HandlerFunc(svc.auditHandler.HandleCloudRunAuditLogs),
 		"cloudrun-events",
@@ -183,31 +163,10 @@ func (svc *MultiProjectCloudRunSlackBotHttp) Run() {
 
 func (svc *MultiProjectCloudRunSlackBotHttp) SlackEventsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		logger := svc.logger.WithContext(ctx).With(zap.String("handler", "MultiProjectSlackEventsHandler"))
-
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			logger.Error("Failed to read request body", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		logger := svc.logger.WithContext(r.Context()).With(zap.String("handler", "MultiProjectSlackEventsHandler"))
 
-		// Verify the request signature
-		sv, err := slack.NewSecretsVerifier(r.Header, svc.signingSecret)
-		if err != nil {
-			logger.Error("Failed to create secrets verifier", zap.Error(err))
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		if _, err := sv.Write(body); err != nil {
-			logger.Error("Failed to write body to verifier", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		if err := sv.Ensure(); err != nil {
-			logger.Error("Failed to verify request signature", zap.Error(err))
-			w.WriteHeader(http.StatusUnauthorized)
+		body, ok := verifySlackRequest(w, r, svc.signingSecret, logger)
+		if !ok {
 			return
 		}
 
@@ -218,8 +177,6 @@ func (svc *MultiProjectCloudRunSlackBotHttp) SlackEventsHandler() http.HandlerFu
 			return
 		}
 
-		_ = ctx // Suppress unused variable warning
-
 		switch eventsAPIEvent.Type {
 		case slackevents.URLVerification:
 			var res *slackevents.ChallengeResponse
@@ -247,8 +204,11 @@ func (svc *MultiProjectCloudRunSlackBotHttp) SlackEventsHandler() http.HandlerFu
 
 func (svc *MultiProjectCloudRunSlackBotHttp) SlackInteractionHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		logger := svc.logger.WithContext(ctx).With(zap.String("handler", "MultiProjectSlackInteractionHandler"))
+		logger := svc.logger.WithContext(r.Context()).With(zap.String("handler", "MultiProjectSlackInteractionHandler"))
+
+		if _, ok := verifySlackRequest(w, r, svc.signingSecret, logger); !ok {
+			return
+		}
 
 		payload := r.FormValue("payload")
 		var interaction slack.InteractionCallback
@@ -263,7 +223,65 @@ func (svc *MultiProjectCloudRunSlackBotHttp) SlackInteractionHandler() http.Hand
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+	}
+}
+
+// SlackCommandsHandler is http.HandlerFunc for slash commands, e.g. `/cloudrun describe`.
+// Results are posted by the handler in the background, so the response itself is empty.
+func (svc *MultiProjectCloudRunSlackBotHttp) SlackCommandsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := svc.logger.WithContext(r.Context()).With(zap.String("handler", "MultiProjectSlackCommandsHandler"))
+
+		if _, ok := verifySlackRequest(w, r, svc.signingSecret, logger); !ok {
+			return
+		}
+
+		cmd, err := slack.SlashCommandParse(r)
+		if err != nil {
+			logger.Error("Failed to parse slash command", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
-		_ = ctx // Suppress unused variable warning
+		// Slack retries commands that are not acknowledged within 3 seconds, so the command runs after responding.
+		// HandleSlashCommand does not use the request's context, which is cancelled once the response is written.
+		w.WriteHeader(http.StatusOK)
+		go func() {
+			if err := svc.slackHandler.HandleSlashCommand(&cmd); err != nil {
+				logger.Error("Failed to handle slash command", zap.Error(err))
+			}
+		}()
 	}
 }
+
+// verifySlackRequest reads the body of a request from Slack and verifies its signature, as authorization relies
+// on the user of the request. The body is restored for parsing forms. If the request cannot be verified, it
+// responds with an error status and returns false.
+func verifySlackRequest(w http.ResponseWriter, r *http.Request, signingSecret string, logger *zap.Logger) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("Failed to read request body", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	sv, err := slack.NewSecretsVerifier(r.Header, signingSecret)
+	if err != nil {
+		logger.Error("Failed to create secrets verifier", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	if _, err := sv.Write(body); err != nil {
+		logger.Error("Failed to write body to verifier", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	if err := sv.Ensure(); err != nil {
+		logger.Error("Failed to verify request signature", zap.Error(err))
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
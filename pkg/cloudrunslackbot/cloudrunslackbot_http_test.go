@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/config"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/logger"
 	slackinternal "github.com/nakamasato/cloud-run-slack-bot/pkg/slack"
 	"github.com/slack-go/slack"
@@ -73,3 +74,91 @@ func TestSlackEventsVerification(t *testing.T) {
 		})
 	}
 }
+
+func TestSlackCommandsVerification(t *testing.T) {
+	testLogger := &logger.Logger{Logger: zap.NewNop()}
+	cfg := &config.Config{SlackSigningSecret: "test_secret"}
+	svc := NewMultiProjectCloudRunSlackBotHttp(cfg, &slack.Client{}, &slackinternal.MultiProjectSlackEventHandler{}, nil, testLogger)
+	body := "command=%2Fcloudrun&text=describe&user_id=U1&channel_id=C1"
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{
+			name:       "missing headers",
+			headers:    map[string]string{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid signature",
+			headers: map[string]string{
+				"X-Slack-Request-Timestamp": fmt.Sprintf("%d", time.Now().Unix()),
+				"X-Slack-Signature":         "v0=0000000000000000000000000000000000000000",
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/slack/commands", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			svc.SlackCommandsHandler()(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSlackInteractionVerification(t *testing.T) {
+	testLogger := &logger.Logger{Logger: zap.NewNop()}
+	cfg := &config.Config{SlackSigningSecret: "test_secret"}
+	svc := NewMultiProjectCloudRunSlackBotHttp(cfg, &slack.Client{}, &slackinternal.MultiProjectSlackEventHandler{}, nil, testLogger)
+	body := "payload=%7B%22type%22%3A%22block_actions%22%2C%22user%22%3A%7B%22id%22%3A%22U1%22%7D%7D"
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{
+			name:       "missing headers",
+			headers:    map[string]string{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid signature",
+			headers: map[string]string{
+				"X-Slack-Request-Timestamp": fmt.Sprintf("%d", time.Now().Unix()),
+				"X-Slack-Signature":         "v0=0000000000000000000000000000000000000000",
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/slack/interaction", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			svc.SlackInteractionHandler()(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
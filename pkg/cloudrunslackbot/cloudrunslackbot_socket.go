@@ -125,6 +125,16 @@ func (svc *MultiProjectCloudRunSlackBotSocket) SlackEventsHandler() {
 			if err != nil {
 				svc.logger.Error("Failed to handle interactive event", zap.Error(err))
 			}
+		case socketmode.EventTypeSlashCommand:
+			cmd, ok := socketEvent.Data.(slack.SlashCommand)
+			if !ok {
+				continue
+			}
+			svc.sClient.Ack(*socketEvent.Request)
+			err := svc.handler.HandleSlashCommand(&cmd)
+			if err != nil {
+				svc.logger.Error("Failed to handle slash command", zap.Error(err))
+			}
 		}
 	}
 }
@@ -0,0 +1,276 @@
+// Package cloudtrace reads traces from Cloud Trace.
+package cloudtrace
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+	cloudtrace "google.golang.org/api/cloudtrace/v1"
+)
+
+const (
+	maxCriticalPathDepth = 10 // Limit the spans listed on the critical path
+	maxErrorSpans        = 5  // Limit the errored spans listed besides the critical path
+	maxLabelValueLength  = 80
+)
+
+// statusCodeLabels are span labels holding an HTTP or gRPC status code, as set by Cloud Run and OpenTelemetry.
+var statusCodeLabels = []string{"/http/status_code", "http.status_code", "http.response.status_code", "rpc.grpc.status_code"}
+
+// errorLabels are span labels holding an error message.
+var errorLabels = []string{"/error/message", "error.message", "exception.message", "otel.status_description"}
+
+// summaryLabels are span labels worth showing in a summary, in order of preference.
+var summaryLabels = []string{"/http/url", "http.url", "url.full", "http.route", "rpc.method", "db.system", "db.statement", "peer.service", "server.address"}
+
+type Client struct {
+	project      string
+	traceService *cloudtrace.Service
+	logger       *zap.Logger
+}
+
+// Span is a span of a trace.
+type Span struct {
+	ID       uint64
+	ParentID uint64 // 0 for a root span
+	Name     string
+	Kind     string
+	Start    time.Time
+	End      time.Time
+	Labels   map[string]string
+}
+
+// Trace is a trace with its spans.
+type Trace struct {
+	ID    string
+	Spans []Span
+}
+
+func NewClient(ctx context.Context, project string, logger *zap.Logger) (*Client, error) {
+	traceService, err := cloudtrace.NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		project:      project,
+		traceService: traceService,
+		logger:       logger,
+	}, nil
+}
+
+// Close closes the underlying HTTP client
+func (c *Client) Close() error {
+	c.traceService.BasePath = ""
+	return nil
+}
+
+// GetTrace returns the spans of a trace.
+func (c *Client) GetTrace(ctx context.Context, traceID string) (*Trace, error) {
+	ctx, span := trace.GetTracer().Start(ctx, "cloudtrace.GetTrace")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("cloudtrace.project", c.project),
+		attribute.String("cloudtrace.trace_id", traceID),
+	)
+
+	res, err := c.traceService.Projects.Traces.Get(c.project, traceID).Context(ctx).Do()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("failed to get trace %s: %w", traceID, err)
+	}
+
+	t := &Trace{ID: traceID, Spans: make([]Span, 0, len(res.Spans))}
+	for _, s := range res.Spans {
+		start, err := time.Parse(time.RFC3339Nano, s.StartTime)
+		if err != nil {
+			c.logger.Warn("Failed to parse span start time", zap.String("span", s.Name), zap.Error(err))
+		}
+		end, err := time.Parse(time.RFC3339Nano, s.EndTime)
+		if err != nil {
+			c.logger.Warn("Failed to parse span end time", zap.String("span", s.Name), zap.Error(err))
+		}
+		t.Spans = append(t.Spans, Span{
+			ID:       s.SpanId,
+			ParentID: s.ParentSpanId,
+			Name:     s.Name,
+			Kind:     s.Kind,
+			Start:    start,
+			End:      end,
+			Labels:   s.Labels,
+		})
+	}
+
+	span.SetAttributes(attribute.Int("cloudtrace.spans.count", len(t.Spans)))
+	return t, nil
+}
+
+// Duration returns how long the span took.
+func (s Span) Duration() time.Duration {
+	if s.Start.IsZero() || s.End.Before(s.Start) {
+		return 0
+	}
+	return s.End.Sub(s.Start)
+}
+
+// Status returns e.g. "HTTP 503" or "error: connection reset" for a failed span, or "" if it succeeded.
+func (s Span) Status() string {
+	for _, key := range statusCodeLabels {
+		code, err := strconv.Atoi(s.Labels[key])
+		if err != nil {
+			continue
+		}
+		switch {
+		case key == "rpc.grpc.status_code":
+			if code != 0 {
+				return fmt.Sprintf("gRPC %d", code)
+			}
+		case code >= 400:
+			return fmt.Sprintf("HTTP %d", code)
+		}
+	}
+	for _, key := range errorLabels {
+		if msg := s.Labels[key]; msg != "" {
+			return "error: " + shorten(msg)
+		}
+	}
+	return ""
+}
+
+// CriticalPath returns the chain of spans that determined the trace's duration, from the root down.
+// At each level it follows the child that finished last, since the parent had to wait for it.
+func (t *Trace) CriticalPath() []Span {
+	if len(t.Spans) == 0 {
+		return nil
+	}
+	ids := make(map[uint64]bool, len(t.Spans))
+	for _, s := range t.Spans {
+		ids[s.ID] = true
+	}
+	children := make(map[uint64][]Span)
+	var root Span
+	hasRoot := false
+	for _, s := range t.Spans {
+		if s.ParentID != 0 && ids[s.ParentID] {
+			children[s.ParentID] = append(children[s.ParentID], s)
+			continue
+		}
+		// Pick the longest of the spans without a known parent as the root
+		if !hasRoot || s.Duration() > root.Duration() {
+			root = s
+			hasRoot = true
+		}
+	}
+
+	path := []Span{root}
+	current := root
+	for len(path) < maxCriticalPathDepth {
+		kids := children[current.ID]
+		if len(kids) == 0 {
+			break
+		}
+		next := kids[0]
+		for _, k := range kids[1:] {
+			if k.End.After(next.End) || (k.End.Equal(next.End) && k.Duration() > next.Duration()) {
+				next = k
+			}
+		}
+		path = append(path, next)
+		current = next
+	}
+	return path
+}
+
+// Summary condenses the trace into lines: the critical path with durations, status and key labels,
+// marking the span that spent the most time itself, followed by errored spans off the path.
+func (t *Trace) Summary() []string {
+	path := t.CriticalPath()
+	if len(path) == 0 {
+		return nil
+	}
+
+	// Self time on the path is the span's duration minus its critical child's
+	bottleneck := 0
+	var maxSelf time.Duration
+	for i, s := range path {
+		self := s.Duration()
+		if i+1 < len(path) {
+			self -= path[i+1].Duration()
+		}
+		if self > maxSelf {
+			maxSelf = self
+			bottleneck = i
+		}
+	}
+
+	lines := []string{fmt.Sprintf("Trace %s: %d spans, %s total", t.ID, len(t.Spans), formatDuration(path[0].Duration()))}
+	onPath := make(map[uint64]bool, len(path))
+	for i, s := range path {
+		onPath[s.ID] = true
+		line := fmt.Sprintf("%s%s", strings.Repeat("  ", i), describe(s))
+		if i == bottleneck && len(path) > 1 {
+			line += fmt.Sprintf(" <- bottleneck (%s self)", formatDuration(maxSelf))
+		}
+		lines = append(lines, line)
+	}
+
+	var errored []Span
+	for _, s := range t.Spans {
+		if !onPath[s.ID] && s.Status() != "" {
+			errored = append(errored, s)
+		}
+	}
+	sort.SliceStable(errored, func(i, j int) bool { return errored[i].Start.Before(errored[j].Start) })
+	if len(errored) > maxErrorSpans {
+		errored = errored[:maxErrorSpans]
+	}
+	if len(errored) > 0 {
+		lines = append(lines, "Other failed spans:")
+		for _, s := range errored {
+			lines = append(lines, "  "+describe(s))
+		}
+	}
+	return lines
+}
+
+// describe formats a span as "name 1.2s [HTTP 503] (key=value)".
+func describe(s Span) string {
+	desc := fmt.Sprintf("%s %s", s.Name, formatDuration(s.Duration()))
+	if status := s.Status(); status != "" {
+		desc += fmt.Sprintf(" [%s]", status)
+	}
+	for _, key := range summaryLabels {
+		if v := s.Labels[key]; v != "" && v != s.Name {
+			desc += fmt.Sprintf(" (%s=%s)", key, shorten(v))
+			break
+		}
+	}
+	return desc
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	default:
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	}
+}
+
+func shorten(s string) string {
+	if len(s) <= maxLabelValueLength {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxLabelValueLength], "") + "..."
+}
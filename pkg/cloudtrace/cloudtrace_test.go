@@ -0,0 +1,74 @@
+package cloudtrace
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTrace() *Trace {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+	return &Trace{
+		ID: "abc123",
+		Spans: []Span{
+			{ID: 1, Name: "GET /orders", Start: at(0), End: at(2000), Labels: map[string]string{"/http/status_code": "500"}},
+			{ID: 2, ParentID: 1, Name: "auth.Check", Start: at(10), End: at(50)},
+			{ID: 3, ParentID: 1, Name: "orders.List", Start: at(60), End: at(1990), Labels: map[string]string{"rpc.method": "List"}},
+			{ID: 4, ParentID: 3, Name: "db.query", Start: at(70), End: at(1900), Labels: map[string]string{"db.system": "postgresql"}},
+			{ID: 5, ParentID: 3, Name: "cache.Get", Start: at(65), End: at(68), Labels: map[string]string{"error.message": "connection reset"}},
+		},
+	}
+}
+
+func TestTrace_CriticalPath(t *testing.T) {
+	var names []string
+	for _, s := range testTrace().CriticalPath() {
+		names = append(names, s.Name)
+	}
+	want := "GET /orders,orders.List,db.query"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("CriticalPath() = %s, want %s", got, want)
+	}
+
+	if path := (&Trace{}).CriticalPath(); path != nil {
+		t.Errorf("CriticalPath() of an empty trace = %v, want nil", path)
+	}
+}
+
+func TestTrace_Summary(t *testing.T) {
+	want := []string{
+		"Trace abc123: 5 spans, 2.00s total",
+		"GET /orders 2.00s [HTTP 500]",
+		"  orders.List 1.93s (rpc.method=List)",
+		"    db.query 1.83s (db.system=postgresql) <- bottleneck (1.83s self)",
+		"Other failed spans:",
+		"  cache.Get 3ms [error: connection reset]",
+	}
+	got := testTrace().Summary()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Summary() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSpan_Status(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{name: "ok", labels: map[string]string{"/http/status_code": "200"}, want: ""},
+		{name: "http error", labels: map[string]string{"http.response.status_code": "503"}, want: "HTTP 503"},
+		{name: "grpc ok", labels: map[string]string{"rpc.grpc.status_code": "0"}, want: ""},
+		{name: "grpc error", labels: map[string]string{"rpc.grpc.status_code": "14"}, want: "gRPC 14"},
+		{name: "error message", labels: map[string]string{"exception.message": "boom"}, want: "error: boom"},
+		{name: "no labels", labels: nil, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Span{Labels: tt.labels}).Status(); got != tt.want {
+				t.Errorf("Status() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
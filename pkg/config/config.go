@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/authz"
 	"go.uber.org/zap"
 )
 
@@ -27,13 +29,40 @@ type Config struct {
 	SlackSigningSecret    string              `json:"-"`
 	SlackAppMode          string              `json:"-"`
 	TmpDir                string              `json:"-"`
+	RBAC                  *authz.Policy       `json:"-"` // Roles required to run commands (nil allows everyone)
+	AuditLogName          string              `json:"-"` // Cloud Logging log that audit events are written to
+	AuditLogFile          string              `json:"-"` // JSONL file that audit events are appended to (empty to disable)
+	MemoryStore           string              `json:"-"` // Where current resources are kept: memory or firestore
+	MemoryCollection      string              `json:"-"` // Firestore collection of current resources
+	MemoryTTL             int                 `json:"-"` // How long a current resource is kept after it was set (hours, 0 keeps it forever)
+	ApprovalStore         string              `json:"-"` // Where requests waiting for approval are kept: memory or firestore
+	ApprovalCollection    string              `json:"-"` // Firestore collection of requests waiting for approval
+	ApprovalTimeout       int                 `json:"-"` // How long a request can be approved after it was made (minutes)
 
 	// Debug feature configuration
-	DebugEnabled    bool   `json:"-"`
-	GCPProjectID    string `json:"-"` // GCP project for Vertex AI
-	VertexLocation  string `json:"-"` // GCP location for Vertex AI
-	ModelName       string `json:"-"` // Gemini model name
-	DebugTimeWindow int    `json:"-"` // How far back to look for errors (minutes)
+	DebugEnabled            bool              `json:"-"`
+	LLMBackend              string            `json:"-"` // LLM backend: vertexai, gemini, openai or fake
+	LLMAPIKey               string            `json:"-"` // API key for the gemini and openai backends
+	LLMBaseURL              string            `json:"-"` // Endpoint for the openai backend
+	GCPProjectID            string            `json:"-"` // GCP project for Vertex AI
+	VertexLocation          string            `json:"-"` // GCP location for Vertex AI
+	ModelName               string            `json:"-"` // Model name
+	LLMInputPrice           float64           `json:"-"` // Price of input tokens in USD per million (0 for the model's list price, if known)
+	LLMOutputPrice          float64           `json:"-"` // Price of output tokens in USD per million (0 for the model's list price, if known)
+	DebugTimeWindow         int               `json:"-"` // How far back to look for errors (minutes)
+	DebugMaxErrors          int               `json:"-"` // Maximum number of error entries fetched for analysis
+	DebugBuckets            int               `json:"-"` // Number of time buckets to sample errors from
+	DebugMaxCount           int               `json:"-"` // Upper bound when counting total errors
+	DebugConcurrency        int               `json:"-"` // Number of error groups analyzed in parallel
+	DebugAnalysisTimeout    int               `json:"-"` // Timeout of each group's LLM analysis (seconds)
+	DebugTraceLogTimeout    int               `json:"-"` // Timeout of each group's trace log query (seconds)
+	DebugCacheTTL           int               `json:"-"` // How long analyses are reused for the same errors (minutes, 0 disables)
+	DebugAgentMaxSteps      int               `json:"-"` // Maximum tool-calling turns per error group (0 disables tools)
+	DebugExportDest         string            `json:"-"` // Where exported incident notes are saved: gs://bucket/prefix or a directory (empty for Slack only)
+	DebugRedactDetectors    []string          `json:"-"` // Built-in redaction detectors applied to logs before analysis ("all" or "none")
+	DebugRedactPatterns     map[string]string `json:"-"` // Custom redaction regexes by name
+	DebugDailyTokens        int               `json:"-"` // Tokens each channel may use per day on each instance (0 for unlimited)
+	DebugChannelDailyTokens map[string]int    `json:"-"` // Per-channel overrides of DebugDailyTokens by channel ID
 }
 
 // validateProjectsConfig validates the structure of the parsed projects configuration
@@ -65,10 +94,64 @@ func LoadConfig() (*Config, error) {
 		TmpDir:             os.Getenv("TMP_DIR"),
 		DefaultChannel:     os.Getenv("SLACK_CHANNEL"),
 		ChannelToProjects:  make(map[string][]string),
+		AuditLogName:       os.Getenv("AUDIT_LOG_NAME"),
+		AuditLogFile:       os.Getenv("AUDIT_LOG_FILE"),
+	}
+	if config.AuditLogName == "" {
+		config.AuditLogName = "cloud-run-slack-bot-audit"
+	}
+
+	// Load current resource memory configuration
+	config.MemoryStore = os.Getenv("MEMORY_STORE")
+	if config.MemoryStore == "" {
+		config.MemoryStore = "memory"
+	}
+	config.MemoryCollection = os.Getenv("MEMORY_FIRESTORE_COLLECTION")
+	if config.MemoryCollection == "" {
+		config.MemoryCollection = "cloud-run-slack-bot-memory"
+	}
+	config.MemoryTTL = 7 * 24
+	if ttl := os.Getenv("MEMORY_TTL_HOURS"); ttl != "" {
+		if val, err := strconv.Atoi(ttl); err == nil && val >= 0 {
+			config.MemoryTTL = val
+		}
+	}
+
+	// Load approval configuration
+	config.ApprovalStore = os.Getenv("APPROVAL_STORE")
+	if config.ApprovalStore == "" {
+		config.ApprovalStore = "memory"
+	}
+	config.ApprovalCollection = os.Getenv("APPROVAL_FIRESTORE_COLLECTION")
+	if config.ApprovalCollection == "" {
+		config.ApprovalCollection = "cloud-run-slack-bot-approvals"
+	}
+	config.ApprovalTimeout = 60
+	if timeout := os.Getenv("APPROVAL_TIMEOUT_MINUTES"); timeout != "" {
+		if val, err := strconv.Atoi(timeout); err == nil && val > 0 {
+			config.ApprovalTimeout = val
+		}
+	}
+
+	// Load role-based access control
+	if rbac := os.Getenv("RBAC_CONFIG"); rbac != "" {
+		config.RBAC = &authz.Policy{}
+		if err := json.Unmarshal([]byte(rbac), config.RBAC); err != nil {
+			return nil, fmt.Errorf("failed to parse RBAC_CONFIG: %v", err)
+		}
+		if err := config.RBAC.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid RBAC_CONFIG: %w", err)
+		}
 	}
 
 	// Load debug configuration
 	config.DebugEnabled = os.Getenv("DEBUG_ENABLED") == "true"
+	config.LLMBackend = os.Getenv("LLM_BACKEND")
+	if config.LLMBackend == "" {
+		config.LLMBackend = "vertexai"
+	}
+	config.LLMAPIKey = os.Getenv("LLM_API_KEY")
+	config.LLMBaseURL = os.Getenv("LLM_BASE_URL")
 	config.GCPProjectID = os.Getenv("GCP_PROJECT_ID")
 	config.VertexLocation = os.Getenv("VERTEX_LOCATION")
 	config.ModelName = os.Getenv("MODEL_NAME")
@@ -83,6 +166,44 @@ func LoadConfig() (*Config, error) {
 	if config.DebugTimeWindow == 0 {
 		config.DebugTimeWindow = 30
 	}
+	config.DebugMaxErrors = getEnvInt("DEBUG_MAX_ERRORS", 100)
+	config.DebugBuckets = getEnvInt("DEBUG_SAMPLE_BUCKETS", 6)
+	config.DebugMaxCount = getEnvInt("DEBUG_MAX_COUNT", 1000)
+	config.DebugConcurrency = getEnvInt("DEBUG_CONCURRENCY", 3)
+	config.DebugAnalysisTimeout = getEnvInt("DEBUG_ANALYSIS_TIMEOUT", 60)
+	config.DebugTraceLogTimeout = getEnvInt("DEBUG_TRACE_LOG_TIMEOUT", 20)
+	config.DebugCacheTTL = 30
+	if cacheTTL := os.Getenv("DEBUG_CACHE_TTL"); cacheTTL != "" {
+		// Unlike the other settings, 0 is allowed to disable the cache
+		if val, err := strconv.Atoi(cacheTTL); err == nil && val >= 0 {
+			config.DebugCacheTTL = val
+		}
+	}
+	config.DebugExportDest = os.Getenv("DEBUG_EXPORT_DESTINATION")
+	config.LLMInputPrice = getEnvFloat("LLM_INPUT_PRICE", 0)
+	config.LLMOutputPrice = getEnvFloat("LLM_OUTPUT_PRICE", 0)
+	config.DebugDailyTokens = getEnvInt("DEBUG_DAILY_TOKEN_BUDGET", 0)
+	if budgets := os.Getenv("DEBUG_CHANNEL_TOKEN_BUDGETS"); budgets != "" {
+		if err := json.Unmarshal([]byte(budgets), &config.DebugChannelDailyTokens); err != nil {
+			return nil, fmt.Errorf("failed to parse DEBUG_CHANNEL_TOKEN_BUDGETS: %v", err)
+		}
+	}
+	config.DebugRedactDetectors = []string{"all"}
+	if detectors := os.Getenv("DEBUG_REDACT_DETECTORS"); detectors != "" {
+		config.DebugRedactDetectors = strings.Split(detectors, ",")
+	}
+	if patterns := os.Getenv("DEBUG_REDACT_PATTERNS"); patterns != "" {
+		if err := json.Unmarshal([]byte(patterns), &config.DebugRedactPatterns); err != nil {
+			return nil, fmt.Errorf("failed to parse DEBUG_REDACT_PATTERNS: %v", err)
+		}
+	}
+	config.DebugAgentMaxSteps = 5
+	if maxSteps := os.Getenv("DEBUG_AGENT_MAX_STEPS"); maxSteps != "" {
+		// 0 is allowed to analyze without tools
+		if val, err := strconv.Atoi(maxSteps); err == nil && val >= 0 {
+			config.DebugAgentMaxSteps = val
+		}
+	}
 
 	// Check for multi-project configuration
 	projectsConfig := os.Getenv("PROJECTS_CONFIG")
@@ -105,6 +226,26 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
+// getEnvInt reads a positive integer from an environment variable, falling back to defaultVal
+func getEnvInt(key string, defaultVal int) int {
+	if v := os.Getenv(key); v != "" {
+		if val, err := strconv.Atoi(v); err == nil && val > 0 {
+			return val
+		}
+	}
+	return defaultVal
+}
+
+// getEnvFloat reads a non-negative number from an environment variable, falling back to defaultVal
+func getEnvFloat(key string, defaultVal float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if val, err := strconv.ParseFloat(v, 64); err == nil && val >= 0 {
+			return val
+		}
+	}
+	return defaultVal
+}
+
 // Validate validates the configuration
 func (c *Config) Validate() error {
 	if c.SlackBotToken == "" {
@@ -130,11 +271,25 @@ func (c *Config) Validate() error {
 
 	// Validate debug configuration
 	if c.DebugEnabled {
-		if c.GCPProjectID == "" {
-			return fmt.Errorf("GCP_PROJECT_ID is required when DEBUG_ENABLED=true")
-		}
-		if c.VertexLocation == "" {
-			return fmt.Errorf("VERTEX_LOCATION is required when DEBUG_ENABLED=true")
+		switch c.LLMBackend {
+		case "vertexai":
+			if c.GCPProjectID == "" {
+				return fmt.Errorf("GCP_PROJECT_ID is required when DEBUG_ENABLED=true")
+			}
+			if c.VertexLocation == "" {
+				return fmt.Errorf("VERTEX_LOCATION is required when DEBUG_ENABLED=true")
+			}
+		case "gemini":
+			if c.LLMAPIKey == "" {
+				return fmt.Errorf("LLM_API_KEY is required when LLM_BACKEND=gemini")
+			}
+		case "openai":
+			if c.LLMBaseURL == "" {
+				return fmt.Errorf("LLM_BASE_URL is required when LLM_BACKEND=openai")
+			}
+		case "fake":
+		default:
+			return fmt.Errorf("invalid LLM_BACKEND %q: must be one of vertexai, gemini, openai, fake", c.LLMBackend)
 		}
 	}
 
@@ -220,6 +375,23 @@ func (c *Config) LogConfiguration(logger *zap.Logger) {
 	logger.Info("Default Channel", zap.String("channel", c.DefaultChannel))
 	logger.Info("Slack App Mode", zap.String("mode", c.SlackAppMode))
 	logger.Info("Projects configured", zap.Int("count", len(c.Projects)))
+	if c.RBAC != nil {
+		logger.Info("Access control enabled",
+			zap.String("default_role", c.RBAC.DefaultRole),
+			zap.Int("grants", len(c.RBAC.Grants)),
+			zap.Int("command_overrides", len(c.RBAC.Commands)))
+	} else {
+		logger.Info("Access control disabled, every user may run every command")
+	}
+	logger.Info("Audit configuration", zap.String("log_name", c.AuditLogName), zap.String("file", c.AuditLogFile))
+	logger.Info("Memory configuration",
+		zap.String("store", c.MemoryStore),
+		zap.String("collection", c.MemoryCollection),
+		zap.Int("ttl_hours", c.MemoryTTL))
+	logger.Info("Approval configuration",
+		zap.String("store", c.ApprovalStore),
+		zap.String("collection", c.ApprovalCollection),
+		zap.Int("timeout_minutes", c.ApprovalTimeout))
 	for _, project := range c.Projects {
 		logger.Info("Project configuration",
 			zap.String("project_id", project.ID),
@@ -244,9 +416,26 @@ func (c *Config) LogConfiguration(logger *zap.Logger) {
 	logger.Info("Debug feature configuration", zap.Bool("enabled", c.DebugEnabled))
 	if c.DebugEnabled {
 		logger.Info("Debug feature details",
+			zap.String("llm_backend", c.LLMBackend),
+			zap.String("llm_base_url", c.LLMBaseURL),
 			zap.String("gcp_project_id", c.GCPProjectID),
 			zap.String("vertex_location", c.VertexLocation),
 			zap.String("model", c.ModelName),
-			zap.Int("time_window_minutes", c.DebugTimeWindow))
+			zap.Int("time_window_minutes", c.DebugTimeWindow),
+			zap.Int("max_errors", c.DebugMaxErrors),
+			zap.Int("sample_buckets", c.DebugBuckets),
+			zap.Int("max_count", c.DebugMaxCount),
+			zap.Int("concurrency", c.DebugConcurrency),
+			zap.Int("analysis_timeout_seconds", c.DebugAnalysisTimeout),
+			zap.Int("trace_log_timeout_seconds", c.DebugTraceLogTimeout),
+			zap.Int("cache_ttl_minutes", c.DebugCacheTTL),
+			zap.Int("agent_max_steps", c.DebugAgentMaxSteps),
+			zap.String("export_destination", c.DebugExportDest),
+			zap.Strings("redact_detectors", c.DebugRedactDetectors),
+			zap.Int("redact_patterns", len(c.DebugRedactPatterns)),
+			zap.Float64("input_price_per_million", c.LLMInputPrice),
+			zap.Float64("output_price_per_million", c.LLMOutputPrice),
+			zap.Int("daily_token_budget", c.DebugDailyTokens),
+			zap.Any("channel_token_budgets", c.DebugChannelDailyTokens))
 	}
 }
@@ -220,6 +220,72 @@ func TestValidate(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "debug with vertexai backend missing location",
+			config: &Config{
+				SlackBotToken:      "test-token",
+				SlackSigningSecret: "test-secret",
+				DebugEnabled:       true,
+				LLMBackend:         "vertexai",
+				GCPProjectID:       "ai-project",
+				Projects: []ProjectConfig{
+					{
+						ID:     "project1",
+						Region: "us-central1",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "debug with gemini backend",
+			config: &Config{
+				SlackBotToken:      "test-token",
+				SlackSigningSecret: "test-secret",
+				DebugEnabled:       true,
+				LLMBackend:         "gemini",
+				LLMAPIKey:          "key",
+				Projects: []ProjectConfig{
+					{
+						ID:     "project1",
+						Region: "us-central1",
+					},
+				},
+			},
+			expectErr: false,
+		},
+		{
+			name: "debug with openai backend missing base URL",
+			config: &Config{
+				SlackBotToken:      "test-token",
+				SlackSigningSecret: "test-secret",
+				DebugEnabled:       true,
+				LLMBackend:         "openai",
+				Projects: []ProjectConfig{
+					{
+						ID:     "project1",
+						Region: "us-central1",
+					},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "debug with unknown backend",
+			config: &Config{
+				SlackBotToken:      "test-token",
+				SlackSigningSecret: "test-secret",
+				DebugEnabled:       true,
+				LLMBackend:         "unknown",
+				Projects: []ProjectConfig{
+					{
+						ID:     "project1",
+						Region: "us-central1",
+					},
+				},
+			},
+			expectErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -353,3 +419,121 @@ func TestBuildChannelToProjectMapping(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadConfig_Redaction(t *testing.T) {
+	t.Setenv("PROJECTS_CONFIG", `[{"id": "project1", "region": "us-central1"}]`)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(config.DebugRedactDetectors) != 1 || config.DebugRedactDetectors[0] != "all" {
+		t.Errorf("Expected all detectors by default, got %v", config.DebugRedactDetectors)
+	}
+
+	t.Setenv("DEBUG_REDACT_DETECTORS", "email,ip")
+	t.Setenv("DEBUG_REDACT_PATTERNS", `{"customer_id": "cus_[A-Za-z0-9]{14}"}`)
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(config.DebugRedactDetectors) != 2 || config.DebugRedactPatterns["customer_id"] != "cus_[A-Za-z0-9]{14}" {
+		t.Errorf("Unexpected redaction config: %v, %v", config.DebugRedactDetectors, config.DebugRedactPatterns)
+	}
+
+	t.Setenv("DEBUG_REDACT_PATTERNS", `["not", "an", "object"]`)
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected error for invalid DEBUG_REDACT_PATTERNS")
+	}
+}
+
+func TestLoadConfig_TokenBudgets(t *testing.T) {
+	t.Setenv("PROJECTS_CONFIG", `[{"id": "project1", "region": "us-central1"}]`)
+	t.Setenv("DEBUG_DAILY_TOKEN_BUDGET", "1000000")
+	t.Setenv("DEBUG_CHANNEL_TOKEN_BUDGETS", `{"C0123456789": 0}`)
+	t.Setenv("LLM_INPUT_PRICE", "0.3")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.DebugDailyTokens != 1000000 || config.DebugChannelDailyTokens["C0123456789"] != 0 || len(config.DebugChannelDailyTokens) != 1 {
+		t.Errorf("Unexpected budgets: %d, %v", config.DebugDailyTokens, config.DebugChannelDailyTokens)
+	}
+	if config.LLMInputPrice != 0.3 || config.LLMOutputPrice != 0 {
+		t.Errorf("Unexpected prices: %v, %v", config.LLMInputPrice, config.LLMOutputPrice)
+	}
+}
+
+func TestLoadConfig_RBAC(t *testing.T) {
+	t.Setenv("PROJECTS_CONFIG", `[{"id": "project1", "region": "us-central1"}]`)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.RBAC != nil {
+		t.Errorf("Expected no RBAC policy, got %+v", config.RBAC)
+	}
+
+	t.Setenv("RBAC_CONFIG", `{"defaultRole": "viewer", "grants": [{"project": "project1", "users": ["U1"], "role": "operator"}]}`)
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.RBAC == nil || config.RBAC.DefaultRole != "viewer" || len(config.RBAC.Grants) != 1 {
+		t.Errorf("Unexpected RBAC policy: %+v", config.RBAC)
+	}
+
+	for _, rbac := range []string{`{"grants": [`, `{"grants": [{"users": ["U1"], "role": "owner"}]}`} {
+		t.Setenv("RBAC_CONFIG", rbac)
+		if _, err := LoadConfig(); err == nil {
+			t.Errorf("Expected error for RBAC_CONFIG %s", rbac)
+		}
+	}
+}
+
+func TestLoadConfig_Audit(t *testing.T) {
+	t.Setenv("PROJECTS_CONFIG", `[{"id": "project1", "region": "us-central1"}]`)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.AuditLogName != "cloud-run-slack-bot-audit" || config.AuditLogFile != "" {
+		t.Errorf("Unexpected audit defaults: %q, %q", config.AuditLogName, config.AuditLogFile)
+	}
+
+	t.Setenv("AUDIT_LOG_NAME", "slack-audit")
+	t.Setenv("AUDIT_LOG_FILE", "/tmp/audit.jsonl")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.AuditLogName != "slack-audit" || config.AuditLogFile != "/tmp/audit.jsonl" {
+		t.Errorf("Unexpected audit configuration: %q, %q", config.AuditLogName, config.AuditLogFile)
+	}
+}
+
+func TestLoadConfig_Memory(t *testing.T) {
+	t.Setenv("PROJECTS_CONFIG", `[{"id": "project1", "region": "us-central1"}]`)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.MemoryStore != "memory" || config.MemoryCollection != "cloud-run-slack-bot-memory" || config.MemoryTTL != 168 {
+		t.Errorf("Unexpected memory defaults: %q, %q, %d", config.MemoryStore, config.MemoryCollection, config.MemoryTTL)
+	}
+
+	t.Setenv("MEMORY_STORE", "firestore")
+	t.Setenv("MEMORY_FIRESTORE_COLLECTION", "bot-memory")
+	t.Setenv("MEMORY_TTL_HOURS", "0")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.MemoryStore != "firestore" || config.MemoryCollection != "bot-memory" || config.MemoryTTL != 0 {
+		t.Errorf("Unexpected memory configuration: %q, %q, %d", config.MemoryStore, config.MemoryCollection, config.MemoryTTL)
+	}
+}
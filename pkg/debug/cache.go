@@ -0,0 +1,63 @@
+package debug
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+)
+
+// cachedAnalysis is an analysis stored in the cache.
+type cachedAnalysis struct {
+	Analysis   adk.ErrorAnalysis
+	AnalyzedAt time.Time
+}
+
+// analysisCache stores error group analyses by project, resource and group fingerprint for a TTL.
+type analysisCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]cachedAnalysis
+}
+
+func newAnalysisCache(ttl time.Duration) *analysisCache {
+	return &analysisCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cachedAnalysis),
+	}
+}
+
+// cacheKeyPrefix returns the part of the cache key identifying the resource.
+func cacheKeyPrefix(projectID, resourceType, resourceName string) string {
+	return projectID + "/" + resourceType + "/" + resourceName + "/"
+}
+
+// get returns the analysis stored for key if it has not expired.
+func (c *analysisCache) get(key string) (cachedAnalysis, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return cachedAnalysis{}, false
+	}
+	if c.now().Sub(entry.AnalyzedAt) > c.ttl {
+		delete(c.entries, key)
+		return cachedAnalysis{}, false
+	}
+	return entry, true
+}
+
+// put stores an analysis and drops expired entries.
+func (c *analysisCache) put(key string, analysis adk.ErrorAnalysis) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k, entry := range c.entries {
+		if now.Sub(entry.AnalyzedAt) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedAnalysis{Analysis: analysis, AnalyzedAt: now}
+}
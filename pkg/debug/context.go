@@ -0,0 +1,198 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudrun"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/logging"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/monitoring"
+	"go.uber.org/zap"
+)
+
+const (
+	maxRevisionsForContext   = 5  // Number of recent revisions included in the analysis
+	maxAuditLogsForContext   = 20 // Number of audit log entries included in the analysis
+	anomalyAggregationPeriod = time.Minute
+	minErrorSpikePerMinute   = 5 // Ignore 5xx spikes below this absolute rate
+)
+
+// ChangeEvent is a deploy or configuration change of the resource.
+type ChangeEvent struct {
+	Time        time.Time
+	Kind        string // "revision" or "audit"
+	Description string
+}
+
+func (e ChangeEvent) String() string {
+	return fmt.Sprintf("[%s] %s", e.Time.UTC().Format(time.RFC3339), e.Description)
+}
+
+// gatherChanges collects recent revisions and audit log changes, oldest first.
+func (d *Debugger) gatherChanges(ctx context.Context, projectID, resourceType, resourceName string) []ChangeEvent {
+	var changes []ChangeEvent
+
+	if rClient, ok := d.rClients[projectID]; ok && resourceType == "service" {
+		revisions, err := rClient.ListRevisions(ctx, resourceName, maxRevisionsForContext)
+		if err != nil {
+			d.logger.Warn("Failed to list revisions", zap.String("resource_name", resourceName), zap.Error(err))
+		}
+		changes = append(changes, revisionChanges(revisions)...)
+	}
+
+	if lClient, ok := d.lClients[projectID]; ok {
+		// Look further back than the error window so that the deploy that caused the errors is included
+		entries, err := lClient.GetAuditLogs(ctx, resourceType, resourceName, 2*d.config.LookbackDuration, logging.QueryOptions{Limit: maxAuditLogsForContext})
+		if err != nil {
+			d.logger.Warn("Failed to get audit logs", zap.String("resource_name", resourceName), zap.Error(err))
+		}
+		changes = append(changes, auditChanges(entries)...)
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.Before(changes[j].Time)
+	})
+	return changes
+}
+
+func revisionChanges(revisions []cloudrun.CloudRunRevision) []ChangeEvent {
+	changes := make([]ChangeEvent, 0, len(revisions))
+	for _, r := range revisions {
+		desc := fmt.Sprintf("Revision %s created", r.Name)
+		if r.Creator != "" {
+			desc = fmt.Sprintf("%s by %s", desc, r.Creator)
+		}
+		if r.Image != "" {
+			desc = fmt.Sprintf("%s (image: %s)", desc, r.Image)
+		}
+		changes = append(changes, ChangeEvent{Time: r.CreateTime, Kind: "revision", Description: desc})
+	}
+	return changes
+}
+
+func auditChanges(entries []logging.AuditLogEntry) []ChangeEvent {
+	changes := make([]ChangeEvent, 0, len(entries))
+	for _, e := range entries {
+		method := e.MethodName
+		if i := strings.LastIndex(method, "."); i >= 0 {
+			method = method[i+1:] // google.cloud.run.v2.Services.UpdateService -> UpdateService
+		}
+		if method == "" {
+			method = "Change"
+		}
+		desc := method
+		if e.Principal != "" {
+			desc = fmt.Sprintf("%s by %s", desc, e.Principal)
+		}
+		if e.ResourceName != "" {
+			parts := strings.Split(e.ResourceName, "/")
+			desc = fmt.Sprintf("%s on %s", desc, parts[len(parts)-1])
+		}
+		if e.Error != "" {
+			desc = fmt.Sprintf("%s (failed: %s)", desc, e.Error)
+		}
+		changes = append(changes, ChangeEvent{Time: e.Timestamp, Kind: "audit", Description: desc})
+	}
+	return changes
+}
+
+// gatherAnomalies looks for spikes in 5xx responses and p99 latency during the lookback window.
+func (d *Debugger) gatherAnomalies(ctx context.Context, projectID, resourceType, resourceName string) []string {
+	mClient, ok := d.mClients[projectID]
+	if !ok || resourceType != "service" {
+		// Request metrics are only available for services
+		return nil
+	}
+
+	endTime := time.Now().UTC().Truncate(anomalyAggregationPeriod)
+	startTime := endTime.Add(-d.config.LookbackDuration)
+	var anomalies []string
+
+	counts, err := mClient.GetCloudRunServiceRequestCount(ctx, resourceName, anomalyAggregationPeriod, startTime, endTime)
+	if err != nil {
+		d.logger.Warn("Failed to get request count for anomaly detection", zap.String("resource_name", resourceName), zap.Error(err))
+	} else if series, ok := (*counts)["5xx"]; ok {
+		if s, found := detectSpike(series, 3, minErrorSpikePerMinute); found {
+			anomalies = append(anomalies, fmt.Sprintf("5xx responses spiked to %.0f/min at %s (baseline %.1f/min)",
+				s.Peak, s.Start.UTC().Format(time.RFC3339), s.Baseline))
+		}
+	}
+
+	latencies, err := mClient.GetCloudRunServiceRequestLatencies(ctx, resourceName, anomalyAggregationPeriod, startTime, endTime)
+	if err != nil {
+		d.logger.Warn("Failed to get request latencies for anomaly detection", zap.String("resource_name", resourceName), zap.Error(err))
+	} else if series, ok := (*latencies)["ALIGN_PERCENTILE_99"]; ok {
+		if s, found := detectSpike(series, 2, 0); found {
+			anomalies = append(anomalies, fmt.Sprintf("p99 latency rose to %.0fms at %s (baseline %.0fms)",
+				s.Peak, s.Start.UTC().Format(time.RFC3339), s.Baseline))
+		}
+	}
+
+	return anomalies
+}
+
+// spike describes a period where a metric exceeded its baseline.
+type spike struct {
+	Start    time.Time // First point above the threshold
+	Peak     float64   // Maximum value in the series
+	Baseline float64   // Median value of the series
+}
+
+// detectSpike reports the first point exceeding max(factor*median, median+3*MAD, minValue).
+// Points with the same timestamp are summed first (e.g. series split by revision).
+func detectSpike(series monitoring.TimeSeries, factor, minValue float64) (spike, bool) {
+	byTime := make(map[time.Time]float64)
+	for _, p := range series {
+		byTime[p.Time] += p.Val
+	}
+	if len(byTime) < 3 {
+		return spike{}, false
+	}
+	times := make([]time.Time, 0, len(byTime))
+	values := make([]float64, 0, len(byTime))
+	for t := range byTime {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for _, t := range times {
+		values = append(values, byTime[t])
+	}
+
+	median := medianOf(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+	}
+	mad := medianOf(deviations)
+	threshold := math.Max(math.Max(factor*median, median+3*mad), minValue)
+
+	result := spike{Baseline: median}
+	found := false
+	for i, v := range values {
+		if v > threshold {
+			if !found {
+				result.Start = times[i]
+				found = true
+			}
+			result.Peak = math.Max(result.Peak, v)
+		}
+	}
+	return result, found
+}
+
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -3,10 +3,14 @@ package debug
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudrun"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudtrace"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/logging"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/monitoring"
 	"go.uber.org/zap"
 )
 
@@ -15,15 +19,27 @@ const maxTraceLogsForAnalysis = 20 // Limit trace logs to prevent overwhelming L
 // Debugger orchestrates the debug workflow.
 type Debugger struct {
 	lClients map[string]*logging.Client
-	agent    *adk.DebugAgent
+	rClients map[string]*cloudrun.Client
+	mClients map[string]*monitoring.Client
+	tClients map[string]*cloudtrace.Client
+	agent    adk.Analyzer
+	cache    *analysisCache // nil if caching is disabled
 	config   Config
 	logger   *zap.Logger
 }
 
 // NewDebugger creates a new debugger.
-func NewDebugger(lClients map[string]*logging.Client, agent *adk.DebugAgent, cfg Config, logger *zap.Logger) *Debugger {
+func NewDebugger(lClients map[string]*logging.Client, rClients map[string]*cloudrun.Client, mClients map[string]*monitoring.Client, tClients map[string]*cloudtrace.Client, agent adk.Analyzer, cfg Config, logger *zap.Logger) *Debugger {
+	var cache *analysisCache
+	if cfg.CacheTTL > 0 {
+		cache = newAnalysisCache(cfg.CacheTTL)
+	}
 	return &Debugger{
+		cache:    cache,
 		lClients: lClients,
+		rClients: rClients,
+		mClients: mClients,
+		tClients: tClients,
 		agent:    agent,
 		config:   cfg,
 		logger:   logger,
@@ -31,13 +47,33 @@ func NewDebugger(lClients map[string]*logging.Client, agent *adk.DebugAgent, cfg
 }
 
 // DebugResource performs debug analysis on a Cloud Run service or job.
-func (d *Debugger) DebugResource(ctx context.Context, projectID, resourceType, resourceName string) (*DebugResult, error) {
+// listener, if not nil, receives progress and each group's analysis as soon as it is available.
+func (d *Debugger) DebugResource(ctx context.Context, projectID, resourceType, resourceName string, listener Listener) (*DebugResult, error) {
+	if listener == nil {
+		listener = nopListener{}
+	}
+
 	// Get logging client for the project
 	lClient, ok := d.lClients[projectID]
 	if !ok {
 		return nil, fmt.Errorf("no logging client found for project %s", projectID)
 	}
 
+	// Count the tokens of this run separately, and add them to the caller's meter, if any, when it is done
+	meter := &adk.UsageMeter{}
+	parentMeter := adk.UsageMeterFrom(ctx)
+	ctx = adk.WithUsageMeter(ctx, meter)
+	var result *DebugResult
+	defer func() {
+		usage := meter.Total()
+		parentMeter.Add(usage)
+		cost := d.recordUsage(ctx, "analyze", projectID, resourceType, resourceName, usage)
+		if result != nil {
+			result.Usage = usage
+			result.Cost = cost
+		}
+	}()
+
 	d.logger.Info("Starting debug analysis",
 		zap.String("resource_type", resourceType),
 		zap.String("resource_name", resourceName),
@@ -45,20 +81,38 @@ func (d *Debugger) DebugResource(ctx context.Context, projectID, resourceType, r
 		zap.Duration("lookback", d.config.LookbackDuration))
 
 	// Step 1: Get error logs
-	errorLogs, err := lClient.GetErrorLogs(ctx, resourceType, resourceName, d.config.LookbackDuration)
+	listener.OnProgress(Progress{Stage: StageFetching})
+	errorLogs, err := lClient.GetErrorLogs(ctx, resourceType, resourceName, d.config.LookbackDuration, logging.QueryOptions{
+		Limit:   d.config.MaxErrors,
+		Buckets: d.config.SampleBuckets,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get error logs: %w", err)
 	}
 
-	result := &DebugResult{
+	result = &DebugResult{
 		ResourceName: resourceName,
 		ResourceType: resourceType,
 		ProjectID:    projectID,
 		TotalErrors:  len(errorLogs),
+		Analyzed:     len(errorLogs),
 		GeneratedAt:  time.Now(),
 		LookbackMin:  int(d.config.LookbackDuration.Minutes()),
 	}
 
+	// Step 1.5: Count all errors in the window, since the fetched entries are capped
+	if len(errorLogs) > 0 {
+		total, capped, err := lClient.CountErrorLogs(ctx, resourceType, resourceName, d.config.LookbackDuration, d.config.MaxCount)
+		if err != nil {
+			d.logger.Warn("Failed to count error logs, using fetched count",
+				zap.String("resource_name", resourceName),
+				zap.Error(err))
+		} else if total >= len(errorLogs) {
+			result.TotalErrors = total
+			result.TotalCapped = capped
+		}
+	}
+
 	if len(errorLogs) == 0 {
 		d.logger.Info("No errors found",
 			zap.String("resource_type", resourceType),
@@ -66,17 +120,32 @@ func (d *Debugger) DebugResource(ctx context.Context, projectID, resourceType, r
 		return result, nil
 	}
 
-	// Convert logging.LogEntry to adk.ErrorLog
+	// Convert logging.LogEntry to adk.ErrorLog, redacting secrets and personal data before anything is
+	// sent to the LLM or posted to Slack
+	redactor := d.config.Redactor
 	adkErrors := make([]adk.ErrorLog, len(errorLogs))
 	for i, entry := range errorLogs {
 		adkErrors[i] = adk.ErrorLog{
-			Message:   entry.Message,
-			Timestamp: entry.Timestamp,
-			TraceID:   entry.TraceID,
+			Message:    redactor.Redact(entry.Message),
+			Timestamp:  entry.Timestamp,
+			TraceID:    entry.TraceID,
+			ErrorType:  entry.ErrorType,
+			StackTrace: redactor.Redact(entry.StackTrace),
+			Request:    redactor.Redact(entry.HTTPRequest.String()),
 		}
 	}
 
+	// Step 1.6: Gather recent changes and metric anomalies as context for the analysis
+	result.Changes = d.gatherChanges(ctx, projectID, resourceType, resourceName)
+	result.Anomalies = d.gatherAnomalies(ctx, projectID, resourceType, resourceName)
+	changes := make([]string, len(result.Changes))
+	for i, c := range result.Changes {
+		result.Changes[i].Description = redactor.Redact(c.Description)
+		changes[i] = result.Changes[i].String()
+	}
+
 	// Step 2: Group errors using LLM
+	listener.OnProgress(Progress{Stage: StageGrouping, ErrorCount: len(errorLogs)})
 	groups, err := d.agent.GroupErrors(ctx, adkErrors)
 	if err != nil {
 		return nil, fmt.Errorf("failed to group errors: %w", err)
@@ -84,58 +153,202 @@ func (d *Debugger) DebugResource(ctx context.Context, projectID, resourceType, r
 
 	// Step 2.5: Merge groups by trace correlation
 	groups = d.agent.MergeGroupsByTrace(groups)
+	listener.OnGroupsReady(result, len(groups))
 
-	// Step 3: Analyze each group
-	for _, group := range groups {
-		groupResult := ErrorGroupResult{
-			Pattern:        group.Pattern,
-			ErrorCount:     group.Count,
-			Representative: group.Representative.Message,
-			TraceID:        group.Representative.TraceID,
-			TraceTimestamp: group.Representative.Timestamp,
+	// Step 3: Analyze groups concurrently, reporting results in group order
+	listener.OnProgress(Progress{Stage: StageAnalyzing, ErrorCount: len(errorLogs), GroupCount: len(groups), GroupIndex: 1})
+	input := adk.AnalysisInput{Changes: changes, Anomalies: result.Anomalies, MaxToolSteps: d.config.MaxToolSteps}
+	if d.config.MaxToolSteps > 0 {
+		input.Tools = d.tools(projectID, resourceType, resourceName)
+	}
+	prefix := cacheKeyPrefix(projectID, resourceType, resourceName)
+	d.analyzeGroups(ctx, lClient, d.tClients[projectID], prefix, groups, input, func(i int, groupResult ErrorGroupResult) {
+		result.ErrorGroups = append(result.ErrorGroups, groupResult)
+		listener.OnGroupAnalyzed(result, i, groupResult)
+		if i+1 < len(groups) {
+			listener.OnProgress(Progress{Stage: StageAnalyzing, ErrorCount: len(errorLogs), GroupCount: len(groups), GroupIndex: i + 2})
 		}
+	})
+
+	// Failed analyses degrade to a placeholder, so a cancelled run is only detected here
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
 
-		// Get trace logs if available (limit to most recent relevant logs)
-		var traceLogs []string
-		if group.Representative.TraceID != "" {
-			traceEntries, err := lClient.GetLogsByTraceID(ctx, group.Representative.TraceID)
-			if err != nil {
-				d.logger.Warn("Failed to get trace logs",
-					zap.String("trace_id", group.Representative.TraceID),
-					zap.Error(err))
-			} else {
-				for i, entry := range traceEntries {
-					if i >= maxTraceLogsForAnalysis {
-						break
-					}
-					traceLogs = append(traceLogs, fmt.Sprintf("[%s] %s: %s",
-						entry.Timestamp.Format(time.RFC3339),
-						entry.Severity,
-						entry.Message))
-				}
+	d.logger.Info("Debug analysis complete",
+		zap.Int("total_errors", result.TotalErrors),
+		zap.Int("analyzed_errors", result.Analyzed),
+		zap.Int("group_count", len(result.ErrorGroups)),
+		zap.Int("prompt_tokens", meter.Total().PromptTokens),
+		zap.Int("response_tokens", meter.Total().ResponseTokens))
+	return result, nil
+}
+
+// FollowUp answers a question about a previous result, given the earlier questions and answers.
+func (d *Debugger) FollowUp(ctx context.Context, result *DebugResult, history []adk.Turn, question string) (string, error) {
+	meter := &adk.UsageMeter{}
+	answer, err := d.agent.AnswerFollowUp(adk.WithUsageMeter(ctx, meter), result.FollowUpContext(), history, question)
+	usage := meter.Total()
+	adk.UsageMeterFrom(ctx).Add(usage)
+	d.recordUsage(ctx, "follow_up", result.ProjectID, result.ResourceType, result.ResourceName, usage)
+	return d.config.Redactor.Redact(answer), err
+}
+
+// analyzeGroups analyzes groups with up to Config.Concurrency workers.
+// report is called from the calling goroutine for each group in order, as soon as it and all groups before it are done.
+func (d *Debugger) analyzeGroups(ctx context.Context, lClient *logging.Client, tClient *cloudtrace.Client, cachePrefix string, groups []adk.ErrorGroup, input adk.AnalysisInput, report func(index int, result ErrorGroupResult)) {
+	results := make([]ErrorGroupResult, len(groups))
+	done := make(chan int)
+	sem := make(chan struct{}, d.concurrency())
+	var wg sync.WaitGroup
+	go func() {
+		for i, group := range groups {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break // groups not started yet are left out of the result
 			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = d.analyzeGroup(ctx, lClient, tClient, cachePrefix, group, input)
+				done <- i
+			}()
 		}
+		wg.Wait()
+		close(done)
+	}()
 
-		// Analyze the error group
-		analysis, err := d.agent.AnalyzeErrors(ctx, group, traceLogs)
-		if err != nil {
-			d.logger.Warn("Failed to analyze error group",
+	finished := make([]bool, len(groups))
+	next := 0
+	for i := range done {
+		finished[i] = true
+		for next < len(groups) && finished[next] {
+			report(next, results[next])
+			next++
+		}
+	}
+}
+
+func (d *Debugger) concurrency() int {
+	if d.config.Concurrency < 1 {
+		return 1
+	}
+	return d.config.Concurrency
+}
+
+// analyzeGroup fetches trace logs and spans and runs the LLM analysis for one group, reusing a cached
+// analysis of the same errors when available.
+// Failures degrade to a placeholder analysis rather than failing the whole run.
+func (d *Debugger) analyzeGroup(ctx context.Context, lClient *logging.Client, tClient *cloudtrace.Client, cachePrefix string, group adk.ErrorGroup, input adk.AnalysisInput) ErrorGroupResult {
+	groupResult := ErrorGroupResult{
+		Pattern:        d.config.Redactor.Redact(group.Pattern),
+		ErrorCount:     group.Count,
+		Representative: group.Representative.Message,
+		TraceID:        group.Representative.TraceID,
+		TraceTimestamp: group.Representative.Timestamp,
+		ErrorType:      group.Representative.ErrorType,
+		Request:        group.Representative.Request,
+		StackTrace:     group.Representative.StackTrace,
+	}
+	groupResult.FirstSeen, groupResult.LastSeen = group.TimeRange()
+
+	cacheKey := cachePrefix + adk.GroupFingerprint(group)
+	if d.cache != nil {
+		if cached, ok := d.cache.get(cacheKey); ok {
+			d.logger.Info("Reusing cached analysis",
 				zap.String("pattern", group.Pattern),
-				zap.Error(err))
-			groupResult.Analysis = adk.ErrorAnalysis{
-				Summary:        fmt.Sprintf("Analysis unavailable for: %s", group.Pattern),
-				PossibleCauses: []string{"Analysis failed"},
-				Suggestions:    []string{"Review logs manually"},
-			}
-		} else {
-			groupResult.Analysis = *analysis
+				zap.Time("analyzed_at", cached.AnalyzedAt))
+			groupResult.Analysis = cached.Analysis
+			groupResult.SeenBefore = cached.AnalyzedAt
+			return groupResult
 		}
+	}
 
-		result.ErrorGroups = append(result.ErrorGroups, groupResult)
+	// Get trace logs if available (limit to most recent relevant logs)
+	if group.Representative.TraceID != "" {
+		input.TraceLogs = d.traceLogs(ctx, lClient, group.Representative.TraceID)
+		groupResult.TraceLogs = input.TraceLogs
+		if tClient != nil {
+			input.TraceSpans = d.traceSpans(ctx, tClient, group.Representative.TraceID)
+			groupResult.TraceSpans = input.TraceSpans
+		}
 	}
 
-	d.logger.Info("Debug analysis complete",
-		zap.Int("total_errors", result.TotalErrors),
-		zap.Int("group_count", len(result.ErrorGroups)))
-	return result, nil
+	// Analyze the error group
+	analysisCtx, cancel := d.withTimeout(ctx, d.config.AnalysisTimeout)
+	defer cancel()
+	analysis, err := d.agent.AnalyzeErrors(analysisCtx, group, input)
+	if err != nil {
+		d.logger.Warn("Failed to analyze error group",
+			zap.String("pattern", group.Pattern),
+			zap.Error(err))
+		groupResult.Analysis = adk.ErrorAnalysis{
+			Summary:        fmt.Sprintf("Analysis unavailable for: %s", group.Pattern),
+			PossibleCauses: []string{"Analysis failed"},
+			Suggestions:    []string{"Review logs manually"},
+		}
+	} else {
+		// The model may echo secrets from tool output or infer them, so its answer is redacted before it is posted
+		groupResult.Analysis = d.redactAnalysis(*analysis)
+		if d.cache != nil {
+			d.cache.put(cacheKey, groupResult.Analysis)
+		}
+	}
+	return groupResult
+}
+
+// redactAnalysis masks secrets and personal data in the text of an analysis.
+func (d *Debugger) redactAnalysis(a adk.ErrorAnalysis) adk.ErrorAnalysis {
+	r := d.config.Redactor
+	a.Summary = r.Redact(a.Summary)
+	a.PossibleCauses = r.Strings(a.PossibleCauses)
+	a.Suggestions = r.Strings(a.Suggestions)
+	a.Response = r.Redact(a.Response)
+	return a
+}
+
+// traceLogs returns the formatted logs of a trace, or nil if they cannot be fetched in time.
+func (d *Debugger) traceLogs(ctx context.Context, lClient *logging.Client, traceID string) []string {
+	traceCtx, cancel := d.withTimeout(ctx, d.config.TraceLogsTimeout)
+	defer cancel()
+	traceEntries, err := lClient.GetLogsByTraceID(traceCtx, traceID, logging.QueryOptions{Limit: maxTraceLogsForAnalysis})
+	if err != nil {
+		d.logger.Warn("Failed to get trace logs",
+			zap.String("trace_id", traceID),
+			zap.Error(err))
+		return nil
+	}
+
+	var traceLogs []string
+	for _, entry := range traceEntries {
+		traceLogs = append(traceLogs, d.config.Redactor.Redact(formatLogLine(entry)))
+	}
+	return traceLogs
+}
+
+// traceSpans returns a critical-path summary of a trace's spans, or nil if the trace cannot be fetched in time.
+func (d *Debugger) traceSpans(ctx context.Context, tClient *cloudtrace.Client, traceID string) []string {
+	traceCtx, cancel := d.withTimeout(ctx, d.config.TraceLogsTimeout)
+	defer cancel()
+	t, err := tClient.GetTrace(traceCtx, traceID)
+	if err != nil {
+		// Traces are sampled, so many errors have no spans
+		d.logger.Warn("Failed to get trace spans",
+			zap.String("trace_id", traceID),
+			zap.Error(err))
+		return nil
+	}
+	return d.config.Redactor.Strings(t.Summary())
+}
+
+// withTimeout applies timeout to ctx unless it is zero.
+func (d *Debugger) withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
 }
@@ -1,10 +1,20 @@
 package debug
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudrun"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudtrace"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/logging"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/monitoring"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/redact"
+	"go.uber.org/zap"
 )
 
 func TestDebugResult(t *testing.T) {
@@ -67,3 +77,361 @@ func TestConfig(t *testing.T) {
 		t.Errorf("Expected lookback 30m, got %v", cfg.LookbackDuration)
 	}
 }
+
+func TestDetectSpike(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	series := func(values ...float64) monitoring.TimeSeries {
+		ts := make(monitoring.TimeSeries, len(values))
+		for i, v := range values {
+			ts[i] = monitoring.Point{Time: base.Add(time.Duration(i) * time.Minute), Val: v}
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name      string
+		series    monitoring.TimeSeries
+		minValue  float64
+		wantFound bool
+		wantStart time.Time
+		wantPeak  float64
+	}{
+		{
+			name:      "spike after stable baseline",
+			series:    series(1, 2, 1, 2, 1, 40, 55, 50),
+			minValue:  5,
+			wantFound: true,
+			wantStart: base.Add(5 * time.Minute),
+			wantPeak:  55,
+		},
+		{
+			name:     "stable series",
+			series:   series(10, 12, 11, 9, 10, 12),
+			minValue: 5,
+		},
+		{
+			name:     "spike below minimum value",
+			series:   series(0, 0, 0, 0, 3),
+			minValue: 5,
+		},
+		{
+			name:     "too few points",
+			series:   series(0, 100),
+			minValue: 5,
+		},
+		{
+			name: "points with the same timestamp are summed",
+			series: append(series(1, 1, 1, 1, 5),
+				monitoring.Point{Time: base.Add(4 * time.Minute), Val: 5}),
+			minValue:  5,
+			wantFound: true,
+			wantStart: base.Add(4 * time.Minute),
+			wantPeak:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := detectSpike(tt.series, 3, tt.minValue)
+			if found != tt.wantFound {
+				t.Fatalf("detectSpike() found = %v, want %v", found, tt.wantFound)
+			}
+			if !found {
+				return
+			}
+			if !got.Start.Equal(tt.wantStart) {
+				t.Errorf("detectSpike() start = %v, want %v", got.Start, tt.wantStart)
+			}
+			if got.Peak != tt.wantPeak {
+				t.Errorf("detectSpike() peak = %v, want %v", got.Peak, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestChangeEvents(t *testing.T) {
+	created := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	revisions := revisionChanges([]cloudrun.CloudRunRevision{
+		{Name: "svc-00002-abc", Creator: "dev@example.com", Image: "gcr.io/p/svc:v2", CreateTime: created},
+	})
+	want := "[2025-01-01T10:00:00Z] Revision svc-00002-abc created by dev@example.com (image: gcr.io/p/svc:v2)"
+	if len(revisions) != 1 || revisions[0].String() != want {
+		t.Errorf("revisionChanges() = %v, want %q", revisions, want)
+	}
+
+	audits := auditChanges([]logging.AuditLogEntry{
+		{
+			Timestamp:    created,
+			MethodName:   "google.cloud.run.v2.Services.UpdateService",
+			Principal:    "ops@example.com",
+			ResourceName: "projects/p/locations/us-central1/services/svc",
+			Error:        "permission denied",
+		},
+	})
+	want = "[2025-01-01T10:00:00Z] UpdateService by ops@example.com on svc (failed: permission denied)"
+	if len(audits) != 1 || audits[0].String() != want {
+		t.Errorf("auditChanges() = %v, want %q", audits, want)
+	}
+}
+
+// fakeAnalyzer analyzes groups after a per-pattern delay and fails patterns listed in fail.
+type fakeAnalyzer struct {
+	delays  map[string]time.Duration
+	fail    map[string]bool
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (f *fakeAnalyzer) GroupErrors(ctx context.Context, errs []adk.ErrorLog) ([]adk.ErrorGroup, error) {
+	return nil, nil
+}
+
+func (f *fakeAnalyzer) MergeGroupsByTrace(groups []adk.ErrorGroup) []adk.ErrorGroup {
+	return groups
+}
+
+func (f *fakeAnalyzer) AnswerFollowUp(ctx context.Context, analysisContext string, history []adk.Turn, question string) (string, error) {
+	return "answer to " + question, nil
+}
+
+func (f *fakeAnalyzer) AnalyzeErrors(ctx context.Context, group adk.ErrorGroup, input adk.AnalysisInput) (*adk.ErrorAnalysis, error) {
+	f.mu.Lock()
+	f.running++
+	f.peak = max(f.peak, f.running)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(f.delays[group.Pattern]):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.fail[group.Pattern] {
+		return nil, errors.New("LLM error")
+	}
+	return &adk.ErrorAnalysis{Summary: "summary of " + group.Pattern}, nil
+}
+
+func TestAnalyzeGroups(t *testing.T) {
+	agent := &fakeAnalyzer{
+		delays: map[string]time.Duration{
+			"a": 60 * time.Millisecond,
+			"b": 10 * time.Millisecond,
+			"c": 30 * time.Millisecond,
+			"d": time.Second, // exceeds the analysis timeout
+		},
+		fail: map[string]bool{"c": true},
+	}
+	d := NewDebugger(nil, nil, nil, nil, agent, Config{
+		Concurrency:     2,
+		AnalysisTimeout: 200 * time.Millisecond,
+	}, zap.NewNop())
+
+	groups := []adk.ErrorGroup{{Pattern: "a"}, {Pattern: "b"}, {Pattern: "c"}, {Pattern: "d"}}
+	var indices []int
+	var results []ErrorGroupResult
+	d.analyzeGroups(context.Background(), nil, nil, "p/service/svc/", groups, adk.AnalysisInput{}, func(i int, r ErrorGroupResult) {
+		indices = append(indices, i)
+		results = append(results, r)
+	})
+
+	if len(results) != len(groups) {
+		t.Fatalf("got %d results, want %d", len(results), len(groups))
+	}
+	for i, r := range results {
+		if indices[i] != i || r.Pattern != groups[i].Pattern {
+			t.Errorf("result %d = %s (index %d), want %s in order", i, r.Pattern, indices[i], groups[i].Pattern)
+		}
+	}
+	if results[0].Analysis.Summary != "summary of a" || results[1].Analysis.Summary != "summary of b" {
+		t.Errorf("unexpected summaries: %q, %q", results[0].Analysis.Summary, results[1].Analysis.Summary)
+	}
+	for _, i := range []int{2, 3} {
+		if !strings.HasPrefix(results[i].Analysis.Summary, "Analysis unavailable") {
+			t.Errorf("group %s should degrade to a placeholder, got %q", results[i].Pattern, results[i].Analysis.Summary)
+		}
+	}
+	if agent.peak > 2 {
+		t.Errorf("peak concurrency = %d, want at most 2", agent.peak)
+	}
+}
+
+func TestAnalyzeGroups_Cancelled(t *testing.T) {
+	agent := &fakeAnalyzer{delays: map[string]time.Duration{"a": time.Second, "b": time.Second}}
+	d := NewDebugger(nil, nil, nil, nil, agent, Config{Concurrency: 1}, zap.NewNop())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var results []ErrorGroupResult
+	d.analyzeGroups(ctx, nil, nil, "p/service/svc/", []adk.ErrorGroup{{Pattern: "a"}, {Pattern: "b"}}, adk.AnalysisInput{}, func(i int, r ErrorGroupResult) {
+		results = append(results, r)
+	})
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("analyzeGroups() took %v after cancellation", elapsed)
+	}
+	if len(results) > 1 {
+		t.Errorf("got %d results, groups not started should be left out", len(results))
+	}
+}
+
+func TestAnalysisCache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	cache := newAnalysisCache(30 * time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.put("p/service/svc/abc", adk.ErrorAnalysis{Summary: "cached"})
+
+	got, ok := cache.get("p/service/svc/abc")
+	if !ok || got.Analysis.Summary != "cached" || !got.AnalyzedAt.Equal(now) {
+		t.Errorf("get() = %+v, %v; want cached analysis", got, ok)
+	}
+	if _, ok := cache.get("p/service/other/abc"); ok {
+		t.Error("get() of another resource should miss")
+	}
+
+	now = now.Add(31 * time.Minute)
+	if _, ok := cache.get("p/service/svc/abc"); ok {
+		t.Error("get() should miss after the TTL")
+	}
+}
+
+func TestAnalyzeGroups_ReusesCachedAnalysis(t *testing.T) {
+	agent := &fakeAnalyzer{}
+	d := NewDebugger(nil, nil, nil, nil, agent, Config{Concurrency: 1, CacheTTL: time.Hour}, zap.NewNop())
+	groups := []adk.ErrorGroup{{Pattern: "a", Representative: adk.ErrorLog{Message: "timeout after 30s"}, Count: 1}}
+
+	var first, second []ErrorGroupResult
+	d.analyzeGroups(context.Background(), nil, nil, "p/service/svc/", groups, adk.AnalysisInput{}, func(i int, r ErrorGroupResult) {
+		first = append(first, r)
+	})
+	agent.fail = map[string]bool{"a": true} // a second LLM call would fail
+	d.analyzeGroups(context.Background(), nil, nil, "p/service/svc/", groups, adk.AnalysisInput{}, func(i int, r ErrorGroupResult) {
+		second = append(second, r)
+	})
+
+	if !first[0].SeenBefore.IsZero() {
+		t.Error("first analysis should not be marked as seen before")
+	}
+	if second[0].SeenBefore.IsZero() || second[0].Analysis.Summary != "summary of a" {
+		t.Errorf("second analysis should reuse the cached one, got %+v", second[0])
+	}
+}
+
+func TestAnalyzeGroups_Redacts(t *testing.T) {
+	redactor, err := redact.New([]string{"all"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDebugger(nil, nil, nil, nil, &fakeAnalyzer{}, Config{Concurrency: 1, Redactor: redactor}, zap.NewNop())
+	groups := []adk.ErrorGroup{{Pattern: "login failed for bob@example.com"}}
+
+	var results []ErrorGroupResult
+	d.analyzeGroups(context.Background(), nil, nil, "p/service/svc/", groups, adk.AnalysisInput{}, func(i int, r ErrorGroupResult) {
+		results = append(results, r)
+	})
+
+	if want := "login failed for [REDACTED:email]"; results[0].Pattern != want {
+		t.Errorf("Pattern = %q, want %q", results[0].Pattern, want)
+	}
+	if want := "summary of login failed for [REDACTED:email]"; results[0].Analysis.Summary != want {
+		t.Errorf("Summary = %q, want %q", results[0].Analysis.Summary, want)
+	}
+}
+
+func TestFollowUp_Usage(t *testing.T) {
+	agent := adk.NewDebugAgentWithBackend(&adk.FakeBackend{}, zap.NewNop())
+	d := NewDebugger(nil, nil, nil, nil, agent, Config{Pricing: adk.Pricing{InputPerMillion: 1, OutputPerMillion: 1}}, zap.NewNop())
+
+	meter := &adk.UsageMeter{}
+	result := &DebugResult{ProjectID: "p", ResourceType: "service", ResourceName: "svc"}
+	if _, err := d.FollowUp(adk.WithUsageMeter(context.Background(), meter), result, nil, "why?"); err != nil {
+		t.Fatalf("FollowUp() error = %v", err)
+	}
+	if usage := meter.Total(); usage.Calls != 1 || usage.PromptTokens == 0 {
+		t.Errorf("caller's meter = %+v, want the follow-up call", usage)
+	}
+}
+
+func TestDebugResult_FollowUpContext(t *testing.T) {
+	result := &DebugResult{
+		ResourceName: "svc",
+		ResourceType: "service",
+		ProjectID:    "p",
+		TotalErrors:  3,
+		Analyzed:     3,
+		ErrorGroups: []ErrorGroupResult{
+			{
+				Pattern:        "Null pointer",
+				ErrorCount:     3,
+				Representative: "java.lang.NullPointerException",
+				StackTrace:     "java.lang.NullPointerException\n\tat com.example.Foo.bar(Foo.java:10)",
+				TraceLogs:      []string{"[2025-01-01T10:00:00Z] INFO: request started"},
+				Analysis:       adk.ErrorAnalysis{Summary: "Foo.bar dereferences null"},
+			},
+		},
+	}
+
+	got := result.FollowUpContext()
+	for _, want := range []string{
+		"Resource: service svc (project p)",
+		"Group 1: Null pointer (3 errors)",
+		"at com.example.Foo.bar(Foo.java:10)",
+		"INFO: request started",
+		"Analysis summary: Foo.bar dereferences null",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("FollowUpContext() does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestDebuggerTools(t *testing.T) {
+	d := NewDebugger(
+		map[string]*logging.Client{"p": nil},
+		map[string]*cloudrun.Client{"p": nil},
+		map[string]*monitoring.Client{"p": nil},
+		map[string]*cloudtrace.Client{"p": nil},
+		nil, Config{LookbackDuration: 30 * time.Minute}, zap.NewNop())
+
+	tests := []struct {
+		name         string
+		projectID    string
+		resourceType string
+		want         []string
+	}{
+		{name: "service", projectID: "p", resourceType: "service", want: []string{"query_logs", "get_trace_logs", "get_trace_spans", "get_service_config", "list_revisions", "get_metrics"}},
+		{name: "job", projectID: "p", resourceType: "job", want: []string{"query_logs", "get_trace_logs", "get_trace_spans", "get_service_config"}},
+		{name: "unknown project", projectID: "other", resourceType: "service", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, tool := range d.tools(tt.projectID, tt.resourceType, "my-resource") {
+				got = append(got, tool.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("tools() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTimeSeries(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	series := monitoring.TimeSeriesMap{
+		"5xx": {{Time: base.Add(time.Minute), Val: 7}, {Time: base, Val: 1}, {Time: base, Val: 2}},
+		"2xx": {{Time: base, Val: 100}},
+	}
+	want := "2xx: 10:00=100\n5xx: 10:00=3, 10:01=7"
+	if got := formatTimeSeries(series); got != want {
+		t.Errorf("formatTimeSeries() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,43 @@
+package debug
+
+import (
+	"context"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// LLM usage metrics. They are recorded with the global MeterProvider, which main registers
+// with METRICS_ENABLED, and are no-ops otherwise.
+var (
+	meter         = otel.Meter("github.com/nakamasato/cloud-run-slack-bot")
+	llmCalls, _   = meter.Int64Counter("debug.llm.calls", metric.WithDescription("Number of LLM calls made by debug analyses"), metric.WithUnit("{call}"))
+	llmTokens, _  = meter.Int64Counter("debug.llm.tokens", metric.WithDescription("Tokens used by debug analyses, by direction (prompt or response)"), metric.WithUnit("{token}"))
+	llmCostUSD, _ = meter.Float64Counter("debug.llm.cost", metric.WithDescription("Estimated cost of debug analyses"), metric.WithUnit("USD"))
+)
+
+// recordUsage exports the usage of an analysis or follow-up as metrics and returns its estimated cost.
+func (d *Debugger) recordUsage(ctx context.Context, operation, projectID, resourceType, resourceName string, usage adk.Usage) float64 {
+	cost := d.config.Pricing.Cost(usage)
+	if usage.Calls == 0 {
+		return cost
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("operation", operation),
+		attribute.String("project_id", projectID),
+		attribute.String("resource_type", resourceType),
+		attribute.String("resource_name", resourceName),
+		attribute.String("model", d.config.Model),
+	}
+	// The run may have been cancelled, but its usage is still recorded
+	ctx = context.WithoutCancel(ctx)
+	llmCalls.Add(ctx, int64(usage.Calls), metric.WithAttributes(attrs...))
+	llmTokens.Add(ctx, int64(usage.PromptTokens), metric.WithAttributes(append(attrs, attribute.String("direction", "prompt"))...))
+	llmTokens.Add(ctx, int64(usage.ResponseTokens), metric.WithAttributes(append(attrs, attribute.String("direction", "response"))...))
+	if !d.config.Pricing.IsZero() {
+		llmCostUSD.Add(ctx, cost, metric.WithAttributes(attrs...))
+	}
+	return cost
+}
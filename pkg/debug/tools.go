@@ -0,0 +1,239 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/logging"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/monitoring"
+	"google.golang.org/genai"
+)
+
+const (
+	defaultToolLogLimit  = 20
+	maxToolLogLimit      = 50
+	maxToolWindowMinutes = 24 * 60
+	maxToolRevisions     = 20
+)
+
+// tools returns the tools the agent can call while analyzing errors of a resource.
+// Tools whose client is not configured for the project are left out.
+func (d *Debugger) tools(projectID, resourceType, resourceName string) []adk.Tool {
+	var tools []adk.Tool
+	defaultMinutes := int(d.config.LookbackDuration.Minutes())
+
+	if lClient, ok := d.lClients[projectID]; ok {
+		tools = append(tools,
+			adk.Tool{
+				Name:        "query_logs",
+				Description: fmt.Sprintf("Query logs of the %s %s with a filter, newest first.", resourceType, resourceName),
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"filter":  {Type: genai.TypeString, Description: `Clauses joined with AND: severity comparisons, textPayload or jsonPayload.<field> substrings and httpRequest.status comparisons, e.g. severity>=WARNING AND textPayload:"timeout". OR and NOT are not supported. The resource is already scoped.`},
+						"minutes": {Type: genai.TypeInteger, Description: "How many minutes back to search."},
+						"limit":   {Type: genai.TypeInteger, Description: fmt.Sprintf("Maximum number of entries (up to %d).", maxToolLogLimit)},
+					},
+				},
+				Run: func(ctx context.Context, args map[string]any) (string, error) {
+					minutes := adk.IntArg(args, "minutes", defaultMinutes, maxToolWindowMinutes)
+					entries, err := lClient.QueryLogs(ctx, resourceType, resourceName, adk.StringArg(args, "filter", ""),
+						time.Duration(minutes)*time.Minute, logging.QueryOptions{Limit: adk.IntArg(args, "limit", defaultToolLogLimit, maxToolLogLimit)})
+					if err != nil {
+						return "", err
+					}
+					return formatLogLines(entries), nil
+				},
+			},
+			adk.Tool{
+				Name:        "get_trace_logs",
+				Description: fmt.Sprintf("Get the logs the %s %s wrote for a trace, to follow a request through it.", resourceType, resourceName),
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"trace_id": {Type: genai.TypeString, Description: "Trace ID of a log entry, 32 hexadecimal characters."},
+					},
+					Required: []string{"trace_id"},
+				},
+				Run: func(ctx context.Context, args map[string]any) (string, error) {
+					traceID := adk.StringArg(args, "trace_id", "")
+					if traceID == "" {
+						return "", fmt.Errorf("trace_id is required")
+					}
+					entries, err := lClient.GetResourceLogsByTraceID(ctx, resourceType, resourceName, traceID, logging.QueryOptions{Limit: maxToolLogLimit})
+					if err != nil {
+						return "", err
+					}
+					return formatLogLines(entries), nil
+				},
+			},
+		)
+	}
+
+	if tClient, ok := d.tClients[projectID]; ok {
+		tools = append(tools, adk.Tool{
+			Name:        "get_trace_spans",
+			Description: "Get the critical path of a trace from Cloud Trace: span names, durations, status and key attributes. Reveals slow or failing downstream calls that do not show up in logs.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"trace_id": {Type: genai.TypeString, Description: "Trace ID of a log entry."},
+				},
+				Required: []string{"trace_id"},
+			},
+			Run: func(ctx context.Context, args map[string]any) (string, error) {
+				traceID := adk.StringArg(args, "trace_id", "")
+				if traceID == "" {
+					return "", fmt.Errorf("trace_id is required")
+				}
+				t, err := tClient.GetTrace(ctx, traceID)
+				if err != nil {
+					return "", err
+				}
+				return strings.Join(t.Summary(), "\n"), nil
+			},
+		})
+	}
+
+	if rClient, ok := d.rClients[projectID]; ok {
+		tools = append(tools, adk.Tool{
+			Name:        "get_service_config",
+			Description: fmt.Sprintf("Get the current configuration of the %s %s: image, latest revision, last modifier and resource limits.", resourceType, resourceName),
+			Run: func(ctx context.Context, _ map[string]any) (string, error) {
+				if resourceType == "job" {
+					job, err := rClient.GetJob(ctx, resourceName)
+					if err != nil {
+						return "", err
+					}
+					return job.String(), nil
+				}
+				svc, err := rClient.GetService(ctx, resourceName)
+				if err != nil {
+					return "", err
+				}
+				return svc.String(), nil
+			},
+		})
+		if resourceType == "service" {
+			tools = append(tools, adk.Tool{
+				Name:        "list_revisions",
+				Description: fmt.Sprintf("List recent revisions of the service %s, newest first, with their image, creator and creation time.", resourceName),
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"limit": {Type: genai.TypeInteger, Description: fmt.Sprintf("Maximum number of revisions (up to %d).", maxToolRevisions)},
+					},
+				},
+				Run: func(ctx context.Context, args map[string]any) (string, error) {
+					revisions, err := rClient.ListRevisions(ctx, resourceName, adk.IntArg(args, "limit", maxRevisionsForContext, maxToolRevisions))
+					if err != nil {
+						return "", err
+					}
+					changes := revisionChanges(revisions)
+					lines := make([]string, len(changes))
+					for i, c := range changes {
+						lines[i] = c.String()
+					}
+					return strings.Join(lines, "\n"), nil
+				},
+			})
+		}
+	}
+
+	// Request metrics are only available for services
+	if mClient, ok := d.mClients[projectID]; ok && resourceType == "service" {
+		tools = append(tools, adk.Tool{
+			Name:        "get_metrics",
+			Description: fmt.Sprintf("Get per-minute request metrics of the service %s: request counts by response code class, or latency percentiles in ms.", resourceName),
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"metric":  {Type: genai.TypeString, Enum: []string{"request_count", "latency"}, Description: "Metric to get."},
+					"minutes": {Type: genai.TypeInteger, Description: "How many minutes back to get."},
+				},
+				Required: []string{"metric"},
+			},
+			Run: func(ctx context.Context, args map[string]any) (string, error) {
+				minutes := adk.IntArg(args, "minutes", defaultMinutes, maxToolWindowMinutes)
+				endTime := time.Now().UTC().Truncate(anomalyAggregationPeriod)
+				startTime := endTime.Add(-time.Duration(minutes) * time.Minute)
+				var series *monitoring.TimeSeriesMap
+				var err error
+				switch metric := adk.StringArg(args, "metric", ""); metric {
+				case "request_count":
+					series, err = mClient.GetCloudRunServiceRequestCount(ctx, resourceName, anomalyAggregationPeriod, startTime, endTime)
+				case "latency":
+					series, err = mClient.GetCloudRunServiceRequestLatencies(ctx, resourceName, anomalyAggregationPeriod, startTime, endTime)
+				default:
+					return "", fmt.Errorf("unsupported metric: %q", metric)
+				}
+				if err != nil {
+					return "", err
+				}
+				return formatTimeSeries(*series), nil
+			},
+		})
+	}
+
+	// Tool output is raw log, trace and configuration data, so it is redacted like the error logs
+	for i := range tools {
+		run := tools[i].Run
+		tools[i].Run = func(ctx context.Context, args map[string]any) (string, error) {
+			output, err := run(ctx, args)
+			return d.config.Redactor.Redact(output), err
+		}
+	}
+	return tools
+}
+
+// formatLogLine formats a log entry as "[timestamp] SEVERITY: message [request: ...]".
+func formatLogLine(entry logging.LogEntry) string {
+	line := fmt.Sprintf("[%s] %s: %s",
+		entry.Timestamp.Format(time.RFC3339),
+		entry.Severity,
+		entry.Message)
+	if entry.HTTPRequest != nil {
+		line = fmt.Sprintf("%s [request: %s]", line, entry.HTTPRequest)
+	}
+	return line
+}
+
+func formatLogLines(entries []logging.LogEntry) string {
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = formatLogLine(entry)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatTimeSeries formats each series as "label: HH:MM=value, ..." with points summed by time, oldest first.
+func formatTimeSeries(series monitoring.TimeSeriesMap) string {
+	labels := make([]string, 0, len(series))
+	for label := range series {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	var lines []string
+	for _, label := range labels {
+		byTime := make(map[time.Time]float64)
+		for _, p := range series[label] {
+			byTime[p.Time] += p.Val
+		}
+		times := make([]time.Time, 0, len(byTime))
+		for t := range byTime {
+			times = append(times, t)
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+		points := make([]string, len(times))
+		for i, t := range times {
+			points[i] = fmt.Sprintf("%s=%.4g", t.UTC().Format("15:04"), byTime[t])
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", label, strings.Join(points, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
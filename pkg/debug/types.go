@@ -2,14 +2,28 @@
 package debug
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/redact"
 )
 
 // Config for debugger.
 type Config struct {
-	LookbackDuration time.Duration // How far back to look for errors
+	LookbackDuration time.Duration    // How far back to look for errors
+	MaxErrors        int              // Maximum number of error entries to fetch for analysis
+	SampleBuckets    int              // Number of time buckets to sample errors from across the lookback window
+	MaxCount         int              // Upper bound when counting the total number of errors
+	Concurrency      int              // Number of error groups analyzed in parallel
+	AnalysisTimeout  time.Duration    // Timeout of each group's LLM analysis (0 for none)
+	TraceLogsTimeout time.Duration    // Timeout of each group's trace log and span queries (0 for none)
+	CacheTTL         time.Duration    // How long analyses are reused for the same errors (0 disables caching)
+	MaxToolSteps     int              // Maximum tool-calling turns the agent takes per group (0 disables tools)
+	Redactor         *redact.Redactor // Masks secrets and personal data in logs before analysis (nil for none)
+	Model            string           // LLM model name, recorded with usage metrics
+	Pricing          adk.Pricing      // Price of the model, to estimate the cost of analyses (zero if unknown)
 }
 
 // DebugResult contains the complete debug analysis.
@@ -18,9 +32,15 @@ type DebugResult struct {
 	ResourceType string             // Type of the resource (service or job)
 	ProjectID    string             // GCP project ID
 	TotalErrors  int                // Total number of errors found
+	TotalCapped  bool               // Whether counting stopped at the configured maximum
+	Analyzed     int                // Number of errors fetched and analyzed
 	ErrorGroups  []ErrorGroupResult // Analysis results per error group
+	Changes      []ChangeEvent      // Recent deploys and configuration changes, oldest first
+	Anomalies    []string           // Metric anomalies detected during the lookback window
 	GeneratedAt  time.Time          // When the analysis was generated
 	LookbackMin  int                // Lookback duration in minutes
+	Usage        adk.Usage          // Tokens used by the LLM calls of the analysis
+	Cost         float64            // Estimated cost of Usage in USD (0 if the model price is unknown)
 }
 
 // ErrorGroupResult contains analysis for one error group.
@@ -30,5 +50,100 @@ type ErrorGroupResult struct {
 	Representative string            // Representative error message
 	TraceID        string            // Representative trace ID for this group
 	TraceTimestamp time.Time         // Representative trace timestamp for this group
+	FirstSeen      time.Time         // Timestamp of the earliest error in this group
+	LastSeen       time.Time         // Timestamp of the latest error in this group
+	SeenBefore     time.Time         // When the reused analysis was generated (zero if analyzed now)
+	ErrorType      string            // Exception type of the representative error, if known
+	Request        string            // HTTP request of the representative error, if any
+	StackTrace     string            // Stack trace of the representative error, if any
+	TraceLogs      []string          // Logs sharing the representative error's trace
+	TraceSpans     []string          // Critical-path summary of the representative error's trace, if sampled
 	Analysis       adk.ErrorAnalysis // LLM analysis of this group
 }
+
+// Stage is a step of the debug analysis.
+type Stage string
+
+const (
+	StageFetching  Stage = "fetching"  // Fetching error logs
+	StageGrouping  Stage = "grouping"  // Grouping errors
+	StageAnalyzing Stage = "analyzing" // Analyzing error groups
+)
+
+// Progress describes how far a debug analysis has got.
+type Progress struct {
+	Stage      Stage
+	ErrorCount int // Number of errors fetched
+	GroupCount int // Number of error groups
+	GroupIndex int // 1-based index of the first group whose analysis has not been reported yet
+}
+
+// Listener receives progress and partial results while a debug analysis runs.
+type Listener interface {
+	// OnProgress is called when the analysis moves to a new stage or group.
+	OnProgress(p Progress)
+	// OnGroupsReady is called once errors are grouped, before any group is analyzed.
+	OnGroupsReady(result *DebugResult, groupCount int)
+	// OnGroupAnalyzed is called as soon as a group has been analyzed. index is 0-based.
+	OnGroupAnalyzed(result *DebugResult, index int, group ErrorGroupResult)
+}
+
+type nopListener struct{}
+
+func (nopListener) OnProgress(Progress)                                 {}
+func (nopListener) OnGroupsReady(*DebugResult, int)                     {}
+func (nopListener) OnGroupAnalyzed(*DebugResult, int, ErrorGroupResult) {}
+
+// FollowUpContext describes the result, including stack traces and trace logs, for follow-up questions.
+func (r *DebugResult) FollowUpContext() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Resource: %s %s (project %s)\n", r.ResourceType, r.ResourceName, r.ProjectID)
+	fmt.Fprintf(&b, "Time range: last %d minutes before %s\n", r.LookbackMin, r.GeneratedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Total errors: %d (analyzed %d)\n", r.TotalErrors, r.Analyzed)
+	if len(r.Changes) > 0 {
+		b.WriteString("\nRecent changes:\n")
+		for _, c := range r.Changes {
+			fmt.Fprintf(&b, "- %s\n", c)
+		}
+	}
+	if len(r.Anomalies) > 0 {
+		b.WriteString("\nMetric anomalies:\n")
+		for _, a := range r.Anomalies {
+			fmt.Fprintf(&b, "- %s\n", a)
+		}
+	}
+
+	for i, g := range r.ErrorGroups {
+		fmt.Fprintf(&b, "\nGroup %d: %s (%d errors)\n", i+1, g.Pattern, g.ErrorCount)
+		if !g.FirstSeen.IsZero() {
+			fmt.Fprintf(&b, "First seen: %s, last seen: %s\n", g.FirstSeen.UTC().Format(time.RFC3339), g.LastSeen.UTC().Format(time.RFC3339))
+		}
+		fmt.Fprintf(&b, "Representative error: %s\n", g.Representative)
+		if g.ErrorType != "" {
+			fmt.Fprintf(&b, "Error type: %s\n", g.ErrorType)
+		}
+		if g.Request != "" {
+			fmt.Fprintf(&b, "HTTP request: %s\n", g.Request)
+		}
+		if g.TraceID != "" {
+			fmt.Fprintf(&b, "Trace ID: %s\n", g.TraceID)
+		}
+		if g.StackTrace != "" {
+			fmt.Fprintf(&b, "Stack trace:\n%s\n", g.StackTrace)
+		}
+		if len(g.TraceLogs) > 0 {
+			fmt.Fprintf(&b, "Trace logs:\n%s\n", strings.Join(g.TraceLogs, "\n"))
+		}
+		if len(g.TraceSpans) > 0 {
+			fmt.Fprintf(&b, "Trace spans (critical path):\n%s\n", strings.Join(g.TraceSpans, "\n"))
+		}
+		fmt.Fprintf(&b, "Analysis summary: %s\n", g.Analysis.Summary)
+		if len(g.Analysis.PossibleCauses) > 0 {
+			fmt.Fprintf(&b, "Possible causes: %s\n", strings.Join(g.Analysis.PossibleCauses, "; "))
+		}
+		if len(g.Analysis.Suggestions) > 0 {
+			fmt.Fprintf(&b, "Suggestions: %s\n", strings.Join(g.Analysis.Suggestions, "; "))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,64 @@
+// Package deploy keeps the recent changes to Cloud Run services and jobs seen in Cloud Run audit logs,
+// e.g. to show them in the App Home tab.
+package deploy
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxEvents is the number of events kept.
+const maxEvents = 200
+
+// Event is a change to a Cloud Run service or job.
+type Event struct {
+	Time         time.Time
+	ProjectID    string
+	ResourceType string // "service" or "job"
+	Name         string
+	Method       string // e.g. google.cloud.run.v2.Services.UpdateService
+	Revision     string // Latest created revision of a service or execution of a job
+	Modifier     string // Last modifier of the resource, if known
+	Failed       bool
+}
+
+// Log keeps the latest events in memory, so it only covers this instance since it started.
+// A nil Log discards events.
+type Log struct {
+	mu     sync.Mutex
+	events []Event // oldest first
+}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+// Add records an event.
+func (l *Log) Add(event Event) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+	if len(l.events) > maxEvents {
+		l.events = l.events[len(l.events)-maxEvents:]
+	}
+}
+
+// Recent returns up to n of the latest events in projects, newest first.
+func (l *Log) Recent(projects []string, n int) []Event {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var recent []Event
+	for i := len(l.events) - 1; i >= 0 && len(recent) < n; i-- {
+		if slices.Contains(projects, l.events[i].ProjectID) {
+			recent = append(recent, l.events[i])
+		}
+	}
+	return recent
+}
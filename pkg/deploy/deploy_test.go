@@ -0,0 +1,60 @@
+package deploy
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLog_Recent(t *testing.T) {
+	l := NewLog()
+	l.Add(Event{ProjectID: "p1", Name: "web"})
+	l.Add(Event{ProjectID: "p2", Name: "api"})
+	l.Add(Event{ProjectID: "p1", Name: "worker"})
+
+	tests := []struct {
+		name     string
+		projects []string
+		n        int
+		want     []string
+	}{
+		{name: "newest first", projects: []string{"p1", "p2"}, n: 10, want: []string{"worker", "api", "web"}},
+		{name: "limited", projects: []string{"p1", "p2"}, n: 2, want: []string{"worker", "api"}},
+		{name: "filtered by project", projects: []string{"p1"}, n: 10, want: []string{"worker", "web"}},
+		{name: "no projects", n: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := l.Recent(tt.projects, tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Recent() returned %d events, want %d", len(got), len(tt.want))
+			}
+			for i, e := range got {
+				if e.Name != tt.want[i] {
+					t.Errorf("Recent()[%d] = %s, want %s", i, e.Name, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLog_Max(t *testing.T) {
+	l := NewLog()
+	for i := 0; i < maxEvents+10; i++ {
+		l.Add(Event{ProjectID: "p1", Name: fmt.Sprint(i)})
+	}
+	got := l.Recent([]string{"p1"}, maxEvents+10)
+	if len(got) != maxEvents {
+		t.Fatalf("Recent() returned %d events, want %d", len(got), maxEvents)
+	}
+	if got[len(got)-1].Name != "10" {
+		t.Errorf("oldest event = %s, want 10", got[len(got)-1].Name)
+	}
+}
+
+func TestLog_Nil(t *testing.T) {
+	var l *Log
+	l.Add(Event{ProjectID: "p1"})
+	if got := l.Recent([]string{"p1"}, 1); got != nil {
+		t.Errorf("Recent() = %v, want nil", got)
+	}
+}
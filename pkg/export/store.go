@@ -0,0 +1,109 @@
+// Package export saves exported documents, such as debug incident notes, to a GCS bucket or a local directory.
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+// Store saves a document under name (a slash-separated relative path) and returns where it was saved.
+type Store interface {
+	Save(ctx context.Context, name string, data []byte) (string, error)
+}
+
+// NewStore creates a store for destination, either "gs://bucket/prefix" or a local directory.
+// It returns nil if destination is empty.
+func NewStore(ctx context.Context, destination string) (Store, error) {
+	if destination == "" {
+		return nil, nil
+	}
+	if rest, ok := strings.CutPrefix(destination, "gs://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid GCS destination %q: bucket is required", destination)
+		}
+		return NewGCSStore(ctx, bucket, prefix)
+	}
+	return NewDirStore(destination), nil
+}
+
+// DirStore saves documents under a local directory.
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+func (s *DirStore) Save(_ context.Context, name string, data []byte) (string, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	fullPath := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(fullPath, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", fullPath, err)
+	}
+	return fullPath, nil
+}
+
+// GCSStore saves documents as objects in a GCS bucket.
+type GCSStore struct {
+	service *storage.Service
+	bucket  string
+	prefix  string
+}
+
+func NewGCSStore(ctx context.Context, bucket, prefix string) (*GCSStore, error) {
+	service, err := storage.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	return &GCSStore{service: service, bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+func (s *GCSStore) Save(ctx context.Context, name string, data []byte) (string, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	if s.prefix != "" {
+		name = s.prefix + "/" + name
+	}
+	object := &storage.Object{Name: name, ContentType: contentType(name)}
+	if _, err := s.service.Objects.Insert(s.bucket, object).Media(bytes.NewReader(data)).Context(ctx).Do(); err != nil {
+		return "", fmt.Errorf("failed to upload gs://%s/%s: %w", s.bucket, name, err)
+	}
+	return fmt.Sprintf("gs://%s/%s", s.bucket, name), nil
+}
+
+// cleanName rejects names that would escape the store's directory or prefix.
+func cleanName(name string) (string, error) {
+	cleaned := path.Clean(name)
+	if cleaned == "." || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid document name %q", name)
+	}
+	return cleaned, nil
+}
+
+func contentType(name string) string {
+	switch path.Ext(name) {
+	case ".md":
+		return "text/markdown; charset=utf-8"
+	case ".json":
+		return "application/json"
+	default:
+		return "application/octet-stream"
+	}
+}
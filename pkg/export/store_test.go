@@ -0,0 +1,68 @@
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		wantNil     bool
+		wantErr     bool
+	}{
+		{name: "empty", destination: "", wantNil: true},
+		{name: "directory", destination: "/tmp/exports"},
+		{name: "bucket without name", destination: "gs://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStore(context.Background(), tt.destination)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (store == nil) != (tt.wantNil || tt.wantErr) {
+				t.Errorf("NewStore() = %v, wantNil %v", store, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestDirStore_Save(t *testing.T) {
+	dir := t.TempDir()
+	store := NewDirStore(dir)
+
+	location, err := store.Save(context.Background(), "my-project/notes.md", []byte("# Notes"))
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if want := filepath.Join(dir, "my-project", "notes.md"); location != want {
+		t.Errorf("Save() location = %s, want %s", location, want)
+	}
+	data, err := os.ReadFile(location)
+	if err != nil || string(data) != "# Notes" {
+		t.Errorf("saved file = %q, %v", data, err)
+	}
+
+	for _, name := range []string{"../escape.md", "/abs.md", ""} {
+		if _, err := store.Save(context.Background(), name, nil); err == nil {
+			t.Errorf("Save(%q) should fail", name)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := map[string]string{
+		"a/notes.md":   "text/markdown; charset=utf-8",
+		"a/notes.json": "application/json",
+		"a/notes":      "application/octet-stream",
+	}
+	for name, want := range tests {
+		if got := contentType(name); got != want {
+			t.Errorf("contentType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
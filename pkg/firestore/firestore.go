@@ -0,0 +1,127 @@
+// Package firestore reads and writes the documents of a Firestore collection through the REST API. It is shared
+// by the stores that can keep their state in Firestore, e.g. the current resources and pending approvals.
+package firestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	firestoreapi "google.golang.org/api/firestore/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// DefaultDatabase is the database that stores use.
+const DefaultDatabase = "(default)"
+
+// UseFirestore checks the kind of a store: "memory" (or empty) for an in-process store that is lost on restart,
+// or "firestore", which needs projectID. It reports whether the store is kept in Firestore; store names the
+// store in errors, e.g. "approval".
+func UseFirestore(kind, projectID, store string) (bool, error) {
+	switch kind {
+	case "", "memory":
+		return false, nil
+	case "firestore":
+		if projectID == "" {
+			return false, fmt.Errorf("a GCP project is required for the firestore %s store", store)
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported %s store %q: must be memory or firestore", store, kind)
+	}
+}
+
+// Document is the fields of a document.
+type Document map[string]firestoreapi.Value
+
+// String returns a string field, or "" if it is not set.
+func (d Document) String(key string) string {
+	return d[key].StringValue
+}
+
+// Timestamp returns a timestamp field, or zero if it is not set.
+func (d Document) Timestamp(key string) (time.Time, error) {
+	v := d[key].TimestampValue
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", v, err)
+	}
+	return t, nil
+}
+
+func StringValue(s string) firestoreapi.Value {
+	return firestoreapi.Value{StringValue: s}
+}
+
+func TimestampValue(t time.Time) firestoreapi.Value {
+	return firestoreapi.Value{TimestampValue: t.UTC().Format(time.RFC3339Nano)}
+}
+
+// Collection is a collection of documents by ID.
+type Collection struct {
+	documents *firestoreapi.ProjectsDatabasesDocumentsService
+	parent    string // projects/<project>/databases/<database>/documents/<collection>
+}
+
+func NewCollection(ctx context.Context, projectID, database, collection string, opts ...option.ClientOption) (*Collection, error) {
+	service, err := firestoreapi.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Firestore client: %w", err)
+	}
+	return &Collection{
+		documents: service.Projects.Databases.Documents,
+		parent:    fmt.Sprintf("projects/%s/databases/%s/documents/%s", projectID, database, collection),
+	}, nil
+}
+
+func (c *Collection) name(id string) string {
+	return c.parent + "/" + id
+}
+
+// Get returns the fields of a document, or false if it does not exist.
+func (c *Collection) Get(ctx context.Context, id string) (Document, bool, error) {
+	doc, err := c.documents.Get(c.name(id)).Context(ctx).Do()
+	if err != nil {
+		if isNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return doc.Fields, true, nil
+}
+
+// Set replaces a document, creating it if needed.
+func (c *Collection) Set(ctx context.Context, id string, fields Document) error {
+	// Patch without an update mask replaces the whole document
+	_, err := c.documents.Patch(c.name(id), &firestoreapi.Document{Fields: fields}).Context(ctx).Do()
+	return err
+}
+
+// Delete deletes a document, which may not exist.
+func (c *Collection) Delete(ctx context.Context, id string) error {
+	_, err := c.documents.Delete(c.name(id)).Context(ctx).Do()
+	return err
+}
+
+// DeleteExisting deletes a document on the condition that it exists, and reports whether it did. Only one of
+// concurrent callers, possibly on different instances, deletes the document.
+func (c *Collection) DeleteExisting(ctx context.Context, id string) (bool, error) {
+	if _, err := c.documents.Delete(c.name(id)).CurrentDocumentExists(true).Context(ctx).Do(); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,58 @@
+package firestore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUseFirestore(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      string
+		projectID string
+		want      bool
+		wantErr   bool
+	}{
+		{name: "default", kind: "", projectID: "p1", want: false},
+		{name: "memory", kind: "memory", projectID: "", want: false},
+		{name: "firestore", kind: "firestore", projectID: "p1", want: true},
+		{name: "firestore without project", kind: "firestore", projectID: "", wantErr: true},
+		{name: "unsupported", kind: "redis", projectID: "p1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UseFirestore(tt.kind, tt.projectID, "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UseFirestore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("UseFirestore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocument(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("JST", 9*60*60))
+	doc := Document{
+		"name":      StringValue("svc"),
+		"createdAt": TimestampValue(now),
+		"invalid":   {TimestampValue: "yesterday"},
+	}
+	if got := doc.String("name"); got != "svc" {
+		t.Errorf("String(name) = %q, want svc", got)
+	}
+	if got := doc.String("missing"); got != "" {
+		t.Errorf("String(missing) = %q, want empty", got)
+	}
+	got, err := doc.Timestamp("createdAt")
+	if err != nil || !got.Equal(now) {
+		t.Errorf("Timestamp(createdAt) = %v, %v, want %v", got, err, now)
+	}
+	if got, err := doc.Timestamp("missing"); err != nil || !got.IsZero() {
+		t.Errorf("Timestamp(missing) = %v, %v, want zero", got, err)
+	}
+	if _, err := doc.Timestamp("invalid"); err == nil {
+		t.Errorf("Timestamp(invalid) succeeded, want error")
+	}
+}
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"cloud.google.com/go/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Fields that WithContext adds, which Cloud Logging expects on the entry rather than in the payload.
+const (
+	traceKey        = "logging.googleapis.com/trace"
+	spanIDKey       = "logging.googleapis.com/spanId"
+	traceSampledKey = "logging.googleapis.com/trace_sampled"
+)
+
+// NewCloudLogger creates a logger that writes to the log logName in projectID through the Cloud Logging API.
+// Unlike NewLogger, whose entries Cloud Run collects from stdout, entries can go to a dedicated log, e.g. for audit events.
+// Entries are sent in the background; call Close to flush them.
+func NewCloudLogger(ctx context.Context, projectID, logName string) (*Logger, error) {
+	client, err := logging.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud Logging client: %w", err)
+	}
+	core := &cloudLoggingCore{LevelEnabler: zapcore.InfoLevel, logger: client.Logger(logName)}
+	return &Logger{
+		Logger:    zap.New(core),
+		projectID: projectID,
+		client:    client,
+	}, nil
+}
+
+// cloudLoggingCore is a zapcore.Core that writes entries with the Cloud Logging API.
+type cloudLoggingCore struct {
+	zapcore.LevelEnabler
+	logger *logging.Logger
+	fields []zapcore.Field
+}
+
+func (c *cloudLoggingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &cloudLoggingCore{LevelEnabler: c.LevelEnabler, logger: c.logger, fields: append(slices.Clone(c.fields), fields...)}
+}
+
+func (c *cloudLoggingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *cloudLoggingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	payload := enc.Fields
+	payload["message"] = entry.Message
+
+	e := logging.Entry{Timestamp: entry.Time, Severity: severity(entry.Level), Payload: payload}
+	if trace, ok := payload[traceKey].(string); ok {
+		e.Trace = trace
+		delete(payload, traceKey)
+	}
+	if spanID, ok := payload[spanIDKey].(string); ok {
+		e.SpanID = spanID
+		delete(payload, spanIDKey)
+	}
+	if sampled, ok := payload[traceSampledKey].(bool); ok {
+		e.TraceSampled = sampled
+		delete(payload, traceSampledKey)
+	}
+	c.logger.Log(e)
+	return nil
+}
+
+func (c *cloudLoggingCore) Sync() error {
+	return c.logger.Flush()
+}
+
+func severity(level zapcore.Level) logging.Severity {
+	switch level {
+	case zapcore.DebugLevel:
+		return logging.Debug
+	case zapcore.InfoLevel:
+		return logging.Info
+	case zapcore.WarnLevel:
+		return logging.Warning
+	case zapcore.ErrorLevel:
+		return logging.Error
+	default:
+		return logging.Critical
+	}
+}
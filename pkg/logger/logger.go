@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 
+	"cloud.google.com/go/logging"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -15,6 +16,7 @@ import (
 type Logger struct {
 	*zap.Logger
 	projectID string
+	client    *logging.Client // nil unless created by NewCloudLogger
 }
 
 // NewLogger creates a new logger with production configuration.
@@ -106,3 +108,11 @@ func (l *Logger) WithContext(ctx context.Context) *zap.Logger {
 func (l *Logger) Sync() error {
 	return l.Logger.Sync()
 }
+
+// Close flushes buffered log entries and releases the Cloud Logging client, if any.
+func (l *Logger) Close() error {
+	if l.client == nil {
+		return l.Sync()
+	}
+	return l.client.Close()
+}
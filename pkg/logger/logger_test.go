@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"cloud.google.com/go/logging"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -138,3 +139,32 @@ func TestWithContext_NoProjectID(t *testing.T) {
 		t.Error("Expected trace_id field as fallback when no project ID")
 	}
 }
+
+func TestSeverity(t *testing.T) {
+	tests := []struct {
+		level zapcore.Level
+		want  logging.Severity
+	}{
+		{zapcore.DebugLevel, logging.Debug},
+		{zapcore.InfoLevel, logging.Info},
+		{zapcore.WarnLevel, logging.Warning},
+		{zapcore.ErrorLevel, logging.Error},
+		{zapcore.FatalLevel, logging.Critical},
+	}
+	for _, tt := range tests {
+		if got := severity(tt.level); got != tt.want {
+			t.Errorf("severity(%v) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestCloudLoggingCore_With(t *testing.T) {
+	core := &cloudLoggingCore{LevelEnabler: zapcore.InfoLevel}
+	child := core.With([]zapcore.Field{zap.String("a", "b")})
+	if len(core.fields) != 0 || len(child.(*cloudLoggingCore).fields) != 1 {
+		t.Errorf("With() should not modify the parent core: parent %v, child %v", core.fields, child.(*cloudLoggingCore).fields)
+	}
+	if core.Enabled(zapcore.DebugLevel) || !core.Enabled(zapcore.InfoLevel) {
+		t.Error("Expected the core to be enabled from the info level")
+	}
+}
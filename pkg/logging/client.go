@@ -3,25 +3,29 @@ package logging
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
 	"cloud.google.com/go/logging/logadmin"
 	"go.uber.org/zap"
 	"google.golang.org/api/iterator"
+	loggingapi "google.golang.org/api/logging/v2"
+	"google.golang.org/genproto/googleapis/cloud/audit"
 )
 
 // LogEntry represents a simplified log entry for processing.
 type LogEntry struct {
-	Timestamp time.Time
-	Severity  string
-	Message   string
-	TraceID   string
-	SpanID    string
-	Labels    map[string]string
-	Resource  ResourceInfo
+	Timestamp     time.Time
+	Severity      string
+	Message       string
+	TraceID       string
+	SpanID        string
+	Labels        map[string]string
+	Resource      ResourceInfo
+	ErrorType     string       // Exception or error type, e.g. java.lang.NullPointerException
+	StackTrace    string       // Stack trace extracted from the payload, if any
+	HTTPRequest   *HTTPRequest // HTTP request the entry was logged for, if any
+	ReportedError bool         // Whether the entry is an Error Reporting ReportedErrorEvent
 }
 
 // ResourceInfo contains information about the logged resource.
@@ -30,10 +34,20 @@ type ResourceInfo struct {
 	Labels map[string]string
 }
 
+// AuditLogEntry is an admin activity audit log entry for a Cloud Run resource.
+type AuditLogEntry struct {
+	Timestamp    time.Time
+	MethodName   string // e.g. google.cloud.run.v2.Services.UpdateService
+	Principal    string // Who made the change
+	ResourceName string // Full resource name the change was applied to
+	Error        string // Status message if the operation failed
+}
+
 // Client wraps Cloud Logging logadmin client.
 type Client struct {
 	project string
 	client  *logadmin.Client
+	entries *loggingapi.EntriesService // REST client for listing entries with a field mask
 	logger  *zap.Logger
 }
 
@@ -43,54 +57,305 @@ func NewLoggingClient(ctx context.Context, project string, logger *zap.Logger) (
 	if err != nil {
 		return nil, fmt.Errorf("failed to create logadmin client: %w", err)
 	}
+	service, err := loggingapi.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create logging REST client: %w", err)
+	}
 	logger.Info("Logging client created", zap.String("project", project))
-	return &Client{project: project, client: client, logger: logger}, nil
+	return &Client{project: project, client: client, entries: service.Entries, logger: logger}, nil
 }
 
-// GetErrorLogs retrieves error logs for a Cloud Run service or job.
-func (c *Client) GetErrorLogs(ctx context.Context, resourceType, resourceName string, duration time.Duration) ([]LogEntry, error) {
-	startTime := time.Now().Add(-duration)
+// DefaultMaxEntries is the default cap on the number of entries returned by a query.
+const DefaultMaxEntries = 100
+
+// DefaultPageSize is the default page size used when iterating log entries.
+const DefaultPageSize = 100
+
+// QueryOptions controls how many entries a query returns and how they are picked.
+type QueryOptions struct {
+	Limit    int // Maximum number of entries to return (defaults to DefaultMaxEntries)
+	PageSize int // Page size for the underlying API calls (defaults to DefaultPageSize)
+	// Buckets splits the lookback window into this many equal time buckets and samples
+	// entries from each of them, so that older errors are not crowded out by the newest ones.
+	// Values <= 1 return the newest entries only.
+	Buckets int
+}
+
+func (o QueryOptions) limit() int {
+	if o.Limit <= 0 {
+		return DefaultMaxEntries
+	}
+	return o.Limit
+}
+
+func (o QueryOptions) pageSize() int {
+	if o.PageSize <= 0 {
+		return DefaultPageSize
+	}
+	return o.PageSize
+}
 
-	var filter string
+// resourceFilter builds the Cloud Logging filter for logs of a Cloud Run service or job.
+func resourceFilter(resourceType, resourceName string) (string, error) {
 	switch resourceType {
 	case "service":
-		filter = fmt.Sprintf(
-			`resource.type = "cloud_run_revision" AND resource.labels.service_name = "%s" AND severity >= ERROR AND timestamp >= "%s"`,
-			resourceName,
-			startTime.Format(time.RFC3339),
-		)
+		return fmt.Sprintf(`resource.type = "cloud_run_revision" AND resource.labels.service_name = "%s"`, resourceName), nil
 	case "job":
-		filter = fmt.Sprintf(
-			`resource.type = "cloud_run_job" AND resource.labels.job_name = "%s" AND severity >= ERROR AND timestamp >= "%s"`,
-			resourceName,
-			startTime.Format(time.RFC3339),
-		)
+		return fmt.Sprintf(`resource.type = "cloud_run_job" AND resource.labels.job_name = "%s"`, resourceName), nil
 	default:
-		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+		return "", fmt.Errorf("unsupported resource type: %s", resourceType)
+	}
+}
+
+// errorLogFilter builds the Cloud Logging filter for error logs of a resource within [startTime, endTime).
+// A zero endTime leaves the window open-ended.
+func errorLogFilter(resourceType, resourceName string, startTime, endTime time.Time) (string, error) {
+	scope, err := resourceFilter(resourceType, resourceName)
+	if err != nil {
+		return "", err
+	}
+	filter := fmt.Sprintf(`%s AND severity >= ERROR AND timestamp >= "%s"`, scope, startTime.Format(time.RFC3339))
+	if !endTime.IsZero() {
+		filter = fmt.Sprintf(`%s AND timestamp < "%s"`, filter, endTime.Format(time.RFC3339))
+	}
+	return filter, nil
+}
+
+// timeBucket is a half-open time range [Start, End).
+type timeBucket struct {
+	Start time.Time
+	End   time.Time
+}
+
+// splitTimeRange splits [start, end) into n equal buckets ordered newest first.
+func splitTimeRange(start, end time.Time, n int) []timeBucket {
+	if n <= 1 || !end.After(start) {
+		return []timeBucket{{Start: start, End: end}}
+	}
+	width := end.Sub(start) / time.Duration(n)
+	if width < time.Second {
+		// Filters use second precision, so narrower buckets would overlap
+		return []timeBucket{{Start: start, End: end}}
+	}
+	buckets := make([]timeBucket, 0, n)
+	for i := 0; i < n; i++ {
+		bEnd := end.Add(-time.Duration(i) * width)
+		bStart := bEnd.Add(-width)
+		if i == n-1 {
+			bStart = start
+		}
+		buckets = append(buckets, timeBucket{Start: bStart, End: bEnd})
+	}
+	return buckets
+}
+
+// bucketQuota returns how many entries to take from the bucket at index i of n,
+// given the remaining overall budget. Unused quota from earlier buckets is carried over.
+func bucketQuota(remaining, i, n int) int {
+	left := n - i
+	if left <= 0 {
+		return 0
+	}
+	quota := remaining / left
+	if remaining%left != 0 {
+		quota++
+	}
+	return quota
+}
+
+// GetErrorLogs retrieves error logs for a Cloud Run service or job.
+// With opts.Buckets > 1 the entries are sampled across the whole lookback window.
+// Entries are returned newest first.
+func (c *Client) GetErrorLogs(ctx context.Context, resourceType, resourceName string, duration time.Duration, opts QueryOptions) ([]LogEntry, error) {
+	endTime := time.Now()
+	startTime := endTime.Add(-duration)
+
+	if opts.Buckets <= 1 {
+		filter, err := errorLogFilter(resourceType, resourceName, startTime, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		c.logger.Info("Getting error logs",
+			zap.String("project", c.project),
+			zap.String("filter", filter),
+			zap.Int("limit", opts.limit()))
+		return c.queryLogs(ctx, filter, opts.limit(), opts.pageSize())
+	}
+
+	buckets := splitTimeRange(startTime, endTime, opts.Buckets)
+	c.logger.Info("Getting sampled error logs",
+		zap.String("project", c.project),
+		zap.String("resource_type", resourceType),
+		zap.String("resource_name", resourceName),
+		zap.Int("buckets", len(buckets)),
+		zap.Int("limit", opts.limit()))
+
+	var entries []LogEntry
+	remaining := opts.limit()
+	for i, b := range buckets {
+		quota := bucketQuota(remaining, i, len(buckets))
+		if quota <= 0 {
+			break
+		}
+		filter, err := errorLogFilter(resourceType, resourceName, b.Start, b.End)
+		if err != nil {
+			return nil, err
+		}
+		bucketEntries, err := c.queryLogs(ctx, filter, quota, opts.pageSize())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, bucketEntries...)
+		remaining -= len(bucketEntries)
+	}
+	return entries, nil
+}
+
+// countPageSize is the maximum page size of entries.list.
+const countPageSize = 1000
+
+// CountErrorLogs counts the error logs for a Cloud Run service or job in the lookback window.
+// Only the insert IDs of the entries are fetched, and counting stops at maxCount to bound API usage;
+// capped reports whether that happened, in which case there are at least count errors.
+func (c *Client) CountErrorLogs(ctx context.Context, resourceType, resourceName string, duration time.Duration, maxCount int) (count int, capped bool, err error) {
+	filter, err := errorLogFilter(resourceType, resourceName, time.Now().Add(-duration), time.Time{})
+	if err != nil {
+		return 0, false, err
+	}
+
+	req := &loggingapi.ListLogEntriesRequest{
+		ResourceNames: []string{"projects/" + c.project},
+		Filter:        filter,
+	}
+	for maxCount <= 0 || count < maxCount {
+		req.PageSize = countPageSize
+		if maxCount > 0 && maxCount-count < countPageSize {
+			req.PageSize = int64(maxCount - count)
+		}
+		resp, err := c.entries.List(req).Fields("entries/insertId", "nextPageToken").Context(ctx).Do()
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to count log entries: %w", err)
+		}
+		count += len(resp.Entries)
+		if resp.NextPageToken == "" {
+			c.logger.Info("Counted error logs",
+				zap.String("project", c.project),
+				zap.Int("count", count))
+			return count, false, nil
+		}
+		req.PageToken = resp.NextPageToken
+	}
+
+	c.logger.Info("Counted error logs (capped)",
+		zap.String("project", c.project),
+		zap.Int("count", count))
+	return count, true, nil
+}
+
+// GetAuditLogs retrieves admin activity audit logs (deploys, configuration changes) for a Cloud Run service or job.
+func (c *Client) GetAuditLogs(ctx context.Context, resourceType, resourceName string, duration time.Duration, opts QueryOptions) ([]AuditLogEntry, error) {
+	scope, err := resourceFilter(resourceType, resourceName)
+	if err != nil {
+		return nil, err
 	}
+	filter := fmt.Sprintf(`logName = "projects/%s/logs/cloudaudit.googleapis.com%%2Factivity" AND %s AND timestamp >= "%s"`,
+		c.project, scope, time.Now().Add(-duration).Format(time.RFC3339))
 
-	c.logger.Info("Getting error logs",
+	c.logger.Info("Getting audit logs",
 		zap.String("project", c.project),
 		zap.String("filter", filter))
 
-	return c.queryLogs(ctx, filter)
+	var entries []AuditLogEntry
+	it := c.client.Entries(ctx, logadmin.Filter(filter), logadmin.NewestFirst(), logadmin.PageSize(int32(opts.pageSize())))
+	for len(entries) < opts.limit() {
+		entry, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate audit log entries: %w", err)
+		}
+		auditEntry := AuditLogEntry{Timestamp: entry.Timestamp}
+		if payload, ok := entry.Payload.(*audit.AuditLog); ok {
+			auditEntry.MethodName = payload.GetMethodName()
+			auditEntry.Principal = payload.GetAuthenticationInfo().GetPrincipalEmail()
+			auditEntry.ResourceName = payload.GetResourceName()
+			auditEntry.Error = payload.GetStatus().GetMessage()
+		}
+		entries = append(entries, auditEntry)
+	}
+
+	c.logger.Info("Retrieved audit log entries",
+		zap.String("project", c.project),
+		zap.Int("count", len(entries)))
+	return entries, nil
+}
+
+// QueryLogs retrieves logs of a Cloud Run service or job within the last duration that match filter, an additional
+// filter of the clauses supported by parseQueryFilter (e.g. `severity >= WARNING AND textPayload:"timeout"`).
+func (c *Client) QueryLogs(ctx context.Context, resourceType, resourceName, filter string, duration time.Duration, opts QueryOptions) ([]LogEntry, error) {
+	scope, err := resourceFilter(resourceType, resourceName)
+	if err != nil {
+		return nil, err
+	}
+	fullFilter := fmt.Sprintf(`%s AND timestamp >= "%s"`, scope, time.Now().Add(-duration).Format(time.RFC3339))
+	clauses, err := parseQueryFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if clauses != "" {
+		fullFilter = fmt.Sprintf("%s AND %s", fullFilter, clauses)
+	}
+	c.logger.Info("Querying logs",
+		zap.String("project", c.project),
+		zap.String("filter", fullFilter))
+	return c.queryLogs(ctx, fullFilter, opts.limit(), opts.pageSize())
 }
 
 // GetLogsByTraceID retrieves all logs for a specific trace.
-func (c *Client) GetLogsByTraceID(ctx context.Context, traceID string) ([]LogEntry, error) {
+func (c *Client) GetLogsByTraceID(ctx context.Context, traceID string, opts QueryOptions) ([]LogEntry, error) {
+	if !ValidTraceID(traceID) {
+		return nil, fmt.Errorf("invalid trace ID %q", traceID)
+	}
 	// Cloud Run trace format: projects/{project}/traces/{trace_id}
 	filter := fmt.Sprintf(`trace = "projects/%s/traces/%s"`, c.project, traceID)
 	c.logger.Info("Getting logs by trace ID",
 		zap.String("project", c.project),
 		zap.String("trace_id", traceID))
-	return c.queryLogs(ctx, filter)
+	return c.queryLogs(ctx, filter, opts.limit(), opts.pageSize())
+}
+
+// GetResourceLogsByTraceID retrieves the logs of a trace that were written by a Cloud Run service or job.
+func (c *Client) GetResourceLogsByTraceID(ctx context.Context, resourceType, resourceName, traceID string, opts QueryOptions) ([]LogEntry, error) {
+	filter, err := c.resourceTraceFilter(resourceType, resourceName, traceID)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Info("Getting logs of resource by trace ID",
+		zap.String("project", c.project),
+		zap.String("filter", filter))
+	return c.queryLogs(ctx, filter, opts.limit(), opts.pageSize())
 }
 
-func (c *Client) queryLogs(ctx context.Context, filter string) ([]LogEntry, error) {
+// resourceTraceFilter builds the Cloud Logging filter for logs of a trace written by a resource.
+func (c *Client) resourceTraceFilter(resourceType, resourceName, traceID string) (string, error) {
+	if !ValidTraceID(traceID) {
+		return "", fmt.Errorf("invalid trace ID %q", traceID)
+	}
+	scope, err := resourceFilter(resourceType, resourceName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`trace = "projects/%s/traces/%s" AND %s`, c.project, traceID, scope), nil
+}
+
+func (c *Client) queryLogs(ctx context.Context, filter string, maxEntries, pageSize int) ([]LogEntry, error) {
 	var entries []LogEntry
-	const maxEntries = 100 // Limit to prevent memory exhaustion and API quota issues
+	if maxEntries < pageSize {
+		pageSize = maxEntries // Avoid fetching pages larger than what we keep
+	}
 
-	it := c.client.Entries(ctx, logadmin.Filter(filter), logadmin.NewestFirst())
+	it := c.client.Entries(ctx, logadmin.Filter(filter), logadmin.NewestFirst(), logadmin.PageSize(int32(pageSize)))
 	for len(entries) < maxEntries {
 		entry, err := it.Next()
 		if err == iterator.Done {
@@ -100,54 +365,7 @@ func (c *Client) queryLogs(ctx context.Context, filter string) ([]LogEntry, erro
 			return nil, fmt.Errorf("failed to iterate log entries: %w", err)
 		}
 
-		logEntry := LogEntry{
-			Timestamp: entry.Timestamp,
-			Severity:  entry.Severity.String(),
-			Labels:    entry.Labels,
-		}
-
-		// Extract message from payload
-		if entry.Payload != nil {
-			switch p := entry.Payload.(type) {
-			case string:
-				logEntry.Message = p
-			case map[string]interface{}:
-				if msg, ok := p["message"].(string); ok {
-					logEntry.Message = msg
-				} else if textPayload, ok := p["textPayload"].(string); ok {
-					logEntry.Message = textPayload
-				} else {
-					// Fallback to serializing the whole payload as JSON, which is better for LLM analysis than the Go map format
-					jsonBytes, err := json.Marshal(p)
-					if err == nil {
-						logEntry.Message = string(jsonBytes)
-					} else {
-						logEntry.Message = fmt.Sprintf("%v", p)
-					}
-				}
-			default:
-				logEntry.Message = fmt.Sprintf("%v", p)
-			}
-		}
-
-		// Extract trace ID from trace field (format: projects/{project}/traces/{trace_id})
-		if entry.Trace != "" {
-			parts := strings.Split(entry.Trace, "/")
-			if len(parts) >= 4 {
-				logEntry.TraceID = parts[len(parts)-1]
-			}
-		}
-		logEntry.SpanID = entry.SpanID
-
-		// Extract resource info
-		if entry.Resource != nil {
-			logEntry.Resource = ResourceInfo{
-				Type:   entry.Resource.Type,
-				Labels: entry.Resource.Labels,
-			}
-		}
-
-		entries = append(entries, logEntry)
+		entries = append(entries, toLogEntry(entry))
 	}
 
 	c.logger.Info("Retrieved log entries",
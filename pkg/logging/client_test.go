@@ -1,7 +1,18 @@
 package logging
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	loggingapi "google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
 )
 
 func TestLogEntry(t *testing.T) {
@@ -37,3 +48,228 @@ func TestResourceInfo(t *testing.T) {
 		t.Errorf("Expected service_name 'my-service', got %s", resource.Labels["service_name"])
 	}
 }
+
+func TestErrorLogFilter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		resourceType string
+		end          time.Time
+		want         string
+		wantErr      bool
+	}{
+		{
+			name:         "service without end",
+			resourceType: "service",
+			want:         `resource.type = "cloud_run_revision" AND resource.labels.service_name = "my-resource" AND severity >= ERROR AND timestamp >= "2024-01-01T10:00:00Z"`,
+		},
+		{
+			name:         "job with end",
+			resourceType: "job",
+			end:          end,
+			want:         `resource.type = "cloud_run_job" AND resource.labels.job_name = "my-resource" AND severity >= ERROR AND timestamp >= "2024-01-01T10:00:00Z" AND timestamp < "2024-01-01T10:30:00Z"`,
+		},
+		{
+			name:         "unsupported type",
+			resourceType: "function",
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := errorLogFilter(tt.resourceType, "my-resource", start, tt.end)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("errorLogFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("errorLogFilter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTimeRange(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(30 * time.Minute)
+
+	buckets := splitTimeRange(start, end, 3)
+	if len(buckets) != 3 {
+		t.Fatalf("Expected 3 buckets, got %d", len(buckets))
+	}
+	// Newest bucket first
+	if !buckets[0].End.Equal(end) || !buckets[0].Start.Equal(end.Add(-10*time.Minute)) {
+		t.Errorf("Unexpected first bucket: %v - %v", buckets[0].Start, buckets[0].End)
+	}
+	if !buckets[2].Start.Equal(start) {
+		t.Errorf("Expected last bucket to start at %v, got %v", start, buckets[2].Start)
+	}
+	for i := 1; i < len(buckets); i++ {
+		if !buckets[i].End.Equal(buckets[i-1].Start) {
+			t.Errorf("Bucket %d is not contiguous with bucket %d", i, i-1)
+		}
+	}
+
+	if got := splitTimeRange(start, end, 1); len(got) != 1 {
+		t.Errorf("Expected a single bucket for n=1, got %d", len(got))
+	}
+	if got := splitTimeRange(start, start.Add(2*time.Second), 10); len(got) != 1 {
+		t.Errorf("Expected a single bucket for sub-second widths, got %d", len(got))
+	}
+}
+
+func TestBucketQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining int
+		i, n      int
+		want      int
+	}{
+		{name: "even split", remaining: 100, i: 0, n: 4, want: 25},
+		{name: "rounds up", remaining: 10, i: 0, n: 3, want: 4},
+		{name: "carries over unused quota", remaining: 90, i: 2, n: 4, want: 45},
+		{name: "last bucket takes the rest", remaining: 7, i: 3, n: 4, want: 7},
+		{name: "out of range", remaining: 7, i: 4, n: 4, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bucketQuota(tt.remaining, tt.i, tt.n); got != tt.want {
+				t.Errorf("bucketQuota() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryOptionsDefaults(t *testing.T) {
+	opts := QueryOptions{}
+	if opts.limit() != DefaultMaxEntries {
+		t.Errorf("Expected default limit %d, got %d", DefaultMaxEntries, opts.limit())
+	}
+	if opts.pageSize() != DefaultPageSize {
+		t.Errorf("Expected default page size %d, got %d", DefaultPageSize, opts.pageSize())
+	}
+	opts = QueryOptions{Limit: 500, PageSize: 50}
+	if opts.limit() != 500 || opts.pageSize() != 50 {
+		t.Errorf("Unexpected options: limit=%d pageSize=%d", opts.limit(), opts.pageSize())
+	}
+}
+
+func TestParseQueryFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", filter: " "},
+		{name: "severity", filter: "severity>=warning", want: "severity >= WARNING"},
+		{name: "payloads", filter: `textPayload:"timeout" AND jsonPayload.error.message : "db"`, want: `textPayload:"timeout" AND jsonPayload.error.message:"db"`},
+		{name: "implicit AND", filter: `severity = ERROR httpRequest.status>=500`, want: "severity = ERROR AND httpRequest.status >= 500"},
+		{name: "balanced parentheses", filter: `(severity >= ERROR) AND (textPayload:"x")`, want: `severity >= ERROR AND textPayload:"x"`},
+		{name: "escape the scope", filter: `x) OR (logName:*`, wantErr: true},
+		{name: "OR", filter: `severity >= ERROR OR textPayload:"x"`, wantErr: true},
+		{name: "NOT", filter: `NOT severity >= ERROR`, wantErr: true},
+		{name: "negation", filter: `-textPayload:"x"`, wantErr: true},
+		{name: "unbalanced parentheses", filter: `(severity >= ERROR`, wantErr: true},
+		{name: "closing parenthesis first", filter: `) AND (severity >= ERROR`, wantErr: true},
+		{name: "other field", filter: `logName:"projects/other"`, wantErr: true},
+		{name: "quote in substring", filter: `textPayload:"a\" OR logName:*"`, wantErr: true},
+		{name: "unknown severity", filter: `severity >= LOUD`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseQueryFilter(tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseQueryFilter(%q) error = %v, wantErr %v", tt.filter, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseQueryFilter(%q) = %q, want %q", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceTraceFilter(t *testing.T) {
+	c := &Client{project: "p1"}
+	traceID := "0123456789abcdef0123456789abcdef"
+
+	got, err := c.resourceTraceFilter("service", "web", traceID)
+	want := `trace = "projects/p1/traces/0123456789abcdef0123456789abcdef" AND resource.type = "cloud_run_revision" AND resource.labels.service_name = "web"`
+	if err != nil || got != want {
+		t.Errorf("resourceTraceFilter() = %s, %v, want %s", got, err, want)
+	}
+	if _, err := c.resourceTraceFilter("service", "web", traceID+` OR trace:""`); err == nil {
+		t.Error("resourceTraceFilter() should reject an invalid trace ID")
+	}
+	if _, err := c.resourceTraceFilter("function", "web", traceID); err == nil {
+		t.Error("resourceTraceFilter() should reject an unsupported resource type")
+	}
+}
+
+func TestValidTraceID(t *testing.T) {
+	tests := map[string]bool{
+		"0123456789abcdef0123456789ABCDEF":    true,
+		"0123456789abcdef":                    false,
+		`0123456789abcdef0123456789abcde"`:    false,
+		"0123456789abcdef0123456789abcdef OR": false,
+	}
+	for traceID, want := range tests {
+		if got := ValidTraceID(traceID); got != want {
+			t.Errorf("ValidTraceID(%q) = %v, want %v", traceID, got, want)
+		}
+	}
+}
+
+func TestCountErrorLogs(t *testing.T) {
+	tests := []struct {
+		name       string
+		total      int
+		maxCount   int
+		wantCount  int
+		wantCapped bool
+	}{
+		{name: "fewer than max", total: 1500, maxCount: 2000, wantCount: 1500},
+		{name: "capped", total: 1500, maxCount: 1200, wantCount: 1200, wantCapped: true},
+		{name: "no max", total: 2500, wantCount: 2500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The fake server returns entries from offset, given as the page token
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Get("fields"); got != "entries/insertId,nextPageToken" {
+					t.Errorf("fields = %q", got)
+				}
+				var req loggingapi.ListLogEntriesRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("Failed to decode request: %v", err)
+				}
+				offset, _ := strconv.Atoi(req.PageToken)
+				resp := loggingapi.ListLogEntriesResponse{}
+				for i := offset; i < tt.total && i < offset+int(req.PageSize); i++ {
+					resp.Entries = append(resp.Entries, &loggingapi.LogEntry{InsertId: fmt.Sprintf("e%d", i)})
+				}
+				if next := offset + len(resp.Entries); next < tt.total {
+					resp.NextPageToken = fmt.Sprintf("%d", next)
+				}
+				_ = json.NewEncoder(w).Encode(resp)
+			}))
+			defer server.Close()
+
+			ctx := context.Background()
+			service, err := loggingapi.NewService(ctx, option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+			if err != nil {
+				t.Fatalf("NewService failed: %v", err)
+			}
+			c := &Client{project: "p1", entries: service.Entries, logger: zap.NewNop()}
+			count, capped, err := c.CountErrorLogs(ctx, "service", "web", time.Hour, tt.maxCount)
+			if err != nil {
+				t.Fatalf("CountErrorLogs failed: %v", err)
+			}
+			if count != tt.wantCount || capped != tt.wantCapped {
+				t.Errorf("CountErrorLogs() = %d, %v, want %d, %v", count, capped, tt.wantCount, tt.wantCapped)
+			}
+		})
+	}
+}
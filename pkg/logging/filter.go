@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Clauses allowed in filters of QueryLogs. Filters come from the debug agent, whose input includes log text,
+// so they are limited to clauses that can only narrow down the resource's logs.
+var (
+	severityClause = regexp.MustCompile(`^severity\s*(>=|<=|!=|=|>|<)\s*(?i:(DEFAULT|DEBUG|INFO|NOTICE|WARNING|ERROR|CRITICAL|ALERT|EMERGENCY))\b`)
+	payloadClause  = regexp.MustCompile(`^(textPayload|jsonPayload(?:\.[A-Za-z_][A-Za-z0-9_]*)+)\s*:\s*"([^"\\]*)"`)
+	statusClause   = regexp.MustCompile(`^httpRequest\.status\s*(>=|<=|!=|=|>|<)\s*([1-5][0-9]{2})\b`)
+	filterKeyword  = regexp.MustCompile(`^[A-Za-z]+\b`)
+	traceIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+)
+
+// parseQueryFilter checks that filter only combines supported clauses with AND and returns it normalized:
+//   - severity with a comparison, e.g. severity >= WARNING
+//   - a substring of textPayload or a jsonPayload field, e.g. textPayload:"timeout" or jsonPayload.message:"timeout"
+//   - httpRequest.status with a comparison, e.g. httpRequest.status >= 500
+//
+// OR, NOT, negation and unbalanced parentheses are rejected.
+func parseQueryFilter(filter string) (string, error) {
+	var clauses []string
+	depth := 0
+	rest := strings.TrimSpace(filter)
+	for rest != "" {
+		switch {
+		case rest[0] == '(':
+			depth++
+			rest = rest[1:]
+		case rest[0] == ')':
+			if depth--; depth < 0 {
+				return "", fmt.Errorf("unbalanced parentheses in filter %q", filter)
+			}
+			rest = rest[1:]
+		case severityClause.MatchString(rest):
+			m := severityClause.FindStringSubmatch(rest)
+			clauses = append(clauses, fmt.Sprintf("severity %s %s", m[1], strings.ToUpper(m[2])))
+			rest = rest[len(m[0]):]
+		case payloadClause.MatchString(rest):
+			m := payloadClause.FindStringSubmatch(rest)
+			clauses = append(clauses, fmt.Sprintf("%s:%q", m[1], m[2]))
+			rest = rest[len(m[0]):]
+		case statusClause.MatchString(rest):
+			m := statusClause.FindStringSubmatch(rest)
+			clauses = append(clauses, fmt.Sprintf("httpRequest.status %s %s", m[1], m[2]))
+			rest = rest[len(m[0]):]
+		default:
+			keyword := filterKeyword.FindString(rest)
+			switch keyword {
+			case "AND":
+				rest = rest[len(keyword):]
+			case "OR", "NOT":
+				return "", fmt.Errorf("%s is not supported in filter %q, only AND", keyword, filter)
+			default:
+				return "", fmt.Errorf("unsupported filter %q at %q: use severity, textPayload, jsonPayload fields or httpRequest.status", filter, rest)
+			}
+		}
+		rest = strings.TrimSpace(rest)
+	}
+	if depth != 0 {
+		return "", fmt.Errorf("unbalanced parentheses in filter %q", filter)
+	}
+	return strings.Join(clauses, " AND "), nil
+}
+
+// ValidTraceID reports whether traceID is a trace ID, 32 hexadecimal characters.
+func ValidTraceID(traceID string) bool {
+	return traceIDPattern.MatchString(traceID)
+}
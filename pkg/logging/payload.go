@@ -0,0 +1,280 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// reportedErrorEventType is the @type used by Error Reporting formatted log entries.
+// See https://cloud.google.com/error-reporting/docs/formatting-error-messages
+const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// maxStackTraceLines limits the stack trace kept per entry to keep LLM prompts small.
+const maxStackTraceLines = 50
+
+var (
+	// errorTypeRegexp matches exception types such as java.lang.IllegalStateException or TypeError.
+	errorTypeRegexp = regexp.MustCompile(`^([A-Za-z_$][\w$]*(?:\.[A-Za-z_$][\w$]*)*(?:Exception|Error|Panic))\b`)
+	// stackFrameRegexp matches common stack frame lines in Java, Node.js, Python and Go traces.
+	stackFrameRegexp = regexp.MustCompile(`^(\s+at\s|\s+File\s"|\s*\.\.\.\s\d+\smore|Caused by:|goroutine\s\d+\s\[|\t\S+\.go:\d+)`)
+)
+
+// HTTPRequest contains the HTTP request details attached to a log entry.
+type HTTPRequest struct {
+	Method  string
+	URL     string
+	Status  int
+	Latency time.Duration
+}
+
+// String formats the request as "GET /path -> 500 (1.2s)".
+func (r *HTTPRequest) String() string {
+	if r == nil {
+		return ""
+	}
+	s := strings.TrimSpace(fmt.Sprintf("%s %s", r.Method, r.URL))
+	if r.Status != 0 {
+		s = fmt.Sprintf("%s -> %d", s, r.Status)
+	}
+	if r.Latency > 0 {
+		s = fmt.Sprintf("%s (%s)", s, r.Latency.Round(time.Millisecond))
+	}
+	return s
+}
+
+// toLogEntry converts a Cloud Logging entry to a LogEntry, extracting structured payload fields.
+func toLogEntry(entry *logging.Entry) LogEntry {
+	logEntry := LogEntry{
+		Timestamp: entry.Timestamp,
+		Severity:  entry.Severity.String(),
+		Labels:    entry.Labels,
+	}
+
+	if entry.Payload != nil {
+		switch p := entry.Payload.(type) {
+		case string:
+			extractTextPayload(p, &logEntry)
+		case *structpb.Struct:
+			// logadmin returns jsonPayload as a protobuf Struct
+			extractJSONPayload(p.AsMap(), &logEntry)
+		case map[string]interface{}:
+			extractJSONPayload(p, &logEntry)
+		default:
+			logEntry.Message = fmt.Sprintf("%v", p)
+		}
+	}
+
+	if hr := entry.HTTPRequest; hr != nil {
+		req := &HTTPRequest{Status: hr.Status, Latency: hr.Latency}
+		if hr.Request != nil {
+			req.Method = hr.Request.Method
+			if hr.Request.URL != nil {
+				req.URL = hr.Request.URL.String()
+			}
+		}
+		logEntry.HTTPRequest = req
+	}
+
+	// Extract trace ID from trace field (format: projects/{project}/traces/{trace_id})
+	if entry.Trace != "" {
+		parts := strings.Split(entry.Trace, "/")
+		if len(parts) >= 4 {
+			logEntry.TraceID = parts[len(parts)-1]
+		}
+	}
+	logEntry.SpanID = entry.SpanID
+
+	// Extract resource info
+	if entry.Resource != nil {
+		logEntry.Resource = ResourceInfo{
+			Type:   entry.Resource.Type,
+			Labels: entry.Resource.Labels,
+		}
+	}
+
+	return logEntry
+}
+
+// extractTextPayload fills the message, and the stack trace when the text is a multiline trace.
+func extractTextPayload(text string, e *LogEntry) {
+	headline, stack := splitStackTrace(text)
+	e.Message = headline
+	e.StackTrace = stack
+	if e.ErrorType == "" {
+		e.ErrorType = parseErrorType(headline)
+	}
+}
+
+// extractJSONPayload fills the entry from common structured logging shapes.
+func extractJSONPayload(p map[string]interface{}, e *LogEntry) {
+	if t, ok := p["@type"].(string); ok && t == reportedErrorEventType {
+		// Error Reporting events carry the stack trace in the message field
+		e.ReportedError = true
+	}
+
+	// Message: message, msg (pino, logrus), textPayload
+	for _, key := range []string{"message", "msg", "textPayload"} {
+		if msg, ok := p[key].(string); ok && msg != "" {
+			extractTextPayload(msg, e)
+			break
+		}
+	}
+
+	// Error: either a string or an object such as {"message", "stack", "type"}
+	for _, key := range []string{"error", "err", "exception"} {
+		switch v := p[key].(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+			headline, stack := splitStackTrace(v)
+			if e.Message == "" {
+				e.Message = headline
+			} else if !strings.Contains(e.Message, headline) {
+				e.Message = fmt.Sprintf("%s: %s", e.Message, headline)
+			}
+			if e.StackTrace == "" {
+				e.StackTrace = stack
+			}
+			if e.ErrorType == "" {
+				e.ErrorType = parseErrorType(headline)
+			}
+		case map[string]interface{}:
+			extractErrorObject(v, e)
+		}
+	}
+
+	// Stack trace fields used by various logging libraries
+	for _, key := range []string{"stack_trace", "stackTrace", "stack", "stacktrace"} {
+		if e.StackTrace != "" {
+			break
+		}
+		if stack, ok := p[key].(string); ok && stack != "" {
+			e.StackTrace = truncateLines(stack, maxStackTraceLines)
+			if e.ErrorType == "" {
+				e.ErrorType = parseErrorType(firstLine(stack))
+			}
+		}
+	}
+
+	// Some loggers put the request into jsonPayload rather than the LogEntry.httpRequest field
+	if hr, ok := p["httpRequest"].(map[string]interface{}); ok && e.HTTPRequest == nil {
+		e.HTTPRequest = parseHTTPRequest(hr)
+	}
+
+	if e.Message == "" {
+		// Fallback to serializing the whole payload as JSON, which is better for LLM analysis than the Go map format
+		jsonBytes, err := json.Marshal(p)
+		if err == nil {
+			e.Message = string(jsonBytes)
+		} else {
+			e.Message = fmt.Sprintf("%v", p)
+		}
+	}
+}
+
+// extractErrorObject fills the entry from an error object, e.g. {"type": "TypeError", "message": "...", "stack": "..."}.
+func extractErrorObject(obj map[string]interface{}, e *LogEntry) {
+	if msg, ok := obj["message"].(string); ok && msg != "" {
+		if e.Message == "" {
+			e.Message = msg
+		} else if !strings.Contains(e.Message, msg) {
+			e.Message = fmt.Sprintf("%s: %s", e.Message, msg)
+		}
+	}
+	for _, key := range []string{"type", "name", "class"} {
+		if t, ok := obj[key].(string); ok && t != "" && e.ErrorType == "" {
+			e.ErrorType = t
+		}
+	}
+	for _, key := range []string{"stack", "stack_trace", "stackTrace"} {
+		if stack, ok := obj[key].(string); ok && stack != "" && e.StackTrace == "" {
+			e.StackTrace = truncateLines(stack, maxStackTraceLines)
+			if e.ErrorType == "" {
+				e.ErrorType = parseErrorType(firstLine(stack))
+			}
+		}
+	}
+}
+
+// parseHTTPRequest parses the LogEntry.httpRequest JSON representation.
+func parseHTTPRequest(hr map[string]interface{}) *HTTPRequest {
+	req := &HTTPRequest{}
+	req.Method, _ = hr["requestMethod"].(string)
+	req.URL, _ = hr["requestUrl"].(string)
+	switch status := hr["status"].(type) {
+	case float64:
+		req.Status = int(status)
+	case string:
+		req.Status, _ = strconv.Atoi(status)
+	}
+	if latency, ok := hr["latency"].(string); ok {
+		// Latency is a Duration in JSON format, e.g. "0.123s"
+		if d, err := time.ParseDuration(latency); err == nil {
+			req.Latency = d
+		}
+	}
+	return req
+}
+
+// splitStackTrace splits a multiline text into a headline and the stack trace.
+// Text without stack frames is returned as the headline with an empty stack trace.
+func splitStackTrace(text string) (headline, stack string) {
+	text = strings.TrimRight(text, "\n")
+	lines := strings.Split(text, "\n")
+	if len(lines) == 1 || !hasStackFrames(lines[1:]) {
+		return text, ""
+	}
+
+	headline = strings.TrimSpace(lines[0])
+	if strings.HasPrefix(headline, "Traceback (most recent call last)") {
+		// Python puts the exception on the last line
+		for i := len(lines) - 1; i > 0; i-- {
+			if line := strings.TrimSpace(lines[i]); line != "" {
+				headline = line
+				break
+			}
+		}
+	}
+	return headline, truncateLines(text, maxStackTraceLines)
+}
+
+func hasStackFrames(lines []string) bool {
+	for _, line := range lines {
+		if stackFrameRegexp.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseErrorType extracts the exception type from a headline such as "java.io.IOException: broken pipe".
+func parseErrorType(headline string) string {
+	headline = strings.TrimPrefix(strings.TrimSpace(headline), "Uncaught ")
+	if m := errorTypeRegexp.FindStringSubmatch(headline); len(m) > 1 {
+		return m[1]
+	}
+	return ""
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func truncateLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines[:n], "\n") + fmt.Sprintf("\n... (%d more lines)", len(lines)-n)
+}
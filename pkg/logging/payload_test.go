@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func mustStruct(t *testing.T, m map[string]interface{}) *structpb.Struct {
+	t.Helper()
+	s, err := structpb.NewStruct(m)
+	if err != nil {
+		t.Fatalf("failed to build struct: %v", err)
+	}
+	return s
+}
+
+func TestToLogEntry(t *testing.T) {
+	javaTrace := "java.lang.IllegalStateException: pool exhausted\n\tat com.example.Pool.get(Pool.java:42)\n\tat com.example.Handler.handle(Handler.java:10)"
+	nodeStack := "TypeError: Cannot read properties of undefined (reading 'id')\n    at getUser (/app/user.js:12:20)\n    at process (/app/index.js:5:3)"
+	pythonTrace := "Traceback (most recent call last):\n  File \"/app/main.py\", line 10, in handler\n    db.query()\nValueError: invalid literal"
+
+	tests := []struct {
+		name          string
+		entry         *logging.Entry
+		wantMessage   string
+		wantErrorType string
+		wantStack     bool
+		wantRequest   string
+		wantReported  bool
+	}{
+		{
+			name:        "plain text payload",
+			entry:       &logging.Entry{Payload: "something failed"},
+			wantMessage: "something failed",
+		},
+		{
+			name:          "multiline java stack trace in textPayload",
+			entry:         &logging.Entry{Payload: javaTrace},
+			wantMessage:   "java.lang.IllegalStateException: pool exhausted",
+			wantErrorType: "java.lang.IllegalStateException",
+			wantStack:     true,
+		},
+		{
+			name:          "python traceback in textPayload",
+			entry:         &logging.Entry{Payload: pythonTrace},
+			wantMessage:   "ValueError: invalid literal",
+			wantErrorType: "ValueError",
+			wantStack:     true,
+		},
+		{
+			name: "json payload with message and stack_trace",
+			entry: &logging.Entry{Payload: mustStruct(t, map[string]interface{}{
+				"message":     "request failed",
+				"stack_trace": javaTrace,
+			})},
+			wantMessage:   "request failed",
+			wantErrorType: "java.lang.IllegalStateException",
+			wantStack:     true,
+		},
+		{
+			name: "json payload with error object",
+			entry: &logging.Entry{Payload: mustStruct(t, map[string]interface{}{
+				"msg": "unhandled error",
+				"err": map[string]interface{}{
+					"type":    "TypeError",
+					"message": "Cannot read properties of undefined (reading 'id')",
+					"stack":   nodeStack,
+				},
+			})},
+			wantMessage:   "unhandled error: Cannot read properties of undefined (reading 'id')",
+			wantErrorType: "TypeError",
+			wantStack:     true,
+		},
+		{
+			name: "json payload with error string only",
+			entry: &logging.Entry{Payload: mustStruct(t, map[string]interface{}{
+				"error": "connection refused",
+			})},
+			wantMessage: "connection refused",
+		},
+		{
+			name: "error reporting event",
+			entry: &logging.Entry{Payload: mustStruct(t, map[string]interface{}{
+				"@type":   reportedErrorEventType,
+				"message": nodeStack,
+			})},
+			wantMessage:   "TypeError: Cannot read properties of undefined (reading 'id')",
+			wantErrorType: "TypeError",
+			wantStack:     true,
+			wantReported:  true,
+		},
+		{
+			name: "httpRequest in json payload",
+			entry: &logging.Entry{Payload: mustStruct(t, map[string]interface{}{
+				"message": "upstream error",
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+					"requestUrl":    "/api/users",
+					"status":        502,
+					"latency":       "1.5s",
+				},
+			})},
+			wantMessage: "upstream error",
+			wantRequest: "GET /api/users -> 502 (1.5s)",
+		},
+		{
+			name: "httpRequest on the log entry",
+			entry: &logging.Entry{
+				Payload: "server error",
+				HTTPRequest: &logging.HTTPRequest{
+					Request: &http.Request{Method: "POST", URL: &url.URL{Path: "/orders"}},
+					Status:  500,
+					Latency: 250 * time.Millisecond,
+				},
+			},
+			wantMessage: "server error",
+			wantRequest: "POST /orders -> 500 (250ms)",
+		},
+		{
+			name: "unknown json payload falls back to JSON",
+			entry: &logging.Entry{Payload: mustStruct(t, map[string]interface{}{
+				"foo": "bar",
+			})},
+			wantMessage: `{"foo":"bar"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toLogEntry(tt.entry)
+			if got.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", got.Message, tt.wantMessage)
+			}
+			if got.ErrorType != tt.wantErrorType {
+				t.Errorf("ErrorType = %q, want %q", got.ErrorType, tt.wantErrorType)
+			}
+			if (got.StackTrace != "") != tt.wantStack {
+				t.Errorf("StackTrace = %q, want stack: %v", got.StackTrace, tt.wantStack)
+			}
+			if got.HTTPRequest.String() != tt.wantRequest {
+				t.Errorf("HTTPRequest = %q, want %q", got.HTTPRequest.String(), tt.wantRequest)
+			}
+			if got.ReportedError != tt.wantReported {
+				t.Errorf("ReportedError = %v, want %v", got.ReportedError, tt.wantReported)
+			}
+		})
+	}
+}
+
+func TestToLogEntryTraceID(t *testing.T) {
+	got := toLogEntry(&logging.Entry{
+		Payload: "error",
+		Trace:   "projects/my-project/traces/abc123",
+		SpanID:  "span1",
+	})
+	if got.TraceID != "abc123" {
+		t.Errorf("Expected traceID 'abc123', got %s", got.TraceID)
+	}
+	if got.SpanID != "span1" {
+		t.Errorf("Expected spanID 'span1', got %s", got.SpanID)
+	}
+}
+
+func TestSplitStackTrace(t *testing.T) {
+	headline, stack := splitStackTrace("line one\nline two")
+	if headline != "line one\nline two" || stack != "" {
+		t.Errorf("Expected text without frames to be kept as is, got headline=%q stack=%q", headline, stack)
+	}
+
+	goPanic := "panic: runtime error: index out of range\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:10 +0x1d"
+	headline, stack = splitStackTrace(goPanic)
+	if headline != "panic: runtime error: index out of range" {
+		t.Errorf("Unexpected headline: %q", headline)
+	}
+	if stack == "" {
+		t.Error("Expected stack trace for Go panic")
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	got := truncateLines("a\nb\nc\nd", 2)
+	want := "a\nb\n... (2 more lines)"
+	if got != want {
+		t.Errorf("truncateLines() = %q, want %q", got, want)
+	}
+	if got := truncateLines("a\nb", 2); got != "a\nb" {
+		t.Errorf("truncateLines() = %q, want %q", got, "a\nb")
+	}
+}
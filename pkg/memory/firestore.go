@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/firestore"
+	"google.golang.org/api/option"
+)
+
+// FirestoreStore keeps entries as documents of a Firestore collection, so that they survive restarts and are
+// shared between instances. Documents have an expiresAt timestamp, which a Firestore TTL policy can use to delete them.
+type FirestoreStore struct {
+	collection *firestore.Collection
+}
+
+func NewFirestoreStore(ctx context.Context, projectID, database, collection string, opts ...option.ClientOption) (*FirestoreStore, error) {
+	c, err := firestore.NewCollection(ctx, projectID, database, collection, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &FirestoreStore{collection: c}, nil
+}
+
+func (s *FirestoreStore) Get(ctx context.Context, key string) (Entry, bool, error) {
+	doc, ok, err := s.collection.Get(ctx, key)
+	if err != nil || !ok {
+		return Entry{}, false, err
+	}
+	entry := Entry{
+		Resource:     doc.String("resource"),
+		ResourceType: doc.String("resourceType"),
+	}
+	if entry.UpdatedAt, err = doc.Timestamp("updatedAt"); err != nil {
+		return Entry{}, false, err
+	}
+	if entry.ExpiresAt, err = doc.Timestamp("expiresAt"); err != nil {
+		return Entry{}, false, err
+	}
+	return entry, true, nil
+}
+
+func (s *FirestoreStore) Set(ctx context.Context, key string, entry Entry) error {
+	doc := firestore.Document{
+		"resource":     firestore.StringValue(entry.Resource),
+		"resourceType": firestore.StringValue(entry.ResourceType),
+		"updatedAt":    firestore.TimestampValue(entry.UpdatedAt),
+	}
+	if !entry.ExpiresAt.IsZero() {
+		doc["expiresAt"] = firestore.TimestampValue(entry.ExpiresAt)
+	}
+	return s.collection.Set(ctx, key, doc)
+}
+
+func (s *FirestoreStore) Delete(ctx context.Context, key string) error {
+	return s.collection.Delete(ctx, key)
+}
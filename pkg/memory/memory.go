@@ -0,0 +1,146 @@
+// Package memory remembers the current Cloud Run resource of Slack users per channel,
+// so that commands like "@bot describe" act on the resource last selected there.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/firestore"
+)
+
+// channelDefault is the user part of the key of a channel-wide default.
+const channelDefault = "_channel"
+
+// Entry is a remembered resource.
+type Entry struct {
+	Resource     string    // Resource value as project:type:name
+	ResourceType string    // "service" or "job"
+	UpdatedAt    time.Time // When the entry was set
+	ExpiresAt    time.Time // Zero if the entry does not expire
+}
+
+// expired reports whether the entry has expired at now.
+func (e Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// Store persists entries by key. Get returns false if the key does not exist.
+type Store interface {
+	Get(ctx context.Context, key string) (Entry, bool, error)
+	Set(ctx context.Context, key string, entry Entry) error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStore creates a store for kind: "memory" (or empty) for an in-process store that is lost on restart,
+// or "firestore" for the collection in the (default) Firestore database of projectID.
+func NewStore(ctx context.Context, kind, projectID, collection string) (Store, error) {
+	useFirestore, err := firestore.UseFirestore(kind, projectID, "memory")
+	if err != nil {
+		return nil, err
+	}
+	if !useFirestore {
+		return NewMapStore(), nil
+	}
+	return NewFirestoreStore(ctx, projectID, firestore.DefaultDatabase, collection)
+}
+
+// Memory keeps the current resource of each user in each channel, and an optional default for the channel.
+type Memory struct {
+	store Store
+	ttl   time.Duration // 0 if entries do not expire
+	now   func() time.Time
+}
+
+// New creates a memory whose entries expire ttl after they were set (never if ttl is 0).
+func New(store Store, ttl time.Duration) *Memory {
+	return &Memory{store: store, ttl: ttl, now: time.Now}
+}
+
+func key(channel, user string) string {
+	return channel + ":" + user
+}
+
+// Get returns the user's current resource in the channel, falling back to the channel's default.
+func (m *Memory) Get(ctx context.Context, channel, user string) (Entry, bool, error) {
+	for _, k := range []string{key(channel, user), key(channel, channelDefault)} {
+		entry, ok, err := m.get(ctx, k)
+		if err != nil || ok {
+			return entry, ok, err
+		}
+	}
+	return Entry{}, false, nil
+}
+
+func (m *Memory) get(ctx context.Context, k string) (Entry, bool, error) {
+	entry, ok, err := m.store.Get(ctx, k)
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to get %s: %w", k, err)
+	}
+	if !ok {
+		return Entry{}, false, nil
+	}
+	if entry.expired(m.now()) {
+		// Stores may not delete expired entries themselves, e.g. Firestore without a TTL policy
+		if err := m.store.Delete(ctx, k); err != nil {
+			return Entry{}, false, fmt.Errorf("failed to delete expired %s: %w", k, err)
+		}
+		return Entry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+// Set sets the user's current resource in the channel.
+func (m *Memory) Set(ctx context.Context, channel, user, resource, resourceType string) error {
+	return m.set(ctx, key(channel, user), resource, resourceType)
+}
+
+// SetChannelDefault sets the current resource of users in the channel who have not set their own.
+func (m *Memory) SetChannelDefault(ctx context.Context, channel, resource, resourceType string) error {
+	return m.set(ctx, key(channel, channelDefault), resource, resourceType)
+}
+
+func (m *Memory) set(ctx context.Context, k, resource, resourceType string) error {
+	now := m.now()
+	entry := Entry{Resource: resource, ResourceType: resourceType, UpdatedAt: now}
+	if m.ttl > 0 {
+		entry.ExpiresAt = now.Add(m.ttl)
+	}
+	if err := m.store.Set(ctx, k, entry); err != nil {
+		return fmt.Errorf("failed to set %s: %w", k, err)
+	}
+	return nil
+}
+
+// MapStore keeps entries in process memory.
+type MapStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+func NewMapStore() *MapStore {
+	return &MapStore{entries: make(map[string]Entry)}
+}
+
+func (s *MapStore) Get(_ context.Context, key string) (Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	return entry, ok, nil
+}
+
+func (s *MapStore) Set(_ context.Context, key string, entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *MapStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
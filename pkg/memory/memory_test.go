@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	firestore "google.golang.org/api/firestore/v1"
+	"google.golang.org/api/option"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	store := NewMapStore()
+	m := New(store, time.Hour)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	if _, ok, err := m.Get(ctx, "C1", "U1"); ok || err != nil {
+		t.Fatalf("Get() = %v, %v before any Set", ok, err)
+	}
+
+	if err := m.Set(ctx, "C1", "U1", "p1:service:payments", "service"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if entry, ok, _ := m.Get(ctx, "C1", "U1"); !ok || entry.Resource != "p1:service:payments" || !entry.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Get() = %+v, %v", entry, ok)
+	}
+	// Resources set in one channel do not apply to another
+	if _, ok, _ := m.Get(ctx, "C2", "U1"); ok {
+		t.Error("Expected no current resource in another channel")
+	}
+
+	// The channel default applies to users without their own resource
+	if err := m.SetChannelDefault(ctx, "C2", "p1:service:search", "service"); err != nil {
+		t.Fatalf("SetChannelDefault failed: %v", err)
+	}
+	if entry, ok, _ := m.Get(ctx, "C2", "U1"); !ok || entry.Resource != "p1:service:search" {
+		t.Errorf("Get() = %+v, %v, want the channel default", entry, ok)
+	}
+	if err := m.Set(ctx, "C2", "U1", "p1:job:batch", "job"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if entry, ok, _ := m.Get(ctx, "C2", "U1"); !ok || entry.Resource != "p1:job:batch" || entry.ResourceType != "job" {
+		t.Errorf("Get() = %+v, %v, want the user's resource over the channel default", entry, ok)
+	}
+
+	// Expired entries are deleted
+	now = now.Add(time.Hour)
+	if _, ok, _ := m.Get(ctx, "C1", "U1"); ok {
+		t.Error("Expected the entry to expire")
+	}
+	if _, ok, _ := store.Get(ctx, "C1:U1"); ok {
+		t.Error("Expected the expired entry to be deleted from the store")
+	}
+}
+
+func TestMemory_NoTTL(t *testing.T) {
+	ctx := context.Background()
+	m := New(NewMapStore(), 0)
+	if err := m.Set(ctx, "C1", "U1", "p1:service:web", "service"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	m.now = func() time.Time { return time.Now().Add(365 * 24 * time.Hour) }
+	if entry, ok, _ := m.Get(ctx, "C1", "U1"); !ok || !entry.ExpiresAt.IsZero() {
+		t.Errorf("Get() = %+v, %v, want an entry that does not expire", entry, ok)
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		kind      string
+		projectID string
+		wantErr   bool
+	}{
+		{kind: ""},
+		{kind: "memory"},
+		{kind: "firestore", wantErr: true},
+		{kind: "redis", projectID: "p1", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := NewStore(context.Background(), tt.kind, tt.projectID, "memory")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewStore(%q) error = %v, wantErr %v", tt.kind, err, tt.wantErr)
+		}
+	}
+}
+
+// fakeFirestore serves the document Get, Patch and Delete methods of the Firestore REST API.
+func fakeFirestore(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	docs := make(map[string]*firestore.Document)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		name := strings.TrimPrefix(r.URL.Path, "/v1/")
+		switch r.Method {
+		case http.MethodGet:
+			doc, ok := docs[name]
+			if !ok {
+				http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(doc)
+		case http.MethodPatch:
+			var doc firestore.Document
+			if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+				t.Errorf("Failed to decode document: %v", err)
+			}
+			doc.Name = name
+			docs[name] = &doc
+			_ = json.NewEncoder(w).Encode(doc)
+		case http.MethodDelete:
+			delete(docs, name)
+			_, _ = w.Write([]byte("{}"))
+		}
+	}))
+}
+
+func TestFirestoreStore(t *testing.T) {
+	server := fakeFirestore(t)
+	defer server.Close()
+
+	ctx := context.Background()
+	store, err := NewFirestoreStore(ctx, "p1", "(default)", "memory", option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewFirestoreStore failed: %v", err)
+	}
+
+	if _, ok, err := store.Get(ctx, "C1:U1"); ok || err != nil {
+		t.Fatalf("Get() = %v, %v for a missing document", ok, err)
+	}
+
+	updated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := Entry{Resource: "p1:service:web", ResourceType: "service", UpdatedAt: updated, ExpiresAt: updated.Add(time.Hour)}
+	if err := store.Set(ctx, "C1:U1", want); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	got, ok, err := store.Get(ctx, "C1:U1")
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v", ok, err)
+	}
+	if got.Resource != want.Resource || got.ResourceType != want.ResourceType || !got.UpdatedAt.Equal(want.UpdatedAt) || !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+
+	if err := store.Delete(ctx, "C1:U1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok, _ := store.Get(ctx, "C1:U1"); ok {
+		t.Error("Expected the document to be deleted")
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
 	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/trace"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -88,6 +89,7 @@ func NewMonitoringClient(project string, logger *zap.Logger) (*Client, error) {
 func (mc *Client) GetCloudRunServiceRequestCount(ctx context.Context, service string, aggregationPeriod time.Duration, startTime, endTime time.Time) (*TimeSeriesMap, error) {
 	ctx, span := trace.GetTracer().Start(ctx, "monitoring.GetCloudRunServiceRequestCount")
 	defer span.End()
+	audit.RecordCall(ctx, "monitoring.GetCloudRunServiceRequestCount", service)
 
 	span.SetAttributes(
 		attribute.String("monitoring.project", mc.project),
@@ -248,6 +250,7 @@ func (mc *Client) AggregateLatencies(ctx context.Context, req *monitoringpb.List
 func (mc *Client) GetCloudRunServiceRequestLatencies(ctx context.Context, service string, aggregationPeriod time.Duration, startTime, endTime time.Time) (*TimeSeriesMap, error) {
 	ctx, span := trace.GetTracer().Start(ctx, "monitoring.GetCloudRunServiceRequestLatencies")
 	defer span.End()
+	audit.RecordCall(ctx, "monitoring.GetCloudRunServiceRequestLatencies", service)
 
 	span.SetAttributes(
 		attribute.String("monitoring.project", mc.project),
@@ -300,6 +303,107 @@ func (mc *Client) GetCloudRunServiceRequestLatencies(ctx context.Context, servic
 	return &timeSeriesMap, nil
 }
 
+// ServiceHealth summarizes the requests of a service over a window.
+type ServiceHealth struct {
+	Requests     int64
+	ServerErrors int64   // Requests with 5xx responses
+	P99          float64 // 99th percentile of request latencies in milliseconds, 0 if unknown
+}
+
+// RequestRate returns the requests per second over window.
+func (h ServiceHealth) RequestRate(window time.Duration) float64 {
+	return float64(h.Requests) / window.Seconds()
+}
+
+// ErrorRatio returns the ratio of requests with 5xx responses.
+func (h ServiceHealth) ErrorRatio() float64 {
+	if h.Requests == 0 {
+		return 0
+	}
+	return float64(h.ServerErrors) / float64(h.Requests)
+}
+
+// GetCloudRunServicesHealth returns the health of the services of the project that had requests in the window before endTime.
+func (mc *Client) GetCloudRunServicesHealth(ctx context.Context, window time.Duration, endTime time.Time) (map[string]ServiceHealth, error) {
+	ctx, span := trace.GetTracer().Start(ctx, "monitoring.GetCloudRunServicesHealth")
+	defer span.End()
+	audit.RecordCall(ctx, "monitoring.GetCloudRunServicesHealth", mc.project)
+
+	span.SetAttributes(
+		attribute.String("monitoring.project", mc.project),
+		attribute.String("monitoring.window", window.String()),
+	)
+
+	interval := &monitoringpb.TimeInterval{
+		StartTime: timestamppb.New(endTime.Add(-window)),
+		EndTime:   timestamppb.New(endTime),
+	}
+	health := map[string]ServiceHealth{}
+
+	// Request count per service and response code class, summed over the window
+	it := mc.client.ListTimeSeries(ctx, &monitoringpb.ListTimeSeriesRequest{
+		Name:     fmt.Sprintf("projects/%s", mc.project),
+		Filter:   `metric.type = "run.googleapis.com/request_count" AND resource.type = "cloud_run_revision"`,
+		Interval: interval,
+		Aggregation: &monitoringpb.Aggregation{
+			AlignmentPeriod:    durationpb.New(window),
+			PerSeriesAligner:   monitoringpb.Aggregation_ALIGN_SUM,
+			CrossSeriesReducer: monitoringpb.Aggregation_REDUCE_SUM,
+			GroupByFields:      []string{"resource.labels.service_name", "metric.labels.response_code_class"},
+		},
+	})
+	for {
+		resp, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to get request counts: %w", err)
+		}
+		service := resp.Resource.Labels["service_name"]
+		h := health[service]
+		for _, p := range resp.GetPoints() {
+			h.Requests += p.GetValue().GetInt64Value()
+			if resp.Metric.Labels["response_code_class"] == "5xx" {
+				h.ServerErrors += p.GetValue().GetInt64Value()
+			}
+		}
+		health[service] = h
+	}
+
+	// 99th percentile of the latencies of all requests to each service over the window
+	it = mc.client.ListTimeSeries(ctx, &monitoringpb.ListTimeSeriesRequest{
+		Name:     fmt.Sprintf("projects/%s", mc.project),
+		Filter:   `metric.type = "run.googleapis.com/request_latencies" AND resource.type = "cloud_run_revision"`,
+		Interval: interval,
+		Aggregation: &monitoringpb.Aggregation{
+			AlignmentPeriod:    durationpb.New(window),
+			PerSeriesAligner:   monitoringpb.Aggregation_ALIGN_DELTA,
+			CrossSeriesReducer: monitoringpb.Aggregation_REDUCE_PERCENTILE_99,
+			GroupByFields:      []string{"resource.labels.service_name"},
+		},
+	})
+	for {
+		resp, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, fmt.Errorf("failed to get request latencies: %w", err)
+		}
+		service := resp.Resource.Labels["service_name"]
+		if h, ok := health[service]; ok && len(resp.GetPoints()) > 0 {
+			h.P99 = resp.GetPoints()[0].GetValue().GetDoubleValue() // Points are newest first
+			health[service] = h
+		}
+	}
+	return health, nil
+}
+
 func (mc *Client) Close() error {
 	return mc.client.Close()
 }
@@ -6,8 +6,10 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/config"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/deploy"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/logger"
 	internalslack "github.com/nakamasato/cloud-run-slack-bot/pkg/slack"
 	"github.com/slack-go/slack"
@@ -19,18 +21,18 @@ var boolEmoji = map[bool]string{
 	false: "👀",
 }
 
-// Color can be good, warning, danger, or any hex color code (eg. #439FE0).
-func getColor(severity string) string {
-	if color, ok := severityColor[severity]; ok {
-		return color
-	}
-	return "#D3D3D3" // light gray
+// severityEmoji marks the header of a notification with the severity of its audit log.
+var severityEmoji = map[string]string{
+	"NOTICE": "🟢",
+	"INFO":   "🟢",
+	"ERROR":  "🔴",
 }
 
-var severityColor = map[string]string{
-	"NOTICE": "good",
-	"INFO":   "good",
-	"ERROR":  "danger",
+func getSeverityEmoji(severity string) string {
+	if emoji, ok := severityEmoji[severity]; ok {
+		return emoji
+	}
+	return "⚪"
 }
 
 // PubSubMessage is the payload of a Pub/Sub event.
@@ -50,8 +52,9 @@ type CloudRunAuditLog struct {
 		Labels map[string]string `json:"labels"`
 		Type   string            `json:"type"`
 	} `json:"resource"`
-	Severity     string `json:"severity"`
-	LogName      string `json:"logName"`
+	Severity     string    `json:"severity"`
+	LogName      string    `json:"logName"`
+	Timestamp    time.Time `json:"timestamp"`
 	ProtoPayload struct {
 		Status struct {
 			Code    int    `json:"code"`
@@ -155,13 +158,6 @@ func (h *CloudRunAuditLogHandler) HandleCloudRunAuditLogs(w http.ResponseWriter,
 	lastModifier := logEntry.ProtoPayload.Response.Metadata.Annotations.LastModifier
 	generation := logEntry.ProtoPayload.Response.Metadata.Generation
 
-	// Service specific fields
-	latestReadyRevision := logEntry.ProtoPayload.Response.Status.LatestReadyRevisionName
-	latestCreatedRevision := logEntry.ProtoPayload.Response.Status.LatestCreatedRevisionName
-
-	// Job specific fields
-	latestCreatedExecution := logEntry.ProtoPayload.Response.Status.LatestCreatedExecutionName
-
 	logger.Info("Processing Cloud Run audit log",
 		zap.String("method", methodName),
 		zap.String("resource_name", jobOrSvcName),
@@ -186,95 +182,6 @@ func (h *CloudRunAuditLogHandler) HandleCloudRunAuditLogs(w http.ResponseWriter,
 		zap.String("resource_type", resourceType),
 	)
 
-	fields := []slack.AttachmentField{
-		{
-			Title: resourceType,
-			Value: jobOrSvcName,
-			Short: true,
-		},
-	}
-	if resourceName := logEntry.ProtoPayload.ResourceName; resourceName != "" {
-		parts := strings.Split(resourceName, "/")
-		shortName := parts[len(parts)-1]
-
-		if shortName != jobOrSvcName { // only when short name is different from jobOrSvcName e.g. revision name, execution name
-			fields = append(fields, slack.AttachmentField{
-				Title: "ResourceName",
-				Value: shortName,
-				Short: true,
-			})
-		}
-	}
-	if methodName != "" {
-		fields = append(fields, slack.AttachmentField{
-			Title: "Method",
-			Value: methodName,
-			Short: true,
-		})
-	}
-
-	if resourceType == "job" {
-		// Job-specific fields
-		if latestCreatedExecution != "" {
-			fields = append(fields, slack.AttachmentField{
-				Title: "Latest Created Execution",
-				Value: fmt.Sprintf("`%s`", latestCreatedExecution),
-				Short: true,
-			})
-		}
-
-		// Add job conditions if available
-		conditions := []string{}
-		for _, condition := range logEntry.ProtoPayload.Response.Status.Conditions {
-			conditions = append(conditions, fmt.Sprintf("- `%s`: %s (%s)", condition.Type, condition.Status, condition.Reason))
-		}
-		if len(conditions) > 0 {
-			fields = append(fields, slack.AttachmentField{
-				Title: "Conditions",
-				Value: strings.Join(conditions, "\n"),
-			})
-		}
-	} else {
-		// Service-specific fields
-		if latestCreatedRevision != "" {
-			fields = append(fields, slack.AttachmentField{
-				Title: "Latest Created Revision",
-				Value: fmt.Sprintf("`%s` (%s)", latestCreatedRevision, boolEmoji[latestReadyRevision == latestCreatedRevision]),
-				Short: true,
-			})
-		}
-
-	revisions := []string{}
-	for _, traffic := range logEntry.ProtoPayload.Response.Status.Traffic {
-		revision := fmt.Sprintf("- `%s` (%d%%)", traffic.RevisionName, traffic.Percent)
-		if traffic.Tag != "" {
-			revision = fmt.Sprintf("%s [%s]", revision, traffic.Tag)
-		}
-		if traffic.LatestRevision {
-			revision = fmt.Sprintf("%s ✅", revision)
-		}
-		revisions = append(revisions, revision)
-		}
-		if len(revisions) > 0 {
-			fields = append(fields, slack.AttachmentField{
-				Title: "Traffic Revisions",
-				Value: strings.Join(revisions, "\n"),
-			})
-		}
-	}
-	if logEntry.Severity == "ERROR" {
-		fields = append(fields, slack.AttachmentField{
-			Title: "Error",
-			Value: fmt.Sprintf("Code: %d\nMessage: %s", logEntry.ProtoPayload.Status.Code, logEntry.ProtoPayload.Status.Message),
-		})
-	}
-
-	fields = append(fields, slack.AttachmentField{
-		Title: "Severity",
-		Value: logEntry.Severity,
-		Short: true,
-	})
-
 	text := ""
 	if logEntry.ProtoPayload.Status.Message != "" {
 		text = logEntry.ProtoPayload.Status.Message
@@ -284,14 +191,9 @@ func (h *CloudRunAuditLogHandler) HandleCloudRunAuditLogs(w http.ResponseWriter,
 		text = fmt.Sprintf("Cloud Run %s `%s` has been updated (generation: %d).", resourceType, jobOrSvcName, generation)
 	}
 
-	attachment := slack.Attachment{
-		Text:   text,
-		Fields: fields,
-		Color:  getColor(logEntry.Severity),
-	}
-
 	_, _, err = h.client.PostMessage(channel,
-		slack.MsgOptionAttachments(attachment),
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(notificationBlocks(&logEntry, resourceType, jobOrSvcName, text)...),
 	)
 	if err != nil {
 		logger.Error("Failed to post Slack message", zap.Error(err))
@@ -304,16 +206,18 @@ func (h *CloudRunAuditLogHandler) HandleCloudRunAuditLogs(w http.ResponseWriter,
 
 // MultiProjectCloudRunAuditLogHandler handles audit logs for multiple projects
 type MultiProjectCloudRunAuditLogHandler struct {
-	client internalslack.Client
-	config *config.Config
-	logger *logger.Logger
+	client  internalslack.Client
+	config  *config.Config
+	deploys *deploy.Log // Changes seen in audit logs, e.g. for the App Home tab
+	logger  *logger.Logger
 }
 
-func NewMultiProjectCloudRunAuditLogHandler(cfg *config.Config, client internalslack.Client, log *logger.Logger) *MultiProjectCloudRunAuditLogHandler {
+func NewMultiProjectCloudRunAuditLogHandler(cfg *config.Config, client internalslack.Client, deploys *deploy.Log, log *logger.Logger) *MultiProjectCloudRunAuditLogHandler {
 	return &MultiProjectCloudRunAuditLogHandler{
-		client: client,
-		config: cfg,
-		logger: log,
+		client:  client,
+		config:  cfg,
+		deploys: deploys,
+		logger:  log,
 	}
 }
 
@@ -370,7 +274,6 @@ func (h *MultiProjectCloudRunAuditLogHandler) HandleCloudRunAuditLogs(w http.Res
 	generation := logEntry.ProtoPayload.Response.Metadata.Generation
 
 	// Service specific fields
-	latestReadyRevision := logEntry.ProtoPayload.Response.Status.LatestReadyRevisionName
 	latestCreatedRevision := logEntry.ProtoPayload.Response.Status.LatestCreatedRevisionName
 
 	// Job specific fields
@@ -383,6 +286,25 @@ func (h *MultiProjectCloudRunAuditLogHandler) HandleCloudRunAuditLogs(w http.Res
 		zap.String("resource_type", resourceType),
 	)
 
+	// Changes are recorded even if no channel is notified of them
+	event := deploy.Event{
+		Time:         logEntry.Timestamp,
+		ProjectID:    projectID,
+		ResourceType: resourceType,
+		Name:         jobOrSvcName,
+		Method:       methodName,
+		Revision:     latestCreatedRevision,
+		Modifier:     lastModifier,
+		Failed:       logEntry.Severity == "ERROR",
+	}
+	if resourceType == "job" {
+		event.Revision = latestCreatedExecution
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	h.deploys.Add(event)
+
 	// Get the channel for this service/job using the multi-project configuration
 	channel := h.config.GetChannelForService(projectID, jobOrSvcName)
 	if channel == "" {
@@ -400,126 +322,104 @@ func (h *MultiProjectCloudRunAuditLogHandler) HandleCloudRunAuditLogs(w http.Res
 		zap.String("project_id", projectID),
 	)
 
-	fields := []slack.AttachmentField{
-		{
-			Title: "Project",
-			Value: projectID,
-			Short: true,
-		},
-		{
-			Title: resourceType,
-			Value: jobOrSvcName,
-			Short: true,
-		},
+	text := ""
+	if logEntry.ProtoPayload.Status.Message != "" {
+		text = logEntry.ProtoPayload.Status.Message
+	} else if lastModifier != "" {
+		text = fmt.Sprintf("Cloud Run %s `%s` in project `%s` has been modified by `%s` (generation: %d).", resourceType, jobOrSvcName, projectID, lastModifier, generation)
+	} else {
+		text = fmt.Sprintf("Cloud Run %s `%s` in project `%s` has been updated (generation: %d).", resourceType, jobOrSvcName, projectID, generation)
 	}
 
+	blocks := notificationBlocks(&logEntry, resourceType, jobOrSvcName, text)
+	blocks = append(blocks, internalslack.ResourceActions(projectID, resourceType, jobOrSvcName, h.config.DebugEnabled, time.Now()))
+	_, _, err = h.client.PostMessage(channel,
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	if err != nil {
+		logger.Error("Failed to post Slack message", zap.Error(err))
+		http.Error(w, "Failed to post Slack message", http.StatusInternalServerError)
+		return
+	}
+
+	_ = ctx // Suppress unused variable warning if not using trace context
+}
+
+// notificationBlocks lays out the notification of an audit log: a header with the resource, the project, region
+// and severity, the summary text and the details of the change.
+func notificationBlocks(logEntry *CloudRunAuditLog, resourceType, name, text string) []slack.Block {
+	blocks := internalslack.HeaderBlocks(
+		fmt.Sprintf("%s Cloud Run %s %s", getSeverityEmoji(logEntry.Severity), resourceType, name),
+		internalslack.ProjectDetail(logEntry.Resource.Labels["project_id"]),
+		internalslack.RegionDetail(logEntry.Resource.Labels["location"]),
+		fmt.Sprintf("Severity `%s`", logEntry.Severity),
+	)
+	blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+	return append(blocks, internalslack.FieldBlocks(auditLogFields(logEntry, resourceType, name))...)
+}
+
+// auditLogFields returns the details of the change to a service or job in an audit log.
+func auditLogFields(logEntry *CloudRunAuditLog, resourceType, name string) []internalslack.Field {
+	var fields []internalslack.Field
 	if resourceName := logEntry.ProtoPayload.ResourceName; resourceName != "" {
 		parts := strings.Split(resourceName, "/")
 		shortName := parts[len(parts)-1]
 
-		if shortName != jobOrSvcName {
-			fields = append(fields, slack.AttachmentField{
-				Title: "ResourceName",
-				Value: shortName,
-				Short: true,
-			})
+		if shortName != name { // only when short name is different from name e.g. revision name, execution name
+			fields = append(fields, internalslack.Field{Title: "ResourceName", Value: shortName})
 		}
 	}
-
-	if methodName != "" {
-		fields = append(fields, slack.AttachmentField{
-			Title: "Method",
-			Value: methodName,
-			Short: true,
-		})
+	if methodName := logEntry.ProtoPayload.MethodName; methodName != "" {
+		fields = append(fields, internalslack.Field{Title: "Method", Value: methodName})
 	}
 
+	status := logEntry.ProtoPayload.Response.Status
 	if resourceType == "job" {
 		// Job-specific fields
-		if latestCreatedExecution != "" {
-			fields = append(fields, slack.AttachmentField{
-				Title: "Latest Created Execution",
-				Value: fmt.Sprintf("`%s`", latestCreatedExecution),
-				Short: true,
-			})
+		if status.LatestCreatedExecutionName != "" {
+			fields = append(fields, internalslack.Field{Title: "Latest Created Execution", Value: fmt.Sprintf("`%s`", status.LatestCreatedExecutionName)})
 		}
 
 		// Add job conditions if available
 		conditions := []string{}
-		for _, condition := range logEntry.ProtoPayload.Response.Status.Conditions {
+		for _, condition := range status.Conditions {
 			conditions = append(conditions, fmt.Sprintf("- `%s`: %s (%s)", condition.Type, condition.Status, condition.Reason))
 		}
 		if len(conditions) > 0 {
-			fields = append(fields, slack.AttachmentField{
-				Title: "Conditions",
-				Value: strings.Join(conditions, "\n"),
-			})
+			fields = append(fields, internalslack.Field{Title: "Conditions", Value: strings.Join(conditions, "\n"), Long: true})
 		}
 	} else {
 		// Service-specific fields
-		if latestCreatedRevision != "" {
-			fields = append(fields, slack.AttachmentField{
+		if status.LatestCreatedRevisionName != "" {
+			fields = append(fields, internalslack.Field{
 				Title: "Latest Created Revision",
-				Value: fmt.Sprintf("`%s` (%s)", latestCreatedRevision, boolEmoji[latestReadyRevision == latestCreatedRevision]),
-				Short: true,
+				Value: fmt.Sprintf("`%s` (%s)", status.LatestCreatedRevisionName, boolEmoji[status.LatestReadyRevisionName == status.LatestCreatedRevisionName]),
 			})
 		}
 
-	revisions := []string{}
-	for _, traffic := range logEntry.ProtoPayload.Response.Status.Traffic {
-		revision := fmt.Sprintf("- `%s` (%d%%)", traffic.RevisionName, traffic.Percent)
-		if traffic.Tag != "" {
-			revision = fmt.Sprintf("%s [%s]", revision, traffic.Tag)
-		}
-		if traffic.LatestRevision {
-			revision = fmt.Sprintf("%s ✅", revision)
-		}
-		revisions = append(revisions, revision)
+		revisions := []string{}
+		for _, traffic := range status.Traffic {
+			revision := fmt.Sprintf("- `%s` (%d%%)", traffic.RevisionName, traffic.Percent)
+			if traffic.Tag != "" {
+				revision = fmt.Sprintf("%s [%s]", revision, traffic.Tag)
+			}
+			if traffic.LatestRevision {
+				revision = fmt.Sprintf("%s ✅", revision)
+			}
+			revisions = append(revisions, revision)
 		}
 		if len(revisions) > 0 {
-			fields = append(fields, slack.AttachmentField{
-				Title: "Traffic Revisions",
-				Value: strings.Join(revisions, "\n"),
-			})
+			fields = append(fields, internalslack.Field{Title: "Traffic Revisions", Value: strings.Join(revisions, "\n"), Long: true})
 		}
 	}
 
 	if logEntry.Severity == "ERROR" {
-		fields = append(fields, slack.AttachmentField{
+		fields = append(fields, internalslack.Field{
 			Title: "Error",
 			Value: fmt.Sprintf("Code: %d\nMessage: %s", logEntry.ProtoPayload.Status.Code, logEntry.ProtoPayload.Status.Message),
+			Long:  true,
 		})
 	}
-
-	fields = append(fields, slack.AttachmentField{
-		Title: "Severity",
-		Value: logEntry.Severity,
-		Short: true,
-	})
-
-	text := ""
-	if logEntry.ProtoPayload.Status.Message != "" {
-		text = logEntry.ProtoPayload.Status.Message
-	} else if lastModifier != "" {
-		text = fmt.Sprintf("Cloud Run %s `%s` in project `%s` has been modified by `%s` (generation: %d).", resourceType, jobOrSvcName, projectID, lastModifier, generation)
-	} else {
-		text = fmt.Sprintf("Cloud Run %s `%s` in project `%s` has been updated (generation: %d).", resourceType, jobOrSvcName, projectID, generation)
-	}
-
-	attachment := slack.Attachment{
-		Text:   text,
-		Fields: fields,
-		Color:  getColor(logEntry.Severity),
-	}
-
-	_, _, err = h.client.PostMessage(channel,
-		slack.MsgOptionAttachments(attachment),
-	)
-	if err != nil {
-		logger.Error("Failed to post Slack message", zap.Error(err))
-		http.Error(w, "Failed to post Slack message", http.StatusInternalServerError)
-		return
-	}
-
-	_ = ctx // Suppress unused variable warning if not using trace context
+	return fields
 }
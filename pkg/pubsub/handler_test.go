@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/config"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/deploy"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/logger"
 	slackinternal "github.com/nakamasato/cloud-run-slack-bot/pkg/slack"
 	"go.uber.org/zap"
@@ -256,3 +259,80 @@ func containsString(s, substr string) bool {
 	}
 	return false
 }
+
+func TestMultiProjectCloudRunAuditLogHandler_RecordsDeploys(t *testing.T) {
+	data := `{
+		"resource": {"labels": {"project_id": "p1", "service_name": "web"}, "type": "cloud_run_revision"},
+		"severity": "NOTICE",
+		"timestamp": "2024-01-01T12:00:00Z",
+		"protoPayload": {
+			"methodName": "google.cloud.run.v1.Services.ReplaceService",
+			"response": {
+				"metadata": {"generation": 2, "annotations": {"serving.knative.dev/lastModifier": "test@example.com"}},
+				"status": {"latestCreatedRevisionName": "web-00002"}
+			}
+		}
+	}`
+	var payload PubSubMessage
+	payload.Message.Data = []byte(data)
+	payloadBytes, _ := json.Marshal(payload)
+
+	deploys := deploy.NewLog()
+	// No channel is configured for the service, so the change is only recorded
+	h := NewMultiProjectCloudRunAuditLogHandler(&config.Config{}, slackinternal.DummySlackClient{}, deploys, &logger.Logger{Logger: zap.NewNop()})
+	rr := httptest.NewRecorder()
+	h.HandleCloudRunAuditLogs(rr, httptest.NewRequest("POST", "/cloudrun/events", bytes.NewBuffer(payloadBytes)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	got := deploys.Recent([]string{"p1"}, 10)
+	if len(got) != 1 {
+		t.Fatalf("recorded %d deploys, want 1", len(got))
+	}
+	if got[0].Name != "web" || got[0].Revision != "web-00002" || got[0].Modifier != "test@example.com" || got[0].Time.Year() != 2024 {
+		t.Errorf("recorded deploy = %+v", got[0])
+	}
+}
+
+func TestNotificationBlocks(t *testing.T) {
+	data := `{
+		"resource": {"labels": {"project_id": "p1", "location": "asia-northeast1", "service_name": "web"}},
+		"severity": "ERROR",
+		"protoPayload": {
+			"status": {"code": 3, "message": "invalid image"},
+			"resourceName": "namespaces/p1/services/web",
+			"methodName": "google.cloud.run.v1.Services.ReplaceService",
+			"response": {"status": {
+				"latestCreatedRevisionName": "web-00002",
+				"latestReadyRevisionName": "web-00001",
+				"traffic": [{"latestRevision": true, "percent": 100, "revisionName": "web-00001"}]
+			}}
+		}
+	}`
+	var logEntry CloudRunAuditLog
+	if err := json.Unmarshal([]byte(data), &logEntry); err != nil {
+		t.Fatal(err)
+	}
+	blocks := notificationBlocks(&logEntry, "service", "web", "invalid image")
+	b, err := json.Marshal(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"🔴 Cloud Run service web",
+		"Project `p1` · Region `asia-northeast1` · Severity `ERROR`",
+		"*Method*\\ngoogle.cloud.run.v1.Services.ReplaceService",
+		"*Latest Created Revision*\\n`web-00002` (👀)",
+		"*Traffic Revisions*\\n- `web-00001` (100%) ✅",
+		"*Error*\\nCode: 3\\nMessage: invalid image",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("notificationBlocks() = %s, want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "ResourceName") {
+		t.Errorf("notificationBlocks() = %s, should not show the resource name of the service itself", got)
+	}
+}
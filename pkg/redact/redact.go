@@ -0,0 +1,171 @@
+// Package redact masks secrets and personal data, such as tokens, emails and IP addresses, in log text
+// before it is sent to an LLM or posted to Slack.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Built-in detectors.
+const (
+	DetectorPrivateKey     = "private_key"     // PEM private key blocks
+	DetectorJWT            = "jwt"             // JSON Web Tokens
+	DetectorBearerToken    = "bearer_token"    // Bearer and Basic authorization credentials
+	DetectorURLCredentials = "url_credentials" // user:password in URLs
+	DetectorAPIKey         = "api_key"         // Well-known API key formats (Google, AWS, Slack, GitHub, Stripe)
+	DetectorSecret         = "secret"          // Values of password=, token=, "api_key": "..." and similar parameters
+	DetectorEmail          = "email"           // Email addresses
+	DetectorIP             = "ip"              // IPv4 and IPv6 addresses
+	DetectorCreditCard     = "credit_card"     // Card numbers passing the Luhn check
+)
+
+// rule replaces the matches of a pattern. replacement is a regexp template with %s for the mask; it may refer
+// to submatches, e.g. to keep a parameter name. It defaults to the mask alone.
+type rule struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+	valid       func(match string) bool // if set, only matches it accepts are replaced
+}
+
+// builtins are applied in this order, so that e.g. a JWT in an Authorization header is reported as a bearer token.
+var builtins = []rule{
+	{name: DetectorPrivateKey, re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{name: DetectorBearerToken, re: regexp.MustCompile(`(?i)\b((?:bearer|basic)\s+)[A-Za-z0-9._~+/=-]{8,}`), replacement: "${1}%s"},
+	{name: DetectorJWT, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{name: DetectorURLCredentials, re: regexp.MustCompile(`(://)[^/\s:@]+:[^/\s@]+@`), replacement: "${1}%s@"},
+	{name: DetectorAPIKey, re: regexp.MustCompile(`\b(?:AIza[0-9A-Za-z_-]{35}|(?:AKIA|ASIA)[0-9A-Z]{16}|xox[abposr]-[A-Za-z0-9-]{10,}|gh[pousr]_[A-Za-z0-9]{36,}|[sr]k_(?:live|test)_[A-Za-z0-9]{16,})`)},
+	{name: DetectorSecret, re: regexp.MustCompile(`(?i)\b((?:password|passwd|pwd|secret|client_secret|token|access_token|refresh_token|api_?key|apikey|access_key)(?:["']?\s*[:=]\s*["']|=))[^\s"'&,;]+`), replacement: "${1}%s"},
+	{name: DetectorEmail, re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{name: DetectorIP, re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b|(?i)\b(?:[0-9a-f]{1,4}:){7}[0-9a-f]{1,4}\b|(?i)\b(?:[0-9a-f]{1,4}:){1,6}:(?:[0-9a-f]{1,4}:){0,5}[0-9a-f]{1,4}\b`)},
+	{name: DetectorCreditCard, re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: luhn},
+}
+
+// Detectors returns the names of the built-in detectors.
+func Detectors() []string {
+	names := make([]string, len(builtins))
+	for i, r := range builtins {
+		names[i] = r.name
+	}
+	return names
+}
+
+// Redactor masks matches of its detectors with e.g. "[REDACTED:email]". A nil Redactor leaves text unchanged.
+type Redactor struct {
+	rules []rule
+}
+
+// New creates a redactor with the given built-in detectors (all of them for "all", none for "none")
+// and custom patterns by name. Matches of a custom pattern are replaced entirely.
+func New(detectors []string, patterns map[string]string) (*Redactor, error) {
+	enabled := make(map[string]bool)
+	for _, d := range detectors {
+		switch d = strings.TrimSpace(d); d {
+		case "", "none":
+		case "all":
+			for _, name := range Detectors() {
+				enabled[name] = true
+			}
+		default:
+			if !isDetector(d) {
+				return nil, fmt.Errorf("unknown redaction detector %q: must be one of %s", d, strings.Join(Detectors(), ", "))
+			}
+			enabled[d] = true
+		}
+	}
+
+	r := &Redactor{}
+	for _, b := range builtins {
+		if enabled[b.name] {
+			r.rules = append(r.rules, b)
+		}
+	}
+
+	// Custom patterns run after the built-ins, in name order so that results are deterministic
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("redaction pattern %q has no name", patterns[name])
+		}
+		re, err := regexp.Compile(patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %w", name, err)
+		}
+		r.rules = append(r.rules, rule{name: name, re: re})
+	}
+	return r, nil
+}
+
+func isDetector(name string) bool {
+	for _, b := range builtins {
+		if b.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns s with every match of the redactor's detectors masked.
+func (r *Redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		mask := fmt.Sprintf("[REDACTED:%s]", rule.name)
+		if rule.valid != nil {
+			s = rule.re.ReplaceAllStringFunc(s, func(match string) string {
+				if rule.valid(match) {
+					return mask
+				}
+				return match
+			})
+			continue
+		}
+		if rule.replacement == "" {
+			s = rule.re.ReplaceAllLiteralString(s, mask)
+			continue
+		}
+		s = rule.re.ReplaceAllString(s, fmt.Sprintf(rule.replacement, mask))
+	}
+	return s
+}
+
+// Strings redacts each element of ss, returning a new slice.
+func (r *Redactor) Strings(ss []string) []string {
+	if r == nil || ss == nil {
+		return ss
+	}
+	redacted := make([]string, len(ss))
+	for i, s := range ss {
+		redacted[i] = r.Redact(s)
+	}
+	return redacted
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum used by card numbers.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
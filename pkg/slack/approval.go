@@ -0,0 +1,212 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/approval"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/authz"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// maxRevisionSuggestions is the number of recent revisions suggested for an unknown rollback revision.
+const maxRevisionSuggestions = 5
+
+// requestRollback asks approvers to approve routing all traffic of a service to revision. The request is posted
+// to the channel even for slash commands, so that approvers can see it.
+func (h *MultiProjectSlackEventHandler) requestRollback(ctx context.Context, channelId, userId, resourceValue, revision string) error {
+	audit.SetResource(ctx, resourceValue)
+	projectID, resourceType, name, err := ParseMultiProjectResourceValue(resourceValue)
+	if err != nil {
+		return fmt.Errorf("failed to parse resource value: %v", err)
+	}
+	var msg string
+	switch {
+	case resourceType != "service":
+		msg = "Only services can be rolled back."
+	case isDirectMessage(ctx):
+		msg = "Request rollbacks in a channel, where approvers can see them."
+	case h.authz == nil || !h.authz.HasApprovers():
+		msg = "Rollbacks need approval, but no approvers are configured. Set `approvers` in RBAC_CONFIG."
+	}
+	if msg != "" {
+		_, err := h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText(msg, false))
+		return err
+	}
+
+	rClient, ok := h.rClients[projectID]
+	if !ok {
+		return fmt.Errorf("no client found for project %s", projectID)
+	}
+	revisions, err := rClient.ListRevisions(ctx, name, 0)
+	if err != nil {
+		return fmt.Errorf("failed to list revisions of service %s: %w", name, err)
+	}
+	var recent []string
+	found := false
+	for _, r := range revisions {
+		found = found || r.Name == revision
+		if len(recent) < maxRevisionSuggestions {
+			recent = append(recent, r.Name)
+		}
+	}
+	if !found {
+		_, err := h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText(
+			fmt.Sprintf("Revision `%s` of service `%s` not found. Recent revisions: `%s`", revision, name, strings.Join(recent, "`, `")), false))
+		return err
+	}
+
+	req, err := h.approvals.NewRequest(authz.CommandRollback, resourceValue, revision, userId, channelId)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("<@%s> requested to roll back service `%s` to revision `%s`", userId, name, revision)
+	_, ts, err := h.client.PostMessageContext(ctx, channelId, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(h.approvalBlocks(req, "")...))
+	if err != nil {
+		return err
+	}
+	req.MessageTS = ts
+	if err := h.approvals.Put(ctx, req); err != nil {
+		// Without the saved request the buttons would do nothing, so they are removed
+		h.updateApproval(ctx, req, "⚠️ The request could not be saved. Please request the rollback again.")
+		return err
+	}
+	h.logger.Info("Rollback requested",
+		zap.String("request_id", req.ID),
+		zap.String("requester", userId),
+		zap.String("resource", resourceValue),
+		zap.String("revision", revision))
+	return nil
+}
+
+// decideApproval handles the Approve and Reject buttons of a request. Only approvers other than the requester may
+// approve; the requester may also reject, e.g. to withdraw a mistaken request.
+func (h *MultiProjectSlackEventHandler) decideApproval(ctx context.Context, interaction *slack.InteractionCallback, action *slack.BlockAction) error {
+	channelId, userId := interaction.Channel.ID, interaction.User.ID
+	approve := action.ActionID == ActionIdApproveRequest
+	reply := func(text string) error {
+		_, err := h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText(text, false))
+		return err
+	}
+
+	req, ok, err := h.approvals.Get(ctx, action.Value)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return reply("This request has already been decided.")
+	}
+	audit.SetCommand(ctx, interactionCommand(interaction), resourceProject(req.Resource))
+	audit.SetResource(ctx, req.Resource)
+
+	if h.approvals.Expired(req) {
+		if _, ok, err := h.approvals.Take(ctx, req.ID); err != nil || !ok {
+			return err
+		}
+		h.updateApproval(ctx, req, "⌛ The request expired without a decision.")
+		return reply("This request has expired.")
+	}
+
+	var allowed bool
+	switch {
+	case userId == req.Requester:
+		allowed = !approve
+	case h.authz != nil:
+		if allowed, err = h.authz.IsApprover(ctx, authz.Request{UserID: userId, ChannelID: req.Channel, Command: req.Command, Projects: resourceProject(req.Resource)}); err != nil {
+			h.logger.Warn("Failed to check approver", zap.String("user", userId), zap.Error(err))
+			return reply("Could not verify that you may decide on this request: " + err.Error())
+		}
+	}
+	if !allowed {
+		audit.Deny(ctx)
+		h.logger.Warn("Approval denied",
+			zap.String("audit", "approval.denied"),
+			zap.String("user", userId),
+			zap.String("request_id", req.ID),
+			zap.String("requester", req.Requester))
+		if approve && userId == req.Requester {
+			return reply("You cannot approve your own request. Ask an approver.")
+		}
+		return reply("Only approvers can decide on this request.")
+	}
+
+	req, ok, err = h.approvals.Take(ctx, req.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return reply("This request has already been decided.")
+	}
+	h.logger.Info("Approval decided",
+		zap.String("audit", "approval.decided"),
+		zap.String("request_id", req.ID),
+		zap.String("user", userId),
+		zap.Bool("approved", approve))
+
+	if !approve {
+		h.updateApproval(ctx, req, fmt.Sprintf("❌ Rejected by <@%s>.", userId))
+		return nil
+	}
+	if err := h.runApproved(ctx, req); err != nil {
+		h.updateApproval(ctx, req, fmt.Sprintf("⚠️ Approved by <@%s>, but the rollback failed: %s", userId, err.Error()))
+		return err
+	}
+	h.updateApproval(ctx, req, fmt.Sprintf("✅ Approved by <@%s>. All traffic is being routed to `%s`.", userId, req.Argument))
+	return nil
+}
+
+// runApproved runs the command of an approved request.
+func (h *MultiProjectSlackEventHandler) runApproved(ctx context.Context, req approval.Request) error {
+	projectID, _, name, err := ParseMultiProjectResourceValue(req.Resource)
+	if err != nil {
+		return fmt.Errorf("failed to parse resource value: %v", err)
+	}
+	rClient, ok := h.rClients[projectID]
+	if !ok {
+		return fmt.Errorf("no client found for project %s", projectID)
+	}
+	switch req.Command {
+	case authz.CommandRollback:
+		return rClient.RouteAllTraffic(ctx, name, req.Argument)
+	default:
+		return fmt.Errorf("unsupported command %q to approve", req.Command)
+	}
+}
+
+// updateApproval replaces the buttons of a request's message with its outcome. Failures are only logged since
+// the request has been decided anyway.
+func (h *MultiProjectSlackEventHandler) updateApproval(ctx context.Context, req approval.Request, status string) {
+	if req.MessageTS == "" {
+		return
+	}
+	if _, _, _, err := h.client.UpdateMessageContext(ctx, req.Channel, req.MessageTS,
+		slack.MsgOptionText(status, false), slack.MsgOptionBlocks(h.approvalBlocks(req, status)...)); err != nil {
+		h.logger.Warn("Failed to update approval request message", zap.String("request_id", req.ID), zap.Error(err))
+	}
+}
+
+// approvalBlocks returns the message of a request: the Approve and Reject buttons while it is pending, or else its status.
+func (h *MultiProjectSlackEventHandler) approvalBlocks(req approval.Request, status string) []slack.Block {
+	projectID, _, name, _ := ParseMultiProjectResourceValue(req.Resource)
+	blocks := HeaderBlocks("Rollback requested", ProjectDetail(projectID), RegionDetail(h.region(projectID)))
+	blocks = append(blocks, FieldBlocks([]Field{
+		{Title: "Service", Value: fmt.Sprintf("`%s`", name)},
+		{Title: "Revision", Value: fmt.Sprintf("`%s`", req.Argument)},
+		{Title: "Requested by", Value: fmt.Sprintf("<@%s>", req.Requester)},
+		{Title: "Expires", Value: fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", req.ExpiresAt.Unix(), req.ExpiresAt.UTC().Format("2006-01-02 15:04 UTC"))},
+	})...)
+	if status != "" {
+		return append(blocks, markdownSection(status))
+	}
+	approve := slack.NewButtonBlockElement(ActionIdApproveRequest, req.ID, slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false))
+	approve.Style = slack.StylePrimary
+	reject := slack.NewButtonBlockElement(ActionIdRejectRequest, req.ID, slack.NewTextBlockObject(slack.PlainTextType, "Reject", false, false))
+	reject.Style = slack.StyleDanger
+	return append(blocks,
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, "An approver other than the requester must approve. The requester can withdraw the request with Reject.", false, false)),
+		slack.NewActionBlock("", approve, reject),
+	)
+}
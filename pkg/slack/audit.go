@@ -0,0 +1,51 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/slack-go/slack"
+)
+
+const (
+	defaultAuditCount = 10 // Events shown by the audit command without an argument
+	maxAuditCount     = 50
+)
+
+// showAudit posts the latest n commands run in a channel (the default number if n is 0) as an ephemeral message,
+// e.g. for "@bot audit 20".
+func (h *MultiProjectSlackEventHandler) showAudit(ctx context.Context, channelId, userId string, n int) error {
+	if n == 0 {
+		n = defaultAuditCount
+	}
+	n = min(n, maxAuditCount)
+	_, err := h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText(formatAuditEvents(h.audit.Recent(channelId, n)), false))
+	return err
+}
+
+// formatAuditEvents formats events as one line each, e.g.
+// "• 2024-01-01 12:00:00 UTC <@U123> `describe` project1:service:web → success (120ms)".
+func formatAuditEvents(events []audit.Event) string {
+	if len(events) == 0 {
+		return "No commands have been recorded in this channel since the bot started."
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Last %d commands in this channel:\n", len(events))
+	for _, e := range events {
+		fmt.Fprintf(&b, "• %s <@%s> `%s`", e.Time.UTC().Format(time.DateTime+" MST"), e.User, e.Command)
+		if e.Resource != "" {
+			fmt.Fprintf(&b, " %s", e.Resource)
+		} else if len(e.Projects) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(e.Projects, ", "))
+		}
+		fmt.Fprintf(&b, " → %s (%dms)", e.Outcome, e.LatencyMs)
+		if e.Error != "" {
+			fmt.Fprintf(&b, ": %s", e.Error)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/authz"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// userGroupResolver resolves Slack user groups for role grants. It requires the usergroups:read scope.
+type userGroupResolver struct {
+	client *slack.Client
+}
+
+func (r userGroupResolver) GroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	return r.client.GetUserGroupMembersContext(ctx, groupID)
+}
+
+// mentionCommand returns the command authorized for a mention such as "@bot d". Unknown words show the help.
+func mentionCommand(word string) string {
+	switch word {
+	case "describe", "d":
+		return authz.CommandDescribe
+	case "metrics", "m":
+		return authz.CommandMetrics
+	case "debug", "dbg":
+		return authz.CommandDebug
+	case "set", "s":
+		return authz.CommandSet
+	case "sample":
+		return authz.CommandSample
+	case "audit":
+		return authz.CommandAudit
+	case "rollback":
+		return authz.CommandRollback
+	default:
+		return authz.CommandHelp
+	}
+}
+
+// actionCommands maps resource selections, buttons, metrics selects and shortcuts to the command they run.
+var actionCommands = map[string]string{
+	ActionIdDescribeResource: authz.CommandDescribe,
+	ActionIdMetricsResource:  authz.CommandMetrics,
+	ActionIdDebugResource:    authz.CommandDebug,
+	ActionIdCurrentResource:  authz.CommandSet,
+	ActionIdChannelResource:  authz.CommandSetChannel,
+	ActionIdMetricsDuration:  authz.CommandMetrics,
+	ActionIdMetricsType:      authz.CommandMetrics,
+	ActionIdDescribeButton:   authz.CommandDescribe,
+	ActionIdMetricsButton:    authz.CommandMetrics,
+	ActionIdDebugButton:      authz.CommandDebug,
+	ActionIdDebugShortcut:    authz.CommandDebug,
+}
+
+// interactionCommand returns the command run by an interaction, or its action ID if it runs none.
+func interactionCommand(interaction *slack.InteractionCallback) string {
+	var id string
+	switch interaction.Type {
+	case slack.InteractionTypeBlockActions:
+		if len(interaction.ActionCallback.BlockActions) > 0 {
+			id = interaction.ActionCallback.BlockActions[0].ActionID
+			// Both feedback buttons are in the feedback block, named after their rating
+			if interaction.ActionCallback.BlockActions[0].BlockID == ActionIdFeedback {
+				id = ActionIdFeedback
+			}
+		}
+	case slack.InteractionTypeMessageAction:
+		id = interaction.CallbackID
+	}
+	switch id {
+	case ActionIdCancelDebug:
+		return authz.CommandCancel
+	case ActionIdExportDebug:
+		return authz.CommandExport
+	case ActionIdFeedback:
+		return authz.CommandFeedback
+	case ActionIdApproveRequest:
+		return "approve"
+	case ActionIdRejectRequest:
+		return "reject"
+	}
+	if command, ok := actionCommands[id]; ok {
+		return command
+	}
+	return id
+}
+
+// resourceProject returns the project of a "project:type:name" resource value, or nil if it cannot be parsed.
+func resourceProject(resourceValue string) []string {
+	projectID, _, _, err := ParseMultiProjectResourceValue(resourceValue)
+	if err != nil {
+		return nil
+	}
+	return []string{projectID}
+}
+
+// listedProjects returns the projects whose resources are listed in a channel.
+func (h *MultiProjectSlackEventHandler) listedProjects(channelProjects []string) []string {
+	if len(channelProjects) > 0 {
+		return channelProjects
+	}
+	projects := make([]string, len(h.config.Projects))
+	for i, p := range h.config.Projects {
+		projects[i] = p.ID
+	}
+	return projects
+}
+
+// authorize checks whether the user may run command on projects. Denials are audit-logged and explained
+// to the user with an ephemeral message (in the thread, if threadTS is set).
+func (h *MultiProjectSlackEventHandler) authorize(ctx context.Context, channelId, userId, threadTS, command string, projects []string) (bool, error) {
+	audit.SetCommand(ctx, command, projects)
+	if h.authz == nil {
+		return true, nil
+	}
+	decision, err := h.authz.Authorize(ctx, authz.Request{UserID: userId, ChannelID: channelId, Command: command, Projects: projects})
+	if decision.Allowed {
+		return true, nil
+	}
+	audit.Deny(ctx)
+
+	h.logger.Warn("Access denied",
+		zap.String("audit", "authz.denied"),
+		zap.String("user", userId),
+		zap.String("channel", channelId),
+		zap.String("command", command),
+		zap.Strings("projects", projects),
+		zap.String("role", decision.Role.String()),
+		zap.String("required_role", decision.Required.String()),
+		zap.Error(err))
+
+	text := fmt.Sprintf("You need the `%s` role to run `%s`", decision.Required, command)
+	if len(projects) > 0 {
+		text += fmt.Sprintf(" in project `%s`", strings.Join(projects, "`, `"))
+	}
+	text += fmt.Sprintf(" (your role: `%s`). Ask a bot admin for access.", decision.Role)
+	if err != nil {
+		text = fmt.Sprintf("Could not verify your permissions to run `%s`: %s", command, err.Error())
+	}
+	opts := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+	_, postErr := h.client.PostEphemeralContext(ctx, channelId, userId, opts...)
+	return false, postErr
+}
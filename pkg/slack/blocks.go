@@ -0,0 +1,223 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/authz"
+	"github.com/slack-go/slack"
+)
+
+// Slack limits of the text of blocks.
+const (
+	maxHeaderLength  = 150
+	maxFieldLength   = 2000
+	maxSectionLength = 3000
+	maxSectionFields = 10
+)
+
+// logsLookback is how far back the Logs button of a message looks for error logs.
+const logsLookback = time.Hour
+
+// Field is a titled value in a message, e.g. the image of a service. Long fields get a section of their own,
+// while the others are shown side by side.
+type Field struct {
+	Title string
+	Value string
+	Long  bool
+}
+
+// HeaderBlocks returns the header of a message and a context line with its details, e.g.
+// "Project `p1` · Region `asia-northeast1`". Empty details are skipped.
+func HeaderBlocks(title string, details ...string) []slack.Block {
+	blocks := []slack.Block{slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, truncateText(title, maxHeaderLength), true, false))}
+	var shown []string
+	for _, d := range details {
+		if d != "" {
+			shown = append(shown, d)
+		}
+	}
+	if len(shown) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, strings.Join(shown, " · "), false, false)))
+	}
+	return blocks
+}
+
+// FieldBlocks lays out fields as sections in their order.
+func FieldBlocks(fields []Field) []slack.Block {
+	var blocks []slack.Block
+	var short []*slack.TextBlockObject
+	flush := func() {
+		if len(short) > 0 {
+			blocks = append(blocks, slack.NewSectionBlock(nil, short, nil))
+			short = nil
+		}
+	}
+	for _, f := range fields {
+		if f.Long {
+			flush()
+			blocks = append(blocks, markdownSection(truncateText(fmt.Sprintf("*%s*\n%s", f.Title, f.Value), maxSectionLength)))
+			continue
+		}
+		short = append(short, slack.NewTextBlockObject(slack.MarkdownType, truncateText(fmt.Sprintf("*%s*\n%s", f.Title, f.Value), maxFieldLength), false, false))
+		if len(short) == maxSectionFields {
+			flush()
+		}
+	}
+	flush()
+	return blocks
+}
+
+// ResourceActions returns the buttons of a message about a resource: describe, metrics (services only), debug if
+// enabled, and a link to its error logs of the last hour before now. They are handled by handleResourceButton.
+func ResourceActions(projectID, resourceType, name string, debug bool, now time.Time) *slack.ActionBlock {
+	value := fmt.Sprintf("%s:%s:%s", projectID, resourceType, name)
+	buttons := []slack.BlockElement{
+		slack.NewButtonBlockElement(ActionIdDescribeButton, value, slack.NewTextBlockObject(slack.PlainTextType, "Describe", false, false)),
+	}
+	if resourceType == "service" {
+		buttons = append(buttons, slack.NewButtonBlockElement(ActionIdMetricsButton, value, slack.NewTextBlockObject(slack.PlainTextType, "Metrics", false, false)))
+	}
+	if debug {
+		buttons = append(buttons, slack.NewButtonBlockElement(ActionIdDebugButton, value, slack.NewTextBlockObject(slack.PlainTextType, "Debug", false, false)))
+	}
+	if link := buildLogLink(projectID, resourceType, name, logsLookback, now); link != "" {
+		buttons = append(buttons, slack.NewButtonBlockElement(ActionIdLogsButton, value, slack.NewTextBlockObject(slack.PlainTextType, "Logs", false, false)).WithURL(link))
+	}
+	return slack.NewActionBlock("", buttons...)
+}
+
+// ProjectDetail and RegionDetail format the details of a header.
+func ProjectDetail(projectID string) string {
+	if projectID == "" {
+		return ""
+	}
+	return fmt.Sprintf("Project `%s`", projectID)
+}
+
+func RegionDetail(region string) string {
+	if region == "" {
+		return ""
+	}
+	return fmt.Sprintf("Region `%s`", region)
+}
+
+// truncateText cuts s to at most n characters, marking the cut with an ellipsis.
+func truncateText(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// handleResourceButton handles the buttons of messages about a resource. Buttons in the App Home tab are not in
+// a channel, so their results are posted in the direct message with the user.
+func (h *MultiProjectSlackEventHandler) handleResourceButton(ctx context.Context, interaction *slack.InteractionCallback, action *slack.BlockAction) error {
+	channelId, userId := interaction.Channel.ID, interaction.User.ID
+	projectID, resourceType, _, err := ParseMultiProjectResourceValue(action.Value)
+	if err != nil {
+		return fmt.Errorf("failed to parse multi-project resource value: %v", err)
+	}
+	if channelId == "" {
+		if channelId, err = h.directMessageChannel(ctx, userId); err != nil {
+			return err
+		}
+	}
+	if allowed, err := h.authorize(ctx, channelId, userId, "", actionCommands[action.ActionID], []string{projectID}); !allowed {
+		return err
+	}
+	h.rememberResource(ctx, channelId, userId, action.Value, resourceType)
+	switch action.ActionID {
+	case ActionIdDescribeButton:
+		return h.describeResource(ctx, channelId, action.Value)
+	case ActionIdMetricsButton:
+		return h.getResourceMetrics(ctx, channelId, action.Value, defaultMetricsType, defaultDuration, defaultAggregationPeriod)
+	default:
+		if h.debugger == nil {
+			_, err := h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText("Debug feature is not enabled.", false))
+			return err
+		}
+		return h.debugResource(ctx, channelId, userId, action.Value)
+	}
+}
+
+// metricsSelectValue encodes the resource and settings of a metrics chart in the options of its selects, so that
+// changing one setting keeps the other.
+func metricsSelectValue(resourceValue, metricsType string, duration time.Duration) string {
+	return fmt.Sprintf("%s|%s|%s", resourceValue, metricsType, duration)
+}
+
+func parseMetricsSelectValue(value string) (resourceValue, metricsType string, duration time.Duration, err error) {
+	parts := strings.Split(value, "|")
+	if len(parts) != 3 {
+		return "", "", 0, fmt.Errorf("invalid metrics value %q", value)
+	}
+	duration, err = time.ParseDuration(parts[2])
+	if err != nil || duration <= 0 {
+		return "", "", 0, fmt.Errorf("invalid metrics value %q", value)
+	}
+	return parts[0], parts[1], duration, nil
+}
+
+// metricsSelects returns the selects to change the duration and type of a metrics chart.
+func metricsSelects(resourceValue, metricsType string, duration time.Duration) []slack.BlockElement {
+	option := func(text, value string) *slack.OptionBlockObject {
+		return slack.NewOptionBlockObject(value, slack.NewTextBlockObject(slack.PlainTextType, text, false, false), nil)
+	}
+	durationSelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, slack.NewTextBlockObject(slack.PlainTextType, "Duration", false, false), ActionIdMetricsDuration)
+	for _, d := range []struct {
+		text     string
+		duration time.Duration
+	}{{"1h", time.Hour}, {"1d", 24 * time.Hour}, {"1w", 168 * time.Hour}} {
+		o := option(d.text, metricsSelectValue(resourceValue, metricsType, d.duration))
+		durationSelect.Options = append(durationSelect.Options, o)
+		if d.duration == duration {
+			durationSelect.InitialOption = o
+		}
+	}
+	typeSelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, slack.NewTextBlockObject(slack.PlainTextType, "Metrics", false, false), ActionIdMetricsType)
+	for _, t := range []string{"count", "latency"} {
+		o := option(t, metricsSelectValue(resourceValue, t, duration))
+		typeSelect.Options = append(typeSelect.Options, o)
+		if t == metricsType {
+			typeSelect.InitialOption = o
+		}
+	}
+	return []slack.BlockElement{durationSelect, typeSelect}
+}
+
+// handleMetricsSelect shows the metrics chart again with the duration or type selected in one.
+func (h *MultiProjectSlackEventHandler) handleMetricsSelect(ctx context.Context, interaction *slack.InteractionCallback, action *slack.BlockAction) error {
+	resourceValue, metricsType, duration, err := parseMetricsSelectValue(action.SelectedOption.Value)
+	if err != nil {
+		return err
+	}
+	if allowed, err := h.authorize(ctx, interaction.Channel.ID, interaction.User.ID, "", authz.CommandMetrics, resourceProject(resourceValue)); !allowed {
+		return err
+	}
+	return h.getResourceMetrics(ctx, interaction.Channel.ID, resourceValue, metricsType, duration, aggregationPeriodFor(duration))
+}
+
+// region returns the configured region of a project.
+func (h *MultiProjectSlackEventHandler) region(projectID string) string {
+	if projectConfig, ok := h.config.GetProjectConfig(projectID); ok {
+		return projectConfig.Region
+	}
+	return ""
+}
+
+// formatDuration formats a duration in its largest whole unit, e.g. "7d" or "6h".
+func formatDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return d.String()
+}
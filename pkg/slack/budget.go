@@ -0,0 +1,89 @@
+package slack
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+)
+
+// tokenBudgets limits the LLM tokens each channel may use per day (UTC).
+// Usage is kept in memory of each instance, so it resets when the bot restarts, and a bot scaled out to several
+// instances allows each channel up to the budget on every instance.
+type tokenBudgets struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	limit     int            // Daily tokens per channel (0 for unlimited)
+	overrides map[string]int // Daily tokens by channel ID, overriding limit (0 for unlimited)
+	day       string         // UTC date that used counts
+	used      map[string]int // Tokens used today by channel ID
+}
+
+func newTokenBudgets(limit int, overrides map[string]int) *tokenBudgets {
+	return &tokenBudgets{now: time.Now, limit: limit, overrides: overrides, used: make(map[string]int)}
+}
+
+func (b *tokenBudgets) limitFor(channelId string) int {
+	if limit, ok := b.overrides[channelId]; ok {
+		return limit
+	}
+	return b.limit
+}
+
+// resetIfNewDay clears usage when the UTC date changes. b.mu must be held.
+func (b *tokenBudgets) resetIfNewDay() {
+	if day := b.now().UTC().Format(time.DateOnly); day != b.day {
+		b.day = day
+		b.used = make(map[string]int)
+	}
+}
+
+// exceeded returns a message explaining why the channel cannot start an LLM call, or "" if it can.
+func (b *tokenBudgets) exceeded(channelId string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resetIfNewDay()
+	limit := b.limitFor(channelId)
+	if limit <= 0 || b.used[channelId] < limit {
+		return ""
+	}
+	return fmt.Sprintf("This channel has used %s of its %s daily LLM tokens, so new debug analyses and follow-up questions are paused until 00:00 UTC.",
+		formatTokens(b.used[channelId]), formatTokens(limit))
+}
+
+// exceededWith reports whether the channel exceeds its budget with usage of a run that is not recorded yet.
+func (b *tokenBudgets) exceededWith(channelId string, usage adk.Usage) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resetIfNewDay()
+	limit := b.limitFor(channelId)
+	return limit > 0 && b.used[channelId]+usage.TotalTokens() >= limit
+}
+
+// add records tokens used by the channel.
+func (b *tokenBudgets) add(channelId string, usage adk.Usage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resetIfNewDay()
+	b.used[channelId] += usage.TotalTokens()
+}
+
+// formatTokens formats a token count with thousands separators, e.g. "12,345".
+func formatTokens(n int) string {
+	s := fmt.Sprintf("%d", n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// formatUsage formats the usage and estimated cost of an analysis, e.g. "12,345 prompt + 678 response tokens (~$0.0042)".
+func formatUsage(usage adk.Usage, cost float64) string {
+	text := fmt.Sprintf("%s prompt + %s response tokens in %d calls",
+		formatTokens(usage.PromptTokens), formatTokens(usage.ResponseTokens), usage.Calls)
+	if cost > 0 {
+		text += fmt.Sprintf(" (~$%.4f)", cost)
+	}
+	return text
+}
@@ -0,0 +1,360 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+const (
+	maxMetricsDuration = 6 * 7 * 24 * time.Hour // Cloud Monitoring keeps metrics for 6 weeks
+	maxSuggestions     = 3                      // Close matches suggested for a mistyped resource name
+)
+
+// metricsTypes are the metrics the metrics command can show.
+var metricsTypes = []string{"count", "latency"}
+
+// mention is a parsed bot mention, e.g. `@bot metrics latency 6h my-job --project foo`.
+type mention struct {
+	command      string        // Command as typed, e.g. "describe" or "d"
+	channel      bool          // `set channel` sets the channel's default resource
+	name         string        // Resource name, empty to use the current resource
+	project      string        // --project: the project to look the resource up in
+	resourceType string        // --type: service or job
+	metricsType  string        // metrics: count or latency
+	duration     time.Duration // metrics: how far back to show, 0 for the default
+	count        int           // audit: number of events, 0 for the default
+	revision     string        // rollback: the revision to route all traffic to
+	share        bool          // --share: post the results of a slash command to the channel
+}
+
+// parseMention parses the text of a mention without the bot mention, e.g. `describe "my service" --project foo`.
+// Arguments can be quoted and flags can be given as `--name value` or `--name=value`, except for `--share` which takes no value.
+func parseMention(text string) (mention, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return mention{}, err
+	}
+
+	var m mention
+	var args []string
+	for i := 0; i < len(tokens); i++ {
+		flag, ok := strings.CutPrefix(tokens[i], "--")
+		if !ok {
+			args = append(args, tokens[i])
+			continue
+		}
+		if flag == "share" {
+			m.share = true
+			continue
+		}
+		name, value, hasValue := strings.Cut(flag, "=")
+		if !hasValue {
+			if i+1 >= len(tokens) {
+				return mention{}, fmt.Errorf("flag --%s needs a value", name)
+			}
+			i++
+			value = tokens[i]
+		}
+		switch name {
+		case "project", "p":
+			m.project = value
+		case "type", "t":
+			if value != "service" && value != "job" {
+				return mention{}, fmt.Errorf("invalid --type %q: must be service or job", value)
+			}
+			m.resourceType = value
+		default:
+			return mention{}, fmt.Errorf("unknown flag --%s", name)
+		}
+	}
+
+	m.command = "describe"
+	if len(args) > 0 {
+		m.command = strings.ToLower(args[0])
+		args = args[1:]
+	}
+	switch m.command {
+	case "describe", "d", "debug", "dbg":
+		if err := m.setName(args); err != nil {
+			return mention{}, err
+		}
+	case "metrics", "m":
+		var names []string
+		for _, arg := range args {
+			if slices.Contains(metricsTypes, strings.ToLower(arg)) {
+				m.metricsType = strings.ToLower(arg)
+			} else if d, ok := parseDuration(arg); ok {
+				if d > maxMetricsDuration {
+					return mention{}, fmt.Errorf("duration %s is longer than the 6 weeks Cloud Monitoring keeps metrics for", arg)
+				}
+				m.duration = d
+			} else {
+				names = append(names, arg)
+			}
+		}
+		if err := m.setName(names); err != nil {
+			return mention{}, err
+		}
+	case "set", "s":
+		if len(args) > 0 && strings.EqualFold(args[0], "channel") {
+			m.channel = true
+			args = args[1:]
+		}
+		if err := m.setName(args); err != nil {
+			return mention{}, err
+		}
+	case "rollback":
+		if len(args) != 2 {
+			return mention{}, errors.New("rollback needs a service and a revision, e.g. `rollback my-service my-service-00042-abc`")
+		}
+		if m.resourceType == "job" {
+			return mention{}, errors.New("only services can be rolled back")
+		}
+		m.name, m.revision, m.resourceType = args[0], args[1], "service"
+	case "audit":
+		if len(args) > 1 {
+			return mention{}, fmt.Errorf("unexpected argument %q", args[1])
+		}
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return mention{}, fmt.Errorf("invalid number of events %q", args[0])
+			}
+			m.count = n
+		}
+	}
+	return m, nil
+}
+
+// setName sets the resource name from the command's arguments, which can name at most one resource.
+func (m *mention) setName(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("unexpected argument %q", args[1])
+	}
+	if len(args) == 1 {
+		m.name = args[0]
+	}
+	return nil
+}
+
+// tokenize splits text on whitespace, keeping quoted strings together. Slack may turn straight quotes
+// into curly ones, so both are accepted.
+func tokenize(text string) ([]string, error) {
+	closing := map[rune]rune{'"': '"', '\'': '\'', '“': '”', '‘': '’'}
+	var tokens []string
+	var b strings.Builder
+	inToken := false
+	var quote rune // Closing quote of the quoted string being read, 0 outside quotes
+	for _, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case closing[r] != 0:
+			quote = closing[r]
+			inToken = true
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, b.String())
+				b.Reset()
+				inToken = false
+			}
+		default:
+			b.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("missing closing quote")
+	}
+	if inToken {
+		tokens = append(tokens, b.String())
+	}
+	return tokens, nil
+}
+
+// parseDuration parses durations such as 30m, 6h, 7d or 2w.
+func parseDuration(s string) (time.Duration, bool) {
+	var d time.Duration
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		days, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, false
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else if n, ok := strings.CutSuffix(s, "w"); ok {
+		weeks, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, false
+		}
+		d = time.Duration(weeks) * 7 * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, false
+		}
+	}
+	return d, d > 0
+}
+
+// aggregationPeriodFor returns the aggregation period of metrics over a duration: the one of the metrics
+// picker for the durations it offers, and otherwise whole minutes giving about 300 points.
+func aggregationPeriodFor(duration time.Duration) time.Duration {
+	for k, period := range durationAggregationPeriodMap {
+		if d, err := time.ParseDuration(k); err == nil && d == duration {
+			return period
+		}
+	}
+	return max((duration / 300).Truncate(time.Minute), time.Minute)
+}
+
+// resourceCandidate is a service or job a resource name can refer to.
+type resourceCandidate struct {
+	projectID    string
+	resourceType string
+	name         string
+}
+
+func (c resourceCandidate) value() string {
+	return fmt.Sprintf("%s:%s:%s", c.projectID, c.resourceType, c.name)
+}
+
+func (c resourceCandidate) String() string {
+	return fmt.Sprintf("`%s` (%s in %s)", c.name, c.resourceType, c.projectID)
+}
+
+// resolveResource finds the service or job called name in projects, optionally only of resourceType.
+// If there is no single match, it returns a message for the user instead, suggesting close matches for typos.
+func (h *MultiProjectSlackEventHandler) resolveResource(ctx context.Context, name, resourceType string, projects []string) (string, string, error) {
+	for _, projectID := range projects {
+		if _, ok := h.rClients[projectID]; !ok {
+			return "", fmt.Sprintf("Project `%s` is not configured.", projectID), nil
+		}
+	}
+	candidates, err := h.listCandidates(ctx, resourceType, projects)
+	if err != nil {
+		return "", "", err
+	}
+
+	var matches []resourceCandidate
+	for _, c := range candidates {
+		if strings.EqualFold(c.name, name) {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0].value(), "", nil
+	case 0:
+		h.logger.Debug("No resource matches name", zap.String("name", name), zap.Strings("projects", projects))
+		msg := fmt.Sprintf("No service or job named `%s` found in %s.", name, strings.Join(projects, ", "))
+		if suggestions := closeMatches(name, candidates, maxSuggestions); len(suggestions) > 0 {
+			msg += " Did you mean " + joinCandidates(suggestions, " or ") + "?"
+		} else {
+			msg += " Run `@cloud-run-bot set` to pick one from a list."
+		}
+		return "", msg, nil
+	default:
+		return "", fmt.Sprintf("`%s` matches %s. Add `--project <id>` or `--type service|job` to choose one.", name, joinCandidates(matches, ", ")), nil
+	}
+}
+
+// listCandidates lists the services and jobs, or only those of resourceType if set, of the configured projects among projects.
+func (h *MultiProjectSlackEventHandler) listCandidates(ctx context.Context, resourceType string, projects []string) ([]resourceCandidate, error) {
+	var candidates []resourceCandidate
+	for _, projectID := range projects {
+		rClient, ok := h.rClients[projectID]
+		if !ok {
+			continue
+		}
+		if resourceType != "job" {
+			services, err := rClient.ListServices(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list services in project %s: %w", projectID, err)
+			}
+			for _, s := range services {
+				candidates = append(candidates, resourceCandidate{projectID: projectID, resourceType: "service", name: s})
+			}
+		}
+		if resourceType != "service" {
+			jobs, err := rClient.ListJobs(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list jobs in project %s: %w", projectID, err)
+			}
+			for _, j := range jobs {
+				candidates = append(candidates, resourceCandidate{projectID: projectID, resourceType: "job", name: j})
+			}
+		}
+	}
+	return candidates, nil
+}
+
+func joinCandidates(candidates []resourceCandidate, sep string) string {
+	s := make([]string, len(candidates))
+	for i, c := range candidates {
+		s[i] = c.String()
+	}
+	return strings.Join(s, sep)
+}
+
+// closeMatches returns up to n candidates whose names contain name or are within a few edits of it, closest first.
+func closeMatches(name string, candidates []resourceCandidate, n int) []resourceCandidate {
+	name = strings.ToLower(name)
+	maxDistance := max(2, len(name)/3)
+	type match struct {
+		candidate resourceCandidate
+		distance  int
+	}
+	var matches []match
+	for _, c := range candidates {
+		candidateName := strings.ToLower(c.name)
+		d := levenshtein(name, candidateName)
+		if d <= maxDistance || strings.Contains(candidateName, name) {
+			matches = append(matches, match{candidate: c, distance: d})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b match) int {
+		if a.distance != b.distance {
+			return a.distance - b.distance
+		}
+		return strings.Compare(a.candidate.name, b.candidate.name)
+	})
+	var result []resourceCandidate
+	for i := 0; i < len(matches) && i < n; i++ {
+		result = append(result, matches[i].candidate)
+	}
+	return result
+}
+
+// levenshtein returns the number of single-character edits needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
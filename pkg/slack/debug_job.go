@@ -0,0 +1,283 @@
+package slack
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/debug"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/trace"
+	"github.com/slack-go/slack"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// debugJobTimeout bounds a background debug analysis.
+const debugJobTimeout = 10 * time.Minute
+
+// debugJob is a debug analysis running in the background.
+// It reports progress by updating a single Slack message and posts each group as soon as it is analyzed.
+type debugJob struct {
+	id           string
+	channelID    string
+	userID       string
+	projectID    string
+	resourceType string
+	resourceName string
+	progressTS   string // Timestamp of the progress message
+	handler      *MultiProjectSlackEventHandler
+	ctx          context.Context
+	cancel       context.CancelFunc
+
+	mu          sync.Mutex
+	threadTS    string // Timestamp of the result header, set once groups are ready
+	cancelledBy string // User who cancelled the job
+	overBudget  bool   // Whether the job was stopped because the channel used up its token budget
+	headerErr   error  // Why the result header could not be posted, which stops the job
+}
+
+// debugJobs keeps track of running debug jobs by ID.
+type debugJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*debugJob
+}
+
+func newDebugJobs() *debugJobs {
+	return &debugJobs{jobs: make(map[string]*debugJob)}
+}
+
+func (j *debugJobs) add(job *debugJob) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jobs[job.id] = job
+}
+
+func (j *debugJobs) get(id string) (*debugJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	return job, ok
+}
+
+func (j *debugJobs) remove(id string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.jobs, id)
+}
+
+// cancel cancels a running job and reports whether it was found.
+func (j *debugJobs) cancel(id, userID string) bool {
+	j.mu.Lock()
+	job, ok := j.jobs[id]
+	j.mu.Unlock()
+	if !ok {
+		return false
+	}
+	job.mu.Lock()
+	job.cancelledBy = userID
+	job.mu.Unlock()
+	job.cancel()
+	return true
+}
+
+func newJobID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// startDebugJob posts the progress message and starts the analysis in the background.
+func (h *MultiProjectSlackEventHandler) startDebugJob(ctx context.Context, channelId, userId, projectID, resourceType, resourceName string) (*debugJob, error) {
+	job := &debugJob{
+		id:           newJobID(),
+		channelID:    channelId,
+		userID:       userId,
+		projectID:    projectID,
+		resourceType: resourceType,
+		resourceName: resourceName,
+		handler:      h,
+	}
+
+	_, ts, err := h.client.PostMessageContext(ctx, channelId, job.progressBlocks("Starting analysis...", true)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to post progress message: %w", err)
+	}
+	job.progressTS = ts
+
+	// The job outlives the Slack event, so it does not inherit the event's context
+	audit.RecordCall(ctx, "debug.DebugResource", projectID+":"+resourceType+":"+resourceName)
+	job.ctx, job.cancel = context.WithTimeout(context.Background(), debugJobTimeout)
+	h.jobs.add(job)
+	go job.run()
+	return job, nil
+}
+
+// cancelDebugJob handles the cancel button of a debug job.
+func (h *MultiProjectSlackEventHandler) cancelDebugJob(ctx context.Context, channelId, userId, jobID string) error {
+	if h.jobs.cancel(jobID, userId) {
+		h.logger.Info("Cancelled debug job", zap.String("job_id", jobID), zap.String("user", userId))
+		return nil
+	}
+	_, err := h.client.PostEphemeralContext(ctx, channelId, userId,
+		slack.MsgOptionText(fmt.Sprintf("Debug job `%s` has already finished.", jobID), false))
+	return err
+}
+
+func (j *debugJob) run() {
+	ctx, span := trace.GetTracer().Start(j.ctx, "DebugJob")
+	defer span.End()
+	defer j.handler.jobs.remove(j.id)
+	defer j.cancel()
+	span.SetAttributes(
+		attribute.String("debug.job_id", j.id),
+		attribute.String("debug.resource_type", j.resourceType),
+		attribute.String("debug.resource_name", j.resourceName),
+		attribute.String("debug.project_id", j.projectID),
+	)
+
+	// Tokens are charged to the channel's budget even if the job fails or is cancelled.
+	// The job is stopped once it uses up the budget, rather than when the next job is refused.
+	meter := adk.NewUsageMeter(func(total adk.Usage) {
+		if j.handler.budgets.exceededWith(j.channelID, total) {
+			j.mu.Lock()
+			j.overBudget = true
+			j.mu.Unlock()
+			j.cancel()
+		}
+	})
+	result, err := j.handler.debugger.DebugResource(adk.WithUsageMeter(ctx, meter), j.projectID, j.resourceType, j.resourceName, j)
+	j.handler.budgets.add(j.channelID, meter.Total())
+
+	// The job context may be done, so final messages use a fresh context
+	postCtx := context.Background()
+	var status string
+	var actions []slack.BlockElement
+	j.mu.Lock()
+	headerErr := j.headerErr
+	j.mu.Unlock()
+	switch {
+	case headerErr != nil:
+		status = fmt.Sprintf("Failed: could not post the result: %s", headerErr.Error())
+	case errors.Is(err, context.Canceled):
+		j.mu.Lock()
+		if j.overBudget {
+			status = "Stopped because this channel used up its daily LLM token budget. New analyses are paused until 00:00 UTC."
+		} else {
+			status = fmt.Sprintf("Cancelled by <@%s>.", j.cancelledBy)
+		}
+		j.mu.Unlock()
+	case errors.Is(err, context.DeadlineExceeded):
+		status = "Timed out. The resource may have too many errors or the AI service is slow. Try reducing the lookback window."
+	case err != nil:
+		status = fmt.Sprintf("Failed: %s", err.Error())
+	case result.TotalErrors == 0:
+		status = "No errors found."
+		if postErr := j.handler.postNoErrors(postCtx, j.channelID, result); postErr != nil {
+			j.handler.logger.Warn("Failed to post debug result", zap.String("job_id", j.id), zap.Error(postErr))
+		}
+	default:
+		status = fmt.Sprintf("Done. Analyzed %d error groups.", len(result.ErrorGroups))
+		j.mu.Lock()
+		threadTS := j.threadTS
+		j.mu.Unlock()
+		if threadTS != "" {
+			// The result is complete, so it can be shared with follow-up questions and exports without further writes
+			j.handler.threads.add(j.channelID, threadTS, result)
+			if err := j.handler.updateDebugHeader(postCtx, j.channelID, threadTS, result); err != nil {
+				j.handler.logger.Warn("Failed to update debug result header", zap.String("job_id", j.id), zap.Error(err))
+			}
+			status += " Mention me in the result thread to ask follow-up questions."
+			exportButton := slack.NewButtonBlockElement(ActionIdExportDebug, threadTS, slack.NewTextBlockObject(slack.PlainTextType, "Export", false, false))
+			actions = append(actions, exportButton)
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		j.handler.logger.Warn("Debug job did not complete", zap.String("job_id", j.id), zap.Error(err))
+	}
+	j.updateProgress(postCtx, status, false, actions...)
+}
+
+// progressBlocks builds the progress message, with a cancel button while the job is running and the given actions.
+func (j *debugJob) progressBlocks(status string, running bool, actions ...slack.BlockElement) []slack.MsgOption {
+	text := fmt.Sprintf("Debug analysis of %s `%s` in project `%s` (job `%s`): %s",
+		j.resourceType, j.resourceName, j.projectID, j.id, status)
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+	}
+	if running {
+		button := slack.NewButtonBlockElement(ActionIdCancelDebug, j.id, slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false))
+		button.Style = slack.StyleDanger
+		actions = append([]slack.BlockElement{button}, actions...)
+	}
+	if len(actions) > 0 {
+		blocks = append(blocks, slack.NewActionBlock("", actions...))
+	}
+	return []slack.MsgOption{slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...)}
+}
+
+func (j *debugJob) updateProgress(ctx context.Context, status string, running bool, actions ...slack.BlockElement) {
+	_, _, _, err := j.handler.client.UpdateMessageContext(ctx, j.channelID, j.progressTS, j.progressBlocks(status, running, actions...)...)
+	if err != nil {
+		j.handler.logger.Warn("Failed to update debug progress", zap.String("job_id", j.id), zap.Error(err))
+	}
+}
+
+// OnProgress implements debug.Listener.
+func (j *debugJob) OnProgress(p debug.Progress) {
+	j.updateProgress(j.ctx, formatDebugProgress(p), true)
+}
+
+// OnGroupsReady implements debug.Listener.
+func (j *debugJob) OnGroupsReady(result *debug.DebugResult, groupCount int) {
+	threadTS, err := j.handler.postDebugHeader(j.ctx, j.channelID, result, groupCount)
+	if err != nil {
+		// Groups are posted into the header's thread, so analyzing them would only spend tokens
+		j.handler.logger.Warn("Failed to post debug result header", zap.String("job_id", j.id), zap.Error(err))
+		j.mu.Lock()
+		j.headerErr = err
+		j.mu.Unlock()
+		j.cancel()
+		return
+	}
+	j.mu.Lock()
+	j.threadTS = threadTS
+	j.mu.Unlock()
+}
+
+// OnGroupAnalyzed implements debug.Listener.
+func (j *debugJob) OnGroupAnalyzed(result *debug.DebugResult, index int, group debug.ErrorGroupResult) {
+	j.mu.Lock()
+	threadTS := j.threadTS
+	j.mu.Unlock()
+	if threadTS == "" {
+		return // The header could not be posted and the job is being cancelled
+	}
+	j.handler.feedback.add(j.channelID, threadTS, result, index, group)
+	if err := j.handler.postDebugGroup(j.ctx, j.channelID, threadTS, result.ProjectID, index, group); err != nil {
+		j.handler.logger.Warn("Failed to post debug group", zap.String("job_id", j.id), zap.Int("group", index+1), zap.Error(err))
+	}
+}
+
+// formatDebugProgress formats progress as e.g. "fetched 100 errors → grouped into 4 → analyzing group 2/4".
+func formatDebugProgress(p debug.Progress) string {
+	switch p.Stage {
+	case debug.StageFetching:
+		return "fetching error logs..."
+	case debug.StageGrouping:
+		return fmt.Sprintf("fetched %d errors → grouping...", p.ErrorCount)
+	case debug.StageAnalyzing:
+		return fmt.Sprintf("fetched %d errors → grouped into %d → analyzing group %d/%d",
+			p.ErrorCount, p.GroupCount, p.GroupIndex, p.GroupCount)
+	default:
+		return string(p.Stage)
+	}
+}
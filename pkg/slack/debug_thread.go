@@ -0,0 +1,108 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/debug"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+const (
+	debugThreadTTL  = 24 * time.Hour  // How long follow-up questions can be asked in a result thread
+	followUpTimeout = 2 * time.Minute // Timeout for answering a follow-up question
+)
+
+// debugThread is the conversation in the thread of a debug result.
+type debugThread struct {
+	result    *debug.DebugResult
+	history   []adk.Turn
+	updatedAt time.Time
+}
+
+// debugThreads keeps debug results by thread so that follow-up questions can be answered.
+type debugThreads struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	threads map[string]*debugThread // channel/thread timestamp -> thread
+}
+
+func newDebugThreads() *debugThreads {
+	return &debugThreads{now: time.Now, threads: make(map[string]*debugThread)}
+}
+
+func threadKey(channelId, threadTS string) string {
+	return channelId + "/" + threadTS
+}
+
+// add registers the result posted in a thread and drops expired threads.
+func (t *debugThreads) add(channelId, threadTS string, result *debug.DebugResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for key, thread := range t.threads {
+		if now.Sub(thread.updatedAt) > debugThreadTTL {
+			delete(t.threads, key)
+		}
+	}
+	t.threads[threadKey(channelId, threadTS)] = &debugThread{result: result, updatedAt: now}
+}
+
+// get returns the result and a copy of the conversation history of a thread.
+func (t *debugThreads) get(channelId, threadTS string) (*debug.DebugResult, []adk.Turn, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	thread, ok := t.threads[threadKey(channelId, threadTS)]
+	if !ok || t.now().Sub(thread.updatedAt) > debugThreadTTL {
+		return nil, nil, false
+	}
+	return thread.result, append([]adk.Turn(nil), thread.history...), true
+}
+
+// addTurn appends a question and answer to the thread's history.
+func (t *debugThreads) addTurn(channelId, threadTS string, turn adk.Turn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if thread, ok := t.threads[threadKey(channelId, threadTS)]; ok {
+		thread.history = append(thread.history, turn)
+		thread.updatedAt = t.now()
+	}
+}
+
+// mentionText returns the text of an app mention without the leading bot mention.
+func mentionText(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "<@") {
+		if i := strings.Index(text, ">"); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// answerFollowUp answers a question asked in the thread of a debug result.
+// It runs in the background since the LLM call can take longer than Slack waits for an event response.
+func (h *MultiProjectSlackEventHandler) answerFollowUp(channelId, threadTS, question string, result *debug.DebugResult, history []adk.Turn) {
+	ctx, cancel := context.WithTimeout(context.Background(), followUpTimeout)
+	defer cancel()
+
+	meter := &adk.UsageMeter{}
+	answer, err := h.debugger.FollowUp(adk.WithUsageMeter(ctx, meter), result, history, question)
+	h.budgets.add(channelId, meter.Total())
+	if err != nil {
+		h.logger.Warn("Failed to answer follow-up question", zap.String("thread_ts", threadTS), zap.Error(err))
+		answer = fmt.Sprintf("Failed to answer the question: %s", err.Error())
+	} else {
+		h.threads.addTurn(channelId, threadTS, adk.Turn{Question: question, Answer: answer})
+	}
+
+	_, _, err = h.client.PostMessageContext(ctx, channelId, slack.MsgOptionText(answer, false), slack.MsgOptionTS(threadTS))
+	if err != nil {
+		h.logger.Warn("Failed to post follow-up answer", zap.String("thread_ts", threadTS), zap.Error(err))
+	}
+}
@@ -0,0 +1,78 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/slack-go/slack"
+)
+
+type directMessageKey struct{}
+
+// inDirectMessage returns a context for a command run in a direct message with the bot.
+func inDirectMessage(ctx context.Context) context.Context {
+	return context.WithValue(ctx, directMessageKey{}, true)
+}
+
+func isDirectMessage(ctx context.Context) bool {
+	dm, _ := ctx.Value(directMessageKey{}).(bool)
+	return dm
+}
+
+// memberProjects returns the projects of the configured channels the user is a member of, which scope commands
+// run in a direct message since it has no projects of its own. It returns nil if the user is in none of them.
+func (h *MultiProjectSlackEventHandler) memberProjects(ctx context.Context, userId string) ([]string, error) {
+	channels, err := h.memberChannels(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return h.channelsProjects(channels), nil
+}
+
+// memberChannels returns the channels the user is a member of that the bot can see.
+func (h *MultiProjectSlackEventHandler) memberChannels(ctx context.Context, userId string) ([]slack.Channel, error) {
+	var channels []slack.Channel
+	params := &slack.GetConversationsForUserParameters{
+		UserID:          userId,
+		Types:           []string{"public_channel", "private_channel"},
+		Limit:           200,
+		ExcludeArchived: true,
+	}
+	for {
+		page, cursor, err := h.client.GetConversationsForUserContext(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list channels of user %s: %w", userId, err)
+		}
+		channels = append(channels, page...)
+		if cursor == "" {
+			return channels, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// directMessageChannel returns the channel of the direct message between the bot and the user.
+func (h *MultiProjectSlackEventHandler) directMessageChannel(ctx context.Context, userId string) (string, error) {
+	channel, _, _, err := h.client.OpenConversationContext(ctx, &slack.OpenConversationParameters{Users: []string{userId}, ReturnIM: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to open direct message with user %s: %w", userId, err)
+	}
+	return channel.ID, nil
+}
+
+// channelsProjects returns the projects of the channels, which are configured by ID or name.
+func (h *MultiProjectSlackEventHandler) channelsProjects(channels []slack.Channel) []string {
+	var projects []string
+	seen := make(map[string]bool)
+	for _, c := range channels {
+		for _, key := range []string{c.ID, c.Name} {
+			for _, projectID := range h.config.ChannelToProjects[key] {
+				if !seen[projectID] {
+					seen[projectID] = true
+					projects = append(projects, projectID)
+				}
+			}
+		}
+	}
+	return projects
+}
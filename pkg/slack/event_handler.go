@@ -2,18 +2,24 @@ package slack
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/approval"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/authz"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudrun"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/config"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/debug"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/deploy"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/export"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/memory"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/monitoring"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/trace"
 	"github.com/nakamasato/cloud-run-slack-bot/pkg/visualize"
@@ -21,6 +27,7 @@ import (
 	"github.com/slack-go/slack/slackevents"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -28,8 +35,21 @@ const (
 	ActionIdDescribeResource = "select-resource-for-describe"
 	ActionIdMetricsResource  = "select-resource-for-metrics"
 	ActionIdCurrentResource  = "select-current-resource"
+	ActionIdChannelResource  = "select-channel-resource"
 	ActionIdDebugResource    = "select-resource-for-debug"
-	ActionIdMetrics          = "metrics"
+	ActionIdCancelDebug      = "cancel-debug-job"
+	ActionIdExportDebug      = "export-debug-result"
+	ActionIdFeedback         = "debug-feedback"
+	ActionIdMetricsDuration  = "select-metrics-duration"
+	ActionIdMetricsType      = "select-metrics-type"
+	ActionIdDescribeButton   = "resource-describe"
+	ActionIdMetricsButton    = "resource-metrics"
+	ActionIdDebugButton      = "resource-debug"
+	ActionIdLogsButton       = "resource-logs" // Opens the logs in the console, so its clicks are only acknowledged
+	ActionIdHomeRefresh      = "home-refresh"
+	ActionIdDebugShortcut    = "debug-this-service" // Callback ID of the "Debug this service" message shortcut
+	ActionIdApproveRequest   = "approve-request"
+	ActionIdRejectRequest    = "reject-request"
 	defaultDuration          = 24 * time.Hour
 	defaultAggregationPeriod = 5 * time.Minute
 	defaultMetricsType       = "count"
@@ -249,6 +269,9 @@ func (h *SlackEventHandler) HandleInteraction(interaction *slack.InteractionCall
 	switch interaction.Type {
 	case slack.InteractionTypeBlockActions:
 		action := interaction.ActionCallback.BlockActions[0]
+		if action.ActionID == ActionIdMetricsDuration || action.ActionID == ActionIdMetricsType {
+			return h.handleMetricsSelect(ctx, interaction.Channel.ID, action)
+		}
 
 		// Parse resource type and name from the selected option value
 		value := action.SelectedOption.Value
@@ -279,64 +302,46 @@ func (h *SlackEventHandler) HandleInteraction(interaction *slack.InteractionCall
 			// Handle all set current resource actions
 			return h.setCurrentResource(ctx, interaction.Channel.ID, interaction.User.ID, resourceName, resourceType)
 		}
-	case slack.InteractionTypeInteractionMessage:
-		callbackId := interaction.CallbackID
-		switch callbackId {
-		case ActionIdMetrics:
-			durationVal := defaultDuration.String()
-			metricsTypeVal := defaultMetricsType
-			for _, action := range interaction.ActionCallback.AttachmentActions {
-				switch action.Name {
-				case "duration":
-					durationVal = action.SelectedOptions[0].Value
-				case "metrics":
-					metricsTypeVal = action.SelectedOptions[0].Value
-				}
-			}
-
-			h.logger.Debug("Processing metrics interaction", zap.Int("attachment_actions_count", len(interaction.ActionCallback.AttachmentActions)))
-			// metricsTypeVal := interaction.ActionCallback.AttachmentActions[1].SelectedOptions[0].Value
-			svc, ok := h.memory.Get(interaction.User.ID)
-			if !ok {
-				return h.list(ctx, interaction.Channel.ID, ActionIdMetricsResource)
-			}
-			duration, err := time.ParseDuration(durationVal)
-			if err != nil {
-				return err
-			}
-			aggregationPeriod, ok := durationAggregationPeriodMap[durationVal]
-			if !ok {
-				aggregationPeriod = defaultAggregationPeriod
-			}
-			return h.getServiceMetrics(ctx, interaction.Channel.ID, svc, metricsTypeVal, duration, aggregationPeriod)
-		}
-
 	}
 	return fmt.Errorf("unsupported interaction %v", interaction.Type)
 }
 
+// handleMetricsSelect shows the metrics chart again with the duration or type selected in one.
+func (h *SlackEventHandler) handleMetricsSelect(ctx context.Context, channelId string, action *slack.BlockAction) error {
+	resourceValue, metricsType, duration, err := parseMetricsSelectValue(action.SelectedOption.Value)
+	if err != nil {
+		return err
+	}
+	_, svcName, err := ParseResourceValue(resourceValue)
+	if err != nil {
+		return fmt.Errorf("failed to parse resource value: %v", err)
+	}
+	return h.getServiceMetrics(ctx, channelId, svcName, metricsType, duration, aggregationPeriodFor(duration))
+}
+
 func (h *SlackEventHandler) help(ctx context.Context, channelId, userId string) error {
-	attachment := slack.Attachment{
-		Text: "Available commands:",
-		Fields: []slack.AttachmentField{
-			{
-				Title: "`describe` or `d`",
-				Value: "describe the target Cloud Run service or job.\n you can check the latest revision, last modifier, update time, etc.",
-			},
-			{
-				Title: "`metrics` or `m`",
-				Value: "show the request count of the target Cloud Run service or job description.\n for services, you can check the request count per revision.",
-			},
-			{
-				Title: "`set` or `s`",
-				Value: "set the target Cloud Run service or job.\n this displays a list of both services and jobs to select from.",
-			},
+	blocks := HeaderBlocks("Available commands")
+	blocks = append(blocks, FieldBlocks([]Field{
+		{
+			Title: "`describe` or `d`",
+			Value: "describe the target Cloud Run service or job.\n you can check the latest revision, last modifier, update time, etc.",
+			Long:  true,
 		},
-	}
+		{
+			Title: "`metrics` or `m`",
+			Value: "show the request count of the target Cloud Run service or job description.\n for services, you can check the request count per revision.",
+			Long:  true,
+		},
+		{
+			Title: "`set` or `s`",
+			Value: "set the target Cloud Run service or job.\n this displays a list of both services and jobs to select from.",
+			Long:  true,
+		},
+	})...)
 	_, err := h.client.PostEphemeralContext(
 		ctx, channelId, userId,
 		slack.MsgOptionText("Usage: @<slack app> <command> e.g. `@cloud-run-bot describe`", false),
-		slack.MsgOptionAttachments(attachment),
+		slack.MsgOptionBlocks(blocks...),
 	)
 	return err
 }
@@ -487,78 +492,23 @@ func (h *SlackEventHandler) getServiceMetrics(ctx context.Context, channelId, sv
 		return err
 	}
 
-	// f, err := h.client.UploadFileContext(ctx, slack.FileUploadParameters{
-	// 	Reader:   file,
-	// 	Filename: imgName,
-	// 	Filetype: "png",
-	// })
-	// if err != nil {
-	// 	return err
-	// }
-
-	fields := []slack.AttachmentField{}
+	var fields []Field
 	for k, v := range *seriesMap {
 		var total int64
 		for _, p := range v {
 			total += int64(p.Val)
 		}
-		fields = append(fields, slack.AttachmentField{
-			Title: k,
-			Value: fmt.Sprint(total),
-			Short: true,
-		})
+		fields = append(fields, Field{Title: k, Value: fmt.Sprint(total)})
 	}
 
-	attachment := slack.Attachment{
-		Text:       title,
-		Fields:     fields,
-		Color:      "good", // good, warning, danger
-		CallbackID: ActionIdMetrics,
-		Actions: []slack.AttachmentAction{
-			{
-				Name: "duration",
-				Text: "Duration",
-				Type: "select",
-				Options: []slack.AttachmentActionOption{
-					{
-						Text:  "1h",
-						Value: "1h",
-					},
-					{
-						Text:  "1d",
-						Value: "24h",
-					},
-					{
-						Text:  "1w",
-						Value: "168h",
-					},
-				},
-			},
-			{
-				Name: "metrics",
-				Text: "Metrics",
-				Type: "select",
-				Options: []slack.AttachmentActionOption{
-					{
-						Text:  "latency",
-						Value: "latency",
-					},
-					{
-						Text:  "count",
-						Value: "count",
-					},
-				},
-			},
-		},
-	}
+	blocks := HeaderBlocks(fmt.Sprintf("%s: %s", title, svcName), fmt.Sprintf("Last %s", formatDuration(duration)))
+	blocks = append(blocks, FieldBlocks(fields)...)
+	blocks = append(blocks, slack.NewActionBlock("", metricsSelects("service:"+svcName, metricsType, duration)...))
 	_, _, err = h.client.PostMessageContext(
 		ctx, channelId,
 		slack.MsgOptionText(fmt.Sprintf("`%s`", svcName), false),
-		slack.MsgOptionAttachments(attachment),
+		slack.MsgOptionBlocks(blocks...),
 	)
-	if err != nil {
-		return err
-	}
 	return err
 }
 
@@ -570,40 +520,15 @@ func (h *SlackEventHandler) describeService(ctx context.Context, channelId, svcN
 		h.logger.Error("Failed to get service", zap.String("service", svcName), zap.String("handler", "legacy"), zap.Error(err))
 		msgOptions = append(msgOptions, slack.MsgOptionText("Failed to get service: "+err.Error(), false))
 	} else {
-		msgOptions = append(msgOptions, slack.MsgOptionAttachments(slack.Attachment{
-			Fields: []slack.AttachmentField{
-				{
-					Title: "Name",
-					Value: svc.Name,
-					Short: true,
-				},
-				{
-					Title: "LatestRevision",
-					Value: svc.LatestRevision,
-					Short: true,
-				},
-				{
-					Title: "Image",
-					Value: svc.Image,
-					Short: true,
-				},
-				{
-					Title: "LastModifier",
-					Value: svc.LastModifier,
-					Short: true,
-				},
-				{
-					Title: "UpdateTime",
-					Value: svc.UpdateTime.Format("2006/01/02 15:04:05"),
-					Short: true,
-				},
-				{
-					Title: "Resource Limit",
-					Value: fmt.Sprintf("- cpu:%s\n- memory:%s", svc.ResourceLimits["cpu"], svc.ResourceLimits["memory"]),
-					Short: true,
-				},
-			},
-		}))
+		blocks := HeaderBlocks(fmt.Sprintf("Cloud Run service %s", svc.Name), ProjectDetail(svc.Project), RegionDetail(svc.Region))
+		blocks = append(blocks, FieldBlocks([]Field{
+			{Title: "Latest Revision", Value: fmt.Sprintf("`%s`", svc.LatestRevision)},
+			{Title: "Image", Value: fmt.Sprintf("`%s`", svc.Image)},
+			{Title: "Last Modifier", Value: svc.LastModifier},
+			{Title: "Update Time", Value: svc.UpdateTime.Format("2006/01/02 15:04:05")},
+			{Title: "Resource Limit", Value: fmt.Sprintf("- cpu:%s\n- memory:%s", svc.ResourceLimits["cpu"], svc.ResourceLimits["memory"])},
+		})...)
+		msgOptions = append(msgOptions, slack.MsgOptionText(svc.Name, false), slack.MsgOptionBlocks(blocks...))
 	}
 	_, _, err = h.client.PostMessageContext(ctx, channelId, msgOptions...)
 	return err
@@ -615,40 +540,15 @@ func (h *SlackEventHandler) describeJob(ctx context.Context, channelId, jobName
 	if err != nil {
 		msgOptions = append(msgOptions, slack.MsgOptionText("Failed to get job: "+err.Error(), false))
 	} else {
-		msgOptions = append(msgOptions, slack.MsgOptionAttachments(slack.Attachment{
-			Fields: []slack.AttachmentField{
-				{
-					Title: "Name",
-					Value: job.Name,
-					Short: true,
-				},
-				{
-					Title: "Image",
-					Value: job.Image,
-					Short: true,
-				},
-				{
-					Title: "LastModifier",
-					Value: job.LastModifier,
-					Short: true,
-				},
-				{
-					Title: "UpdateTime",
-					Value: job.UpdateTime.Format("2006/01/02 15:04:05"),
-					Short: true,
-				},
-				{
-					Title: "Resource Limit",
-					Value: fmt.Sprintf("- cpu:%s\n- memory:%s", job.ResourceLimits["cpu"], job.ResourceLimits["memory"]),
-					Short: true,
-				},
-				{
-					Title: "Console URL",
-					Value: fmt.Sprintf("<%s|Cloud Run Job>", job.GetYamlUrl()),
-					Short: true,
-				},
-			},
-		}))
+		blocks := HeaderBlocks(fmt.Sprintf("Cloud Run job %s", job.Name), ProjectDetail(job.Project), RegionDetail(job.Region))
+		blocks = append(blocks, FieldBlocks([]Field{
+			{Title: "Image", Value: fmt.Sprintf("`%s`", job.Image)},
+			{Title: "Last Modifier", Value: job.LastModifier},
+			{Title: "Update Time", Value: job.UpdateTime.Format("2006/01/02 15:04:05")},
+			{Title: "Resource Limit", Value: fmt.Sprintf("- cpu:%s\n- memory:%s", job.ResourceLimits["cpu"], job.ResourceLimits["memory"])},
+			{Title: "Console URL", Value: fmt.Sprintf("<%s|Cloud Run Job>", job.GetYamlUrl())},
+		})...)
+		msgOptions = append(msgOptions, slack.MsgOptionText(job.Name, false), slack.MsgOptionBlocks(blocks...))
 	}
 	_, _, err = h.client.PostMessageContext(ctx, channelId, msgOptions...)
 	return err
@@ -680,26 +580,48 @@ func (h *SlackEventHandler) sample(ctx context.Context, channelId string) error
 
 // MultiProjectSlackEventHandler handles slack events for multiple projects
 type MultiProjectSlackEventHandler struct {
-	client   *slack.Client
-	mClients map[string]*monitoring.Client
-	rClients map[string]*cloudrun.Client
-	debugger *debug.Debugger // nil if debug feature is disabled
-	memory   *Memory
-	tmpDir   string
-	config   *config.Config
-	logger   *zap.Logger
+	client    *slack.Client
+	mClients  map[string]*monitoring.Client
+	rClients  map[string]*cloudrun.Client
+	debugger  *debug.Debugger   // nil if debug feature is disabled
+	jobs      *debugJobs        // running debug jobs
+	threads   *debugThreads     // debug results open for follow-up questions
+	feedback  *feedbackTargets  // analyzed groups that can be rated
+	budgets   *tokenBudgets     // daily LLM token budgets by channel
+	authz     *authz.Authorizer // nil if every user may run every command
+	audit     *audit.Trail      // commands run through the bot
+	exports   export.Store      // nil if exports are only uploaded to Slack
+	memory    *memory.Memory
+	deploys   *deploy.Log         // changes seen in Cloud Run audit logs, for the App Home tab
+	approvals *approval.Approvals // requests of commands that change Cloud Run state, waiting for approval
+	tmpDir    string
+	config    *config.Config
+	logger    *zap.Logger
 }
 
-func NewMultiProjectSlackEventHandler(client *slack.Client, rClients map[string]*cloudrun.Client, mClients map[string]*monitoring.Client, debugger *debug.Debugger, tmpDir string, cfg *config.Config, logger *zap.Logger) *MultiProjectSlackEventHandler {
+func NewMultiProjectSlackEventHandler(client *slack.Client, rClients map[string]*cloudrun.Client, mClients map[string]*monitoring.Client, debugger *debug.Debugger, exports export.Store, trail *audit.Trail, resources *memory.Memory, deploys *deploy.Log, approvals *approval.Approvals, tmpDir string, cfg *config.Config, logger *zap.Logger) *MultiProjectSlackEventHandler {
+	var authorizer *authz.Authorizer
+	if cfg.RBAC != nil {
+		authorizer = authz.New(cfg.RBAC, userGroupResolver{client: client})
+	}
 	return &MultiProjectSlackEventHandler{
-		client:   client,
-		rClients: rClients,
-		mClients: mClients,
-		debugger: debugger,
-		memory:   NewMemory(),
-		tmpDir:   tmpDir,
-		config:   cfg,
-		logger:   logger,
+		client:    client,
+		rClients:  rClients,
+		mClients:  mClients,
+		debugger:  debugger,
+		jobs:      newDebugJobs(),
+		threads:   newDebugThreads(),
+		feedback:  newFeedbackTargets(),
+		budgets:   newTokenBudgets(cfg.DebugDailyTokens, cfg.DebugChannelDailyTokens),
+		authz:     authorizer,
+		audit:     trail,
+		exports:   exports,
+		memory:    resources,
+		deploys:   deploys,
+		approvals: approvals,
+		tmpDir:    tmpDir,
+		config:    cfg,
+		logger:    logger,
 	}
 }
 
@@ -712,59 +634,41 @@ func (h *MultiProjectSlackEventHandler) HandleEvent(event *slackevents.EventsAPI
 
 	switch e := innerEvent.Data.(type) {
 	case *slackevents.AppMentionEvent:
-		message := strings.Split(e.Text, " ")
-		command := "describe"
-		if len(message) > 1 {
-			command = message[1]
+		ctx = audit.Start(ctx, e.User, e.Channel, "mention")
+		err := h.handleMessage(ctx, span, e.Channel, e.User, e.ThreadTimeStamp, mentionText(e.Text))
+		h.audit.Finish(ctx, err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
-		h.logger.Info("Received app mention in multi-project mode", zap.String("command", command))
-
-		span.SetAttributes(
-			attribute.String("slack.command", command),
-			attribute.String("slack.user", e.User),
-			attribute.String("slack.channel", e.Channel),
-		)
-
-		currentItem, ok := h.memory.Get(e.User)
-
-		// Check if we can auto-detect projects from channel
-		channelProjects := h.config.GetProjectsForChannel(e.Channel)
-		h.logger.Debug("Channel associated with projects", zap.String("channel", e.Channel), zap.Strings("projects", channelProjects))
-		span.SetAttributes(attribute.StringSlice("channel.projects", channelProjects))
-
-		var err error
-		switch command {
-		case "describe", "d":
-			if !ok {
-				err = h.listResourcesForChannel(ctx, e.Channel, ActionIdDescribeResource, channelProjects)
-			} else {
-				err = h.describeResource(ctx, e.Channel, currentItem)
-			}
-		case "metrics", "m":
-			if !ok {
-				err = h.listResourcesForChannel(ctx, e.Channel, ActionIdMetricsResource, channelProjects)
-			} else {
-				err = h.getResourceMetrics(ctx, e.Channel, currentItem, "count", defaultDuration, defaultAggregationPeriod)
-			}
-		case "debug", "dbg":
-			if h.debugger == nil {
-				_, err = h.client.PostEphemeralContext(ctx, e.Channel, e.User,
-					slack.MsgOptionText("Debug feature is not enabled. Set DEBUG_ENABLED=true to enable.", false))
-			} else if !ok {
-				err = h.listResourcesForChannel(ctx, e.Channel, ActionIdDebugResource, channelProjects)
-			} else {
-				err = h.debugResource(ctx, e.Channel, e.User, currentItem)
-			}
-		case "set", "s":
-			err = h.listResourcesForChannel(ctx, e.Channel, ActionIdCurrentResource, channelProjects)
-		case "help", "h":
-			err = h.help(ctx, e.Channel, e.User)
-		case "sample":
-			err = h.sample(ctx, e.Channel)
-		default:
-			err = h.help(ctx, e.Channel, e.User)
+		return err
+	case *slackevents.LinkSharedEvent:
+		ctx = audit.Start(ctx, e.User, e.Channel, "unfurl")
+		err := h.unfurlLinks(ctx, e)
+		h.audit.Finish(ctx, err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
-
+		return err
+	case *slackevents.AppHomeOpenedEvent:
+		if e.Tab != "home" {
+			return nil
+		}
+		err := h.publishHome(ctx, e.User)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	case *slackevents.MessageEvent:
+		// Only messages sent to the bot in a direct message are commands; the bot's own messages, edits, etc. are ignored
+		if e.ChannelType != "im" || e.BotID != "" || e.SubType != "" {
+			return nil
+		}
+		ctx = inDirectMessage(audit.Start(ctx, e.User, e.Channel, "dm"))
+		err := h.handleMessage(ctx, span, e.Channel, e.User, e.ThreadTimeStamp, mentionText(e.Text))
+		h.audit.Finish(ctx, err)
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
@@ -777,11 +681,226 @@ func (h *MultiProjectSlackEventHandler) HandleEvent(event *slackevents.EventsAPI
 	return err
 }
 
+// handleMessage runs the command of a mention or direct message, or answers a follow-up question in a debug result thread.
+func (h *MultiProjectSlackEventHandler) handleMessage(ctx context.Context, span oteltrace.Span, channelId, userId, threadTS, text string) error {
+	// Mentions in the thread of a debug result are follow-up questions about it
+	if threadTS != "" && h.debugger != nil {
+		if result, history, ok := h.threads.get(channelId, threadTS); ok {
+			span.SetAttributes(attribute.String("slack.command", "follow-up"))
+			audit.SetResource(ctx, result.ProjectID+":"+result.ResourceType+":"+result.ResourceName)
+			if allowed, err := h.authorize(ctx, channelId, userId, threadTS, authz.CommandFollowUp, []string{result.ProjectID}); !allowed {
+				return err
+			}
+			if msg := h.budgets.exceeded(channelId); msg != "" {
+				_, err := h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText(msg, false), slack.MsgOptionTS(threadTS))
+				return err
+			}
+			go h.answerFollowUp(channelId, threadTS, text, result, history)
+			return nil
+		}
+	}
+
+	h.logger.Info("Received message in multi-project mode", zap.String("text", text), zap.Bool("direct_message", isDirectMessage(ctx)))
+	return h.runCommand(ctx, span, channelId, userId, text, false)
+}
+
+// runCommand runs a command typed in a mention or slash command, e.g. `describe my-service --project foo`.
+// If ephemeral is true, results are only shown to the user unless the command has `--share`.
+func (h *MultiProjectSlackEventHandler) runCommand(ctx context.Context, span oteltrace.Span, channelId, userId, text string, ephemeral bool) error {
+	m, err := parseMention(text)
+	if err != nil {
+		_, err = h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText(
+			fmt.Sprintf("Invalid command: %s. Usage: `<command> [name] [--project <id>] [--type service|job]`, see `help`.", err.Error()), false))
+		return err
+	}
+	command := m.command
+	if ephemeral && !m.share {
+		ctx = replyEphemerally(ctx, userId)
+	}
+
+	span.SetAttributes(
+		attribute.String("slack.command", command),
+		attribute.String("slack.user", userId),
+		attribute.String("slack.channel", channelId),
+	)
+
+	// Check if we can auto-detect projects from channel. A direct message has no projects, so those of the user's channels are used
+	channelProjects := h.config.GetProjectsForChannel(channelId)
+	if isDirectMessage(ctx) {
+		// Without projects, commands would act on all configured projects, so they are refused instead
+		channelProjects, err = h.memberProjects(ctx, userId)
+		if err != nil {
+			h.logger.Warn("Failed to resolve the projects of a direct message", zap.String("user", userId), zap.Error(err))
+			return h.postMessage(ctx, channelId, slack.MsgOptionText("Could not resolve the projects of your channels. Please try again later, or run the command in a channel.", false))
+		}
+		if len(channelProjects) == 0 {
+			return h.postMessage(ctx, channelId, slack.MsgOptionText("Commands in direct messages act on the projects of the channels you are a member of, but none of your channels has projects. Run the command in a channel.", false))
+		}
+		if m.project != "" && !slices.Contains(channelProjects, m.project) {
+			return h.postMessage(ctx, channelId, slack.MsgOptionText(fmt.Sprintf(
+				"Project `%s` is not a project of your channels. In direct messages, use one of `%s`.", m.project, strings.Join(channelProjects, "`, `")), false))
+		}
+	}
+	h.logger.Debug("Channel associated with projects", zap.String("channel", channelId), zap.Strings("projects", channelProjects))
+	span.SetAttributes(attribute.StringSlice("channel.projects", channelProjects))
+
+	// Resources are listed or looked up by name in the channel's projects, or the project given with --project
+	searchProjects := h.listedProjects(channelProjects)
+	if m.project != "" {
+		searchProjects = []string{m.project}
+	}
+
+	authzCommand := mentionCommand(command)
+	if m.channel {
+		authzCommand = authz.CommandSetChannel
+	}
+	var currentItem string
+	var ok bool
+	if m.name == "" && (authzCommand == authz.CommandDescribe || authzCommand == authz.CommandMetrics || authzCommand == authz.CommandDebug) {
+		currentItem, ok = h.currentResource(ctx, channelId, userId)
+	}
+
+	// Commands on the current resource act on its project; others list, look up or set resources of the searched projects
+	var projects []string
+	switch authzCommand {
+	case authz.CommandDescribe, authz.CommandMetrics, authz.CommandDebug:
+		if ok {
+			projects = resourceProject(currentItem)
+		} else {
+			projects = searchProjects
+		}
+	case authz.CommandSet, authz.CommandSetChannel, authz.CommandSample, authz.CommandRollback:
+		projects = searchProjects
+	}
+	if allowed, err := h.authorize(ctx, channelId, userId, "", authzCommand, projects); !allowed {
+		return err
+	}
+
+	// A resource named in the command is used instead of the current one, and becomes the current one
+	if m.name != "" && len(projects) > 0 {
+		value, msg, err := h.resolveResource(ctx, m.name, m.resourceType, searchProjects)
+		if err != nil {
+			return err
+		}
+		if msg != "" {
+			_, err = h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText(msg, false))
+			return err
+		}
+		currentItem, ok = value, true
+		if authzCommand != authz.CommandSet && authzCommand != authz.CommandSetChannel {
+			_, resourceType, _, _ := ParseMultiProjectResourceValue(value)
+			h.rememberResource(ctx, channelId, userId, value, resourceType)
+		}
+	}
+
+	switch command {
+	case "describe", "d":
+		if !ok {
+			err = h.listResourcesForChannel(ctx, channelId, ActionIdDescribeResource, channelProjects)
+		} else {
+			err = h.describeResource(ctx, channelId, currentItem)
+		}
+	case "metrics", "m":
+		metricsType, duration := defaultMetricsType, defaultDuration
+		if m.metricsType != "" {
+			metricsType = m.metricsType
+		}
+		if m.duration > 0 {
+			duration = m.duration
+		}
+		if !ok {
+			err = h.listResourcesForChannel(ctx, channelId, ActionIdMetricsResource, channelProjects)
+		} else {
+			err = h.getResourceMetrics(ctx, channelId, currentItem, metricsType, duration, aggregationPeriodFor(duration))
+		}
+	case "debug", "dbg":
+		if h.debugger == nil {
+			_, err = h.client.PostEphemeralContext(ctx, channelId, userId,
+				slack.MsgOptionText("Debug feature is not enabled. Set DEBUG_ENABLED=true to enable.", false))
+		} else if !ok {
+			err = h.listResourcesForChannel(ctx, channelId, ActionIdDebugResource, channelProjects)
+		} else {
+			err = h.debugResource(ctx, channelId, userId, currentItem)
+		}
+	case "set", "s":
+		actionId := ActionIdCurrentResource
+		if m.channel {
+			actionId = ActionIdChannelResource
+		}
+		switch {
+		case !ok:
+			err = h.listResourcesForChannel(ctx, channelId, actionId, channelProjects)
+		case m.channel:
+			_, resourceType, _, _ := ParseMultiProjectResourceValue(currentItem)
+			err = h.setChannelResource(ctx, channelId, userId, currentItem, resourceType)
+		default:
+			_, resourceType, _, _ := ParseMultiProjectResourceValue(currentItem)
+			err = h.setCurrentResource(ctx, channelId, userId, currentItem, resourceType)
+		}
+	case "help", "h":
+		err = h.help(ctx, channelId, userId)
+	case "sample":
+		err = h.sample(ctx, channelId)
+	case "audit":
+		err = h.showAudit(ctx, channelId, userId, m.count)
+	case "rollback":
+		err = h.requestRollback(ctx, channelId, userId, currentItem, m.revision)
+	default:
+		err = h.help(ctx, channelId, userId)
+	}
+	return err
+}
+
 func (h *MultiProjectSlackEventHandler) HandleInteraction(interaction *slack.InteractionCallback) error {
-	ctx := context.Background()
+	ctx := audit.Start(context.Background(), interaction.User.ID, interaction.Channel.ID, interactionCommand(interaction))
+	err := h.handleInteraction(ctx, interaction)
+	h.audit.Finish(ctx, err)
+	return err
+}
+
+func (h *MultiProjectSlackEventHandler) handleInteraction(ctx context.Context, interaction *slack.InteractionCallback) error {
+	// Selections in messages only shown to the user, e.g. lists posted for slash commands, are answered in the same way
+	if interaction.Container.IsEphemeral {
+		ctx = replyEphemerally(ctx, interaction.User.ID)
+	}
 	switch interaction.Type {
 	case slack.InteractionTypeBlockActions:
 		action := interaction.ActionCallback.BlockActions[0]
+		if action.BlockID == ActionIdFeedback {
+			if allowed, err := h.authorize(ctx, interaction.Channel.ID, interaction.User.ID, "", authz.CommandFeedback, h.feedbackProject(interaction)); !allowed {
+				return err
+			}
+			return h.recordFeedback(ctx, interaction.Channel.ID, interaction.User.ID, action)
+		}
+		// Buttons of debug jobs carry the job ID or result thread, and metrics selects their settings, rather than a selected resource
+		switch action.ActionID {
+		case ActionIdCancelDebug:
+			if job, ok := h.jobs.get(action.Value); ok {
+				audit.SetResource(ctx, job.projectID+":"+job.resourceType+":"+job.resourceName)
+				if allowed, err := h.authorize(ctx, interaction.Channel.ID, interaction.User.ID, "", authz.CommandCancel, []string{job.projectID}); !allowed {
+					return err
+				}
+			}
+			return h.cancelDebugJob(ctx, interaction.Channel.ID, interaction.User.ID, action.Value)
+		case ActionIdExportDebug:
+			if result, _, ok := h.threads.get(interaction.Channel.ID, action.Value); ok {
+				audit.SetResource(ctx, result.ProjectID+":"+result.ResourceType+":"+result.ResourceName)
+				if allowed, err := h.authorize(ctx, interaction.Channel.ID, interaction.User.ID, "", authz.CommandExport, []string{result.ProjectID}); !allowed {
+					return err
+				}
+			}
+			return h.exportDebugResult(ctx, interaction.Channel.ID, interaction.User.ID, action.Value)
+		case ActionIdDescribeButton, ActionIdMetricsButton, ActionIdDebugButton:
+			return h.handleResourceButton(ctx, interaction, action)
+		case ActionIdLogsButton:
+			return nil
+		case ActionIdMetricsDuration, ActionIdMetricsType:
+			return h.handleMetricsSelect(ctx, interaction, action)
+		case ActionIdHomeRefresh:
+			return h.publishHome(ctx, interaction.User.ID)
+		case ActionIdApproveRequest, ActionIdRejectRequest:
+			return h.decideApproval(ctx, interaction, action)
+		}
 		value := action.SelectedOption.Value
 
 		// Parse project:resourceType:resourceName format
@@ -789,15 +908,19 @@ func (h *MultiProjectSlackEventHandler) HandleInteraction(interaction *slack.Int
 		if err != nil {
 			return fmt.Errorf("failed to parse multi-project resource value: %v", err)
 		}
-		_ = projectID    // Used in action handlers below
 		_ = resourceName // Used in action handlers below
+		if command, ok := actionCommands[action.ActionID]; ok {
+			if allowed, err := h.authorize(ctx, interaction.Channel.ID, interaction.User.ID, "", command, []string{projectID}); !allowed {
+				return err
+			}
+		}
 
 		switch action.ActionID {
 		case ActionIdDescribeResource:
-			h.memory.Set(interaction.User.ID, value, resourceType)
+			h.rememberResource(ctx, interaction.Channel.ID, interaction.User.ID, value, resourceType)
 			return h.describeResource(ctx, interaction.Channel.ID, value)
 		case ActionIdMetricsResource:
-			h.memory.Set(interaction.User.ID, value, resourceType)
+			h.rememberResource(ctx, interaction.Channel.ID, interaction.User.ID, value, resourceType)
 			return h.getResourceMetrics(ctx, interaction.Channel.ID, value, "count", defaultDuration, defaultAggregationPeriod)
 		case ActionIdDebugResource:
 			if h.debugger == nil {
@@ -805,40 +928,16 @@ func (h *MultiProjectSlackEventHandler) HandleInteraction(interaction *slack.Int
 					slack.MsgOptionText("Debug feature is not enabled.", false))
 				return err
 			}
-			h.memory.Set(interaction.User.ID, value, resourceType)
+			h.rememberResource(ctx, interaction.Channel.ID, interaction.User.ID, value, resourceType)
 			return h.debugResource(ctx, interaction.Channel.ID, interaction.User.ID, value)
 		case ActionIdCurrentResource:
 			return h.setCurrentResource(ctx, interaction.Channel.ID, interaction.User.ID, value, resourceType)
+		case ActionIdChannelResource:
+			return h.setChannelResource(ctx, interaction.Channel.ID, interaction.User.ID, value, resourceType)
 		}
-	case slack.InteractionTypeInteractionMessage:
-		callbackId := interaction.CallbackID
-		switch callbackId {
-		case ActionIdMetrics:
-			durationVal := defaultDuration.String()
-			metricsTypeVal := defaultMetricsType
-			for _, action := range interaction.ActionCallback.AttachmentActions {
-				switch action.Name {
-				case "duration":
-					durationVal = action.SelectedOptions[0].Value
-				case "metrics":
-					metricsTypeVal = action.SelectedOptions[0].Value
-				}
-			}
-
-			svc, ok := h.memory.Get(interaction.User.ID)
-			if !ok {
-				channelProjects := h.config.GetProjectsForChannel(interaction.Channel.ID)
-				return h.listResourcesForChannel(ctx, interaction.Channel.ID, ActionIdMetricsResource, channelProjects)
-			}
-			duration, err := time.ParseDuration(durationVal)
-			if err != nil {
-				return err
-			}
-			aggregationPeriod, ok := durationAggregationPeriodMap[durationVal]
-			if !ok {
-				aggregationPeriod = defaultAggregationPeriod
-			}
-			return h.getResourceMetrics(ctx, interaction.Channel.ID, svc, metricsTypeVal, duration, aggregationPeriod)
+	case slack.InteractionTypeMessageAction:
+		if interaction.CallbackID == ActionIdDebugShortcut {
+			return h.debugFromMessage(ctx, interaction)
 		}
 	}
 	return fmt.Errorf("unsupported interaction %v", interaction.Type)
@@ -849,15 +948,14 @@ func (h *MultiProjectSlackEventHandler) listResourcesForChannel(ctx context.Cont
 	if len(channelProjects) == 1 {
 		return h.listSingleProjectResources(ctx, channel, actionId, channelProjects[0])
 	}
-	// If channel has multiple projects or no specific projects, list all or filtered resources
-	return h.listAllProjects(ctx, channel, actionId)
+	// If channel has multiple projects, list theirs, or all projects' resources if the channel has no specific projects
+	return h.listProjectsResources(ctx, channel, actionId, h.listedProjects(channelProjects))
 }
 
 func (h *MultiProjectSlackEventHandler) listSingleProjectResources(ctx context.Context, channel, actionId, projectID string) error {
 	rClient, ok := h.rClients[projectID]
 	if !ok {
-		h.logger.Warn("No client found for project", zap.String("project_id", projectID))
-		return h.listAllProjects(ctx, channel, actionId)
+		return fmt.Errorf("no client found for project %s", projectID)
 	}
 
 	options := []*slack.OptionBlockObject{}
@@ -865,8 +963,7 @@ func (h *MultiProjectSlackEventHandler) listSingleProjectResources(ctx context.C
 	// Get services for this project
 	svcNames, err := rClient.ListServices(ctx)
 	if err != nil {
-		h.logger.Error("Error listing services", zap.String("project_id", projectID), zap.Error(err))
-		return h.listAllProjects(ctx, channel, actionId)
+		return fmt.Errorf("failed to list services of project %s: %w", projectID, err)
 	}
 
 	for _, svcName := range svcNames {
@@ -881,8 +978,7 @@ func (h *MultiProjectSlackEventHandler) listSingleProjectResources(ctx context.C
 	// Get jobs for this project
 	jobNames, err := rClient.ListJobs(ctx)
 	if err != nil {
-		h.logger.Error("Error listing jobs", zap.String("project_id", projectID), zap.Error(err))
-		return h.listAllProjects(ctx, channel, actionId)
+		return fmt.Errorf("failed to list jobs of project %s: %w", projectID, err)
 	}
 
 	for _, jobName := range jobNames {
@@ -895,12 +991,12 @@ func (h *MultiProjectSlackEventHandler) listSingleProjectResources(ctx context.C
 	}
 
 	if len(options) == 0 {
-		_, _, err := h.client.PostMessageContext(ctx, channel,
+		err := h.postMessage(ctx, channel,
 			slack.MsgOptionText(fmt.Sprintf("No Cloud Run services or jobs found in project %s.", projectID), false))
 		return err
 	}
 
-	_, _, err = h.client.PostMessageContext(ctx, channel, slack.MsgOptionBlocks(
+	err = h.postMessage(ctx, channel, slack.MsgOptionBlocks(
 		slack.SectionBlock{
 			Type: slack.MBTSection,
 			Text: &slack.TextBlockObject{
@@ -923,26 +1019,27 @@ func (h *MultiProjectSlackEventHandler) listSingleProjectResources(ctx context.C
 	return err
 }
 
-func (h *MultiProjectSlackEventHandler) listAllProjects(ctx context.Context, channel, actionId string) error {
+// listProjectsResources lists the resources of projects, labeled with their project.
+func (h *MultiProjectSlackEventHandler) listProjectsResources(ctx context.Context, channel, actionId string, projectIDs []string) error {
 	options := []*slack.OptionBlockObject{}
 
-	for _, project := range h.config.Projects {
-		rClient, ok := h.rClients[project.ID]
+	for _, projectID := range projectIDs {
+		rClient, ok := h.rClients[projectID]
 		if !ok {
-			h.logger.Warn("No client found for project", zap.String("project_id", project.ID))
+			h.logger.Warn("No client found for project", zap.String("project_id", projectID))
 			continue
 		}
 
 		// Get services for this project
 		svcNames, err := rClient.ListServices(ctx)
 		if err != nil {
-			h.logger.Error("Error listing services for project", zap.String("project_id", project.ID), zap.Error(err))
+			h.logger.Error("Error listing services for project", zap.String("project_id", projectID), zap.Error(err))
 			continue
 		}
 
 		for _, svcName := range svcNames {
-			displayName := fmt.Sprintf("[%s] [SVC] %s", project.ID, svcName)
-			value := fmt.Sprintf("%s:service:%s", project.ID, svcName)
+			displayName := fmt.Sprintf("[%s] [SVC] %s", projectID, svcName)
+			value := fmt.Sprintf("%s:service:%s", projectID, svcName)
 			options = append(options, &slack.OptionBlockObject{
 				Text:  &slack.TextBlockObject{Type: slack.PlainTextType, Text: displayName},
 				Value: value,
@@ -952,13 +1049,13 @@ func (h *MultiProjectSlackEventHandler) listAllProjects(ctx context.Context, cha
 		// Get jobs for this project
 		jobNames, err := rClient.ListJobs(ctx)
 		if err != nil {
-			h.logger.Error("Error listing jobs for project", zap.String("project_id", project.ID), zap.Error(err))
+			h.logger.Error("Error listing jobs for project", zap.String("project_id", projectID), zap.Error(err))
 			continue
 		}
 
 		for _, jobName := range jobNames {
-			displayName := fmt.Sprintf("[%s] [JOB] %s", project.ID, jobName)
-			value := fmt.Sprintf("%s:job:%s", project.ID, jobName)
+			displayName := fmt.Sprintf("[%s] [JOB] %s", projectID, jobName)
+			value := fmt.Sprintf("%s:job:%s", projectID, jobName)
 			options = append(options, &slack.OptionBlockObject{
 				Text:  &slack.TextBlockObject{Type: slack.PlainTextType, Text: displayName},
 				Value: value,
@@ -967,12 +1064,12 @@ func (h *MultiProjectSlackEventHandler) listAllProjects(ctx context.Context, cha
 	}
 
 	if len(options) == 0 {
-		_, _, err := h.client.PostMessageContext(ctx, channel,
-			slack.MsgOptionText("No Cloud Run services or jobs found in any configured project.", false))
+		err := h.postMessage(ctx, channel,
+			slack.MsgOptionText(fmt.Sprintf("No Cloud Run services or jobs found in projects `%s`.", strings.Join(projectIDs, "`, `")), false))
 		return err
 	}
 
-	_, _, err := h.client.PostMessageContext(ctx, channel, slack.MsgOptionBlocks(
+	err := h.postMessage(ctx, channel, slack.MsgOptionBlocks(
 		slack.SectionBlock{
 			Type: slack.MBTSection,
 			Text: &slack.TextBlockObject{
@@ -996,6 +1093,7 @@ func (h *MultiProjectSlackEventHandler) listAllProjects(ctx context.Context, cha
 }
 
 func (h *MultiProjectSlackEventHandler) describeResource(ctx context.Context, channelId, resourceValue string) error {
+	audit.SetResource(ctx, resourceValue)
 	projectID, resourceType, resourceName, err := ParseMultiProjectResourceValue(resourceValue)
 	if err != nil {
 		return fmt.Errorf("failed to parse resource value: %v", err)
@@ -1013,6 +1111,7 @@ func (h *MultiProjectSlackEventHandler) describeResource(ctx context.Context, ch
 }
 
 func (h *MultiProjectSlackEventHandler) getResourceMetrics(ctx context.Context, channelId, resourceValue, metricsType string, duration, aggregationPeriod time.Duration) error {
+	audit.SetResource(ctx, resourceValue)
 	projectID, resourceType, resourceName, err := ParseMultiProjectResourceValue(resourceValue)
 	if err != nil {
 		return fmt.Errorf("failed to parse resource value: %v", err)
@@ -1037,11 +1136,12 @@ func (h *MultiProjectSlackEventHandler) getResourceMetrics(ctx context.Context,
 		return fmt.Errorf("no cloud run client found for project %s", projectID)
 	}
 
-	return h.getServiceMetricsForProject(ctx, channelId, resourceName, metricsType, duration, aggregationPeriod, mClient, rClient)
+	return h.getServiceMetricsForProject(ctx, channelId, projectID, resourceName, metricsType, duration, aggregationPeriod, mClient, rClient)
 }
 
 func (h *MultiProjectSlackEventHandler) setCurrentResource(ctx context.Context, channelId, userId, resourceValue, resourceType string) error {
-	h.memory.Set(userId, resourceValue, resourceType)
+	audit.SetResource(ctx, resourceValue)
+	h.rememberResource(ctx, channelId, userId, resourceValue, resourceType)
 	projectID, _, resourceName, err := ParseMultiProjectResourceValue(resourceValue)
 	if err != nil {
 		// Fallback to legacy format
@@ -1054,99 +1154,80 @@ func (h *MultiProjectSlackEventHandler) setCurrentResource(ctx context.Context,
 	return err
 }
 
+// setChannelResource sets the current resource of the channel's users who have not set their own.
+// It is posted to the channel since it changes what everyone's commands act on.
+func (h *MultiProjectSlackEventHandler) setChannelResource(ctx context.Context, channelId, userId, resourceValue, resourceType string) error {
+	audit.SetResource(ctx, resourceValue)
+	projectID, _, resourceName, err := ParseMultiProjectResourceValue(resourceValue)
+	if err != nil {
+		return fmt.Errorf("failed to parse resource value: %v", err)
+	}
+	if err := h.memory.SetChannelDefault(ctx, channelId, resourceValue, resourceType); err != nil {
+		return err
+	}
+	_, _, err = h.client.PostMessageContext(ctx, channelId,
+		slack.MsgOptionText(fmt.Sprintf("<@%s> set the default %s of this channel to %s in project %s", userId, resourceType, resourceName, projectID), false))
+	return err
+}
+
+// currentResource returns the user's current resource value in the channel. Failures to read the memory are
+// logged and treated as no current resource, so that the user is asked to select one.
+func (h *MultiProjectSlackEventHandler) currentResource(ctx context.Context, channelId, userId string) (string, bool) {
+	entry, ok, err := h.memory.Get(ctx, channelId, userId)
+	if err != nil {
+		h.logger.Warn("Failed to get current resource", zap.String("channel", channelId), zap.String("user", userId), zap.Error(err))
+		return "", false
+	}
+	return entry.Resource, ok
+}
+
+// rememberResource sets the user's current resource in the channel. Failures are only logged since the command
+// on the selected resource can still run.
+func (h *MultiProjectSlackEventHandler) rememberResource(ctx context.Context, channelId, userId, resourceValue, resourceType string) {
+	if err := h.memory.Set(ctx, channelId, userId, resourceValue, resourceType); err != nil {
+		h.logger.Warn("Failed to set current resource", zap.String("channel", channelId), zap.String("user", userId), zap.Error(err))
+	}
+}
+
 func (h *MultiProjectSlackEventHandler) describeServiceForProject(ctx context.Context, channelId, svcName string, rClient *cloudrun.Client) error {
-	msgOptions := []slack.MsgOption{}
 	h.logger.Debug("Getting service for project", zap.String("service", svcName))
 	svc, err := rClient.GetService(ctx, svcName)
 	if err != nil {
 		h.logger.Error("Failed to get service", zap.String("service", svcName), zap.Error(err))
-		msgOptions = append(msgOptions, slack.MsgOptionText("Failed to get service: "+err.Error(), false))
-	} else {
-		msgOptions = append(msgOptions, slack.MsgOptionAttachments(slack.Attachment{
-			Fields: []slack.AttachmentField{
-				{
-					Title: "Name",
-					Value: svc.Name,
-					Short: true,
-				},
-				{
-					Title: "LatestRevision",
-					Value: svc.LatestRevision,
-					Short: true,
-				},
-				{
-					Title: "Image",
-					Value: svc.Image,
-					Short: true,
-				},
-				{
-					Title: "LastModifier",
-					Value: svc.LastModifier,
-					Short: true,
-				},
-				{
-					Title: "UpdateTime",
-					Value: svc.UpdateTime.Format("2006/01/02 15:04:05"),
-					Short: true,
-				},
-				{
-					Title: "Resource Limit",
-					Value: fmt.Sprintf("- cpu:%s\n- memory:%s", svc.ResourceLimits["cpu"], svc.ResourceLimits["memory"]),
-					Short: true,
-				},
-			},
-		}))
-	}
-	_, _, err = h.client.PostMessageContext(ctx, channelId, msgOptions...)
-	return err
+		return h.postMessage(ctx, channelId, slack.MsgOptionText("Failed to get service: "+err.Error(), false))
+	}
+	title := fmt.Sprintf("Cloud Run service %s", svc.Name)
+	blocks := HeaderBlocks(title, ProjectDetail(svc.Project), RegionDetail(svc.Region))
+	blocks = append(blocks, FieldBlocks([]Field{
+		{Title: "Latest Revision", Value: fmt.Sprintf("`%s`", svc.LatestRevision)},
+		{Title: "Image", Value: fmt.Sprintf("`%s`", svc.Image)},
+		{Title: "Last Modifier", Value: svc.LastModifier},
+		{Title: "Update Time", Value: svc.UpdateTime.Format("2006/01/02 15:04:05")},
+		{Title: "Resource Limit", Value: fmt.Sprintf("- cpu:%s\n- memory:%s", svc.ResourceLimits["cpu"], svc.ResourceLimits["memory"])},
+	})...)
+	blocks = append(blocks, ResourceActions(svc.Project, "service", svc.Name, h.debugger != nil, time.Now()))
+	return h.postMessage(ctx, channelId, slack.MsgOptionText(title, false), slack.MsgOptionBlocks(blocks...))
 }
 
 func (h *MultiProjectSlackEventHandler) describeJobForProject(ctx context.Context, channelId, jobName string, rClient *cloudrun.Client) error {
-	msgOptions := []slack.MsgOption{}
 	job, err := rClient.GetJob(ctx, jobName)
 	if err != nil {
-		msgOptions = append(msgOptions, slack.MsgOptionText("Failed to get job: "+err.Error(), false))
-	} else {
-		msgOptions = append(msgOptions, slack.MsgOptionAttachments(slack.Attachment{
-			Fields: []slack.AttachmentField{
-				{
-					Title: "Name",
-					Value: job.Name,
-					Short: true,
-				},
-				{
-					Title: "Image",
-					Value: job.Image,
-					Short: true,
-				},
-				{
-					Title: "LastModifier",
-					Value: job.LastModifier,
-					Short: true,
-				},
-				{
-					Title: "UpdateTime",
-					Value: job.UpdateTime.Format("2006/01/02 15:04:05"),
-					Short: true,
-				},
-				{
-					Title: "Resource Limit",
-					Value: fmt.Sprintf("- cpu:%s\n- memory:%s", job.ResourceLimits["cpu"], job.ResourceLimits["memory"]),
-					Short: true,
-				},
-				{
-					Title: "Console URL",
-					Value: fmt.Sprintf("<%s|Cloud Run Job>", job.GetYamlUrl()),
-					Short: true,
-				},
-			},
-		}))
-	}
-	_, _, err = h.client.PostMessageContext(ctx, channelId, msgOptions...)
-	return err
+		return h.postMessage(ctx, channelId, slack.MsgOptionText("Failed to get job: "+err.Error(), false))
+	}
+	title := fmt.Sprintf("Cloud Run job %s", job.Name)
+	blocks := HeaderBlocks(title, ProjectDetail(job.Project), RegionDetail(job.Region))
+	blocks = append(blocks, FieldBlocks([]Field{
+		{Title: "Image", Value: fmt.Sprintf("`%s`", job.Image)},
+		{Title: "Last Modifier", Value: job.LastModifier},
+		{Title: "Update Time", Value: job.UpdateTime.Format("2006/01/02 15:04:05")},
+		{Title: "Resource Limit", Value: fmt.Sprintf("- cpu:%s\n- memory:%s", job.ResourceLimits["cpu"], job.ResourceLimits["memory"])},
+		{Title: "Console URL", Value: fmt.Sprintf("<%s|Cloud Run Job>", job.GetYamlUrl())},
+	})...)
+	blocks = append(blocks, ResourceActions(job.Project, "job", job.Name, h.debugger != nil, time.Now()))
+	return h.postMessage(ctx, channelId, slack.MsgOptionText(title, false), slack.MsgOptionBlocks(blocks...))
 }
 
-func (h *MultiProjectSlackEventHandler) getServiceMetricsForProject(ctx context.Context, channelId, svcName, metricsType string, duration, aggregationPeriod time.Duration, mClient *monitoring.Client, rClient *cloudrun.Client) error {
+func (h *MultiProjectSlackEventHandler) getServiceMetricsForProject(ctx context.Context, channelId, projectID, svcName, metricsType string, duration, aggregationPeriod time.Duration, mClient *monitoring.Client, rClient *cloudrun.Client) error {
 	now := time.Now().UTC()
 	endTime := now.Truncate(aggregationPeriod).Add(aggregationPeriod)
 	startTime := endTime.Add(-1 * duration).UTC()
@@ -1164,7 +1245,7 @@ func (h *MultiProjectSlackEventHandler) getServiceMetricsForProject(ctx context.
 	}
 
 	if err != nil {
-		_, _, err := h.client.PostMessageContext(ctx, channelId, slack.MsgOptionText("Failed to get request: "+err.Error(), false))
+		err := h.postMessage(ctx, channelId, slack.MsgOptionText("Failed to get request: "+err.Error(), false))
 		return err
 	}
 
@@ -1175,102 +1256,71 @@ func (h *MultiProjectSlackEventHandler) getServiceMetricsForProject(ctx context.
 			h.logger.Error("Failed to get service for metrics URL", zap.String("service", svcName), zap.String("handler", "multi-project"), zap.Error(err))
 			return err
 		}
-		_, _, err = h.client.PostMessageContext(ctx, channelId,
+		err = h.postMessage(ctx, channelId,
 			slack.MsgOptionText(fmt.Sprintf("No requests found for last %s. Please check <%s|%s>\n", duration, svc.GetMetricsUrl(), "Cloud Run metrics (GCP Console)"), false),
 		)
 		return err
 	}
 
-	h.logger.Info("Visualizing metrics", zap.String("service", svcName))
-	imgName := path.Join(h.tmpDir, fmt.Sprintf("%s-metrics.png", svcName))
-	h.logger.Debug("Saving visualization", zap.String("image_name", imgName))
+	// Files cannot be shown to a single user, so the chart is only uploaded for results posted to the channel
+	var note string
+	if _, ephemeral := ephemeralUser(ctx); ephemeral {
+		note = "Add `--share` to post the chart to the channel."
+	} else {
+		h.logger.Info("Visualizing metrics", zap.String("service", svcName))
+		imgName := path.Join(h.tmpDir, fmt.Sprintf("%s-metrics.png", svcName))
+		h.logger.Debug("Saving visualization", zap.String("image_name", imgName))
 
-	size, err := visualize.Visualize(ctx, title, imgName, startTime, endTime, aggregationPeriod, seriesMap, h.logger)
-	if err != nil {
-		h.logger.Error("Failed to visualize metrics", zap.Error(err))
-		return nil
-	}
+		size, err := visualize.Visualize(ctx, title, imgName, startTime, endTime, aggregationPeriod, seriesMap, h.logger)
+		if err != nil {
+			h.logger.Error("Failed to visualize metrics", zap.Error(err))
+			return nil
+		}
 
-	file, err := os.Open(imgName)
-	if err != nil {
-		return err
-	}
+		file, err := os.Open(imgName)
+		if err != nil {
+			return err
+		}
 
-	_, err = h.client.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
-		Reader:   file,
-		FileSize: int(size),
-		Filename: imgName,
-		Channel:  channelId,
-	})
-	if err != nil {
-		h.logger.Error("Failed to upload file", zap.Error(err))
-		return err
+		_, err = h.client.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+			Reader:   file,
+			FileSize: int(size),
+			Filename: imgName,
+			Channel:  channelId,
+		})
+		if err != nil {
+			h.logger.Error("Failed to upload file", zap.Error(err))
+			return err
+		}
 	}
 
-	fields := []slack.AttachmentField{}
+	fields := []Field{}
 	for k, v := range *seriesMap {
 		var total int64
 		for _, p := range v {
 			total += int64(p.Val)
 		}
-		fields = append(fields, slack.AttachmentField{
-			Title: k,
-			Value: fmt.Sprint(total),
-			Short: true,
-		})
+		fields = append(fields, Field{Title: k, Value: fmt.Sprint(total)})
 	}
+	slices.SortFunc(fields, func(a, b Field) int { return strings.Compare(a.Title, b.Title) })
 
-	attachment := slack.Attachment{
-		Text:       title,
-		Fields:     fields,
-		Color:      "good",
-		CallbackID: ActionIdMetrics,
-		Actions: []slack.AttachmentAction{
-			{
-				Name: "duration",
-				Text: "Duration",
-				Type: "select",
-				Options: []slack.AttachmentActionOption{
-					{
-						Text:  "1h",
-						Value: "1h",
-					},
-					{
-						Text:  "1d",
-						Value: "24h",
-					},
-					{
-						Text:  "1w",
-						Value: "168h",
-					},
-				},
-			},
-			{
-				Name: "metrics",
-				Text: "Metrics",
-				Type: "select",
-				Options: []slack.AttachmentActionOption{
-					{
-						Text:  "latency",
-						Value: "latency",
-					},
-					{
-						Text:  "count",
-						Value: "count",
-					},
-				},
-			},
-		},
+	resourceValue := fmt.Sprintf("%s:service:%s", projectID, svcName)
+	blocks := HeaderBlocks(fmt.Sprintf("%s: %s", title, svcName), ProjectDetail(projectID), RegionDetail(h.region(projectID)), fmt.Sprintf("Last %s", formatDuration(duration)))
+	if note != "" {
+		blocks = append(blocks, markdownSection(note))
 	}
-	_, _, err = h.client.PostMessageContext(
-		ctx, channelId,
-		slack.MsgOptionText(fmt.Sprintf("`%s`", svcName), false),
-		slack.MsgOptionAttachments(attachment),
-	)
+	blocks = append(blocks, FieldBlocks(fields)...)
+	blocks = append(blocks,
+		slack.NewActionBlock("", metricsSelects(resourceValue, metricsType, duration)...),
+		ResourceActions(projectID, "service", svcName, h.debugger != nil, time.Now()))
+	err = h.postMessage(ctx, channelId, slack.MsgOptionText(fmt.Sprintf("%s: %s", title, svcName), false), slack.MsgOptionBlocks(blocks...))
 	return err
 }
 
 func (h *MultiProjectSlackEventHandler) sample(ctx context.Context, channelId string) error {
+	if _, ephemeral := ephemeralUser(ctx); ephemeral {
+		return h.postMessage(ctx, channelId, slack.MsgOptionText("The sample chart is a file, which can only be posted to the channel: add `--share`.", false))
+	}
 	imgName := path.Join(h.tmpDir, "sample.png")
 	err := visualize.VisualizeSample(ctx, imgName, h.logger)
 	if err != nil {
@@ -1295,166 +1345,230 @@ func (h *MultiProjectSlackEventHandler) sample(ctx context.Context, channelId st
 }
 
 func (h *MultiProjectSlackEventHandler) help(ctx context.Context, channelId, userId string) error {
-	fields := []slack.AttachmentField{
+	fields := []Field{
 		{
-			Title: "`describe` or `d`",
-			Value: "describe the target Cloud Run service or job from any configured project.\n you can check the latest revision, last modifier, update time, etc.",
+			Title: "`describe [name]` or `d [name]`",
+			Value: "describe the target Cloud Run service or job from any configured project, or the one named.\n you can check the latest revision, last modifier, update time, etc.",
+			Long:  true,
 		},
 		{
-			Title: "`metrics` or `m`",
-			Value: "show the request count of the target Cloud Run service or job description.\n for services, you can check the request count per revision across all projects.",
+			Title: "`metrics [count|latency] [duration] [name]` or `m ...`",
+			Value: "show the request count or latency of the target Cloud Run service or job, e.g. `metrics latency 6h my-service`.\n durations such as 30m, 6h, 7d or 2w (up to 6 weeks) are accepted; the default is 1d.",
+			Long:  true,
 		},
 		{
-			Title: "`set` or `s`",
-			Value: "set the target Cloud Run service or job from any configured project.\n this displays a list of both services and jobs from all projects to select from.",
+			Title: "`set [name]` or `s [name]`",
+			Value: "set the target Cloud Run service or job from any configured project.\n without a name, this displays a list of both services and jobs from all projects to select from.",
+			Long:  true,
+		},
+		{
+			Title: "`set channel [name]`",
+			Value: "set the default target of this channel, used by everyone who has not set their own target here.",
+			Long:  true,
+		},
+		{
+			Title: "`rollback <service> <revision>`",
+			Value: "request to route all traffic of the service to the revision. an approver other than you must approve the request posted to the channel.",
+			Long:  true,
+		},
+		{
+			Title: "`audit [N]`",
+			Value: "show the last N (default 10) commands run through the bot in this channel, with who ran them and the outcome.",
+			Long:  true,
 		},
 	}
 
 	// Add debug command if enabled
 	if h.debugger != nil {
-		fields = append(fields, slack.AttachmentField{
-			Title: "`debug` or `dbg`",
-			Value: "analyze recent error logs for the target Cloud Run service or job using AI.\n groups similar errors and provides root cause analysis and suggestions.",
+		fields = append(fields, Field{
+			Title: "`debug [name]` or `dbg [name]`",
+			Value: "analyze recent error logs for the target Cloud Run service or job using AI.\n groups similar errors and provides root cause analysis and suggestions.\n mention the bot in the result thread to ask follow-up questions.",
+			Long:  true,
 		})
 	}
 
-	attachment := slack.Attachment{
-		Text:   "Available commands (Multi-Project Mode):",
-		Fields: fields,
-	}
+	usage := "Usage: @<slack app> <command> [name] [--project <id>] [--type service|job] e.g. `@cloud-run-bot describe my-service --project foo`. Quote names with spaces.\n" +
+		"Commands also work as `/cloudrun <command>`, whose results are only shown to you unless you add `--share`."
+	blocks := HeaderBlocks("Available commands", "Multi-Project Mode")
+	blocks = append(blocks, markdownSection(usage))
+	blocks = append(blocks, FieldBlocks(fields)...)
 	_, err := h.client.PostEphemeralContext(
 		ctx, channelId, userId,
-		slack.MsgOptionText("Usage: @<slack app> <command> e.g. `@cloud-run-bot describe`", false),
-		slack.MsgOptionAttachments(attachment),
+		slack.MsgOptionText(usage, false),
+		slack.MsgOptionBlocks(blocks...),
 	)
 	return err
 }
 
 func (h *MultiProjectSlackEventHandler) debugResource(ctx context.Context, channelId, userId, resourceValue string) error {
+	audit.SetResource(ctx, resourceValue)
 	projectID, resourceType, resourceName, err := ParseMultiProjectResourceValue(resourceValue)
 	if err != nil {
 		return fmt.Errorf("failed to parse resource value: %v", err)
 	}
 
-	// Send initial "analyzing" message
-	_, err = h.client.PostEphemeralContext(ctx, channelId, userId,
-		slack.MsgOptionText(fmt.Sprintf("Analyzing errors for %s `%s` in project `%s`... This may take a moment.", resourceType, resourceName, projectID), false))
-	if err != nil {
-		h.logger.Warn("Failed to send analyzing message", zap.Error(err))
+	// The progress message is updated and the results are posted in its thread, which ephemeral messages cannot do
+	if _, ephemeral := ephemeralUser(ctx); ephemeral {
+		return h.postMessage(ctx, channelId, slack.MsgOptionText("Debug results are posted in a thread of the channel: add `--share`.", false))
 	}
 
-	// Run debug analysis with timeout
-	analysisCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
-	defer cancel()
+	if msg := h.budgets.exceeded(channelId); msg != "" {
+		_, err := h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText(msg, false))
+		return err
+	}
 
-	result, err := h.debugger.DebugResource(analysisCtx, projectID, resourceType, resourceName)
+	// Run the analysis in the background so that the Slack event is acknowledged immediately
+	job, err := h.startDebugJob(ctx, channelId, userId, projectID, resourceType, resourceName)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			_, _, postErr := h.client.PostMessageContext(ctx, channelId,
-				slack.MsgOptionText("Debug analysis timed out. The service may have too many errors or the AI service is slow. Try reducing the lookback window.", false))
-			if postErr != nil {
-				return postErr
-			}
-			return err
-		}
-		_, _, postErr := h.client.PostMessageContext(ctx, channelId,
-			slack.MsgOptionText(fmt.Sprintf("Debug analysis failed: %s", err.Error()), false))
-		if postErr != nil {
-			return postErr
-		}
 		return err
 	}
+	h.logger.Info("Started debug job",
+		zap.String("job_id", job.id),
+		zap.String("resource_type", resourceType),
+		zap.String("resource_name", resourceName),
+		zap.String("project_id", projectID))
+	return nil
+}
 
-	return h.postDebugResult(ctx, channelId, result)
+// postNoErrors posts the result of an analysis that found no errors.
+func (h *MultiProjectSlackEventHandler) postNoErrors(ctx context.Context, channelId string, result *debug.DebugResult) error {
+	text := fmt.Sprintf("No errors found for %s %s in the last %d minutes.", result.ResourceType, result.ResourceName, result.LookbackMin)
+	blocks := HeaderBlocks(fmt.Sprintf("Debug analysis: %s %s", result.ResourceType, result.ResourceName),
+		ProjectDetail(result.ProjectID), RegionDetail(h.region(result.ProjectID)), fmt.Sprintf("Last %d minutes", result.LookbackMin))
+	blocks = append(blocks, markdownSection(":large_green_circle: No errors found."))
+	_, _, err := h.client.PostMessageContext(ctx, channelId, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...))
+	return err
 }
 
-func (h *MultiProjectSlackEventHandler) postDebugResult(ctx context.Context, channelId string, result *debug.DebugResult) error {
-	if result.TotalErrors == 0 {
-		_, _, err := h.client.PostMessageContext(ctx, channelId,
-			slack.MsgOptionText(fmt.Sprintf("No errors found for %s `%s` in project `%s` (last %d minutes).",
-				result.ResourceType, result.ResourceName, result.ProjectID, result.LookbackMin), false))
-		return err
-	}
+// postDebugHeader posts the summary of an analysis and returns the thread timestamp for the group results.
+func (h *MultiProjectSlackEventHandler) postDebugHeader(ctx context.Context, channelId string, result *debug.DebugResult, groupCount int) (string, error) {
+	_, threadTS, err := h.client.PostMessageContext(ctx, channelId, h.debugHeaderOptions(result, groupCount)...)
+	return threadTS, err
+}
 
-	// Build header text
-	headerText := fmt.Sprintf("Debug Analysis: %s `%s` (Project: `%s`)\nTime Range: Last %d minutes | Total Errors: %d | Error Groups: %d",
-		result.ResourceType, result.ResourceName, result.ProjectID, result.LookbackMin, result.TotalErrors, len(result.ErrorGroups))
-	logLink := buildLogLink(result.ProjectID, result.ResourceType, result.ResourceName, time.Duration(result.LookbackMin)*time.Minute, result.GeneratedAt)
-	if logLink != "" {
-		headerText = fmt.Sprintf("%s\nLog: <%s|Log>", headerText, logLink)
-	}
+// updateDebugHeader rewrites the header of a finished analysis to include its token usage and cost.
+func (h *MultiProjectSlackEventHandler) updateDebugHeader(ctx context.Context, channelId, threadTS string, result *debug.DebugResult) error {
+	_, _, _, err := h.client.UpdateMessageContext(ctx, channelId, threadTS, h.debugHeaderOptions(result, len(result.ErrorGroups))...)
+	return err
+}
 
-	_, threadTS, err := h.client.PostMessageContext(ctx, channelId, slack.MsgOptionText(headerText, false))
-	if err != nil {
-		return err
+// debugHeaderOptions returns the message of the header of an analysis.
+func (h *MultiProjectSlackEventHandler) debugHeaderOptions(result *debug.DebugResult, groupCount int) []slack.MsgOption {
+	text := fmt.Sprintf("Debug analysis: %s %s (%s errors, %d groups)", result.ResourceType, result.ResourceName, formatErrorCount(result), groupCount)
+	return []slack.MsgOption{slack.MsgOptionText(text, false), slack.MsgOptionBlocks(h.debugHeaderBlocks(result, groupCount)...)}
+}
+
+// debugHeaderBlocks lays out the header of an analysis: the analyzed resource and time range, error counts, log
+// link, recent changes and anomalies, and the token usage once it is known.
+func (h *MultiProjectSlackEventHandler) debugHeaderBlocks(result *debug.DebugResult, groupCount int) []slack.Block {
+	fields := []Field{
+		{Title: "Total Errors", Value: formatErrorCount(result)},
+		{Title: "Error Groups", Value: fmt.Sprintf("%d", groupCount)},
+	}
+	if logLink := buildLogLink(result.ProjectID, result.ResourceType, result.ResourceName, time.Duration(result.LookbackMin)*time.Minute, result.GeneratedAt); logLink != "" {
+		fields = append(fields, Field{Title: "Logs", Value: fmt.Sprintf("<%s|View in Cloud Logging>", logLink)})
 	}
+	if result.Usage.Calls > 0 {
+		fields = append(fields, Field{Title: "LLM Usage", Value: formatUsage(result.Usage, result.Cost)})
+	}
+	if len(result.Changes) > 0 {
+		changes := make([]string, len(result.Changes))
+		for i, c := range result.Changes {
+			changes[i] = "• " + c.String()
+		}
+		fields = append(fields, Field{Title: "Recent Changes", Value: strings.Join(changes, "\n"), Long: true})
+	}
+	if len(result.Anomalies) > 0 {
+		fields = append(fields, Field{Title: "Metric Anomalies", Value: "• " + strings.Join(result.Anomalies, "\n• "), Long: true})
+	}
+	blocks := HeaderBlocks(fmt.Sprintf("Debug analysis: %s %s", result.ResourceType, result.ResourceName),
+		ProjectDetail(result.ProjectID), RegionDetail(h.region(result.ProjectID)), fmt.Sprintf("Last %d minutes", result.LookbackMin))
+	return append(blocks, FieldBlocks(fields)...)
+}
 
-	for i, group := range result.ErrorGroups {
-		groupTitle := fmt.Sprintf("Group %d: %s. (%d errors)", i+1, group.Pattern, group.ErrorCount)
+// postDebugGroup posts the analysis of one error group into the thread. index is 0-based.
+func (h *MultiProjectSlackEventHandler) postDebugGroup(ctx context.Context, channelId, threadTS, projectID string, index int, group debug.ErrorGroupResult) error {
+	groupTitle := fmt.Sprintf("Group %d: %s. (%d errors)", index+1, group.Pattern, group.ErrorCount)
 
-		summary := group.Analysis.Summary
-		if summary == "" {
-			summary = "N/A"
-		}
+	summary := group.Analysis.Summary
+	if summary == "" {
+		summary = "N/A"
+	}
 
-		possibleCauses := "None"
-		if len(group.Analysis.PossibleCauses) > 0 {
-			possibleCauses = strings.Join(group.Analysis.PossibleCauses, "\n")
-		}
+	possibleCauses := "None"
+	if len(group.Analysis.PossibleCauses) > 0 {
+		possibleCauses = strings.Join(group.Analysis.PossibleCauses, "\n")
+	}
 
-		suggestions := "None"
-		if len(group.Analysis.Suggestions) > 0 {
-			suggestions = strings.Join(group.Analysis.Suggestions, "\n")
-		}
+	suggestions := "None"
+	if len(group.Analysis.Suggestions) > 0 {
+		suggestions = strings.Join(group.Analysis.Suggestions, "\n")
+	}
 
-		traceValue := "None"
-		if group.TraceID != "" {
-			traceLink := buildTraceLink(result.ProjectID, group.TraceID, group.TraceTimestamp)
-			if traceLink == "" {
-				traceValue = fmt.Sprintf("`%s`", group.TraceID)
-			} else {
-				traceValue = fmt.Sprintf("<%s|%s>", traceLink, group.TraceID)
-			}
+	traceValue := "None"
+	if group.TraceID != "" {
+		traceLink := buildTraceLink(projectID, group.TraceID, group.TraceTimestamp)
+		if traceLink == "" {
+			traceValue = fmt.Sprintf("`%s`", group.TraceID)
+		} else {
+			traceValue = fmt.Sprintf("<%s|%s>", traceLink, group.TraceID)
 		}
+	}
 
-		attachment := slack.Attachment{
-			Color: "danger",
-			Title: groupTitle,
-			Fields: []slack.AttachmentField{
-				{
-					Title: "Summary",
-					Value: summary,
-					Short: false,
-				},
-				{
-					Title: "Possible Causes",
-					Value: possibleCauses,
-					Short: false,
-				},
-				{
-					Title: "Suggestions",
-					Value: suggestions,
-					Short: false,
-				},
-				{
-					Title: "Sample Trace",
-					Value: traceValue,
-					Short: false,
-				},
-			},
-			MarkdownIn: []string{"fields"},
-		}
+	fields := []Field{
+		{Title: "Summary", Value: summary, Long: true},
+		{Title: "Possible Causes", Value: possibleCauses, Long: true},
+		{Title: "Suggestions", Value: suggestions, Long: true},
+		{Title: "Sample Trace", Value: traceValue, Long: true},
+	}
+	if len(group.TraceSpans) > 0 {
+		fields = append(fields, Field{
+			Title: "Trace Critical Path",
+			Value: fmt.Sprintf("```%s```\n<%s|View in Cloud Trace>", strings.Join(group.TraceSpans, "\n"), buildTraceExplorerLink(projectID, group.TraceID)),
+			Long:  true,
+		})
+	}
+	fields = append(fields,
+		Field{Title: "First Seen", Value: formatSeen(group.FirstSeen)},
+		Field{Title: "Last Seen", Value: formatSeen(group.LastSeen)},
+	)
+	if !group.SeenBefore.IsZero() {
+		fields = append(fields, Field{
+			Title: "Seen Before",
+			Value: fmt.Sprintf("Seen before at %s, previous analysis reused", formatSeen(group.SeenBefore)),
+			Long:  true,
+		})
+	}
+	blocks := []slack.Block{markdownSection(truncateText(":red_circle: *"+groupTitle+"*", maxSectionLength))}
+	blocks = append(blocks, FieldBlocks(fields)...)
+	blocks = append(blocks, feedbackActions(threadTS, index))
 
-		_, _, postErr := h.client.PostMessageContext(ctx, channelId,
-			slack.MsgOptionAttachments(attachment),
-			slack.MsgOptionTS(threadTS),
-		)
-		if postErr != nil {
-			return postErr
-		}
+	_, _, err := h.client.PostMessageContext(ctx, channelId,
+		slack.MsgOptionText(groupTitle, false),
+		slack.MsgOptionBlocks(blocks...),
+		slack.MsgOptionTS(threadTS),
+	)
+	return err
+}
+
+// formatSeen formats a first/last seen timestamp of an error group.
+func formatSeen(t time.Time) string {
+	if t.IsZero() {
+		return "N/A"
 	}
+	return t.UTC().Format(time.RFC3339)
+}
 
-	return nil
+// formatErrorCount formats the total error count, noting when only a sample was analyzed.
+func formatErrorCount(result *debug.DebugResult) string {
+	total := fmt.Sprintf("%d", result.TotalErrors)
+	if result.TotalCapped {
+		total += "+"
+	}
+	if result.Analyzed > 0 && result.Analyzed < result.TotalErrors {
+		total = fmt.Sprintf("%s (analyzed %d)", total, result.Analyzed)
+	}
+	return total
 }
 
 func buildTraceLink(projectID, traceID string, cursorTimestamp time.Time) string {
@@ -1469,6 +1583,11 @@ func buildTraceLink(projectID, traceID string, cursorTimestamp time.Time) string
 		escapedQuery, timestamp, projectID)
 }
 
+// buildTraceExplorerLink returns the Cloud Trace page of a trace, which shows its spans.
+func buildTraceExplorerLink(projectID, traceID string) string {
+	return fmt.Sprintf("https://console.cloud.google.com/traces/list?project=%s&tid=%s", url.QueryEscape(projectID), url.QueryEscape(traceID))
+}
+
 func buildLogLink(projectID, resourceType, resourceName string, lookback time.Duration, cursorTimestamp time.Time) string {
 	if projectID == "" || resourceType == "" || resourceName == "" || lookback <= 0 || cursorTimestamp.IsZero() {
 		return ""
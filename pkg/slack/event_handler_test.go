@@ -1,7 +1,26 @@
 package slack
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/adk"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/approval"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/config"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/debug"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/deploy"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/monitoring"
+	"github.com/slack-go/slack"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 func TestMemory_Get(t *testing.T) {
@@ -123,3 +142,891 @@ func TestMemory_IsJob(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatErrorCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *debug.DebugResult
+		want   string
+	}{
+		{
+			name:   "all analyzed",
+			result: &debug.DebugResult{TotalErrors: 5, Analyzed: 5},
+			want:   "5",
+		},
+		{
+			name:   "sampled",
+			result: &debug.DebugResult{TotalErrors: 523, Analyzed: 100},
+			want:   "523 (analyzed 100)",
+		},
+		{
+			name:   "capped count",
+			result: &debug.DebugResult{TotalErrors: 10000, TotalCapped: true, Analyzed: 100},
+			want:   "10000+ (analyzed 100)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatErrorCount(tt.result); got != tt.want {
+				t.Errorf("formatErrorCount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDebugProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress debug.Progress
+		want     string
+	}{
+		{
+			name:     "fetching",
+			progress: debug.Progress{Stage: debug.StageFetching},
+			want:     "fetching error logs...",
+		},
+		{
+			name:     "grouping",
+			progress: debug.Progress{Stage: debug.StageGrouping, ErrorCount: 100},
+			want:     "fetched 100 errors → grouping...",
+		},
+		{
+			name:     "analyzing",
+			progress: debug.Progress{Stage: debug.StageAnalyzing, ErrorCount: 100, GroupCount: 4, GroupIndex: 2},
+			want:     "fetched 100 errors → grouped into 4 → analyzing group 2/4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatDebugProgress(tt.progress); got != tt.want {
+				t.Errorf("formatDebugProgress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebugJobs_Cancel(t *testing.T) {
+	jobs := newDebugJobs()
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &debugJob{id: "job1", ctx: ctx, cancel: cancel}
+	jobs.add(job)
+
+	if jobs.cancel("unknown", "U1") {
+		t.Error("cancel() of an unknown job should return false")
+	}
+	if !jobs.cancel("job1", "U1") {
+		t.Fatal("cancel() of a running job should return true")
+	}
+	if ctx.Err() == nil {
+		t.Error("job context should be cancelled")
+	}
+	if job.cancelledBy != "U1" {
+		t.Errorf("cancelledBy = %v, want U1", job.cancelledBy)
+	}
+
+	jobs.remove("job1")
+	if jobs.cancel("job1", "U1") {
+		t.Error("cancel() of a finished job should return false")
+	}
+}
+
+func TestDebugJob_HeaderFailure(t *testing.T) {
+	// The fake Slack API refuses every message
+	var mu sync.Mutex
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.URL.Path)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+	}))
+	defer server.Close()
+
+	h := &MultiProjectSlackEventHandler{
+		client: slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/")),
+		config: &config.Config{Projects: []config.ProjectConfig{{ID: "p1"}}},
+		logger: zap.NewNop(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &debugJob{id: "job1", channelID: "C1", handler: h, ctx: ctx, cancel: cancel}
+	result := &debug.DebugResult{ProjectID: "p1", ResourceType: "service", ResourceName: "web", TotalErrors: 3}
+
+	job.OnGroupsReady(result, 1)
+	if ctx.Err() == nil || job.headerErr == nil {
+		t.Fatalf("job should be cancelled with the header error, got %v", job.headerErr)
+	}
+
+	// Groups analyzed before the cancellation takes effect are not posted outside a thread
+	job.OnGroupAnalyzed(result, 0, debug.ErrorGroupResult{})
+	if len(calls) != 1 {
+		t.Errorf("Slack API calls = %v, want only the header", calls)
+	}
+}
+
+func TestMentionText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "<@U123> show me the stack trace for group 2", want: "show me the stack trace for group 2"},
+		{text: "  <@U123>   is this related to the DB?  ", want: "is this related to the DB?"},
+		{text: "no mention", want: "no mention"},
+	}
+	for _, tt := range tests {
+		if got := mentionText(tt.text); got != tt.want {
+			t.Errorf("mentionText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDebugThreads(t *testing.T) {
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	threads := newDebugThreads()
+	threads.now = func() time.Time { return now }
+	result := &debug.DebugResult{ResourceName: "svc"}
+
+	threads.add("C1", "111.222", result)
+	if _, _, ok := threads.get("C1", "333.444"); ok {
+		t.Error("get() of an unknown thread should miss")
+	}
+
+	threads.addTurn("C1", "111.222", adk.Turn{Question: "q1", Answer: "a1"})
+	got, history, ok := threads.get("C1", "111.222")
+	if !ok || got != result {
+		t.Fatalf("get() = %v, %v; want the registered result", got, ok)
+	}
+	if len(history) != 1 || history[0].Question != "q1" {
+		t.Errorf("history = %+v, want one turn", history)
+	}
+
+	// The returned history is a copy
+	history[0].Question = "changed"
+	if _, history, _ := threads.get("C1", "111.222"); history[0].Question != "q1" {
+		t.Error("get() should return a copy of the history")
+	}
+
+	now = now.Add(debugThreadTTL + time.Minute)
+	if _, _, ok := threads.get("C1", "111.222"); ok {
+		t.Error("get() should miss after the TTL")
+	}
+}
+
+func TestIncidentDocument(t *testing.T) {
+	base := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	result := &debug.DebugResult{
+		ResourceName: "my-service",
+		ResourceType: "service",
+		ProjectID:    "my-project",
+		TotalErrors:  12,
+		Analyzed:     10,
+		GeneratedAt:  base.Add(30 * time.Minute),
+		LookbackMin:  30,
+		Changes:      []debug.ChangeEvent{{Time: base.Add(5 * time.Minute), Kind: "revision", Description: "Revision my-service-00002 created"}},
+		Anomalies:    []string{"5xx responses spiked to 12/min"},
+		ErrorGroups: []debug.ErrorGroupResult{{
+			Pattern:        "Database timeout",
+			ErrorCount:     10,
+			Representative: "query failed: ```timeout```",
+			TraceID:        "abc123",
+			TraceTimestamp: base.Add(10 * time.Minute),
+			FirstSeen:      base.Add(6 * time.Minute),
+			LastSeen:       base.Add(25 * time.Minute),
+			Analysis: adk.ErrorAnalysis{
+				Summary:        "The new revision exhausts the DB pool.",
+				PossibleCauses: []string{"Pool size reduced"},
+				Suggestions:    []string{"Roll back"},
+			},
+		}},
+	}
+
+	doc := newIncidentDocument(result)
+	var timeline []string
+	for _, e := range doc.Timeline {
+		timeline = append(timeline, e.Time+" "+e.Event)
+	}
+	wantTimeline := []string{
+		"2025-01-01T10:05:00Z Revision my-service-00002 created",
+		"2025-01-01T10:06:00Z Group 1 first seen: Database timeout",
+		"2025-01-01T10:25:00Z Group 1 last seen: Database timeout",
+		"2025-01-01T10:30:00Z Debug analysis generated",
+	}
+	if strings.Join(timeline, "\n") != strings.Join(wantTimeline, "\n") {
+		t.Errorf("timeline =\n%s\nwant\n%s", strings.Join(timeline, "\n"), strings.Join(wantTimeline, "\n"))
+	}
+
+	md := doc.Markdown()
+	for _, want := range []string{
+		"# Incident notes: service `my-service`",
+		"- **Total errors:** 12 (analyzed 10)",
+		"### Group 1: Database timeout (10 errors)",
+		"````\nquery failed: ```timeout```\n````",
+		"[Cloud Trace](https://console.cloud.google.com/traces/list?project=my-project&tid=abc123)",
+		"**Possible causes**\n\n- Pool size reduced",
+		"- 5xx responses spiked to 12/min",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() does not contain %q:\n%s", want, md)
+		}
+	}
+
+	data, err := doc.JSON()
+	if err != nil {
+		t.Fatalf("JSON() error = %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("JSON() is not valid JSON: %v", err)
+	}
+	groups := decoded["groups"].([]interface{})
+	if len(groups) != 1 || groups[0].(map[string]interface{})["trace_id"] != "abc123" {
+		t.Errorf("unexpected groups in JSON: %v", decoded["groups"])
+	}
+
+	if got := exportBaseName(result); got != "my-project/my-service-20250101-103000" {
+		t.Errorf("exportBaseName() = %s", got)
+	}
+}
+
+func TestParseFeedbackValue(t *testing.T) {
+	block := feedbackActions("1700000000.123456", 2)
+	buttons := block.Elements.ElementSet
+	if block.BlockID != ActionIdFeedback || len(buttons) != 2 ||
+		buttons[0].(*slack.ButtonBlockElement).ActionID != ratingUp || buttons[1].(*slack.ButtonBlockElement).ActionID != ratingDown {
+		t.Fatalf("feedbackActions() = %+v", block)
+	}
+	value := buttons[0].(*slack.ButtonBlockElement).Value
+	threadTS, index, err := parseFeedbackValue(value)
+	if err != nil || threadTS != "1700000000.123456" || index != 2 {
+		t.Errorf("parseFeedbackValue(%q) = %q, %d, %v", value, threadTS, index, err)
+	}
+
+	for _, value := range []string{"", "1700000000.123456", "1700000000.123456:x", "1700000000.123456:-1"} {
+		if _, _, err := parseFeedbackValue(value); err == nil {
+			t.Errorf("parseFeedbackValue(%q) should fail", value)
+		}
+	}
+}
+
+func TestFeedbackTargets(t *testing.T) {
+	now := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	targets := newFeedbackTargets()
+	targets.now = func() time.Time { return now }
+
+	result := &debug.DebugResult{ProjectID: "my-project", ResourceType: "service", ResourceName: "my-service"}
+	group := debug.ErrorGroupResult{Pattern: "DB timeout", Analysis: adk.ErrorAnalysis{Model: "gemini", Prompt: "prompt", Response: "response"}}
+	targets.add("C1", "123.456", result, 0, group)
+
+	target, ok := targets.get("C1", "123.456", 0)
+	if !ok || target.resourceName != "my-service" || target.group.Analysis.Prompt != "prompt" {
+		t.Errorf("get() = %+v, %v", target, ok)
+	}
+	if _, ok := targets.get("C1", "123.456", 1); ok {
+		t.Error("get() should not find another group")
+	}
+
+	now = now.Add(debugThreadTTL + time.Minute)
+	if _, ok := targets.get("C1", "123.456", 0); ok {
+		t.Error("get() should not return an expired group")
+	}
+}
+
+func TestTokenBudgets(t *testing.T) {
+	now := time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)
+	budgets := newTokenBudgets(1000, map[string]int{"C2": 0})
+	budgets.now = func() time.Time { return now }
+
+	if msg := budgets.exceeded("C1"); msg != "" {
+		t.Errorf("exceeded() = %q before any usage", msg)
+	}
+	budgets.add("C1", adk.Usage{PromptTokens: 900, ResponseTokens: 150})
+	budgets.add("C2", adk.Usage{PromptTokens: 5000})
+	if msg := budgets.exceeded("C1"); !strings.Contains(msg, "1,050 of its 1,000") {
+		t.Errorf("exceeded() = %q, want the used and allowed tokens", msg)
+	}
+	if msg := budgets.exceeded("C2"); msg != "" {
+		t.Errorf("exceeded() = %q for a channel without a limit", msg)
+	}
+	if !budgets.exceededWith("C1", adk.Usage{}) || budgets.exceededWith("C2", adk.Usage{PromptTokens: 5000}) {
+		t.Error("exceededWith() should only report channels with a limit")
+	}
+	budgets.add("C3", adk.Usage{PromptTokens: 500})
+	if budgets.exceededWith("C3", adk.Usage{PromptTokens: 400}) || !budgets.exceededWith("C3", adk.Usage{PromptTokens: 500}) {
+		t.Error("exceededWith() should add the usage of the run to the usage of the day")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if msg := budgets.exceeded("C1"); msg != "" {
+		t.Errorf("exceeded() = %q on a new day", msg)
+	}
+}
+
+func TestFormatUsage(t *testing.T) {
+	usage := adk.Usage{Calls: 3, PromptTokens: 1234567, ResponseTokens: 890}
+	if got, want := formatUsage(usage, 0.0421), "1,234,567 prompt + 890 response tokens in 3 calls (~$0.0421)"; got != want {
+		t.Errorf("formatUsage() = %q, want %q", got, want)
+	}
+	if got, want := formatUsage(usage, 0), "1,234,567 prompt + 890 response tokens in 3 calls"; got != want {
+		t.Errorf("formatUsage() = %q, want %q", got, want)
+	}
+}
+
+func TestInteractionCommand(t *testing.T) {
+	blockAction := func(actionID string) *slack.InteractionCallback {
+		return &slack.InteractionCallback{
+			Type:           slack.InteractionTypeBlockActions,
+			ActionCallback: slack.ActionCallbacks{BlockActions: []*slack.BlockAction{{ActionID: actionID}}},
+		}
+	}
+	tests := []struct {
+		name        string
+		interaction *slack.InteractionCallback
+		want        string
+	}{
+		{name: "resource selection", interaction: blockAction(ActionIdDebugResource), want: "debug"},
+		{name: "cancel button", interaction: blockAction(ActionIdCancelDebug), want: "cancel"},
+		{name: "metrics select", interaction: blockAction(ActionIdMetricsDuration), want: "metrics"},
+		{name: "resource button", interaction: blockAction(ActionIdDescribeButton), want: "describe"},
+		{name: "feedback button", interaction: &slack.InteractionCallback{
+			Type:           slack.InteractionTypeBlockActions,
+			ActionCallback: slack.ActionCallbacks{BlockActions: []*slack.BlockAction{{BlockID: ActionIdFeedback, ActionID: ratingUp}}},
+		}, want: "feedback"},
+		{name: "message shortcut", interaction: &slack.InteractionCallback{Type: slack.InteractionTypeMessageAction, CallbackID: ActionIdDebugShortcut}, want: "debug"},
+		{name: "approve button", interaction: blockAction(ActionIdApproveRequest), want: "approve"},
+		{name: "unknown action", interaction: blockAction("unknown"), want: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interactionCommand(tt.interaction); got != tt.want {
+				t.Errorf("interactionCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatAuditEvents(t *testing.T) {
+	if got := formatAuditEvents(nil); !strings.Contains(got, "No commands") {
+		t.Errorf("formatAuditEvents(nil) = %q", got)
+	}
+
+	events := []audit.Event{
+		{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), User: "U1", Command: "describe", Resource: "project1:service:web", Outcome: audit.OutcomeSuccess, LatencyMs: 120},
+		{Time: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC), User: "U2", Command: "set", Projects: []string{"project1", "project2"}, Outcome: audit.OutcomeError, Error: "boom", LatencyMs: 5},
+	}
+	got := formatAuditEvents(events)
+	for _, want := range []string{
+		"Last 2 commands",
+		"• 2024-01-01 12:00:00 UTC <@U1> `describe` project1:service:web → success (120ms)",
+		"• 2024-01-01 11:00:00 UTC <@U2> `set` (project1, project2) → error (5ms): boom",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatAuditEvents() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestParseMention(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    mention
+		wantErr bool
+	}{
+		{name: "empty", text: "", want: mention{command: "describe"}},
+		{name: "command only", text: "describe", want: mention{command: "describe"}},
+		{name: "double spaces", text: "describe  svc-name ", want: mention{command: "describe", name: "svc-name"}},
+		{name: "uppercase command", text: "D web", want: mention{command: "d", name: "web"}},
+		{name: "metrics with type, duration and flag", text: "metrics latency 6h my-job --project foo",
+			want: mention{command: "metrics", name: "my-job", project: "foo", metricsType: "latency", duration: 6 * time.Hour}},
+		{name: "metrics in days", text: "m 7d", want: mention{command: "m", duration: 7 * 24 * time.Hour}},
+		{name: "quoted name", text: `describe "my service" --type=job`, want: mention{command: "describe", name: "my service", resourceType: "job"}},
+		{name: "curly quotes", text: "debug “my service”", want: mention{command: "debug", name: "my service"}},
+		{name: "set channel", text: "set channel web --p foo", want: mention{command: "set", channel: true, name: "web", project: "foo"}},
+		{name: "audit count", text: "audit 20", want: mention{command: "audit", count: 20}},
+		{name: "share", text: "describe --share web", want: mention{command: "describe", name: "web", share: true}},
+		{name: "rollback", text: "rollback web web-00041-xyz --project foo",
+			want: mention{command: "rollback", name: "web", revision: "web-00041-xyz", project: "foo", resourceType: "service"}},
+		{name: "rollback without revision", text: "rollback web", wantErr: true},
+		{name: "rollback of a job", text: "rollback batch batch-00001 --type job", wantErr: true},
+		{name: "missing closing quote", text: `describe "web`, wantErr: true},
+		{name: "flag without value", text: "describe web --project", wantErr: true},
+		{name: "unknown flag", text: "describe web --zone a", wantErr: true},
+		{name: "invalid type", text: "describe web --type function", wantErr: true},
+		{name: "too many names", text: "describe web api", wantErr: true},
+		{name: "duration too long", text: "metrics 7w", wantErr: true},
+		{name: "invalid audit count", text: "audit -1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMention(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMention(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseMention(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   time.Duration
+		wantOk bool
+	}{
+		{in: "30m", want: 30 * time.Minute, wantOk: true},
+		{in: "6h", want: 6 * time.Hour, wantOk: true},
+		{in: "2d", want: 48 * time.Hour, wantOk: true},
+		{in: "1w", want: 7 * 24 * time.Hour, wantOk: true},
+		{in: "0h"},
+		{in: "web"},
+		{in: "xd"},
+	}
+	for _, tt := range tests {
+		got, ok := parseDuration(tt.in)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestAggregationPeriodFor(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want time.Duration
+	}{
+		{in: 24 * time.Hour, want: durationAggregationPeriodMap["24h"]},
+		{in: 30 * time.Minute, want: time.Minute},
+		{in: 50 * time.Hour, want: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := aggregationPeriodFor(tt.in); got != tt.want {
+			t.Errorf("aggregationPeriodFor(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCloseMatches(t *testing.T) {
+	candidates := []resourceCandidate{
+		{projectID: "p1", resourceType: "service", name: "frontend"},
+		{projectID: "p1", resourceType: "service", name: "backend"},
+		{projectID: "p2", resourceType: "job", name: "backend-migrate"},
+		{projectID: "p2", resourceType: "job", name: "cleanup"},
+	}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "frontnd", want: []string{"frontend"}},
+		{name: "backend", want: []string{"backend", "backend-migrate"}},
+		{name: "BACKEDN", want: []string{"backend"}},
+		{name: "database"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range closeMatches(tt.name, candidates, maxSuggestions) {
+			got = append(got, c.name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("closeMatches(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "web", want: 3},
+		{a: "web", b: "web", want: 0},
+		{a: "kitten", b: "sitting", want: 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestChannelsProjects(t *testing.T) {
+	h := &MultiProjectSlackEventHandler{config: &config.Config{ChannelToProjects: map[string][]string{
+		"C1":      {"project1"},
+		"general": {"project1", "project2"},
+		"C3":      {"project3"},
+	}}}
+	tests := []struct {
+		name     string
+		channels []slack.Channel
+		want     []string
+	}{
+		{name: "no channels"},
+		{name: "unmapped channel", channels: []slack.Channel{channel("C9", "random")}},
+		{name: "by ID and name", channels: []slack.Channel{channel("C1", "dev"), channel("C2", "general")}, want: []string{"project1", "project2"}},
+		{name: "by ID", channels: []slack.Channel{channel("C3", "ops")}, want: []string{"project3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.channelsProjects(tt.channels); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("channelsProjects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCommandInDirectMessage(t *testing.T) {
+	// The fake Slack API lists the user's channels and records the posted messages
+	var mu sync.Mutex
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users.conversations":
+			_, _ = w.Write([]byte(`{"ok": true, "channels": [{"id": "C1", "name": "dev"}]}`))
+		case "/chat.postMessage":
+			mu.Lock()
+			posted = append(posted, r.FormValue("text"))
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"ok": true, "channel": "D1", "ts": "1700000000.000100"}`))
+		default:
+			t.Errorf("unexpected Slack API call %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	h := &MultiProjectSlackEventHandler{
+		client: slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/")),
+		config: &config.Config{
+			Projects:          []config.ProjectConfig{{ID: "project1"}, {ID: "project2"}},
+			ChannelToProjects: map[string][]string{"C1": {"project1"}, "C2": {"project2"}},
+		},
+		logger: zap.NewNop(),
+	}
+	ctx := inDirectMessage(context.Background())
+	span := oteltrace.SpanFromContext(ctx)
+
+	// project2 is mapped to a channel the user is not a member of
+	if err := h.runCommand(ctx, span, "D1", "U1", "describe web --project project2", false); err != nil {
+		t.Fatalf("runCommand failed: %v", err)
+	}
+	if len(posted) != 1 || !strings.Contains(posted[0], "Project `project2` is not a project of your channels") {
+		t.Errorf("posted = %q, want the project to be refused", posted)
+	}
+}
+
+func channel(id, name string) slack.Channel {
+	var c slack.Channel
+	c.ID = id
+	c.Name = name
+	return c
+}
+
+func TestFormatHealthTable(t *testing.T) {
+	health := map[string]monitoring.ServiceHealth{
+		"web":    {Requests: 7200, ServerErrors: 72, P99: 123.4},
+		"api":    {Requests: 3600},
+		"worker": {Requests: 36},
+	}
+	want := "service     req/s     5xx       p99\n" +
+		"web          2.00    1.0%     123ms\n" +
+		"api          1.00    0.0%         -\n" +
+		"and 1 more\n"
+	if got := formatHealthTable(health, time.Hour, 2); got != want {
+		t.Errorf("formatHealthTable() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatDeploys(t *testing.T) {
+	if got := formatDeploys(nil); !strings.Contains(got, "None") {
+		t.Errorf("formatDeploys(nil) = %q", got)
+	}
+	events := []deploy.Event{
+		{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), ProjectID: "p1", ResourceType: "service", Name: "web",
+			Method: "google.cloud.run.v1.Services.ReplaceService", Revision: "web-00002", Modifier: "someone@example.com"},
+		{Time: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC), ProjectID: "p2", ResourceType: "job", Name: "batch", Failed: true},
+	}
+	want := "• 2024-01-01 12:00 UTC `web` (service in `p1`) ReplaceService → `web-00002` by someone@example.com\n" +
+		"• 2024-01-01 11:00 UTC `batch` (job in `p2`) :warning: failed"
+	if got := formatDeploys(events); got != want {
+		t.Errorf("formatDeploys() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatHomeResource(t *testing.T) {
+	tests := []struct {
+		name string
+		r    homeResource
+		want string
+	}{
+		{name: "channel", r: homeResource{channelId: "C1", value: "p1:service:web"}, want: "<#C1>: `web` (service in `p1`)"},
+		{name: "direct message", r: homeResource{channelId: "D1", dm: true, value: "p1:job:batch"}, want: "Direct message: `batch` (job in `p1`)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatHomeResource(tt.r); got != tt.want {
+				t.Errorf("formatHomeResource() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucketCounts(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	seriesMap := monitoring.TimeSeriesMap{
+		"2xx": {{Time: start, Val: 1}, {Time: start.Add(90 * time.Minute), Val: 2}},
+		"5xx": {{Time: start.Add(time.Hour), Val: 3}, {Time: start.Add(-time.Hour), Val: 4}, {Time: start.Add(3 * time.Hour), Val: 5}},
+	}
+	got := bucketCounts(seriesMap, start, time.Hour, 3)
+	want := []float64{1, 5, 0}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("bucketCounts()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   string
+	}{
+		{name: "scaled", values: []float64{0, 1, 7, 14}, want: "▁▂▅█"},
+		{name: "all zero", values: []float64{0, 0}, want: "▁▁"},
+		{name: "empty", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sparkline(tt.values); got != tt.want {
+				t.Errorf("sparkline() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageText(t *testing.T) {
+	msg := slack.Message{Msg: slack.Msg{
+		Text:        "deployed",
+		Attachments: []slack.Attachment{{Text: "attachment", Fields: []slack.AttachmentField{{Title: "Service", Value: "web"}}}},
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			markdownSection("section"),
+			slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, "context", false, false)),
+		}},
+	}}
+	got := messageText(msg)
+	for _, want := range []string{"deployed", "attachment", "Service", "web", "section", "context"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("messageText() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestServiceUrlPattern(t *testing.T) {
+	text := "see <https://console.cloud.google.com/run/detail/asia-northeast1/web/metrics?project=p1|web> and https://example.com"
+	got := serviceUrlPattern.FindAllString(text, -1)
+	want := "https://console.cloud.google.com/run/detail/asia-northeast1/web/metrics?project=p1"
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("serviceUrlPattern found %v, want [%s]", got, want)
+	}
+}
+
+func TestUnfurlsProject(t *testing.T) {
+	h := &MultiProjectSlackEventHandler{config: &config.Config{
+		Projects: []config.ProjectConfig{
+			{ID: "p1", Region: "asia-northeast1"},
+			{ID: "p2", Region: "us-central1"},
+		},
+		ChannelToProjects: map[string][]string{"C1": {"p1"}},
+	}}
+	tests := []struct {
+		name      string
+		channel   string
+		projectID string
+		region    string
+		want      bool
+	}{
+		{name: "mapped project", channel: "C1", projectID: "p1", region: "asia-northeast1", want: true},
+		{name: "project not mapped to the channel", channel: "C1", projectID: "p2", region: "us-central1"},
+		{name: "unmapped channel", channel: "C9", projectID: "p2", region: "us-central1", want: true},
+		{name: "other region", channel: "C1", projectID: "p1", region: "us-central1"},
+		{name: "unknown project", channel: "C9", projectID: "p3", region: "us-central1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.unfurlsProject(tt.channel, tt.projectID, tt.region); got != tt.want {
+				t.Errorf("unfurlsProject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldBlocks(t *testing.T) {
+	fields := []Field{{Title: "a", Value: "1"}, {Title: "b", Value: "2"}, {Title: "long", Value: "3", Long: true}, {Title: "c", Value: "4"}}
+	for i := 0; i < maxSectionFields; i++ {
+		fields = append(fields, Field{Title: fmt.Sprint(i), Value: "x"})
+	}
+	blocks := FieldBlocks(fields)
+	// a and b, long, c and the first 9 others, the last other
+	wantFields := []int{2, 0, 10, 1}
+	if len(blocks) != len(wantFields) {
+		t.Fatalf("FieldBlocks() returned %d blocks, want %d", len(blocks), len(wantFields))
+	}
+	for i, want := range wantFields {
+		section := blocks[i].(*slack.SectionBlock)
+		if len(section.Fields) != want {
+			t.Errorf("block %d has %d fields, want %d", i, len(section.Fields), want)
+		}
+	}
+	if text := blocks[1].(*slack.SectionBlock).Text.Text; text != "*long*\n3" {
+		t.Errorf("long field = %q", text)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("abcdef", 4); got != "abc…" {
+		t.Errorf("truncateText() = %q, want abc…", got)
+	}
+	if got := truncateText("abc", 4); got != "abc" {
+		t.Errorf("truncateText() = %q, want abc", got)
+	}
+}
+
+func TestMetricsSelectValue(t *testing.T) {
+	value := metricsSelectValue("p1:service:web", "latency", 168*time.Hour)
+	resource, metricsType, duration, err := parseMetricsSelectValue(value)
+	if err != nil || resource != "p1:service:web" || metricsType != "latency" || duration != 168*time.Hour {
+		t.Errorf("parseMetricsSelectValue(%q) = %q, %q, %v, %v", value, resource, metricsType, duration, err)
+	}
+	for _, value := range []string{"", "p1:service:web|count", "p1:service:web|count|x", "p1:service:web|count|-1h"} {
+		if _, _, _, err := parseMetricsSelectValue(value); err == nil {
+			t.Errorf("parseMetricsSelectValue(%q) should fail", value)
+		}
+	}
+
+	selects := metricsSelects("p1:service:web", "count", 24*time.Hour)
+	durationSelect, typeSelect := selects[0].(*slack.SelectBlockElement), selects[1].(*slack.SelectBlockElement)
+	if durationSelect.InitialOption == nil || durationSelect.InitialOption.Text.Text != "1d" {
+		t.Errorf("duration select initial option = %+v, want 1d", durationSelect.InitialOption)
+	}
+	if typeSelect.InitialOption == nil || typeSelect.InitialOption.Text.Text != "count" {
+		t.Errorf("type select initial option = %+v, want count", typeSelect.InitialOption)
+	}
+}
+
+func TestResourceActions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		resourceType string
+		debug        bool
+		want         []string
+	}{
+		{name: "service", resourceType: "service", debug: true, want: []string{ActionIdDescribeButton, ActionIdMetricsButton, ActionIdDebugButton, ActionIdLogsButton}},
+		{name: "job without debug", resourceType: "job", want: []string{ActionIdDescribeButton, ActionIdLogsButton}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buttons := ResourceActions("p1", tt.resourceType, "web", tt.debug, now).Elements.ElementSet
+			if len(buttons) != len(tt.want) {
+				t.Fatalf("ResourceActions() returned %d buttons, want %d", len(buttons), len(tt.want))
+			}
+			for i, want := range tt.want {
+				button := buttons[i].(*slack.ButtonBlockElement)
+				if button.ActionID != want || button.Value != "p1:"+tt.resourceType+":web" {
+					t.Errorf("button %d = %s %s, want %s", i, button.ActionID, button.Value, want)
+				}
+			}
+			if logs := buttons[len(buttons)-1].(*slack.ButtonBlockElement); logs.URL == "" {
+				t.Error("Logs button has no URL")
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		7 * 24 * time.Hour: "7d",
+		6 * time.Hour:      "6h",
+		30 * time.Minute:   "30m",
+		90 * time.Second:   "1m30s",
+	}
+	for d, want := range tests {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestApprovalBlocks(t *testing.T) {
+	h := &MultiProjectSlackEventHandler{config: &config.Config{Projects: []config.ProjectConfig{{ID: "p1", Region: "asia-northeast1"}}}}
+	req := approval.Request{ID: "r1", Command: "rollback", Resource: "p1:service:web", Argument: "web-00041-xyz", Requester: "U1",
+		ExpiresAt: time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)}
+
+	// A pending request has the Approve and Reject buttons, carrying its ID
+	blocks := h.approvalBlocks(req, "")
+	actions, ok := blocks[len(blocks)-1].(*slack.ActionBlock)
+	if !ok {
+		t.Fatalf("last block = %T, want the buttons", blocks[len(blocks)-1])
+	}
+	var ids []string
+	for _, e := range actions.Elements.ElementSet {
+		button := e.(*slack.ButtonBlockElement)
+		if button.Value != "r1" {
+			t.Errorf("button %s value = %q, want the request ID", button.ActionID, button.Value)
+		}
+		ids = append(ids, button.ActionID)
+	}
+	if fmt.Sprint(ids) != fmt.Sprint([]string{ActionIdApproveRequest, ActionIdRejectRequest}) {
+		t.Errorf("buttons = %v", ids)
+	}
+
+	// A decided request shows its outcome instead
+	blocks = h.approvalBlocks(req, "Rejected by <@U2>.")
+	for _, b := range blocks {
+		if _, ok := b.(*slack.ActionBlock); ok {
+			t.Error("Expected no buttons on a decided request")
+		}
+	}
+	if section, ok := blocks[len(blocks)-1].(*slack.SectionBlock); !ok || section.Text.Text != "Rejected by <@U2>." {
+		t.Errorf("last block = %+v, want the outcome", blocks[len(blocks)-1])
+	}
+}
+
+func TestDebugHeaderBlocks(t *testing.T) {
+	h := &MultiProjectSlackEventHandler{config: &config.Config{Projects: []config.ProjectConfig{{ID: "p1", Region: "asia-northeast1"}}}}
+	result := &debug.DebugResult{ResourceType: "service", ResourceName: "web", ProjectID: "p1", LookbackMin: 60, TotalErrors: 12, Analyzed: 12,
+		Anomalies: []string{"5xx ratio rose to 12%"}}
+
+	text := func(blocks []slack.Block) string {
+		var b strings.Builder
+		for _, block := range blocks {
+			switch block := block.(type) {
+			case *slack.HeaderBlock:
+				b.WriteString(block.Text.Text + "\n")
+			case *slack.SectionBlock:
+				if block.Text != nil {
+					b.WriteString(block.Text.Text + "\n")
+				}
+				for _, f := range block.Fields {
+					b.WriteString(f.Text + "\n")
+				}
+			}
+		}
+		return b.String()
+	}
+
+	got := text(h.debugHeaderBlocks(result, 2))
+	for _, want := range []string{"Debug analysis: service web", "*Total Errors*\n12", "*Error Groups*\n2", "*Metric Anomalies*\n• 5xx ratio rose to 12%"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("debugHeaderBlocks() = %q, want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "LLM Usage") {
+		t.Errorf("debugHeaderBlocks() = %q, want no usage before the analysis is done", got)
+	}
+
+	// The usage is added once the analysis is done
+	result.Usage = adk.Usage{Calls: 3, PromptTokens: 1000, ResponseTokens: 200}
+	if got := text(h.debugHeaderBlocks(result, 2)); !strings.Contains(got, "*LLM Usage*") {
+		t.Errorf("debugHeaderBlocks() = %q, want the usage", got)
+	}
+}
@@ -0,0 +1,273 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/debug"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// incidentDocument is a debug result exported as incident notes, e.g. for a postmortem.
+type incidentDocument struct {
+	ProjectID       string          `json:"project_id"`
+	ResourceType    string          `json:"resource_type"`
+	ResourceName    string          `json:"resource_name"`
+	GeneratedAt     string          `json:"generated_at"`
+	LookbackMinutes int             `json:"lookback_minutes"`
+	TotalErrors     int             `json:"total_errors"`
+	TotalCapped     bool            `json:"total_capped"`
+	AnalyzedErrors  int             `json:"analyzed_errors"`
+	LogsURL         string          `json:"logs_url,omitempty"`
+	Timeline        []timelineEntry `json:"timeline"`
+	Anomalies       []string        `json:"anomalies,omitempty"`
+	Groups          []incidentGroup `json:"groups"`
+
+	errorCount string // Formatted total error count
+}
+
+type timelineEntry struct {
+	Time  string `json:"time"`
+	Event string `json:"event"`
+}
+
+type incidentGroup struct {
+	Pattern        string   `json:"pattern"`
+	ErrorCount     int      `json:"error_count"`
+	Representative string   `json:"representative"`
+	FirstSeen      string   `json:"first_seen,omitempty"`
+	LastSeen       string   `json:"last_seen,omitempty"`
+	ErrorType      string   `json:"error_type,omitempty"`
+	Request        string   `json:"request,omitempty"`
+	TraceID        string   `json:"trace_id,omitempty"`
+	TraceLogsURL   string   `json:"trace_logs_url,omitempty"`
+	TraceURL       string   `json:"trace_url,omitempty"`
+	StackTrace     string   `json:"stack_trace,omitempty"`
+	TraceSpans     []string `json:"trace_spans,omitempty"`
+	Summary        string   `json:"summary"`
+	PossibleCauses []string `json:"possible_causes"`
+	Suggestions    []string `json:"suggestions"`
+}
+
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func newIncidentDocument(result *debug.DebugResult) incidentDocument {
+	doc := incidentDocument{
+		ProjectID:       result.ProjectID,
+		ResourceType:    result.ResourceType,
+		ResourceName:    result.ResourceName,
+		GeneratedAt:     formatExportTime(result.GeneratedAt),
+		LookbackMinutes: result.LookbackMin,
+		TotalErrors:     result.TotalErrors,
+		TotalCapped:     result.TotalCapped,
+		AnalyzedErrors:  result.Analyzed,
+		LogsURL:         buildLogLink(result.ProjectID, result.ResourceType, result.ResourceName, time.Duration(result.LookbackMin)*time.Minute, result.GeneratedAt),
+		Anomalies:       result.Anomalies,
+		Groups:          make([]incidentGroup, 0, len(result.ErrorGroups)),
+		errorCount:      formatErrorCount(result),
+	}
+
+	type event struct {
+		time time.Time
+		text string
+	}
+	var events []event
+	for _, c := range result.Changes {
+		events = append(events, event{c.Time, c.Description})
+	}
+	for i, g := range result.ErrorGroups {
+		if !g.FirstSeen.IsZero() {
+			events = append(events, event{g.FirstSeen, fmt.Sprintf("Group %d first seen: %s", i+1, g.Pattern)})
+			events = append(events, event{g.LastSeen, fmt.Sprintf("Group %d last seen: %s", i+1, g.Pattern)})
+		}
+
+		group := incidentGroup{
+			Pattern:        g.Pattern,
+			ErrorCount:     g.ErrorCount,
+			Representative: g.Representative,
+			FirstSeen:      formatExportTime(g.FirstSeen),
+			LastSeen:       formatExportTime(g.LastSeen),
+			ErrorType:      g.ErrorType,
+			Request:        g.Request,
+			TraceID:        g.TraceID,
+			TraceLogsURL:   buildTraceLink(result.ProjectID, g.TraceID, g.TraceTimestamp),
+			StackTrace:     g.StackTrace,
+			TraceSpans:     g.TraceSpans,
+			Summary:        g.Analysis.Summary,
+			PossibleCauses: g.Analysis.PossibleCauses,
+			Suggestions:    g.Analysis.Suggestions,
+		}
+		if g.TraceID != "" {
+			group.TraceURL = buildTraceExplorerLink(result.ProjectID, g.TraceID)
+		}
+		doc.Groups = append(doc.Groups, group)
+	}
+	events = append(events, event{result.GeneratedAt, "Debug analysis generated"})
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].time.Before(events[j].time) })
+	for _, e := range events {
+		if !e.time.IsZero() {
+			doc.Timeline = append(doc.Timeline, timelineEntry{Time: formatExportTime(e.time), Event: e.text})
+		}
+	}
+	return doc
+}
+
+// JSON returns the document as indented JSON.
+func (d incidentDocument) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// Markdown returns the document as Markdown incident notes.
+func (d incidentDocument) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Incident notes: %s `%s`\n\n", d.ResourceType, d.ResourceName)
+	fmt.Fprintf(&b, "- **Project:** `%s`\n", d.ProjectID)
+	fmt.Fprintf(&b, "- **Generated:** %s\n", d.GeneratedAt)
+	fmt.Fprintf(&b, "- **Time range:** last %d minutes\n", d.LookbackMinutes)
+	fmt.Fprintf(&b, "- **Total errors:** %s\n", d.errorCount)
+	fmt.Fprintf(&b, "- **Error groups:** %d\n", len(d.Groups))
+	if d.LogsURL != "" {
+		fmt.Fprintf(&b, "- **Logs:** [Cloud Logging](%s)\n", d.LogsURL)
+	}
+
+	b.WriteString("\n## Timeline\n\n")
+	for _, e := range d.Timeline {
+		fmt.Fprintf(&b, "- `%s` %s\n", e.Time, e.Event)
+	}
+
+	if len(d.Anomalies) > 0 {
+		b.WriteString("\n## Metric anomalies\n\n")
+		for _, a := range d.Anomalies {
+			fmt.Fprintf(&b, "- %s\n", a)
+		}
+	}
+
+	b.WriteString("\n## Error groups\n")
+	for i, g := range d.Groups {
+		fmt.Fprintf(&b, "\n### Group %d: %s (%d errors)\n\n", i+1, g.Pattern, g.ErrorCount)
+		if g.FirstSeen != "" {
+			fmt.Fprintf(&b, "- **First seen:** %s\n- **Last seen:** %s\n", g.FirstSeen, g.LastSeen)
+		}
+		if g.ErrorType != "" {
+			fmt.Fprintf(&b, "- **Error type:** `%s`\n", g.ErrorType)
+		}
+		if g.Request != "" {
+			fmt.Fprintf(&b, "- **Request:** `%s`\n", g.Request)
+		}
+		if g.TraceID != "" {
+			links := []string{fmt.Sprintf("`%s`", g.TraceID)}
+			if g.TraceLogsURL != "" {
+				links = append(links, fmt.Sprintf("[logs](%s)", g.TraceLogsURL))
+			}
+			links = append(links, fmt.Sprintf("[Cloud Trace](%s)", g.TraceURL))
+			fmt.Fprintf(&b, "- **Sample trace:** %s\n", strings.Join(links, " · "))
+		}
+
+		fmt.Fprintf(&b, "\n**Representative error**\n\n%s\n", markdownCodeBlock(g.Representative))
+		fmt.Fprintf(&b, "\n**Summary:** %s\n", g.Summary)
+		writeMarkdownList(&b, "Possible causes", g.PossibleCauses)
+		writeMarkdownList(&b, "Suggestions", g.Suggestions)
+		if g.StackTrace != "" {
+			fmt.Fprintf(&b, "\n**Stack trace**\n\n%s\n", markdownCodeBlock(g.StackTrace))
+		}
+		if len(g.TraceSpans) > 0 {
+			fmt.Fprintf(&b, "\n**Trace critical path**\n\n%s\n", markdownCodeBlock(strings.Join(g.TraceSpans, "\n")))
+		}
+	}
+	return b.String()
+}
+
+func writeMarkdownList(b *strings.Builder, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n**%s**\n\n", title)
+	for _, item := range items {
+		fmt.Fprintf(b, "- %s\n", item)
+	}
+}
+
+// markdownCodeBlock fences s with enough backticks that fences inside s do not end the block.
+func markdownCodeBlock(s string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s\n%s\n%s", fence, strings.TrimRight(s, "\n"), fence)
+}
+
+// exportBaseName returns e.g. "my-project/my-service-20250101-100000" for the files of an export.
+func exportBaseName(result *debug.DebugResult) string {
+	return path.Join(result.ProjectID, fmt.Sprintf("%s-%s", result.ResourceName, result.GeneratedAt.UTC().Format("20060102-150405")))
+}
+
+// exportDebugResult handles the export button of a debug result: it uploads the result as Markdown and JSON
+// incident notes into the result thread, and saves them to the export destination if one is configured.
+func (h *MultiProjectSlackEventHandler) exportDebugResult(ctx context.Context, channelId, userId, threadTS string) error {
+	result, _, ok := h.threads.get(channelId, threadTS)
+	if !ok {
+		_, err := h.client.PostEphemeralContext(ctx, channelId, userId,
+			slack.MsgOptionText("This debug result has expired. Run `debug` again to export it.", false))
+		return err
+	}
+
+	doc := newIncidentDocument(result)
+	jsonData, err := doc.JSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal incident notes: %w", err)
+	}
+	files := []struct {
+		ext  string
+		data []byte
+	}{
+		{ext: ".md", data: []byte(doc.Markdown())},
+		{ext: ".json", data: jsonData},
+	}
+
+	baseName := exportBaseName(result)
+	comment := fmt.Sprintf("Incident notes exported by <@%s>.", userId)
+	if h.exports != nil {
+		for _, f := range files {
+			audit.RecordCall(ctx, "export.Save", baseName+f.ext)
+			location, err := h.exports.Save(ctx, baseName+f.ext, f.data)
+			if err != nil {
+				h.logger.Warn("Failed to save incident notes", zap.String("name", baseName+f.ext), zap.Error(err))
+				comment += fmt.Sprintf("\nFailed to save `%s`: %s", path.Base(baseName)+f.ext, err.Error())
+				continue
+			}
+			comment += fmt.Sprintf("\nSaved to `%s`", location)
+		}
+	}
+
+	for i, f := range files {
+		params := slack.UploadFileV2Parameters{
+			Reader:          bytes.NewReader(f.data),
+			FileSize:        len(f.data),
+			Filename:        path.Base(baseName) + f.ext,
+			Title:           fmt.Sprintf("Incident notes: %s %s%s", result.ResourceType, result.ResourceName, f.ext),
+			Channel:         channelId,
+			ThreadTimestamp: threadTS,
+		}
+		if i == 0 {
+			params.InitialComment = comment
+		}
+		if _, err := h.client.UploadFileV2Context(ctx, params); err != nil {
+			return fmt.Errorf("failed to upload incident notes: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/debug"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// Feedback ratings, used as the action IDs of the feedback buttons.
+const (
+	ratingUp   = "up"
+	ratingDown = "down"
+)
+
+// feedbackRecord is a rating of one group's analysis, kept with what the model was asked and answered
+// so that poor analyses can be reproduced and added to a replay corpus.
+type feedbackRecord struct {
+	AnalysisID   string `json:"analysis_id"` // Rated group as <channel>/<thread>/<group>
+	Time         string `json:"time"`
+	UserID       string `json:"user_id"`
+	ChannelID    string `json:"channel_id"`
+	ThreadTS     string `json:"thread_ts"`
+	ProjectID    string `json:"project_id"`
+	ResourceType string `json:"resource_type"`
+	ResourceName string `json:"resource_name"`
+	GroupIndex   int    `json:"group_index"` // 1-based
+	Pattern      string `json:"pattern"`
+	ErrorCount   int    `json:"error_count"`
+	Rating       string `json:"rating"`
+	Model        string `json:"model"`
+	Prompt       string `json:"prompt"`
+	Response     string `json:"response"`
+	ParseFailed  bool   `json:"parse_failed"`
+}
+
+// feedbackTarget is an analyzed group that can be rated.
+type feedbackTarget struct {
+	projectID    string
+	resourceType string
+	resourceName string
+	group        debug.ErrorGroupResult
+	addedAt      time.Time
+}
+
+// feedbackTargets keeps analyzed groups by thread and index, so they can be rated while the job is still running.
+type feedbackTargets struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	targets map[string]feedbackTarget // channel/thread timestamp/index -> group
+}
+
+func newFeedbackTargets() *feedbackTargets {
+	return &feedbackTargets{now: time.Now, targets: make(map[string]feedbackTarget)}
+}
+
+func feedbackKey(channelId, threadTS string, index int) string {
+	return fmt.Sprintf("%s/%d", threadKey(channelId, threadTS), index)
+}
+
+// add registers an analyzed group and drops expired ones. index is 0-based.
+func (f *feedbackTargets) add(channelId, threadTS string, result *debug.DebugResult, index int, group debug.ErrorGroupResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	for key, target := range f.targets {
+		if now.Sub(target.addedAt) > debugThreadTTL {
+			delete(f.targets, key)
+		}
+	}
+	f.targets[feedbackKey(channelId, threadTS, index)] = feedbackTarget{
+		projectID:    result.ProjectID,
+		resourceType: result.ResourceType,
+		resourceName: result.ResourceName,
+		group:        group,
+		addedAt:      now,
+	}
+}
+
+func (f *feedbackTargets) get(channelId, threadTS string, index int) (feedbackTarget, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target, ok := f.targets[feedbackKey(channelId, threadTS, index)]
+	if !ok || f.now().Sub(target.addedAt) > debugThreadTTL {
+		return feedbackTarget{}, false
+	}
+	return target, true
+}
+
+// feedbackActions returns the 👍/👎 buttons of a group reply. index is 0-based.
+func feedbackActions(threadTS string, index int) *slack.ActionBlock {
+	value := fmt.Sprintf("%s:%d", threadTS, index)
+	return slack.NewActionBlock(ActionIdFeedback,
+		slack.NewButtonBlockElement(ratingUp, value, slack.NewTextBlockObject(slack.PlainTextType, ":+1: Helpful", true, false)),
+		slack.NewButtonBlockElement(ratingDown, value, slack.NewTextBlockObject(slack.PlainTextType, ":-1: Not helpful", true, false)),
+	)
+}
+
+// parseFeedbackValue parses the "threadTS:index" value of a feedback button.
+func parseFeedbackValue(value string) (threadTS string, index int, err error) {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid feedback value %q", value)
+	}
+	index, err = strconv.Atoi(value[i+1:])
+	if err != nil || index < 0 {
+		return "", 0, fmt.Errorf("invalid feedback value %q", value)
+	}
+	return value[:i], index, nil
+}
+
+// feedbackProject returns the project of the group rated by a feedback button, or nil if it has expired.
+func (h *MultiProjectSlackEventHandler) feedbackProject(interaction *slack.InteractionCallback) []string {
+	threadTS, index, err := parseFeedbackValue(interaction.ActionCallback.BlockActions[0].Value)
+	if err != nil {
+		return nil
+	}
+	if target, ok := h.feedback.get(interaction.Channel.ID, threadTS, index); ok {
+		return []string{target.projectID}
+	}
+	return nil
+}
+
+// recordFeedback handles a feedback button of a group reply. The rating is logged, and saved as a JSON document
+// to the export destination if one is configured.
+func (h *MultiProjectSlackEventHandler) recordFeedback(ctx context.Context, channelId, userId string, action *slack.BlockAction) error {
+	if action.ActionID != ratingUp && action.ActionID != ratingDown {
+		return fmt.Errorf("unsupported feedback rating %q", action.ActionID)
+	}
+	threadTS, index, err := parseFeedbackValue(action.Value)
+	if err != nil {
+		return err
+	}
+	target, ok := h.feedback.get(channelId, threadTS, index)
+	if !ok {
+		_, err := h.client.PostEphemeralContext(ctx, channelId, userId,
+			slack.MsgOptionText("This debug result has expired, so feedback can no longer be recorded.", false))
+		return err
+	}
+
+	now := time.Now().UTC()
+	analysis := target.group.Analysis
+	record := feedbackRecord{
+		AnalysisID:   fmt.Sprintf("%s/%s/%d", channelId, threadTS, index+1),
+		Time:         now.Format(time.RFC3339),
+		UserID:       userId,
+		ChannelID:    channelId,
+		ThreadTS:     threadTS,
+		ProjectID:    target.projectID,
+		ResourceType: target.resourceType,
+		ResourceName: target.resourceName,
+		GroupIndex:   index + 1,
+		Pattern:      target.group.Pattern,
+		ErrorCount:   target.group.ErrorCount,
+		Rating:       action.ActionID,
+		Model:        analysis.Model,
+		Prompt:       analysis.Prompt,
+		Response:     analysis.Response,
+		ParseFailed:  analysis.ParseFailed,
+	}
+	// The prompt and response contain error messages and stack traces, so they are only logged at debug level
+	h.logger.Info("Debug analysis feedback",
+		zap.String("analysis_id", record.AnalysisID),
+		zap.String("rating", record.Rating),
+		zap.String("user", userId),
+		zap.String("project_id", record.ProjectID),
+		zap.String("resource_name", record.ResourceName),
+		zap.String("model", record.Model),
+		zap.Bool("parse_failed", record.ParseFailed))
+	h.logger.Debug("Debug analysis feedback prompt and response",
+		zap.String("analysis_id", record.AnalysisID),
+		zap.String("prompt", record.Prompt),
+		zap.String("response", record.Response))
+
+	if h.exports != nil {
+		data, err := json.MarshalIndent(record, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal feedback: %w", err)
+		}
+		name := path.Join("feedback", record.ProjectID, fmt.Sprintf("%s-%s-%d-%s.json",
+			record.ResourceName, now.Format("20060102-150405"), record.GroupIndex, userId))
+		audit.RecordCall(ctx, "export.Save", name)
+		if _, err := h.exports.Save(ctx, name, data); err != nil {
+			h.logger.Warn("Failed to save feedback", zap.String("name", name), zap.Error(err))
+		}
+	}
+
+	_, err = h.client.PostEphemeralContext(ctx, channelId, userId,
+		slack.MsgOptionText(fmt.Sprintf("Thanks for the feedback on group %d.", index+1), false))
+	return err
+}
@@ -0,0 +1,220 @@
+package slack
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/authz"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/deploy"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/monitoring"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+const (
+	homeHealthWindow  = time.Hour // Window of the service health table
+	homeMaxServices   = 10        // Busiest services shown per project
+	homeMaxDeploys    = 10
+	homeMaxResources  = 5  // Current resources shown with quick actions
+	homeNameMaxLength = 30 // Longer service names are cut in the health table
+)
+
+// homeResource is a current resource of the user in a channel.
+type homeResource struct {
+	channelId string
+	dm        bool // The direct message with the bot
+	value     string
+}
+
+// publishHome publishes the App Home tab of the user: their current resources with quick actions, the health
+// of the services of their channels' projects and the recent deploys to them.
+func (h *MultiProjectSlackEventHandler) publishHome(ctx context.Context, userId string) error {
+	channels, err := h.memberChannels(ctx, userId)
+	if err != nil {
+		h.logger.Warn("Failed to list the user's channels for the App Home tab", zap.String("user", userId), zap.Error(err))
+	}
+	projects := h.viewableProjects(ctx, userId, h.listedProjects(h.channelsProjects(channels)))
+
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, "Cloud Run", false, false)),
+		slack.NewActionBlock("",
+			slack.NewButtonBlockElement(ActionIdHomeRefresh, "", slack.NewTextBlockObject(slack.PlainTextType, "Refresh", false, false))),
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType,
+			fmt.Sprintf("Updated %s", time.Now().UTC().Format("2006-01-02 15:04 MST")), false, false)),
+	}
+	blocks = append(blocks, h.homeResourceBlocks(ctx, userId, channels)...)
+	blocks = append(blocks, slack.NewDividerBlock(), markdownSection("*Service health* (last hour)"))
+	blocks = append(blocks, h.homeHealthBlocks(ctx, projects)...)
+	blocks = append(blocks, slack.NewDividerBlock(), markdownSection("*Recent deploys*\n"+formatDeploys(h.deploys.Recent(projects, homeMaxDeploys))))
+
+	_, err = h.client.PublishViewContext(ctx, slack.PublishViewContextRequest{
+		UserID: userId,
+		View:   slack.HomeTabViewRequest{Type: slack.VTHomeTab, Blocks: slack.Blocks{BlockSet: blocks}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish App Home tab: %w", err)
+	}
+	return nil
+}
+
+// viewableProjects returns the projects the user may see metrics of.
+func (h *MultiProjectSlackEventHandler) viewableProjects(ctx context.Context, userId string, projects []string) []string {
+	if h.authz == nil {
+		return projects
+	}
+	var viewable []string
+	for _, projectID := range projects {
+		decision, err := h.authz.Authorize(ctx, authz.Request{UserID: userId, Command: authz.CommandMetrics, Projects: []string{projectID}})
+		if err != nil {
+			h.logger.Warn("Failed to authorize the App Home tab", zap.String("user", userId), zap.String("project_id", projectID), zap.Error(err))
+		}
+		if decision.Allowed {
+			viewable = append(viewable, projectID)
+		}
+	}
+	return viewable
+}
+
+// homeResourceBlocks lists the current resources of the user in a direct message and their configured channels,
+// with the buttons of messages about them, whose results are posted in the direct message with the user.
+func (h *MultiProjectSlackEventHandler) homeResourceBlocks(ctx context.Context, userId string, channels []slack.Channel) []slack.Block {
+	var resources []homeResource
+	if dm, err := h.directMessageChannel(ctx, userId); err != nil {
+		h.logger.Warn("Failed to open direct message for the App Home tab", zap.String("user", userId), zap.Error(err))
+	} else if value, ok := h.currentResource(ctx, dm, userId); ok {
+		resources = append(resources, homeResource{channelId: dm, dm: true, value: value})
+	}
+	for _, c := range channels {
+		if len(h.channelsProjects([]slack.Channel{c})) == 0 {
+			continue
+		}
+		if value, ok := h.currentResource(ctx, c.ID, userId); ok {
+			resources = append(resources, homeResource{channelId: c.ID, value: value})
+		}
+	}
+
+	blocks := []slack.Block{slack.NewDividerBlock(), markdownSection("*Your current resources*")}
+	if len(resources) == 0 {
+		return append(blocks, markdownSection("None yet. Run `set` in a channel or a direct message with me to pick one."))
+	}
+	now := time.Now()
+	for _, r := range resources[:min(len(resources), homeMaxResources)] {
+		blocks = append(blocks, markdownSection(formatHomeResource(r)))
+		if projectID, resourceType, resourceName, err := ParseMultiProjectResourceValue(r.value); err == nil {
+			blocks = append(blocks, ResourceActions(projectID, resourceType, resourceName, h.debugger != nil, now))
+		}
+	}
+	return blocks
+}
+
+// homeHealthBlocks shows a health table per project.
+func (h *MultiProjectSlackEventHandler) homeHealthBlocks(ctx context.Context, projects []string) []slack.Block {
+	if len(projects) == 0 {
+		return []slack.Block{markdownSection("No projects to show.")}
+	}
+	var blocks []slack.Block
+	now := time.Now()
+	for _, projectID := range projects {
+		mClient, ok := h.mClients[projectID]
+		if !ok {
+			continue
+		}
+		text := fmt.Sprintf("`%s`\n", projectID)
+		health, err := mClient.GetCloudRunServicesHealth(ctx, homeHealthWindow, now)
+		switch {
+		case err != nil:
+			h.logger.Warn("Failed to get service health", zap.String("project_id", projectID), zap.Error(err))
+			text += "_Failed to get metrics._"
+		case len(health) == 0:
+			text += "_No requests._"
+		default:
+			text += "```\n" + formatHealthTable(health, homeHealthWindow, homeMaxServices) + "```"
+		}
+		blocks = append(blocks, markdownSection(text))
+	}
+	return blocks
+}
+
+func markdownSection(text string) *slack.SectionBlock {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+// formatHomeResource formats a current resource, e.g. "<#C1>: `web` (service in `project1`)".
+func formatHomeResource(r homeResource) string {
+	where := fmt.Sprintf("<#%s>", r.channelId)
+	if r.dm {
+		where = "Direct message"
+	}
+	projectID, resourceType, resourceName, err := ParseMultiProjectResourceValue(r.value)
+	if err != nil {
+		return fmt.Sprintf("%s: `%s`", where, r.value)
+	}
+	return fmt.Sprintf("%s: `%s` (%s in `%s`)", where, resourceName, resourceType, projectID)
+}
+
+// formatHealthTable formats the health of up to n of the busiest services as an aligned table.
+func formatHealthTable(health map[string]monitoring.ServiceHealth, window time.Duration, n int) string {
+	services := make([]string, 0, len(health))
+	for service := range health {
+		services = append(services, service)
+	}
+	slices.SortFunc(services, func(a, b string) int {
+		if c := cmp.Compare(health[b].Requests, health[a].Requests); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	names := make([]string, min(len(services), n))
+	width := len("service")
+	for i := range names {
+		names[i] = services[i]
+		if len(names[i]) > homeNameMaxLength {
+			names[i] = names[i][:homeNameMaxLength-1] + "~"
+		}
+		width = max(width, len(names[i]))
+	}
+	lines := []string{fmt.Sprintf("%-*s  %8s  %6s  %8s", width, "service", "req/s", "5xx", "p99")}
+	for i, name := range names {
+		s := health[services[i]]
+		p99 := "-"
+		if s.P99 > 0 {
+			p99 = fmt.Sprintf("%.0fms", s.P99)
+		}
+		lines = append(lines, fmt.Sprintf("%-*s  %8.2f  %5.1f%%  %8s", width, name, s.RequestRate(window), s.ErrorRatio()*100, p99))
+	}
+	if len(services) > n {
+		lines = append(lines, fmt.Sprintf("and %d more", len(services)-n))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// formatDeploys formats deploys one per line, e.g.
+// "• 2024-01-01 12:00 UTC `web` (service in `project1`) ReplaceService → `web-00002` by someone@example.com".
+func formatDeploys(events []deploy.Event) string {
+	if len(events) == 0 {
+		return "None seen since the bot started."
+	}
+	lines := make([]string, len(events))
+	for i, e := range events {
+		line := fmt.Sprintf("• %s `%s` (%s in `%s`)", e.Time.UTC().Format("2006-01-02 15:04 MST"), e.Name, e.ResourceType, e.ProjectID)
+		if e.Method != "" {
+			line += " " + e.Method[strings.LastIndex(e.Method, ".")+1:]
+		}
+		if e.Revision != "" {
+			line += fmt.Sprintf(" → `%s`", e.Revision)
+		}
+		if e.Modifier != "" {
+			line += " by " + e.Modifier
+		}
+		if e.Failed {
+			line += " :warning: failed"
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,56 @@
+package slack
+
+import (
+	"context"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/trace"
+	"github.com/slack-go/slack"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+type ephemeralUserKey struct{}
+
+// replyEphemerally returns a context in which command results are only shown to userId rather than posted to the channel.
+func replyEphemerally(ctx context.Context, userId string) context.Context {
+	return context.WithValue(ctx, ephemeralUserKey{}, userId)
+}
+
+// ephemeralUser returns the user that command results are only shown to, if any.
+func ephemeralUser(ctx context.Context) (string, bool) {
+	userId, ok := ctx.Value(ephemeralUserKey{}).(string)
+	return userId, ok
+}
+
+// postMessage posts a command result to the channel, or only to the user if the command replies ephemerally.
+func (h *MultiProjectSlackEventHandler) postMessage(ctx context.Context, channelId string, options ...slack.MsgOption) error {
+	if userId, ok := ephemeralUser(ctx); ok {
+		_, err := h.client.PostEphemeralContext(ctx, channelId, userId, options...)
+		return err
+	}
+	_, _, err := h.client.PostMessageContext(ctx, channelId, options...)
+	return err
+}
+
+// HandleSlashCommand runs a slash command, e.g. `/cloudrun describe my-service`, with the same commands as mentions.
+// Results are only shown to the user who ran it unless the command has `--share`.
+func (h *MultiProjectSlackEventHandler) HandleSlashCommand(cmd *slack.SlashCommand) error {
+	ctx, span := trace.GetTracer().Start(context.Background(), "MultiProjectHandleSlashCommand")
+	defer span.End()
+	span.SetAttributes(attribute.String("slack.slash_command", cmd.Command))
+	h.logger.Info("Received slash command in multi-project mode", zap.String("command", cmd.Command), zap.String("text", cmd.Text))
+
+	ctx = audit.Start(ctx, cmd.UserID, cmd.ChannelID, "slash")
+	if cmd.ChannelName == "directmessage" {
+		ctx = inDirectMessage(ctx)
+	}
+	err := h.runCommand(ctx, span, cmd.ChannelID, cmd.UserID, cmd.Text, true)
+	h.audit.Finish(ctx, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,243 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/audit"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/authz"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/cloudrun"
+	"github.com/nakamasato/cloud-run-slack-bot/pkg/monitoring"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"go.uber.org/zap"
+)
+
+const (
+	sparklineBuckets = 24        // Points of the request count sparkline of unfurls
+	sparklinePeriod  = time.Hour // Period of each point
+)
+
+var (
+	sparkChars = []rune("▁▂▃▄▅▆▇█")
+	// serviceUrlPattern matches console URLs of services in message text, which Slack wraps as <url> or <url|label>.
+	serviceUrlPattern = regexp.MustCompile(`https://console\.cloud\.google\.com/run/detail/[^\s|>]+`)
+	// nonNameChars separates the words of a message that can be service names.
+	nonNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// unfurlLinks shows the revision, image, last modifier and recent requests of the services whose console URLs
+// are shared in a message. Links of projects or regions that are not configured, of projects the channel is not
+// mapped to, or that the user may not describe, are left as they are.
+func (h *MultiProjectSlackEventHandler) unfurlLinks(ctx context.Context, e *slackevents.LinkSharedEvent) error {
+	// Links typed in the message composer are identified by an unfurl ID instead, which is not supported
+	if e.Channel == "COMPOSER" {
+		return nil
+	}
+	unfurls := map[string]slack.Attachment{}
+	for _, link := range e.Links {
+		projectID, region, name, err := cloudrun.ParseServiceUrl(link.URL)
+		if err != nil {
+			continue // Other console pages
+		}
+		if !h.unfurlsProject(e.Channel, projectID, region) {
+			continue
+		}
+		if h.authz != nil {
+			decision, err := h.authz.Authorize(ctx, authz.Request{UserID: e.User, ChannelID: e.Channel, Command: authz.CommandDescribe, Projects: []string{projectID}})
+			if !decision.Allowed {
+				h.logger.Debug("Not unfurling link the user may not describe", zap.String("user", e.User), zap.String("project_id", projectID), zap.Error(err))
+				continue
+			}
+		}
+		audit.SetResource(ctx, projectID+":service:"+name)
+		attachment, err := h.serviceUnfurl(ctx, projectID, name)
+		if err != nil {
+			h.logger.Warn("Failed to unfurl service link", zap.String("url", link.URL), zap.Error(err))
+			continue
+		}
+		unfurls[link.URL] = attachment
+	}
+	if len(unfurls) == 0 {
+		return nil
+	}
+	if _, _, _, err := h.client.UnfurlMessageContext(ctx, e.Channel, e.MessageTimeStamp, unfurls); err != nil {
+		return fmt.Errorf("failed to unfurl links: %w", err)
+	}
+	return nil
+}
+
+// unfurlsProject reports whether links to services of a project in region are unfurled in channel: the project
+// must be configured in that region and, if the channel is mapped to projects, be one of them.
+func (h *MultiProjectSlackEventHandler) unfurlsProject(channel, projectID, region string) bool {
+	if projectConfig, ok := h.config.GetProjectConfig(projectID); !ok || projectConfig.Region != region {
+		return false
+	}
+	channelProjects := h.config.GetProjectsForChannel(channel)
+	return len(channelProjects) == 0 || slices.Contains(channelProjects, projectID)
+}
+
+// serviceUnfurl builds the unfurl of a service with a sparkline of its requests over the last day.
+func (h *MultiProjectSlackEventHandler) serviceUnfurl(ctx context.Context, projectID, name string) (slack.Attachment, error) {
+	rClient, ok := h.rClients[projectID]
+	if !ok {
+		return slack.Attachment{}, fmt.Errorf("no client found for project %s", projectID)
+	}
+	svc, err := rClient.GetService(ctx, name)
+	if err != nil {
+		return slack.Attachment{}, fmt.Errorf("failed to get service %s: %w", name, err)
+	}
+	blocks := []slack.Block{
+		slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Cloud Run service `%s`* in `%s`", svc.Name, svc.Project), false, false),
+			[]*slack.TextBlockObject{
+				slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Revision*\n`%s`", svc.LatestRevision), false, false),
+				slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Image*\n`%s`", svc.Image), false, false),
+				slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Last modifier*\n%s", svc.LastModifier), false, false),
+				slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*Updated*\n%s", svc.UpdateTime.Format("2006/01/02 15:04:05")), false, false),
+			}, nil),
+	}
+
+	if mClient, ok := h.mClients[projectID]; ok {
+		end := time.Now().UTC().Truncate(sparklinePeriod).Add(sparklinePeriod)
+		start := end.Add(-sparklineBuckets * sparklinePeriod)
+		seriesMap, err := mClient.GetCloudRunServiceRequestCount(ctx, name, sparklinePeriod, start, end)
+		if err != nil {
+			h.logger.Warn("Failed to get request count for unfurl", zap.String("service", name), zap.Error(err))
+		} else {
+			counts := bucketCounts(*seriesMap, start, sparklinePeriod, sparklineBuckets)
+			var total float64
+			for _, c := range counts {
+				total += c
+			}
+			blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType,
+				fmt.Sprintf("Requests (last 24h): %s %.0f total", sparkline(counts), total), false, false)))
+		}
+	}
+	return slack.Attachment{Blocks: slack.Blocks{BlockSet: blocks}}, nil
+}
+
+// bucketCounts sums the points of all series into n buckets of period from start.
+func bucketCounts(seriesMap monitoring.TimeSeriesMap, start time.Time, period time.Duration, n int) []float64 {
+	counts := make([]float64, n)
+	for _, series := range seriesMap {
+		for _, p := range series {
+			if i := int(p.Time.Sub(start) / period); i >= 0 && i < n {
+				counts[i] += p.Val
+			}
+		}
+	}
+	return counts
+}
+
+// sparkline draws values as a line of block characters scaled to the largest value.
+func sparkline(values []float64) string {
+	var largest float64
+	for _, v := range values {
+		largest = max(largest, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if largest > 0 {
+			i = int(v/largest*float64(len(sparkChars)-1) + 0.5)
+		}
+		b.WriteRune(sparkChars[i])
+	}
+	return b.String()
+}
+
+// debugFromMessage handles the "Debug this service" message shortcut, which debugs the service that the
+// selected message links to or names, e.g. a deploy notification.
+func (h *MultiProjectSlackEventHandler) debugFromMessage(ctx context.Context, interaction *slack.InteractionCallback) error {
+	channelId, userId := interaction.Channel.ID, interaction.User.ID
+	if h.debugger == nil {
+		_, err := h.client.PostEphemeralContext(ctx, channelId, userId,
+			slack.MsgOptionText("Debug feature is not enabled.", false))
+		return err
+	}
+	value, msg, err := h.messageService(ctx, channelId, interaction.Message)
+	if err != nil {
+		return err
+	}
+	if msg != "" {
+		_, err = h.client.PostEphemeralContext(ctx, channelId, userId, slack.MsgOptionText(msg, false))
+		return err
+	}
+	if allowed, err := h.authorize(ctx, channelId, userId, "", authz.CommandDebug, resourceProject(value)); !allowed {
+		return err
+	}
+	h.rememberResource(ctx, channelId, userId, value, "service")
+	return h.debugResource(ctx, channelId, userId, value)
+}
+
+// messageService finds the service of a message: the first service of the channel's projects it links to, or else
+// the only service of the channel's projects it names. If there is none, it returns a message for the user instead.
+func (h *MultiProjectSlackEventHandler) messageService(ctx context.Context, channelId string, msg slack.Message) (string, string, error) {
+	text := messageText(msg)
+	for _, rawUrl := range serviceUrlPattern.FindAllString(text, -1) {
+		projectID, region, name, err := cloudrun.ParseServiceUrl(rawUrl)
+		if err != nil {
+			continue
+		}
+		if h.unfurlsProject(channelId, projectID, region) {
+			return resourceCandidate{projectID: projectID, resourceType: "service", name: name}.value(), "", nil
+		}
+	}
+
+	candidates, err := h.listCandidates(ctx, "service", h.listedProjects(h.config.GetProjectsForChannel(channelId)))
+	if err != nil {
+		return "", "", err
+	}
+	words := map[string]bool{}
+	for _, w := range nonNameChars.Split(strings.ToLower(text), -1) {
+		words[w] = true
+	}
+	var matches []resourceCandidate
+	for _, c := range candidates {
+		if words[c.name] {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", "No Cloud Run service of this channel's projects found in the message.", nil
+	case 1:
+		return matches[0].value(), "", nil
+	default:
+		return "", fmt.Sprintf("The message mentions %s. Run `@cloud-run-bot debug <name> --project <id>` for one of them.", joinCandidates(matches, ", ")), nil
+	}
+}
+
+// messageText returns the text of a message including its attachments and blocks, e.g. of notifications.
+func messageText(msg slack.Message) string {
+	texts := []string{msg.Text}
+	for _, a := range msg.Attachments {
+		texts = append(texts, a.Pretext, a.Text)
+		for _, f := range a.Fields {
+			texts = append(texts, f.Title, f.Value)
+		}
+	}
+	for _, block := range msg.Blocks.BlockSet {
+		switch b := block.(type) {
+		case *slack.SectionBlock:
+			if b.Text != nil {
+				texts = append(texts, b.Text.Text)
+			}
+			for _, f := range b.Fields {
+				texts = append(texts, f.Text)
+			}
+		case *slack.ContextBlock:
+			for _, e := range b.ContextElements.Elements {
+				if t, ok := e.(*slack.TextBlockObject); ok {
+					texts = append(texts, t.Text)
+				}
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,70 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mexporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/metric"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.uber.org/zap"
+)
+
+// metricExportInterval is how often metrics are exported to Cloud Monitoring.
+const metricExportInterval = time.Minute
+
+// MeterProvider wraps the OpenTelemetry MeterProvider.
+type MeterProvider struct {
+	mp *sdkmetric.MeterProvider
+}
+
+// NewMeterProvider creates a new OpenTelemetry MeterProvider with Google Cloud Monitoring exporter and registers
+// it globally, so that metrics recorded with otel.Meter, e.g. the LLM usage of debug analyses, are exported.
+// SamplingRate of cfg is not used.
+func NewMeterProvider(ctx context.Context, cfg Config, logger *zap.Logger) (*MeterProvider, error) {
+	if cfg.ProjectID == "" {
+		return nil, fmt.Errorf("projectID is required")
+	}
+
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "cloud-run-slack-bot"
+	}
+
+	res, err := newResource(ctx, cfg.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	mpOptions := []sdkmetric.Option{sdkmetric.WithResource(res)}
+
+	// Only create exporter in production mode
+	if !cfg.TestMode {
+		exporter, err := mexporter.New(mexporter.WithProjectID(cfg.ProjectID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+		}
+		mpOptions = append(mpOptions, sdkmetric.WithReader(
+			sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(metricExportInterval)),
+		))
+	}
+
+	mp := sdkmetric.NewMeterProvider(mpOptions...)
+
+	// Set global MeterProvider
+	otel.SetMeterProvider(mp)
+
+	logger.Info("Meter provider initialized",
+		zap.String("project_id", cfg.ProjectID),
+		zap.Duration("export_interval", metricExportInterval))
+
+	return &MeterProvider{mp: mp}, nil
+}
+
+// Shutdown shuts down the meter provider, exporting any remaining metrics.
+func (p *MeterProvider) Shutdown(ctx context.Context) error {
+	if p.mp == nil {
+		return nil
+	}
+	return p.mp.Shutdown(ctx)
+}
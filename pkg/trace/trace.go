@@ -1,4 +1,4 @@
-// Package trace provides OpenTelemetry tracing with Google Cloud Trace integration.
+// Package trace provides OpenTelemetry tracing with Google Cloud Trace integration, and metrics exported to Google Cloud Monitoring.
 package trace
 
 import (
@@ -50,15 +50,9 @@ func NewProvider(ctx context.Context, cfg Config, logger *zap.Logger) (*Provider
 		cfg.SamplingRate = 1.0 // Default to always sampling
 	}
 
-	// Create resource with service information
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(cfg.ServiceName),
-			semconv.ServiceVersion("1.0.0"),
-		),
-	)
+	res, err := newResource(ctx, cfg.ServiceName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
+		return nil, err
 	}
 
 	// Create sampler based on configuration
@@ -106,6 +100,20 @@ func NewProvider(ctx context.Context, cfg Config, logger *zap.Logger) (*Provider
 	return &Provider{tp: tp}, nil
 }
 
+// newResource creates the resource with service information shared by traces and metrics.
+func newResource(ctx context.Context, serviceName string) (*resource.Resource, error) {
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion("1.0.0"),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+	return res, nil
+}
+
 // Shutdown shuts down the trace provider, flushing any remaining spans.
 func (p *Provider) Shutdown(ctx context.Context) error {
 	if p.tp == nil {
@@ -136,3 +136,18 @@ type testError struct {
 func (e *testError) Error() string {
 	return e.msg
 }
+
+func TestNewMeterProvider(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewMeterProvider(ctx, Config{}, zap.NewNop()); err == nil {
+		t.Fatal("Expected error when projectID is missing")
+	}
+
+	provider, err := NewMeterProvider(ctx, Config{ProjectID: "test-project", TestMode: true}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create meter provider: %v", err)
+	}
+	if err := provider.Shutdown(ctx); err != nil {
+		t.Errorf("Failed to shutdown meter provider: %v", err)
+	}
+}